@@ -0,0 +1,582 @@
+package gpa
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// =====================================
+// Audit Entries
+// =====================================
+
+// AuditOperation is the kind of change recorded in an audit entry
+type AuditOperation string
+
+const (
+	AuditCreate AuditOperation = "create"
+	AuditUpdate AuditOperation = "update"
+	AuditDelete AuditOperation = "delete"
+)
+
+// FieldChange is the before and after value of a single field.
+// Before is nil for creates and After is nil for deletes.
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditEntry records who changed which entity, and how.
+// The db and gorm tags match the columns written by SQLAuditSink.
+type AuditEntry struct {
+	ID        string         `json:"id" db:"id" gorm:"primaryKey"`
+	Actor     string         `json:"actor" db:"actor"`
+	Entity    string         `json:"entity" db:"entity"`
+	EntityID  string         `json:"entity_id" db:"entity_id"`
+	Operation AuditOperation `json:"operation" db:"operation"`
+	Changes   []FieldChange  `json:"changes" db:"changes" gorm:"serializer:json"`
+	Timestamp time.Time      `json:"timestamp" db:"created_at" gorm:"column:created_at"`
+}
+
+type actorContextKey struct{}
+
+// WithActor returns a context carrying the actor recorded in audit entries.
+// Example: ctx = gpa.WithActor(ctx, "user:42")
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// ActorFromContext returns the actor stored by WithActor.
+// Falls back to the subject stored by WithSubject, formatted with fmt.Sprint.
+func ActorFromContext(ctx context.Context) (string, bool) {
+	if actor, ok := ctx.Value(actorContextKey{}).(string); ok && actor != "" {
+		return actor, true
+	}
+	if subject, ok := SubjectFromContext(ctx); ok {
+		return fmt.Sprint(subject), true
+	}
+	return "", false
+}
+
+// DiffEntities returns the fields that differ between before and after.
+// Fields are taken from info when it lists any, and from the exported struct fields otherwise.
+// Either entity may be nil, for creates and deletes.
+func DiffEntities(before, after interface{}, info *EntityInfo) []FieldChange {
+	beforeValue := indirectValue(reflect.ValueOf(before))
+	afterValue := indirectValue(reflect.ValueOf(after))
+	structType := beforeValue
+	if !structType.IsValid() {
+		structType = afterValue
+	}
+	if !structType.IsValid() || structType.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var names []string
+	if info != nil {
+		for _, field := range info.Fields {
+			names = append(names, field.Name)
+		}
+	}
+	if len(names) == 0 {
+		for _, sf := range reflect.VisibleFields(structType.Type()) {
+			if sf.IsExported() && !sf.Anonymous {
+				names = append(names, sf.Name)
+			}
+		}
+	}
+
+	var changes []FieldChange
+	for _, name := range names {
+		beforeField, beforeOK := auditFieldValue(beforeValue, name)
+		afterField, afterOK := auditFieldValue(afterValue, name)
+		if !beforeOK && !afterOK {
+			continue
+		}
+		if reflect.DeepEqual(beforeField, afterField) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: name, Before: beforeField, After: afterField})
+	}
+	return changes
+}
+
+// auditFieldValue returns the dereferenced value of a field, or nil if the entity or field is absent
+func auditFieldValue(entity reflect.Value, name string) (interface{}, bool) {
+	if !entity.IsValid() {
+		return nil, false
+	}
+	field, _, ok := lookupStructField(entity, name)
+	if !ok || !field.CanInterface() {
+		return nil, false
+	}
+	field = indirectValue(field)
+	if !field.IsValid() {
+		return nil, true
+	}
+	return field.Interface(), true
+}
+
+// newRandomID returns a random 128-bit hex identifier
+func newRandomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// =====================================
+// Audit Sinks
+// =====================================
+
+// AuditSink stores audit entries
+type AuditSink interface {
+	Record(ctx context.Context, entry AuditEntry) error
+}
+
+// Executor executes raw statements. Every Repository[T] and Transaction[T] is an Executor.
+type Executor interface {
+	RawExec(ctx context.Context, query string, args []interface{}) (Result, error)
+}
+
+// TxAuditSink is an AuditSink that can write entries inside the audited transaction,
+// so that entries are committed or rolled back together with the change. RecordTx
+// returns ErrorTypeUnsupported when it cannot write on tx, e.g. on a transaction that
+// does not run raw statements; the entry is then recorded after commit.
+type TxAuditSink interface {
+	AuditSink
+	RecordTx(ctx context.Context, tx Executor, entry AuditEntry) error
+}
+
+// repositoryAuditSink stores entries in a Repository[AuditEntry]
+type repositoryAuditSink struct {
+	repo Repository[AuditEntry]
+}
+
+// NewRepositoryAuditSink returns a sink that creates each entry in repo. Inside an
+// audited transaction the entry is inserted on the transaction instead, into the table
+// of repo with the columns of SQLAuditSink, so it commits together with the change.
+// Example: sink := gpa.NewRepositoryAuditSink(gpagorm.GetRepository[gpa.AuditEntry](provider))
+func NewRepositoryAuditSink(repo Repository[AuditEntry]) TxAuditSink {
+	return &repositoryAuditSink{repo: repo}
+}
+
+func (s *repositoryAuditSink) Record(ctx context.Context, entry AuditEntry) error {
+	return s.repo.Create(ctx, &entry)
+}
+
+func (s *repositoryAuditSink) RecordTx(ctx context.Context, tx Executor, entry AuditEntry) error {
+	sink := SQLAuditSink{}
+	if info, err := s.repo.GetEntityInfo(); err == nil && info != nil {
+		sink.Table = info.TableName
+	}
+	return sink.RecordTx(ctx, tx, entry)
+}
+
+// slogAuditSink logs entries with log/slog
+type slogAuditSink struct {
+	logger *slog.Logger
+	level  slog.Level
+}
+
+// NewSlogAuditSink returns a sink that logs each entry at info level.
+// A nil logger uses slog.Default().
+func NewSlogAuditSink(logger *slog.Logger) AuditSink {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &slogAuditSink{logger: logger, level: slog.LevelInfo}
+}
+
+func (s *slogAuditSink) Record(ctx context.Context, entry AuditEntry) error {
+	changes := make([]any, 0, len(entry.Changes))
+	for _, change := range entry.Changes {
+		changes = append(changes, slog.Group(change.Field, slog.Any("before", change.Before), slog.Any("after", change.After)))
+	}
+	s.logger.LogAttrs(ctx, s.level, "audit",
+		slog.String("audit_id", entry.ID),
+		slog.String("actor", entry.Actor),
+		slog.String("entity", entry.Entity),
+		slog.String("entity_id", entry.EntityID),
+		slog.String("operation", string(entry.Operation)),
+		slog.Time("timestamp", entry.Timestamp),
+		slog.Group("changes", changes...),
+	)
+	return nil
+}
+
+// SQLAuditSink inserts entries into a table with raw SQL. Inside an audited transaction the
+// insert runs on the transaction itself. The table needs the columns id, actor, entity,
+// entity_id, operation, changes (JSON text) and created_at.
+type SQLAuditSink struct {
+	// Executor runs inserts made outside a transaction, e.g. any repository on the same database
+	Executor Executor
+	// Table defaults to "audit_log"
+	Table string
+}
+
+// Record implements AuditSink
+func (s *SQLAuditSink) Record(ctx context.Context, entry AuditEntry) error {
+	if s.Executor == nil {
+		return NewError(ErrorTypeInvalidArgument, "SQLAuditSink requires an Executor outside transactions")
+	}
+	return s.RecordTx(ctx, s.Executor, entry)
+}
+
+// RecordTx implements TxAuditSink
+func (s *SQLAuditSink) RecordTx(ctx context.Context, tx Executor, entry AuditEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return NewErrorWithCause(ErrorTypeSerialization, "cannot encode audit changes", err)
+	}
+	table := s.Table
+	if table == "" {
+		table = "audit_log"
+	}
+	query := fmt.Sprintf("INSERT INTO %s (id, actor, entity, entity_id, operation, changes, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)", table)
+	_, err = tx.RawExec(ctx, query, []interface{}{
+		entry.ID, entry.Actor, entry.Entity, entry.EntityID, string(entry.Operation), string(changes), entry.Timestamp,
+	})
+	return err
+}
+
+// =====================================
+// Auditing Repository
+// =====================================
+
+// AuditOptions configures an auditing repository
+type AuditOptions struct {
+	// OnError is called when an entry could not be recorded after its write committed.
+	// The write is not failed, since it cannot be undone. Defaults to logging the
+	// failure with slog.Default().
+	OnError func(entry AuditEntry, err error)
+}
+
+// AuditOption configures AuditOptions
+type AuditOption func(*AuditOptions)
+
+// OnAuditError reports entries that could not be recorded after their write committed
+// Example: repo = gpa.NewAuditRepository(repo, sink, gpa.OnAuditError(func(e gpa.AuditEntry, err error) { failed.Add(1) }))
+func OnAuditError(fn func(entry AuditEntry, err error)) AuditOption {
+	return func(o *AuditOptions) { o.OnError = fn }
+}
+
+// auditRepository records an AuditEntry for every write
+type auditRepository[T any] struct {
+	repo    Repository[T]
+	sink    AuditSink
+	info    func() *EntityInfo
+	now     func() time.Time
+	onError func(entry AuditEntry, err error)
+
+	// atomic runs writes outside transactions in one, so a TxAuditSink records on it
+	atomic bool
+
+	// record stores an entry; inside transactions it writes to the transaction or buffers until commit
+	record func(ctx context.Context, entry AuditEntry) error
+}
+
+// NewAuditRepository wraps repo so that every write is recorded in sink with the actor
+// from the context. Update, UpdatePartial, Delete and DeleteByCondition load the prior
+// state to record a field-level diff. A TxAuditSink writes on the transaction of the
+// change, and writes made outside a transaction run in one of their own. Other sinks
+// receive the entries after the change has committed; failures to record those are
+// passed to AuditOptions.OnError instead of failing the write.
+// Example: repo = NewAuditRepository(repo, gpa.NewSlogAuditSink(logger))
+func NewAuditRepository[T any](repo Repository[T], sink AuditSink, opts ...AuditOption) Repository[T] {
+	options := AuditOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.OnError == nil {
+		options.OnError = func(entry AuditEntry, err error) {
+			slog.Default().Error("audit entry not recorded", slog.String("audit_id", entry.ID), slog.Any("error", err))
+		}
+	}
+	_, atomic := sink.(TxAuditSink)
+	r := &auditRepository[T]{
+		repo:    repo,
+		sink:    sink,
+		now:     time.Now,
+		onError: options.OnError,
+		atomic:  atomic,
+		info: sync.OnceValue(func() *EntityInfo {
+			info, err := repo.GetEntityInfo()
+			if err != nil {
+				return nil
+			}
+			return info
+		}),
+	}
+	r.record = func(ctx context.Context, entry AuditEntry) error {
+		r.recordCommitted(ctx, entry)
+		return nil
+	}
+	return r
+}
+
+// recordCommitted records an entry for a write that has already committed. The write
+// stands, so a failing sink is reported to onError rather than returned.
+func (r *auditRepository[T]) recordCommitted(ctx context.Context, entry AuditEntry) {
+	if err := r.sink.Record(ctx, entry); err != nil {
+		r.onError(entry, err)
+	}
+}
+
+// transactional runs write on an audited transaction when the sink can record on it,
+// so the entries commit together with the change. It reports false when the write
+// should run directly instead, including on repositories without transactions.
+func (r *auditRepository[T]) transactional(ctx context.Context, write func(tx Transaction[T]) error) (bool, error) {
+	if !r.atomic {
+		return false, nil
+	}
+	started := false
+	err := r.Transaction(ctx, func(tx Transaction[T]) error {
+		started = true
+		return write(tx)
+	})
+	if !started && IsErrorType(err, ErrorTypeUnsupported) {
+		return false, nil
+	}
+	return true, err
+}
+
+// entry builds an audit entry for entity id with the given changes
+func (r *auditRepository[T]) entry(ctx context.Context, op AuditOperation, id interface{}, changes []FieldChange) AuditEntry {
+	actor, _ := ActorFromContext(ctx)
+	entity := entityName[T]()
+	if info := r.info(); info != nil && info.Name != "" {
+		entity = info.Name
+	}
+	return AuditEntry{
+		ID:        newRandomID(),
+		Actor:     actor,
+		Entity:    entity,
+		EntityID:  fmt.Sprint(id),
+		Operation: op,
+		Changes:   changes,
+		Timestamp: r.now().UTC(),
+	}
+}
+
+// idOf returns the primary key of entity, or nil if it cannot be determined
+func (r *auditRepository[T]) idOf(entity *T) interface{} {
+	id, err := entityPrimaryKey(entity, r.info())
+	if err != nil {
+		return nil
+	}
+	return id
+}
+
+func (r *auditRepository[T]) Create(ctx context.Context, entity *T) error {
+	if ok, err := r.transactional(ctx, func(tx Transaction[T]) error { return tx.Create(ctx, entity) }); ok {
+		return err
+	}
+	if err := r.repo.Create(ctx, entity); err != nil {
+		return err
+	}
+	return r.record(ctx, r.entry(ctx, AuditCreate, r.idOf(entity), DiffEntities(nil, entity, r.info())))
+}
+
+func (r *auditRepository[T]) CreateBatch(ctx context.Context, entities []*T) error {
+	if ok, err := r.transactional(ctx, func(tx Transaction[T]) error { return tx.CreateBatch(ctx, entities) }); ok {
+		return err
+	}
+	if err := r.repo.CreateBatch(ctx, entities); err != nil {
+		return err
+	}
+	for _, entity := range entities {
+		if err := r.record(ctx, r.entry(ctx, AuditCreate, r.idOf(entity), DiffEntities(nil, entity, r.info()))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *auditRepository[T]) FindByID(ctx context.Context, id interface{}) (*T, error) {
+	return r.repo.FindByID(ctx, id)
+}
+
+func (r *auditRepository[T]) FindAll(ctx context.Context, opts ...QueryOption) ([]*T, error) {
+	return r.repo.FindAll(ctx, opts...)
+}
+
+func (r *auditRepository[T]) Update(ctx context.Context, entity *T) error {
+	if ok, err := r.transactional(ctx, func(tx Transaction[T]) error { return tx.Update(ctx, entity) }); ok {
+		return err
+	}
+	id, err := entityPrimaryKey(entity, r.info())
+	if err != nil {
+		return err
+	}
+	before, err := r.repo.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.repo.Update(ctx, entity); err != nil {
+		return err
+	}
+	return r.record(ctx, r.entry(ctx, AuditUpdate, id, DiffEntities(before, entity, r.info())))
+}
+
+func (r *auditRepository[T]) UpdatePartial(ctx context.Context, id interface{}, updates map[string]interface{}) error {
+	if ok, err := r.transactional(ctx, func(tx Transaction[T]) error { return tx.UpdatePartial(ctx, id, updates) }); ok {
+		return err
+	}
+	before, err := r.repo.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.repo.UpdatePartial(ctx, id, updates); err != nil {
+		return err
+	}
+	after := *before
+	applyUpdates(reflect.ValueOf(&after).Elem(), updates)
+	return r.record(ctx, r.entry(ctx, AuditUpdate, id, DiffEntities(before, &after, r.info())))
+}
+
+func (r *auditRepository[T]) Delete(ctx context.Context, id interface{}) error {
+	if ok, err := r.transactional(ctx, func(tx Transaction[T]) error { return tx.Delete(ctx, id) }); ok {
+		return err
+	}
+	before, err := r.repo.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	return r.record(ctx, r.entry(ctx, AuditDelete, id, DiffEntities(before, nil, r.info())))
+}
+
+// DeleteByCondition records one entry per deleted entity
+func (r *auditRepository[T]) DeleteByCondition(ctx context.Context, condition Condition) error {
+	if ok, err := r.transactional(ctx, func(tx Transaction[T]) error { return tx.DeleteByCondition(ctx, condition) }); ok {
+		return err
+	}
+	matches, err := r.repo.Query(ctx, ConditionOption{Condition: condition})
+	if err != nil {
+		return err
+	}
+	if err := r.repo.DeleteByCondition(ctx, condition); err != nil {
+		return err
+	}
+	for _, before := range matches {
+		if err := r.record(ctx, r.entry(ctx, AuditDelete, r.idOf(before), DiffEntities(before, nil, r.info()))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *auditRepository[T]) Query(ctx context.Context, opts ...QueryOption) ([]*T, error) {
+	return r.repo.Query(ctx, opts...)
+}
+
+func (r *auditRepository[T]) QueryScored(ctx context.Context, opts ...QueryOption) ([]Scored[T], error) {
+	return QueryScored(ctx, r.repo, opts...)
+}
+
+func (r *auditRepository[T]) QueryOne(ctx context.Context, opts ...QueryOption) (*T, error) {
+	return r.repo.QueryOne(ctx, opts...)
+}
+
+func (r *auditRepository[T]) Count(ctx context.Context, opts ...QueryOption) (int64, error) {
+	return r.repo.Count(ctx, opts...)
+}
+
+func (r *auditRepository[T]) Exists(ctx context.Context, opts ...QueryOption) (bool, error) {
+	return r.repo.Exists(ctx, opts...)
+}
+
+// Transaction records entries on the transaction when the sink is a TxAuditSink that
+// can write on it. Other entries are buffered and recorded once the transaction has
+// committed, reporting failures to OnError; rolling back to a savepoint drops the
+// entries buffered after it.
+func (r *auditRepository[T]) Transaction(ctx context.Context, fn TransactionFunc[T]) error {
+	var scoped *auditTransaction[T]
+	err := r.repo.Transaction(ctx, func(tx Transaction[T]) error {
+		scoped = &auditTransaction[T]{
+			auditRepository: auditRepository[T]{repo: tx, sink: r.sink, info: r.info, now: r.now},
+			tx:              tx,
+			savepoints:      make(map[string]int),
+		}
+		txSink, joins := r.sink.(TxAuditSink)
+		scoped.record = func(ctx context.Context, entry AuditEntry) error {
+			if joins {
+				if err := txSink.RecordTx(ctx, tx, entry); !IsErrorType(err, ErrorTypeUnsupported) {
+					return err
+				}
+			}
+			scoped.pending = append(scoped.pending, entry)
+			return nil
+		}
+		return fn(scoped)
+	})
+	if err != nil || scoped == nil {
+		return err
+	}
+	for _, entry := range scoped.pending {
+		r.recordCommitted(ctx, entry)
+	}
+	return nil
+}
+
+func (r *auditRepository[T]) RawQuery(ctx context.Context, query string, args []interface{}) ([]*T, error) {
+	return r.repo.RawQuery(ctx, query, args)
+}
+
+// RawExec is not audited, since its effect on entities is unknown
+func (r *auditRepository[T]) RawExec(ctx context.Context, query string, args []interface{}) (Result, error) {
+	return r.repo.RawExec(ctx, query, args)
+}
+
+func (r *auditRepository[T]) GetEntityInfo() (*EntityInfo, error) {
+	return r.repo.GetEntityInfo()
+}
+
+func (r *auditRepository[T]) Close() error {
+	return r.repo.Close()
+}
+
+// auditTransaction records entries for writes executed inside a transaction
+type auditTransaction[T any] struct {
+	auditRepository[T]
+	tx Transaction[T]
+
+	// pending holds entries to record after commit; savepoints the length of pending
+	// when each savepoint was set
+	pending    []AuditEntry
+	savepoints map[string]int
+}
+
+func (t *auditTransaction[T]) Commit() error { return t.tx.Commit() }
+
+func (t *auditTransaction[T]) Rollback() error {
+	t.pending = nil
+	return t.tx.Rollback()
+}
+
+func (t *auditTransaction[T]) SetSavepoint(name string) error {
+	if err := t.tx.SetSavepoint(name); err != nil {
+		return err
+	}
+	t.savepoints[name] = len(t.pending)
+	return nil
+}
+
+func (t *auditTransaction[T]) RollbackToSavepoint(name string) error {
+	if err := t.tx.RollbackToSavepoint(name); err != nil {
+		return err
+	}
+	if n, ok := t.savepoints[name]; ok {
+		t.pending = t.pending[:n]
+	}
+	return nil
+}
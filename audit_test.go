@@ -0,0 +1,292 @@
+package gpa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+type auditedAccount struct {
+	ID      int    `json:"id"`
+	Owner   string `json:"owner"`
+	Balance int    `json:"balance"`
+}
+
+// memoryAuditSink collects entries
+type memoryAuditSink struct {
+	entries []AuditEntry
+}
+
+func (s *memoryAuditSink) Record(ctx context.Context, entry AuditEntry) error {
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+// recordingExecutor captures raw statements
+type recordingExecutor struct {
+	queries []string
+	args    [][]interface{}
+}
+
+func (e *recordingExecutor) RawExec(ctx context.Context, query string, args []interface{}) (Result, error) {
+	e.queries = append(e.queries, query)
+	e.args = append(e.args, args)
+	return nil, nil
+}
+
+func TestDiffEntities(t *testing.T) {
+	before := &auditedAccount{ID: 1, Owner: "ada", Balance: 10}
+	after := &auditedAccount{ID: 1, Owner: "ada", Balance: 25}
+
+	changes := DiffEntities(before, after, nil)
+	if len(changes) != 1 || changes[0].Field != "Balance" || changes[0].Before != 10 || changes[0].After != 25 {
+		t.Errorf("Expected balance change, got %+v", changes)
+	}
+
+	info := &EntityInfo{Fields: []FieldInfo{{Name: "owner"}, {Name: "balance"}}}
+	created := DiffEntities(nil, after, info)
+	if len(created) != 2 || created[0].Field != "owner" || created[0].Before != nil {
+		t.Errorf("Expected fields from EntityInfo, got %+v", created)
+	}
+}
+
+func TestActorFromContext(t *testing.T) {
+	if _, ok := ActorFromContext(context.Background()); ok {
+		t.Error("Expected no actor")
+	}
+	actor, _ := ActorFromContext(WithSubject(context.Background(), "svc-billing"))
+	if actor != "svc-billing" {
+		t.Errorf("Expected subject fallback, got %q", actor)
+	}
+	actor, _ = ActorFromContext(WithActor(WithSubject(context.Background(), "x"), "user:1"))
+	if actor != "user:1" {
+		t.Errorf("Expected explicit actor, got %q", actor)
+	}
+}
+
+func TestAuditRepository_Writes(t *testing.T) {
+	mock := &mockRepository[auditedAccount]{}
+	sink := &memoryAuditSink{}
+	repo := NewAuditRepository[auditedAccount](storingRepository[auditedAccount]{mock}, sink)
+	ctx := WithActor(context.Background(), "user:7")
+
+	if err := repo.Create(ctx, &auditedAccount{ID: 1, Owner: "ada", Balance: 10}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := repo.Update(ctx, &auditedAccount{ID: 1, Owner: "ada", Balance: 30}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := repo.UpdatePartial(ctx, 1, map[string]interface{}{"owner": "grace"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := repo.Delete(ctx, 1); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(sink.entries) != 4 {
+		t.Fatalf("Expected 4 entries, got %d", len(sink.entries))
+	}
+	create, update, partial, del := sink.entries[0], sink.entries[1], sink.entries[2], sink.entries[3]
+
+	if create.Operation != AuditCreate || create.Actor != "user:7" || create.EntityID != "1" || create.Entity != "auditedAccount" {
+		t.Errorf("Unexpected create entry: %+v", create)
+	}
+	if create.ID == "" || create.Timestamp.IsZero() {
+		t.Error("Expected entry id and timestamp")
+	}
+	if len(update.Changes) != 1 || update.Changes[0].Field != "Balance" || update.Changes[0].After != 30 {
+		t.Errorf("Expected balance diff on update, got %+v", update.Changes)
+	}
+	if len(partial.Changes) != 1 || partial.Changes[0].Field != "Owner" || partial.Changes[0].After != "grace" {
+		t.Errorf("Expected owner diff on partial update, got %+v", partial.Changes)
+	}
+	if del.Operation != AuditDelete || len(del.Changes) != 3 || del.Changes[0].After != nil {
+		t.Errorf("Expected prior state on delete, got %+v", del)
+	}
+}
+
+func TestAuditRepository_FailedWriteNotAudited(t *testing.T) {
+	mock := &mockRepository[auditedAccount]{
+		items: []*auditedAccount{{ID: 1}},
+		errs:  []error{nil, NewError(ErrorTypeConstraint, "check failed")},
+	}
+	sink := &memoryAuditSink{}
+	repo := NewAuditRepository[auditedAccount](mock, sink)
+
+	if err := repo.Delete(context.Background(), 1); !IsErrorType(err, ErrorTypeConstraint) {
+		t.Fatalf("Expected delete error, got %v", err)
+	}
+	if len(sink.entries) != 0 {
+		t.Errorf("Expected no entry for failed write, got %d", len(sink.entries))
+	}
+}
+
+func TestAuditRepository_TransactionBuffersUntilCommit(t *testing.T) {
+	mock := &mockRepository[auditedAccount]{}
+	sink := &memoryAuditSink{}
+	repo := NewAuditRepository[auditedAccount](mock, sink)
+	ctx := context.Background()
+
+	err := repo.Transaction(ctx, func(tx Transaction[auditedAccount]) error {
+		if err := tx.Create(ctx, &auditedAccount{ID: 1}); err != nil {
+			return err
+		}
+		if len(sink.entries) != 0 {
+			t.Error("Expected entries to be buffered until commit")
+		}
+		return nil
+	})
+	if err != nil || len(sink.entries) != 1 {
+		t.Errorf("Expected entry after commit, got %d (%v)", len(sink.entries), err)
+	}
+
+	sink.entries = nil
+	repo.Transaction(ctx, func(tx Transaction[auditedAccount]) error {
+		tx.Create(ctx, &auditedAccount{ID: 2})
+		return NewError(ErrorTypeValidation, "abort")
+	})
+	if len(sink.entries) != 0 {
+		t.Errorf("Expected no entries after rollback, got %d", len(sink.entries))
+	}
+}
+
+func TestAuditRepository_TxSinkJoinsTransaction(t *testing.T) {
+	mock := &mockRepository[auditedAccount]{}
+	outside := &recordingExecutor{}
+	sink := &SQLAuditSink{Executor: outside}
+	repo := NewAuditRepository[auditedAccount](mock, sink)
+	ctx := context.Background()
+
+	repo.Transaction(ctx, func(tx Transaction[auditedAccount]) error {
+		return tx.Create(ctx, &auditedAccount{ID: 1, Owner: "ada"})
+	})
+	if mock.callCount("RawExec") != 1 || len(outside.queries) != 0 {
+		t.Errorf("Expected audit insert on the transaction, got %d tx / %d outside", mock.callCount("RawExec"), len(outside.queries))
+	}
+
+	if err := repo.Create(ctx, &auditedAccount{ID: 2}); err != nil || mock.callCount("Transaction") != 2 || mock.callCount("RawExec") != 2 {
+		t.Errorf("Expected a write outside transactions to run in one with its entry, got %d transactions (%v)", mock.callCount("Transaction"), err)
+	}
+
+	mock.errs = []error{NewError(ErrorTypeUnsupported, "no transactions")}
+	repo.Create(ctx, &auditedAccount{ID: 3})
+	if len(outside.queries) != 1 || !strings.HasPrefix(outside.queries[0], "INSERT INTO audit_log") {
+		t.Fatalf("Expected insert through executor without transactions, got %v", outside.queries)
+	}
+	var changes []FieldChange
+	if err := json.Unmarshal([]byte(outside.args[0][5].(string)), &changes); err != nil || len(changes) != 3 {
+		t.Errorf("Expected JSON encoded changes, got %v (%v)", outside.args[0][5], err)
+	}
+}
+
+// failingAuditSink fails every record
+type failingAuditSink struct{}
+
+func (failingAuditSink) Record(ctx context.Context, entry AuditEntry) error {
+	return NewError(ErrorTypeConnection, "sink down")
+}
+
+func TestAuditRepository_SinkFailureAfterCommit(t *testing.T) {
+	mock := &mockRepository[auditedAccount]{items: []*auditedAccount{{ID: 1}}}
+	var failed []AuditEntry
+	repo := NewAuditRepository[auditedAccount](mock, failingAuditSink{}, OnAuditError(func(entry AuditEntry, err error) {
+		failed = append(failed, entry)
+	}))
+	ctx := context.Background()
+
+	if err := repo.Create(ctx, &auditedAccount{ID: 2}); err != nil {
+		t.Errorf("Expected the committed create to succeed, got %v", err)
+	}
+	if err := repo.Delete(ctx, 1); err != nil {
+		t.Errorf("Expected the committed delete to succeed, got %v", err)
+	}
+	err := repo.Transaction(ctx, func(tx Transaction[auditedAccount]) error {
+		return tx.Update(ctx, &auditedAccount{ID: 1, Balance: 5})
+	})
+	if err != nil {
+		t.Errorf("Expected the committed transaction to succeed, got %v", err)
+	}
+	if len(failed) != 3 || failed[0].Operation != AuditCreate || failed[2].Operation != AuditUpdate {
+		t.Errorf("Expected the failed entries to be reported, got %+v", failed)
+	}
+}
+
+func TestAuditRepository_TxSinkFailureRollsBack(t *testing.T) {
+	mock := &mockRepository[auditedAccount]{}
+	repo := NewAuditRepository[auditedAccount](mock, &SQLAuditSink{})
+	mock.errs = []error{nil, nil, NewError(ErrorTypeConnection, "insert failed")}
+
+	if err := repo.Create(context.Background(), &auditedAccount{ID: 1}); !IsConnection(err) || mock.callCount("Rollback") != 1 {
+		t.Errorf("Expected a failed audit insert to roll back the write, got %v", err)
+	}
+}
+
+func TestSlogAuditSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewSlogAuditSink(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	sink.Record(context.Background(), AuditEntry{
+		ID: "a1", Actor: "user:1", Entity: "accounts", EntityID: "9", Operation: AuditUpdate,
+		Changes: []FieldChange{{Field: "balance", Before: 1, After: 2}},
+	})
+
+	var logged map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &logged); err != nil {
+		t.Fatalf("Invalid log output: %v", err)
+	}
+	if logged["msg"] != "audit" || logged["actor"] != "user:1" || logged["operation"] != "update" {
+		t.Errorf("Unexpected log record: %v", logged)
+	}
+	changes := logged["changes"].(map[string]interface{})
+	if changes["balance"].(map[string]interface{})["after"] != float64(2) {
+		t.Errorf("Expected change details in log, got %v", changes)
+	}
+}
+
+func TestRepositoryAuditSink(t *testing.T) {
+	store := &mockRepository[AuditEntry]{}
+	sink := NewRepositoryAuditSink(store)
+
+	sink.Record(context.Background(), AuditEntry{ID: "a1", Operation: AuditDelete})
+	if len(store.items) != 1 || store.items[0].ID != "a1" {
+		t.Errorf("Expected entry stored in repository, got %+v", store.items)
+	}
+}
+
+func TestRepositoryAuditSink_JoinsTransaction(t *testing.T) {
+	mock := &mockRepository[auditedAccount]{}
+	store := &mockRepository[AuditEntry]{}
+	repo := NewAuditRepository[auditedAccount](mock, NewRepositoryAuditSink(store))
+	ctx := context.Background()
+
+	repo.Transaction(ctx, func(tx Transaction[auditedAccount]) error {
+		return tx.Create(ctx, &auditedAccount{ID: 1})
+	})
+	if mock.callCount("RawExec") != 1 || len(store.items) != 0 {
+		t.Errorf("Expected the entry inserted on the transaction, got %d tx inserts and %d stored", mock.callCount("RawExec"), len(store.items))
+	}
+}
+
+func TestAuditRepository_SavepointDropsBufferedEntries(t *testing.T) {
+	store := NewMemoryRepository[AuditEntry]()
+	repo := NewAuditRepository[auditedAccount](NewMemoryRepository[auditedAccount](), NewRepositoryAuditSink(store))
+	ctx := context.Background()
+
+	err := repo.Transaction(ctx, func(tx Transaction[auditedAccount]) error {
+		tx.Create(ctx, &auditedAccount{ID: 1})
+		tx.SetSavepoint("before_second")
+		tx.Create(ctx, &auditedAccount{ID: 2})
+		return tx.RollbackToSavepoint("before_second")
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The memory transaction cannot run the insert, so entries are recorded after commit
+	entries, _ := store.FindAll(ctx)
+	if len(entries) != 1 || entries[0].EntityID != "1" {
+		t.Errorf("Expected only the entry before the savepoint, got %+v", entries)
+	}
+}
@@ -0,0 +1,660 @@
+package gpa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// =====================================
+// Circuit Breaker
+// =====================================
+
+// CircuitState represents the state of a circuit breaker
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// GuardConfig configures the circuit breaker and bulkhead protecting a provider instance
+type GuardConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens the circuit.
+	FailureThreshold int
+
+	// OpenTimeout is how long the circuit stays open before allowing probe calls.
+	OpenTimeout time.Duration
+
+	// HalfOpenMaxCalls is the number of concurrent probe calls allowed while half-open.
+	HalfOpenMaxCalls int
+
+	// MaxConcurrent limits concurrent operations on the instance. Zero means unlimited.
+	MaxConcurrent int
+
+	// MaxWait is how long a call waits for a free bulkhead slot before failing.
+	// Zero fails immediately when the bulkhead is full.
+	MaxWait time.Duration
+
+	// IsFailure decides whether an operation error counts against the circuit.
+	// Defaults to connection and timeout errors when nil, so that not-found or
+	// validation errors don't trip the breaker.
+	IsFailure func(err error) bool
+}
+
+// DefaultGuardConfig returns a configuration that opens after 5 consecutive failures,
+// probes again after 30s and does not limit concurrency.
+func DefaultGuardConfig() GuardConfig {
+	return GuardConfig{
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+		HalfOpenMaxCalls: 1,
+	}
+}
+
+// CircuitBreaker fails fast while a dependency is known to be unavailable
+type CircuitBreaker struct {
+	mutex            sync.Mutex
+	config           GuardConfig
+	state            CircuitState
+	failures         int
+	openedAt         time.Time
+	halfOpenInFlight int
+	now              func() time.Time
+
+	// generation changes on every state change, so outcomes of calls admitted under an
+	// earlier state are ignored
+	generation uint64
+}
+
+// NewCircuitBreaker creates a closed circuit breaker
+func NewCircuitBreaker(config GuardConfig) *CircuitBreaker {
+	if config.FailureThreshold < 1 {
+		config.FailureThreshold = 1
+	}
+	if config.HalfOpenMaxCalls < 1 {
+		config.HalfOpenMaxCalls = 1
+	}
+	return &CircuitBreaker{config: config, state: CircuitClosed, now: time.Now}
+}
+
+// State returns the current circuit state
+func (b *CircuitBreaker) State() CircuitState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.advance()
+	return b.state
+}
+
+// Failures returns the current number of consecutive failures
+func (b *CircuitBreaker) Failures() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.failures
+}
+
+// setState moves the circuit to state and starts a new generation.
+// Callers must hold the mutex.
+func (b *CircuitBreaker) setState(state CircuitState) {
+	b.state = state
+	b.generation++
+	b.halfOpenInFlight = 0
+	if state == CircuitOpen {
+		b.openedAt = b.now()
+	}
+}
+
+// advance moves an open circuit to half-open once the open timeout elapsed.
+// Callers must hold the mutex.
+func (b *CircuitBreaker) advance() {
+	if b.state == CircuitOpen && b.now().Sub(b.openedAt) >= b.config.OpenTimeout {
+		b.setState(CircuitHalfOpen)
+	}
+}
+
+// Allow reports whether a call may proceed and returns the generation it is admitted
+// under. Returns an ErrorTypeConnection GPAError while the circuit is open or while all
+// half-open probe slots are taken. Every allowed call must be followed by exactly one
+// call to Record with the returned generation.
+func (b *CircuitBreaker) Allow() (uint64, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.advance()
+
+	switch b.state {
+	case CircuitOpen:
+		return 0, NewErrorWithCode(ErrorTypeConnection, "circuit breaker is open", string(CircuitOpen))
+	case CircuitHalfOpen:
+		if b.halfOpenInFlight >= b.config.HalfOpenMaxCalls {
+			return 0, NewErrorWithCode(ErrorTypeConnection, "circuit breaker is half-open and probing", string(CircuitHalfOpen))
+		}
+		b.halfOpenInFlight++
+	}
+	return b.generation, nil
+}
+
+// callOutcome is how a call admitted by the breaker ended
+type callOutcome int
+
+const (
+	callSucceeded callOutcome = iota
+	callFailed
+	// callAbandoned says nothing about the dependency's health, e.g. a cancelled call
+	callAbandoned
+)
+
+// Record reports the outcome of a call allowed under generation. Outcomes of calls
+// admitted before the circuit last changed state are ignored, so a slow call that
+// started before the circuit opened cannot close it. Calls cancelled through their
+// context count neither as success nor as failure.
+func (b *CircuitBreaker) Record(generation uint64, err error) {
+	outcome := callSucceeded
+	switch {
+	case err == nil:
+	case errors.Is(err, context.Canceled):
+		outcome = callAbandoned
+	case b.isFailure(err):
+		outcome = callFailed
+	}
+	b.finish(generation, outcome)
+}
+
+func (b *CircuitBreaker) isFailure(err error) bool {
+	if b.config.IsFailure != nil {
+		return b.config.IsFailure(err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	return IsConnection(err) || IsErrorType(err, ErrorTypeTimeout)
+}
+
+// finish applies the outcome of a call admitted under generation
+func (b *CircuitBreaker) finish(generation uint64, outcome callOutcome) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.advance()
+	if generation != b.generation {
+		return
+	}
+
+	switch b.state {
+	case CircuitHalfOpen:
+		b.halfOpenInFlight--
+		switch outcome {
+		case callSucceeded:
+			b.failures = 0
+			b.setState(CircuitClosed)
+		case callFailed:
+			b.failures++
+			b.setState(CircuitOpen)
+		}
+	case CircuitClosed:
+		switch outcome {
+		case callSucceeded:
+			b.failures = 0
+		case callFailed:
+			b.failures++
+			if b.failures >= b.config.FailureThreshold {
+				b.setState(CircuitOpen)
+			}
+		}
+	}
+}
+
+// Reset forces the circuit back to closed
+func (b *CircuitBreaker) Reset() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.failures = 0
+	b.setState(CircuitClosed)
+}
+
+// =====================================
+// Bulkhead
+// =====================================
+
+// Bulkhead limits the number of concurrent operations against a provider instance
+type Bulkhead struct {
+	slots   chan struct{}
+	maxWait time.Duration
+}
+
+// NewBulkhead creates a bulkhead with maxConcurrent slots.
+// A bulkhead with zero slots never blocks.
+func NewBulkhead(maxConcurrent int, maxWait time.Duration) *Bulkhead {
+	b := &Bulkhead{maxWait: maxWait}
+	if maxConcurrent > 0 {
+		b.slots = make(chan struct{}, maxConcurrent)
+	}
+	return b
+}
+
+// Acquire takes a slot, waiting up to the configured MaxWait or until ctx is done.
+// Returns a release function that must be called when the operation finishes.
+// Returns an ErrorTypeTimeout GPAError when no slot became free in time.
+func (b *Bulkhead) Acquire(ctx context.Context) (func(), error) {
+	if b.slots == nil {
+		return func() {}, nil
+	}
+
+	release := func() { <-b.slots }
+	select {
+	case b.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	if b.maxWait <= 0 {
+		return nil, NewError(ErrorTypeTimeout, "bulkhead is full")
+	}
+
+	timer := time.NewTimer(b.maxWait)
+	defer timer.Stop()
+	select {
+	case b.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, NewError(ErrorTypeTimeout, "timed out waiting for bulkhead slot")
+	case <-ctx.Done():
+		return nil, NewErrorWithCause(ErrorTypeTimeout, "cancelled waiting for bulkhead slot", ctx.Err())
+	}
+}
+
+// InUse returns the number of occupied slots
+func (b *Bulkhead) InUse() int {
+	return len(b.slots)
+}
+
+// Capacity returns the number of slots, or zero when unlimited
+func (b *Bulkhead) Capacity() int {
+	return cap(b.slots)
+}
+
+// =====================================
+// Provider Guard
+// =====================================
+
+// GuardStats is a snapshot of a provider guard's state
+type GuardStats struct {
+	State         CircuitState
+	Failures      int
+	InFlight      int
+	MaxConcurrent int
+}
+
+// ProviderGuard combines a circuit breaker and a bulkhead for one provider instance
+type ProviderGuard struct {
+	breaker  *CircuitBreaker
+	bulkhead *Bulkhead
+}
+
+// NewProviderGuard creates a guard from config
+func NewProviderGuard(config GuardConfig) *ProviderGuard {
+	return &ProviderGuard{
+		breaker:  NewCircuitBreaker(config),
+		bulkhead: NewBulkhead(config.MaxConcurrent, config.MaxWait),
+	}
+}
+
+// Breaker returns the guard's circuit breaker
+func (g *ProviderGuard) Breaker() *CircuitBreaker {
+	return g.breaker
+}
+
+// Bulkhead returns the guard's bulkhead
+func (g *ProviderGuard) Bulkhead() *Bulkhead {
+	return g.bulkhead
+}
+
+// Do runs fn if the circuit allows it and a bulkhead slot is available,
+// then feeds the outcome back into the circuit breaker.
+func (g *ProviderGuard) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	generation, err := g.breaker.Allow()
+	if err != nil {
+		return err
+	}
+	release, err := g.bulkhead.Acquire(ctx)
+	if err != nil {
+		// Rejected by the bulkhead, not by the provider: the outcome says nothing about its health
+		g.breaker.finish(generation, callAbandoned)
+		return err
+	}
+	defer release()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			// Count the panic as a failure so a half-open probe does not hold its slot
+			g.breaker.finish(generation, callFailed)
+			panic(recovered)
+		}
+	}()
+
+	err = fn(ctx)
+	g.breaker.Record(generation, err)
+	return err
+}
+
+// CheckHealth calls provider.Health through the circuit breaker.
+// While the circuit is open it returns immediately without contacting the provider.
+// Any health error counts as a failure.
+func (g *ProviderGuard) CheckHealth(provider Provider) error {
+	generation, err := g.breaker.Allow()
+	if err != nil {
+		return err
+	}
+	outcome := callSucceeded
+	if err = provider.Health(); err != nil {
+		outcome = callFailed
+	}
+	g.breaker.finish(generation, outcome)
+	if err != nil {
+		return NewErrorWithCause(ErrorTypeConnection, "health check failed", err)
+	}
+	return nil
+}
+
+// Stats returns a snapshot of the guard's state
+func (g *ProviderGuard) Stats() GuardStats {
+	return GuardStats{
+		State:         g.breaker.State(),
+		Failures:      g.breaker.Failures(),
+		InFlight:      g.bulkhead.InUse(),
+		MaxConcurrent: g.bulkhead.Capacity(),
+	}
+}
+
+// =====================================
+// Registry Integration
+// =====================================
+
+// Protect attaches a circuit breaker and bulkhead to a registered provider instance.
+// Once protected, HealthCheck reports the instance through the guard, failing fast
+// while the circuit is open, and Get returns the instance wrapped in the guard: see
+// GuardProvider. Use NewGuardedRepository to route repository calls through the same
+// guard.
+// Example: guard, err := Registry().Protect("mongo", "primary", DefaultGuardConfig())
+func (r *ProviderRegistry) Protect(providerType, instanceName string, config GuardConfig) (*ProviderGuard, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.providers[providerType][instanceName]; !exists {
+		return nil, fmt.Errorf("%w: instance '%s' of type '%s' not found", ErrProviderNotFound, instanceName, providerType)
+	}
+
+	if r.guards == nil {
+		r.guards = make(map[string]map[string]*ProviderGuard)
+	}
+	if r.guards[providerType] == nil {
+		r.guards[providerType] = make(map[string]*ProviderGuard)
+	}
+	guard := NewProviderGuard(config)
+	r.guards[providerType][instanceName] = guard
+	return guard, nil
+}
+
+// Guard returns the guard attached to a provider instance, if any
+func (r *ProviderRegistry) Guard(providerType, instanceName string) (*ProviderGuard, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	guard, exists := r.guards[providerType][instanceName]
+	return guard, exists
+}
+
+// GuardStats returns the state of every guarded provider instance
+func (r *ProviderRegistry) GuardStats() map[string]map[string]GuardStats {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	results := make(map[string]map[string]GuardStats)
+	for providerType, typeGuards := range r.guards {
+		results[providerType] = make(map[string]GuardStats)
+		for instanceName, guard := range typeGuards {
+			results[providerType][instanceName] = guard.Stats()
+		}
+	}
+	return results
+}
+
+// =====================================
+// Guarded Providers
+// =====================================
+
+// GuardProvider wraps provider so its calls pass through guard. Key-value providers
+// have their key operations guarded; every provider has Health checked through the
+// circuit breaker. Other methods are delegated unchanged, and UnwrapProvider returns
+// the wrapped provider.
+// Example: kv := gpa.GuardProvider(redis, guard).(gpa.KeyValueProvider)
+func GuardProvider(provider Provider, guard *ProviderGuard) Provider {
+	if kv, ok := provider.(KeyValueProvider); ok {
+		return NewGuardedKeyValueProvider(kv, guard)
+	}
+	return &guardedProvider{Provider: provider, guard: guard}
+}
+
+// UnwrapProvider returns the provider wrapped by GuardProvider, or provider itself
+func UnwrapProvider(provider Provider) Provider {
+	if wrapper, ok := provider.(interface{ Unwrap() Provider }); ok {
+		return wrapper.Unwrap()
+	}
+	return provider
+}
+
+// guardedProvider checks the health of a provider through a guard
+type guardedProvider struct {
+	Provider
+	guard *ProviderGuard
+}
+
+func (p *guardedProvider) Health() error    { return p.guard.CheckHealth(p.Provider) }
+func (p *guardedProvider) Unwrap() Provider { return p.Provider }
+
+// guardedKeyValueProvider routes key operations through a guard
+type guardedKeyValueProvider struct {
+	KeyValueProvider
+	guard *ProviderGuard
+}
+
+// NewGuardedKeyValueProvider wraps provider so Get, Set, Delete, Exists, Keys, Expire
+// and TTL pass through guard's circuit breaker and bulkhead.
+// All other methods are delegated unchanged.
+func NewGuardedKeyValueProvider(provider KeyValueProvider, guard *ProviderGuard) KeyValueProvider {
+	return &guardedKeyValueProvider{KeyValueProvider: provider, guard: guard}
+}
+
+func (p *guardedKeyValueProvider) Health() error    { return p.guard.CheckHealth(p.KeyValueProvider) }
+func (p *guardedKeyValueProvider) Unwrap() Provider { return p.KeyValueProvider }
+
+func (p *guardedKeyValueProvider) Get(ctx context.Context, key string) (value interface{}, err error) {
+	err = p.guard.Do(ctx, func(ctx context.Context) error {
+		value, err = p.KeyValueProvider.Get(ctx, key)
+		return err
+	})
+	return value, err
+}
+
+func (p *guardedKeyValueProvider) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return p.guard.Do(ctx, func(ctx context.Context) error {
+		return p.KeyValueProvider.Set(ctx, key, value, ttl)
+	})
+}
+
+func (p *guardedKeyValueProvider) Delete(ctx context.Context, key string) error {
+	return p.guard.Do(ctx, func(ctx context.Context) error {
+		return p.KeyValueProvider.Delete(ctx, key)
+	})
+}
+
+func (p *guardedKeyValueProvider) Exists(ctx context.Context, key string) (exists bool, err error) {
+	err = p.guard.Do(ctx, func(ctx context.Context) error {
+		exists, err = p.KeyValueProvider.Exists(ctx, key)
+		return err
+	})
+	return exists, err
+}
+
+func (p *guardedKeyValueProvider) Keys(ctx context.Context, pattern string) (keys []string, err error) {
+	err = p.guard.Do(ctx, func(ctx context.Context) error {
+		keys, err = p.KeyValueProvider.Keys(ctx, pattern)
+		return err
+	})
+	return keys, err
+}
+
+func (p *guardedKeyValueProvider) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return p.guard.Do(ctx, func(ctx context.Context) error {
+		return p.KeyValueProvider.Expire(ctx, key, ttl)
+	})
+}
+
+func (p *guardedKeyValueProvider) TTL(ctx context.Context, key string) (ttl time.Duration, err error) {
+	err = p.guard.Do(ctx, func(ctx context.Context) error {
+		ttl, err = p.KeyValueProvider.TTL(ctx, key)
+		return err
+	})
+	return ttl, err
+}
+
+// =====================================
+// Guarded Repository
+// =====================================
+
+// guardedRepository routes every repository call through a ProviderGuard
+type guardedRepository[T any] struct {
+	repo  Repository[T]
+	guard *ProviderGuard
+}
+
+// NewGuardedRepository wraps repo so every call passes through guard's circuit breaker
+// and bulkhead. Operation errors feed the breaker; calls fail fast with
+// ErrorTypeConnection while the circuit is open.
+// Example: repo = NewGuardedRepository(repo, guard)
+func NewGuardedRepository[T any](repo Repository[T], guard *ProviderGuard) Repository[T] {
+	return &guardedRepository[T]{repo: repo, guard: guard}
+}
+
+func (r *guardedRepository[T]) Create(ctx context.Context, entity *T) error {
+	return r.guard.Do(ctx, func(ctx context.Context) error {
+		return r.repo.Create(ctx, entity)
+	})
+}
+
+func (r *guardedRepository[T]) CreateBatch(ctx context.Context, entities []*T) error {
+	return r.guard.Do(ctx, func(ctx context.Context) error {
+		return r.repo.CreateBatch(ctx, entities)
+	})
+}
+
+func (r *guardedRepository[T]) FindByID(ctx context.Context, id interface{}) (result *T, err error) {
+	err = r.guard.Do(ctx, func(ctx context.Context) error {
+		result, err = r.repo.FindByID(ctx, id)
+		return err
+	})
+	return result, err
+}
+
+func (r *guardedRepository[T]) FindAll(ctx context.Context, opts ...QueryOption) (result []*T, err error) {
+	err = r.guard.Do(ctx, func(ctx context.Context) error {
+		result, err = r.repo.FindAll(ctx, opts...)
+		return err
+	})
+	return result, err
+}
+
+func (r *guardedRepository[T]) Update(ctx context.Context, entity *T) error {
+	return r.guard.Do(ctx, func(ctx context.Context) error {
+		return r.repo.Update(ctx, entity)
+	})
+}
+
+func (r *guardedRepository[T]) UpdatePartial(ctx context.Context, id interface{}, updates map[string]interface{}) error {
+	return r.guard.Do(ctx, func(ctx context.Context) error {
+		return r.repo.UpdatePartial(ctx, id, updates)
+	})
+}
+
+func (r *guardedRepository[T]) Delete(ctx context.Context, id interface{}) error {
+	return r.guard.Do(ctx, func(ctx context.Context) error {
+		return r.repo.Delete(ctx, id)
+	})
+}
+
+func (r *guardedRepository[T]) DeleteByCondition(ctx context.Context, condition Condition) error {
+	return r.guard.Do(ctx, func(ctx context.Context) error {
+		return r.repo.DeleteByCondition(ctx, condition)
+	})
+}
+
+func (r *guardedRepository[T]) Query(ctx context.Context, opts ...QueryOption) (result []*T, err error) {
+	err = r.guard.Do(ctx, func(ctx context.Context) error {
+		result, err = r.repo.Query(ctx, opts...)
+		return err
+	})
+	return result, err
+}
+
+func (r *guardedRepository[T]) QueryScored(ctx context.Context, opts ...QueryOption) (result []Scored[T], err error) {
+	err = r.guard.Do(ctx, func(ctx context.Context) error {
+		result, err = QueryScored(ctx, r.repo, opts...)
+		return err
+	})
+	return result, err
+}
+
+func (r *guardedRepository[T]) QueryOne(ctx context.Context, opts ...QueryOption) (result *T, err error) {
+	err = r.guard.Do(ctx, func(ctx context.Context) error {
+		result, err = r.repo.QueryOne(ctx, opts...)
+		return err
+	})
+	return result, err
+}
+
+func (r *guardedRepository[T]) Count(ctx context.Context, opts ...QueryOption) (count int64, err error) {
+	err = r.guard.Do(ctx, func(ctx context.Context) error {
+		count, err = r.repo.Count(ctx, opts...)
+		return err
+	})
+	return count, err
+}
+
+func (r *guardedRepository[T]) Exists(ctx context.Context, opts ...QueryOption) (exists bool, err error) {
+	err = r.guard.Do(ctx, func(ctx context.Context) error {
+		exists, err = r.repo.Exists(ctx, opts...)
+		return err
+	})
+	return exists, err
+}
+
+// Transaction occupies a single bulkhead slot for the whole transaction.
+// Calls made through tx are not guarded individually.
+func (r *guardedRepository[T]) Transaction(ctx context.Context, fn TransactionFunc[T]) error {
+	return r.guard.Do(ctx, func(ctx context.Context) error {
+		return r.repo.Transaction(ctx, fn)
+	})
+}
+
+func (r *guardedRepository[T]) RawQuery(ctx context.Context, query string, args []interface{}) (result []*T, err error) {
+	err = r.guard.Do(ctx, func(ctx context.Context) error {
+		result, err = r.repo.RawQuery(ctx, query, args)
+		return err
+	})
+	return result, err
+}
+
+func (r *guardedRepository[T]) RawExec(ctx context.Context, query string, args []interface{}) (result Result, err error) {
+	err = r.guard.Do(ctx, func(ctx context.Context) error {
+		result, err = r.repo.RawExec(ctx, query, args)
+		return err
+	})
+	return result, err
+}
+
+func (r *guardedRepository[T]) GetEntityInfo() (*EntityInfo, error) {
+	return r.repo.GetEntityInfo()
+}
+
+func (r *guardedRepository[T]) Close() error {
+	return r.repo.Close()
+}
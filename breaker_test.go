@@ -0,0 +1,288 @@
+package gpa
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker_OpensAfterThreshold(t *testing.T) {
+	breaker := NewCircuitBreaker(GuardConfig{FailureThreshold: 2, OpenTimeout: time.Minute})
+	failure := NewError(ErrorTypeConnection, "refused")
+
+	for i := 0; i < 2; i++ {
+		generation, err := breaker.Allow()
+		if err != nil {
+			t.Fatalf("Unexpected rejection on attempt %d: %v", i+1, err)
+		}
+		breaker.Record(generation, failure)
+	}
+
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("Expected circuit to be open, got %s", breaker.State())
+	}
+	_, err := breaker.Allow()
+	if !IsConnection(err) {
+		t.Errorf("Expected connection error while open, got %v", err)
+	}
+}
+
+func TestCircuitBreaker_IgnoresNonConnectionErrors(t *testing.T) {
+	breaker := NewCircuitBreaker(GuardConfig{FailureThreshold: 1, OpenTimeout: time.Minute})
+
+	generation, _ := breaker.Allow()
+	breaker.Record(generation, NewError(ErrorTypeNotFound, "missing"))
+
+	if breaker.State() != CircuitClosed {
+		t.Errorf("Expected not-found errors to keep the circuit closed, got %s", breaker.State())
+	}
+}
+
+func TestCircuitBreaker_HalfOpenProbe(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(GuardConfig{FailureThreshold: 1, OpenTimeout: time.Second})
+	breaker.now = func() time.Time { return now }
+
+	generation, _ := breaker.Allow()
+	breaker.Record(generation, NewError(ErrorTypeTimeout, "slow"))
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("Expected open circuit, got %s", breaker.State())
+	}
+
+	now = now.Add(2 * time.Second)
+	if breaker.State() != CircuitHalfOpen {
+		t.Fatalf("Expected half-open circuit, got %s", breaker.State())
+	}
+	probe, err := breaker.Allow()
+	if err != nil {
+		t.Fatalf("Expected probe to be allowed: %v", err)
+	}
+	if _, err := breaker.Allow(); err == nil {
+		t.Error("Expected second concurrent probe to be rejected")
+	}
+
+	breaker.Record(probe, nil)
+	if breaker.State() != CircuitClosed {
+		t.Errorf("Expected successful probe to close circuit, got %s", breaker.State())
+	}
+}
+
+func TestCircuitBreaker_FailedProbeReopens(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(GuardConfig{FailureThreshold: 3, OpenTimeout: time.Second})
+	breaker.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		generation, _ := breaker.Allow()
+		breaker.Record(generation, NewError(ErrorTypeConnection, "refused"))
+	}
+	now = now.Add(2 * time.Second)
+
+	probe, _ := breaker.Allow()
+	breaker.Record(probe, NewError(ErrorTypeConnection, "refused"))
+	if breaker.State() != CircuitOpen {
+		t.Errorf("Expected failed probe to reopen circuit, got %s", breaker.State())
+	}
+}
+
+func TestCircuitBreaker_IgnoresEarlierGenerations(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(GuardConfig{FailureThreshold: 1, OpenTimeout: time.Second})
+	breaker.now = func() time.Time { return now }
+
+	slow, _ := breaker.Allow()
+	failing, _ := breaker.Allow()
+	breaker.Record(failing, NewError(ErrorTypeConnection, "refused"))
+	breaker.Record(slow, nil)
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("Expected a call admitted before the trip not to close the circuit, got %s", breaker.State())
+	}
+
+	now = now.Add(2 * time.Second)
+	probe, err := breaker.Allow()
+	if err != nil {
+		t.Fatalf("Expected probe to be allowed: %v", err)
+	}
+	breaker.Record(slow, nil)
+	if _, err := breaker.Allow(); err == nil {
+		t.Error("Expected a stale result not to free the probe slot")
+	}
+
+	breaker.Record(probe, context.Canceled)
+	if breaker.State() != CircuitHalfOpen {
+		t.Errorf("Expected a cancelled probe to keep the circuit half-open, got %s", breaker.State())
+	}
+	probe, err = breaker.Allow()
+	if err != nil {
+		t.Fatalf("Expected the cancelled probe to free its slot: %v", err)
+	}
+	breaker.Record(probe, nil)
+	if breaker.State() != CircuitClosed {
+		t.Errorf("Expected a successful probe to close the circuit, got %s", breaker.State())
+	}
+}
+
+func TestBulkhead(t *testing.T) {
+	bulkhead := NewBulkhead(1, 0)
+
+	release, err := bulkhead.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if bulkhead.InUse() != 1 {
+		t.Errorf("Expected 1 slot in use, got %d", bulkhead.InUse())
+	}
+
+	if _, err := bulkhead.Acquire(context.Background()); !IsErrorType(err, ErrorTypeTimeout) {
+		t.Errorf("Expected timeout error when full, got %v", err)
+	}
+
+	release()
+	if _, err := bulkhead.Acquire(context.Background()); err != nil {
+		t.Errorf("Expected slot after release, got %v", err)
+	}
+}
+
+func TestBulkhead_WaitsForSlot(t *testing.T) {
+	bulkhead := NewBulkhead(1, time.Second)
+	release, _ := bulkhead.Acquire(context.Background())
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+	}()
+
+	if _, err := bulkhead.Acquire(context.Background()); err != nil {
+		t.Errorf("Expected to acquire slot after waiting, got %v", err)
+	}
+}
+
+func TestBulkhead_Unlimited(t *testing.T) {
+	bulkhead := NewBulkhead(0, 0)
+	for i := 0; i < 10; i++ {
+		if _, err := bulkhead.Acquire(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if bulkhead.Capacity() != 0 {
+		t.Errorf("Expected unlimited capacity, got %d", bulkhead.Capacity())
+	}
+}
+
+func TestProviderRegistry_ProtectHealthCheck(t *testing.T) {
+	registry := &ProviderRegistry{
+		providers: make(map[string]map[string]Provider),
+	}
+	provider := newMockProvider("mongo")
+	provider.healthError = errors.New("replica set unavailable")
+	registry.Register("primary", provider)
+
+	if _, err := registry.Protect("mongo", "missing", DefaultGuardConfig()); err == nil {
+		t.Error("Expected error protecting unknown instance")
+	}
+
+	guard, err := registry.Protect("mongo", "primary", GuardConfig{FailureThreshold: 1, OpenTimeout: time.Minute})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	results := registry.HealthCheck()
+	if !IsConnection(results["mongo"]["primary"]) {
+		t.Errorf("Expected connection error, got %v", results["mongo"]["primary"])
+	}
+	if guard.Stats().State != CircuitOpen {
+		t.Fatalf("Expected circuit to open after failed health check, got %s", guard.Stats().State)
+	}
+
+	provider.healthError = nil
+	results = registry.HealthCheck()
+	if !IsConnection(results["mongo"]["primary"]) {
+		t.Errorf("Expected open circuit to fail fast, got %v", results["mongo"]["primary"])
+	}
+
+	stats := registry.GuardStats()
+	if stats["mongo"]["primary"].State != CircuitOpen {
+		t.Errorf("Expected guard stats to report open circuit, got %+v", stats)
+	}
+
+	if err := registry.Remove("mongo", "primary"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, exists := registry.Guard("mongo", "primary"); exists {
+		t.Error("Expected guard to be removed with its provider")
+	}
+}
+
+func TestProviderGuard_PanicRecordsFailure(t *testing.T) {
+	guard := NewProviderGuard(GuardConfig{FailureThreshold: 1, OpenTimeout: time.Minute, MaxConcurrent: 1})
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected the panic to propagate")
+			}
+		}()
+		guard.Do(context.Background(), func(ctx context.Context) error { panic("driver bug") })
+	}()
+	if stats := guard.Stats(); stats.State != CircuitOpen || stats.InFlight != 0 {
+		t.Errorf("Expected the panic to count as a failure and release its slot, got %+v", stats)
+	}
+}
+
+func TestProviderRegistry_GetGuarded(t *testing.T) {
+	registry := &ProviderRegistry{
+		providers: make(map[string]map[string]Provider),
+	}
+	kv := &tracingKVProvider{mockProvider: newMockProvider("redis"), values: map[string]interface{}{"a": 1}}
+	plain := newMockProvider("mongo")
+	registry.Register("cache", kv)
+	registry.Register("primary", plain)
+
+	guard, _ := registry.Protect("redis", "cache", GuardConfig{FailureThreshold: 1, OpenTimeout: time.Minute})
+	registry.Protect("mongo", "primary", GuardConfig{FailureThreshold: 1, OpenTimeout: time.Minute})
+
+	provider, _ := registry.Get("redis", "cache")
+	guarded, ok := provider.(KeyValueProvider)
+	if !ok || UnwrapProvider(provider) != kv {
+		t.Fatalf("Expected a guarded key-value provider, got %T", provider)
+	}
+	ctx := context.Background()
+	if value, err := guarded.Get(ctx, "a"); err != nil || value != 1 {
+		t.Errorf("Expected the value through the guard, got %v (%v)", value, err)
+	}
+	guard.Do(ctx, func(ctx context.Context) error { return NewError(ErrorTypeConnection, "reset") })
+	if _, err := guarded.Get(ctx, "a"); !IsConnection(err) {
+		t.Errorf("Expected the open circuit to fail fast, got %v", err)
+	}
+
+	providers, _ := registry.GetByType("mongo")
+	plain.healthError = errors.New("down")
+	providers["primary"].Health()
+	if stats, _ := registry.Guard("mongo", "primary"); stats.Stats().State != CircuitOpen {
+		t.Error("Expected health checks through the guard")
+	}
+	if UnwrapProvider(providers["primary"]) != plain {
+		t.Error("Expected the wrapped provider")
+	}
+}
+
+func TestGuardedRepository(t *testing.T) {
+	guard := NewProviderGuard(GuardConfig{FailureThreshold: 2, OpenTimeout: time.Minute})
+	mock := &mockRepository[tracedEntity]{
+		errs: []error{NewError(ErrorTypeConnection, "refused"), NewError(ErrorTypeConnection, "refused")},
+	}
+	repo := NewGuardedRepository[tracedEntity](mock, guard)
+	ctx := context.Background()
+
+	repo.Create(ctx, &tracedEntity{ID: 1})
+	repo.Create(ctx, &tracedEntity{ID: 2})
+
+	err := repo.Create(ctx, &tracedEntity{ID: 3})
+	if !IsConnection(err) {
+		t.Errorf("Expected fail-fast connection error, got %v", err)
+	}
+	if mock.callCount("Create") != 2 {
+		t.Errorf("Expected the open circuit to skip the provider, got %d calls", mock.callCount("Create"))
+	}
+}
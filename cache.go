@@ -0,0 +1,358 @@
+package gpa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// =====================================
+// Cache Options
+// =====================================
+
+// cacheTagPrefix is prepended to the keys holding tag versions
+const cacheTagPrefix = "cache:tag:"
+
+// CacheOptions configures Remember
+type CacheOptions struct {
+	// Tags group cached values so InvalidateTags can drop them together
+	Tags []string
+
+	// StaleFor keeps values this long past their TTL. An expired value is reloaded, but
+	// served while the loader fails, so an outage of the source does not empty the cache.
+	StaleFor time.Duration
+
+	// Beta tunes probabilistic early expiration (XFetch): values are reloaded early with
+	// a probability that grows as the TTL ends and with how long the loader took, so
+	// concurrent processes do not all miss at once. Defaults to 1; larger values reload
+	// earlier and negative values disable early reloads.
+	Beta float64
+
+	// Codec and Compressor encode cached values. Codec defaults to JSONCodec.
+	Codec      Codec
+	Compressor Compressor
+
+	// LoadTimeout bounds a loader call. The call is shared by every caller missing the
+	// key, so it is not canceled when the caller that started it gives up. Defaults to
+	// 30 seconds; zero or less leaves loads unbounded.
+	LoadTimeout time.Duration
+
+	now    func() time.Time
+	random func() float64
+}
+
+// CacheOption configures CacheOptions
+type CacheOption func(*CacheOptions)
+
+// CacheTags groups a cached value under tags
+// Example: gpa.Remember(ctx, kv, "user:1", time.Minute, load, gpa.CacheTags("users"))
+func CacheTags(tags ...string) CacheOption {
+	return func(o *CacheOptions) { o.Tags = append(o.Tags, tags...) }
+}
+
+// StaleFor serves a value for up to window past its TTL when reloading it fails
+// Example: gpa.Remember(ctx, kv, "rates", time.Minute, load, gpa.StaleFor(time.Hour))
+func StaleFor(window time.Duration) CacheOption {
+	return func(o *CacheOptions) { o.StaleFor = window }
+}
+
+// EarlyExpiration sets the XFetch beta; see CacheOptions.Beta
+// Example: gpa.Remember(ctx, kv, "report", time.Hour, load, gpa.EarlyExpiration(2))
+func EarlyExpiration(beta float64) CacheOption {
+	return func(o *CacheOptions) { o.Beta = beta }
+}
+
+// CacheCodec encodes cached values with codec and an optional compressor
+// Example: gpa.Remember(ctx, kv, "user:1", time.Minute, load, gpa.CacheCodec(gpa.GobCodec{}, nil))
+func CacheCodec(codec Codec, compressor Compressor) CacheOption {
+	return func(o *CacheOptions) { o.Codec, o.Compressor = codec, compressor }
+}
+
+// LoadTimeout bounds loader calls; see CacheOptions.LoadTimeout
+// Example: gpa.Remember(ctx, kv, "report", time.Hour, load, gpa.LoadTimeout(time.Minute))
+func LoadTimeout(timeout time.Duration) CacheOption {
+	return func(o *CacheOptions) { o.LoadTimeout = timeout }
+}
+
+func newCacheOptions(opts []CacheOption) CacheOptions {
+	options := CacheOptions{Beta: 1, LoadTimeout: 30 * time.Second}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.Codec == nil {
+		options.Codec = JSONCodec{}
+	}
+	if options.now == nil {
+		options.now = time.Now
+	}
+	if options.random == nil {
+		options.random = rand.Float64
+	}
+	return options
+}
+
+// =====================================
+// Cache-Aside
+// =====================================
+
+// cacheEntry is what Remember stores: the encoded value with the metadata needed for
+// early expiration, stale serving and tag invalidation
+type cacheEntry struct {
+	Value   []byte            `json:"v"`
+	Expires int64             `json:"e,omitempty"` // logical expiry in unix nanoseconds, 0 for never
+	Delta   int64             `json:"d,omitempty"` // how long the loader took, in nanoseconds
+	Tags    map[string]string `json:"t,omitempty"` // tag versions when the value was loaded
+}
+
+// Remember returns the value cached under key, or calls loader and caches its result
+// for ttl. Concurrent misses of the same key in this process share one loader call, and
+// the returned value is shared with them. The loader keeps the values of ctx but not its
+// cancellation, so a caller giving up does not fail the others (see LoadTimeout).
+// Values are reloaded shortly before their TTL ends (see CacheOptions.Beta), may be
+// served stale when the loader fails (StaleFor), and are dropped by InvalidateTags.
+// A ttl of 0 caches until invalidated.
+// Example:
+//
+//	user, err := gpa.Remember(ctx, kv, "user:1", 5*time.Minute, func(ctx context.Context) (*User, error) {
+//	    return repo.FindByID(ctx, 1)
+//	}, gpa.CacheTags("users"), gpa.StaleFor(time.Hour))
+func Remember[T any](ctx context.Context, kv KeyValueProvider, key string, ttl time.Duration, loader func(ctx context.Context) (*T, error), opts ...CacheOption) (*T, error) {
+	options := newCacheOptions(opts)
+	entry, cached, err := readCache[T](ctx, kv, key, options)
+	if err != nil {
+		return nil, err
+	}
+	if cached == nil {
+		return loadCache(ctx, kv, key, ttl, loader, options)
+	}
+	if entry.Expires == 0 {
+		return cached, nil
+	}
+
+	now := options.now().UnixNano()
+	if now < entry.Expires {
+		// XFetch: reload early once now - delta*beta*ln(rand) reaches the expiry
+		early := options.Beta >= 0 && float64(now)-float64(entry.Delta)*options.Beta*math.Log(1-options.random()) >= float64(entry.Expires)
+		if !early {
+			return cached, nil
+		}
+	} else if now >= entry.Expires+int64(options.StaleFor) {
+		return loadCache(ctx, kv, key, ttl, loader, options)
+	}
+
+	// Reloading early or stale: keep serving the cached value if the loader fails
+	if fresh, err := loadCache(ctx, kv, key, ttl, loader, options); err == nil {
+		return fresh, nil
+	}
+	return cached, nil
+}
+
+// readCache returns the entry cached under key and its decoded value, both nil when key
+// is missing, unreadable or invalidated by one of its tags
+func readCache[T any](ctx context.Context, kv KeyValueProvider, key string, options CacheOptions) (*cacheEntry, *T, error) {
+	raw, err := kv.Get(ctx, key)
+	if IsNotFound(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	// Entries written by other code or versions are reloaded and overwritten
+	entry, err := decodeStored[cacheEntry](raw)
+	if err != nil || entry.Value == nil {
+		return nil, nil, nil
+	}
+	if len(entry.Tags) > 0 {
+		tags := make([]string, 0, len(entry.Tags))
+		for tag := range entry.Tags {
+			tags = append(tags, tag)
+		}
+		versions, err := tagVersions(ctx, kv, tags, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		for tag, version := range entry.Tags {
+			if versions[tag] != version {
+				return nil, nil, nil
+			}
+		}
+	}
+	var value T
+	if err := DecodeValue(entry.Value, &value, options.Codec, options.Compressor); err != nil {
+		return nil, nil, nil
+	}
+	return entry, &value, nil
+}
+
+// loadCache calls loader once for all concurrent callers of key and caches the result
+func loadCache[T any](ctx context.Context, kv KeyValueProvider, key string, ttl time.Duration, loader func(ctx context.Context) (*T, error), options CacheOptions) (*T, error) {
+	result, err := cacheFlights.do(ctx, newFlightKey[T](ctx, kv, key), options.LoadTimeout, func(ctx context.Context) (interface{}, error) {
+		// Tag versions are read before loading, so an invalidation during the load
+		// leaves the entry already invalid
+		versions, err := tagVersions(ctx, kv, options.Tags, true)
+		if err != nil {
+			return nil, err
+		}
+		start := options.now()
+		value, err := loader(ctx)
+		if err != nil {
+			return nil, err
+		}
+		loaded := options.now()
+
+		data, err := EncodeValue(options.Codec, options.Compressor, value)
+		if err != nil {
+			return nil, err
+		}
+		entry := cacheEntry{Value: data, Delta: int64(loaded.Sub(start)), Tags: versions}
+		storeTTL := time.Duration(0)
+		if ttl > 0 {
+			entry.Expires = loaded.Add(ttl).UnixNano()
+			storeTTL = ttl + options.StaleFor
+		}
+		encoded, err := json.Marshal(entry)
+		if err != nil {
+			return nil, NewErrorWithCause(ErrorTypeSerialization, "cache entry encoding failed", err)
+		}
+		if err := kv.Set(ctx, key, encoded, storeTTL); err != nil {
+			return nil, err
+		}
+		return value, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*T), nil
+}
+
+// =====================================
+// Tag Invalidation
+// =====================================
+
+// tagVersions returns the current version of each tag. Missing versions are created
+// when create is set and reported as empty otherwise.
+func tagVersions(ctx context.Context, kv KeyValueProvider, tags []string, create bool) (map[string]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	versions := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		raw, err := kv.Get(ctx, cacheTagPrefix+tag)
+		switch {
+		case err == nil:
+			versions[tag] = fmt.Sprint(raw)
+			if b, ok := raw.([]byte); ok {
+				versions[tag] = string(b)
+			}
+		case IsNotFound(err) && create:
+			version := newRandomID()
+			if err := kv.Set(ctx, cacheTagPrefix+tag, version, 0); err != nil {
+				return nil, err
+			}
+			versions[tag] = version
+		case !IsNotFound(err):
+			return nil, err
+		}
+	}
+	return versions, nil
+}
+
+// InvalidateTags drops every value cached by Remember under any of tags. Values are not
+// deleted: each tag gets a new version, so entries loaded under the old one miss.
+// Example: err := gpa.InvalidateTags(ctx, kv, "users")
+func InvalidateTags(ctx context.Context, kv KeyValueProvider, tags ...string) error {
+	for _, tag := range tags {
+		if err := kv.Set(ctx, cacheTagPrefix+tag, newRandomID(), 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// =====================================
+// Request Coalescing
+// =====================================
+
+// flightKey identifies one key of one provider, per tenant so that namespaced providers
+// never share values across tenants, and per value type so callers loading the same key
+// into different types never get each other's values. Providers that cannot be compared
+// get a token per call instead, so their loads are not shared at all rather than shared
+// with other providers.
+type flightKey struct {
+	kv     interface{}
+	tenant string
+	key    string
+	typ    reflect.Type
+}
+
+func newFlightKey[T any](ctx context.Context, kv KeyValueProvider, key string) flightKey {
+	fk := flightKey{key: key, typ: reflect.TypeFor[T]()}
+	if reflect.TypeOf(kv).Comparable() {
+		fk.kv = kv
+	} else {
+		fk.kv = new(byte)
+	}
+	if tenant, ok := TenantFromContext(ctx); ok {
+		fk.tenant = fmt.Sprint(tenant)
+	}
+	return fk
+}
+
+// flight is a loader call in progress
+type flight struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// flightGroup runs one call per key at a time and shares its result with the callers
+// that arrive while it runs. The call runs apart from its callers, on the values of the
+// first caller's context, so each caller can stop waiting without canceling it.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[flightKey]*flight
+}
+
+var cacheFlights = &flightGroup{flights: make(map[flightKey]*flight)}
+
+func (g *flightGroup) do(ctx context.Context, key flightKey, timeout time.Duration, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	f, ok := g.flights[key]
+	if !ok {
+		f = &flight{done: make(chan struct{})}
+		g.flights[key] = f
+		go g.run(context.WithoutCancel(ctx), key, f, timeout, fn)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		return nil, NewErrorWithCause(ErrorTypeTimeout, fmt.Sprintf("gave up waiting for %q to load", key.key), ctx.Err())
+	}
+}
+
+// run calls fn for the flight of key and publishes its result
+func (g *flightGroup) run(ctx context.Context, key flightKey, f *flight, timeout time.Duration, fn func(ctx context.Context) (interface{}, error)) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			f.value, f.err = nil, NewError(ErrorTypeInternal, fmt.Sprintf("loading %q panicked: %v", key.key, r))
+		}
+		g.mu.Lock()
+		delete(g.flights, key)
+		g.mu.Unlock()
+		close(f.done)
+	}()
+	f.value, f.err = fn(ctx)
+}
@@ -0,0 +1,253 @@
+package gpa
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type cachedRate struct {
+	Pair string
+	Rate float64
+}
+
+// clockedCache returns a memory provider and an option that share a settable clock
+func clockedCache() (*MemoryProvider, *time.Time, CacheOption) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	provider := NewMemoryProvider()
+	provider.now = func() time.Time { return now }
+	return provider, &now, func(o *CacheOptions) { o.now = provider.now }
+}
+
+func TestRemember_CoalescesLoads(t *testing.T) {
+	provider := NewMemoryProvider()
+	ctx := context.Background()
+	var calls int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (*cachedRate, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &cachedRate{Pair: "EURUSD", Rate: 1.1}, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*cachedRate, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = Remember(ctx, provider, "rate", time.Minute, loader)
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Expected one loader call, got %d", calls)
+	}
+	for _, result := range results {
+		if result == nil || result.Rate != 1.1 {
+			t.Fatalf("Expected every caller to get the loaded value, got %+v", result)
+		}
+	}
+	if _, err := Remember(ctx, provider, "rate", time.Minute, loader); err != nil || calls != 1 {
+		t.Errorf("Expected a cache hit, got %d calls (%v)", calls, err)
+	}
+}
+
+func TestRemember_StaleWhileRevalidate(t *testing.T) {
+	provider, now, clock := clockedCache()
+	ctx := context.Background()
+	failing := errors.New("source down")
+	rate := 1.0
+	loader := func(ctx context.Context) (*cachedRate, error) {
+		if rate < 0 {
+			return nil, failing
+		}
+		return &cachedRate{Rate: rate}, nil
+	}
+
+	Remember(ctx, provider, "rate", time.Minute, loader, StaleFor(time.Minute), clock)
+	*now = now.Add(90 * time.Second)
+	rate = -1
+	if got, err := Remember(ctx, provider, "rate", time.Minute, loader, StaleFor(time.Minute), clock); err != nil || got.Rate != 1 {
+		t.Errorf("Expected the stale value while the loader fails, got %+v (%v)", got, err)
+	}
+
+	rate = 2
+	if got, _ := Remember(ctx, provider, "rate", time.Minute, loader, StaleFor(time.Minute), clock); got.Rate != 2 {
+		t.Errorf("Expected an expired value to be reloaded, got %+v", got)
+	}
+
+	*now = now.Add(3 * time.Minute)
+	rate = -1
+	if _, err := Remember(ctx, provider, "rate", time.Minute, loader, StaleFor(time.Minute), clock); !errors.Is(err, failing) {
+		t.Errorf("Expected the loader error past the stale window, got %v", err)
+	}
+}
+
+func TestRemember_EarlyExpiration(t *testing.T) {
+	provider, now, clock := clockedCache()
+	ctx := context.Background()
+	calls := 0
+	loader := func(ctx context.Context) (*cachedRate, error) {
+		calls++
+		*now = now.Add(time.Second) // loads take a second
+		return &cachedRate{Rate: float64(calls)}, nil
+	}
+	random := func(r float64) CacheOption {
+		return func(o *CacheOptions) { o.random = func() float64 { return r } }
+	}
+
+	Remember(ctx, provider, "rate", time.Minute, loader, clock)
+	*now = now.Add(50 * time.Second)
+
+	// -ln(0.5) seconds is well under the 10s left
+	if got, _ := Remember(ctx, provider, "rate", time.Minute, loader, clock, random(0.5)); got.Rate != 1 || calls != 1 {
+		t.Errorf("Expected no early reload far from expiry, got %+v after %d calls", got, calls)
+	}
+	// -ln(1e-6) is about 14s, beyond the expiry
+	if got, _ := Remember(ctx, provider, "rate", time.Minute, loader, clock, random(1-1e-6)); got.Rate != 2 {
+		t.Errorf("Expected an early reload, got %+v", got)
+	}
+	*now = now.Add(58 * time.Second)
+	if got, _ := Remember(ctx, provider, "rate", time.Minute, loader, clock, random(1-1e-6), EarlyExpiration(-1)); got.Rate != 2 {
+		t.Errorf("Expected early reloads to be disabled, got %+v", got)
+	}
+}
+
+func TestRemember_Tags(t *testing.T) {
+	provider := NewMemoryProvider()
+	ctx := context.Background()
+	calls := 0
+	loader := func(ctx context.Context) (*cachedRate, error) {
+		calls++
+		return &cachedRate{Rate: float64(calls)}, nil
+	}
+
+	Remember(ctx, provider, "rate:eur", 0, loader, CacheTags("rates", "eur"))
+	Remember(ctx, provider, "rate:usd", 0, loader, CacheTags("rates"))
+	Remember(ctx, provider, "other", 0, loader)
+
+	if err := InvalidateTags(ctx, provider, "eur"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got, _ := Remember(ctx, provider, "rate:eur", 0, loader, CacheTags("rates", "eur")); got.Rate != 4 {
+		t.Errorf("Expected an invalidated value to be reloaded, got %+v", got)
+	}
+	if got, _ := Remember(ctx, provider, "rate:usd", 0, loader, CacheTags("rates")); got.Rate != 2 {
+		t.Errorf("Expected other tags to be kept, got %+v", got)
+	}
+
+	InvalidateTags(ctx, provider, "rates")
+	Remember(ctx, provider, "rate:eur", 0, loader, CacheTags("rates", "eur"))
+	Remember(ctx, provider, "rate:usd", 0, loader, CacheTags("rates"))
+	if got, _ := Remember(ctx, provider, "other", 0, loader); calls != 6 || got.Rate != 3 {
+		t.Errorf("Expected the whole group reloaded and untagged values kept, got %d calls and %+v", calls, got)
+	}
+}
+
+func TestRemember_LoadOutlivesCanceledCaller(t *testing.T) {
+	provider := NewMemoryProvider()
+	release := make(chan struct{})
+	var loadErr error
+	loader := func(ctx context.Context) (*cachedRate, error) {
+		<-release
+		loadErr = ctx.Err()
+		return &cachedRate{Rate: 1.1}, nil
+	}
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := Remember(leaderCtx, provider, "rate", time.Minute, loader)
+		leaderErr <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	follower := make(chan *cachedRate, 1)
+	go func() {
+		result, _ := Remember(context.Background(), provider, "rate", time.Minute, loader)
+		follower <- result
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	if err := <-leaderErr; !IsErrorType(err, ErrorTypeTimeout) {
+		t.Errorf("Expected the canceled caller to stop waiting, got %v", err)
+	}
+	close(release)
+	if result := <-follower; result == nil || result.Rate != 1.1 {
+		t.Errorf("Expected the other caller to get the loaded value, got %+v", result)
+	}
+	if loadErr != nil {
+		t.Errorf("Expected the loader context to outlive the canceled caller, got %v", loadErr)
+	}
+}
+
+func TestRemember_CoalescesPerType(t *testing.T) {
+	provider := NewMemoryProvider()
+	release := make(chan struct{})
+	rates := make(chan *cachedRate, 1)
+	go func() {
+		result, _ := Remember(context.Background(), provider, "shared", time.Minute, func(ctx context.Context) (*cachedRate, error) {
+			<-release
+			return &cachedRate{Rate: 1.1}, nil
+		})
+		rates <- result
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	pair, err := Remember(context.Background(), provider, "shared", time.Minute, func(ctx context.Context) (*string, error) {
+		pair := "EURUSD"
+		return &pair, nil
+	})
+	close(release)
+	if err != nil || pair == nil || *pair != "EURUSD" {
+		t.Errorf("Expected a separate load for another type, got %v (%v)", pair, err)
+	}
+	if result := <-rates; result == nil || result.Rate != 1.1 {
+		t.Errorf("Expected the first load to keep its own value, got %+v", result)
+	}
+}
+
+// uncomparableKV is a provider value whose type cannot be used as a map key
+type uncomparableKV struct {
+	*MemoryProvider
+	labels []string
+}
+
+func TestRemember_UncomparableProvidersDoNotShare(t *testing.T) {
+	first := uncomparableKV{MemoryProvider: NewMemoryProvider()}
+	second := uncomparableKV{MemoryProvider: NewMemoryProvider()}
+	if newFlightKey[string](context.Background(), first, "k") == newFlightKey[string](context.Background(), second, "k") {
+		t.Error("Expected different uncomparable providers to get different flight keys")
+	}
+
+	release := make(chan struct{})
+	values := make(chan *string, 1)
+	go func() {
+		result, _ := Remember(context.Background(), first, "shared", time.Minute, func(ctx context.Context) (*string, error) {
+			<-release
+			value := "first"
+			return &value, nil
+		})
+		values <- result
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	value, err := Remember(context.Background(), second, "shared", time.Minute, func(ctx context.Context) (*string, error) {
+		value := "second"
+		return &value, nil
+	})
+	close(release)
+	if err != nil || value == nil || *value != "second" {
+		t.Errorf("Expected the second provider to load its own value, got %v (%v)", value, err)
+	}
+	if result := <-values; result == nil || *result != "first" {
+		t.Errorf("Expected the first provider to keep its own value, got %v", result)
+	}
+}
@@ -0,0 +1,620 @@
+package gpa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =====================================
+// Change Events
+// =====================================
+
+// ChangeOp is the kind of change in a ChangeEvent
+type ChangeOp string
+
+const (
+	ChangeInsert ChangeOp = "insert"
+	ChangeUpdate ChangeOp = "update"
+	ChangeDelete ChangeOp = "delete"
+)
+
+// ChangeEvent is a single change to an entity.
+// Before is nil for inserts and After is nil for deletes. Providers that cannot
+// report the prior state leave Before nil for updates as well.
+type ChangeEvent[T any] struct {
+	Op          ChangeOp
+	ID          interface{}
+	Before      *T
+	After       *T
+	Timestamp   time.Time
+	ResumeToken string
+}
+
+// ChangeOptions selects which changes a stream delivers
+type ChangeOptions struct {
+	// ResumeAfter is the ResumeToken of the last event seen. When empty the stream
+	// starts with changes made after it was opened.
+	ResumeAfter string
+
+	// Ops limits the stream to these operations. Empty means all operations.
+	Ops []ChangeOp
+
+	// Conditions are matched against After, or Before for deletes.
+	Conditions []Condition
+}
+
+// ChangeOption configures ChangeOptions
+type ChangeOption func(*ChangeOptions)
+
+// ResumeAfter continues a stream after the event with the given token
+// Example: gpa.Changes(ctx, repo, gpa.ResumeAfter(lastToken))
+func ResumeAfter(token string) ChangeOption {
+	return func(o *ChangeOptions) { o.ResumeAfter = token }
+}
+
+// OnlyChanges limits a stream to the given operations
+// Example: gpa.Changes(ctx, repo, gpa.OnlyChanges(gpa.ChangeInsert))
+func OnlyChanges(ops ...ChangeOp) ChangeOption {
+	return func(o *ChangeOptions) { o.Ops = append(o.Ops, ops...) }
+}
+
+// ChangesWhere limits a stream to entities matching every condition
+// Example: gpa.Changes(ctx, repo, gpa.ChangesWhere(gpa.WhereCondition("status", gpa.OpEqual, "paid")))
+func ChangesWhere(conditions ...Condition) ChangeOption {
+	return func(o *ChangeOptions) { o.Conditions = append(o.Conditions, conditions...) }
+}
+
+// Matches reports whether a change passes the operation and condition filters
+func (o ChangeOptions) Matches(op ChangeOp, before, after interface{}) (bool, error) {
+	if len(o.Ops) > 0 {
+		found := false
+		for _, allowed := range o.Ops {
+			if allowed == op {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	if len(o.Conditions) == 0 {
+		return true, nil
+	}
+	entity := after
+	if op == ChangeDelete {
+		entity = before
+	}
+	if !indirectValue(reflect.ValueOf(entity)).IsValid() {
+		return false, nil
+	}
+	return MatchConditions(entity, o.Conditions)
+}
+
+// =====================================
+// Change Streams
+// =====================================
+
+// ChangeStreamer is implemented by repositories that can stream changes: the in-memory
+// repository, which notifies directly, and repositories wrapped by NewSQLChangeRepository
+// (trigger-fed change log), NewDocumentChangeRepository (MongoDB change streams) and
+// NewKeyspaceChangeRepository (Redis keyspace notifications). Implementations may push
+// the filters in ChangeOptions down to the database; Changes applies them again in memory.
+type ChangeStreamer[T any] interface {
+	Changes(ctx context.Context, opts ChangeOptions) iter.Seq2[ChangeEvent[T], error]
+}
+
+// Changes streams changes to the entities of repo until ctx is done.
+// repo must implement ChangeStreamer[T]; otherwise the stream yields a single
+// ErrorTypeUnsupported error. Decorators do not forward streams, so pass the
+// provider's repository.
+// Example:
+//
+//	for event, err := range gpa.Changes(ctx, repo, gpa.OnlyChanges(gpa.ChangeInsert)) {
+//	    if err != nil { return err }
+//	    save(event.ResumeToken)
+//	}
+func Changes[T any](ctx context.Context, repo Repository[T], opts ...ChangeOption) iter.Seq2[ChangeEvent[T], error] {
+	var options ChangeOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	streamer, ok := repo.(ChangeStreamer[T])
+	if !ok {
+		return func(yield func(ChangeEvent[T], error) bool) {
+			yield(ChangeEvent[T]{}, NewError(ErrorTypeUnsupported, "repository does not support change streams").WithEntity(entityName[T]()))
+		}
+	}
+
+	return func(yield func(ChangeEvent[T], error) bool) {
+		for event, err := range streamer.Changes(ctx, options) {
+			if err == nil {
+				var matched bool
+				if matched, err = options.Matches(event.Op, event.Before, event.After); err == nil && !matched {
+					continue
+				}
+			}
+			if !yield(event, err) {
+				return
+			}
+		}
+	}
+}
+
+// =====================================
+// SQL Change Log
+// =====================================
+
+// ChangeRecord is a row of a SQL change log table, usually written by triggers.
+// Before and After hold the row as JSON, decoded with the json tags of the entity.
+type ChangeRecord struct {
+	Seq       int64     `json:"seq" db:"seq" gorm:"primaryKey"`
+	Entity    string    `json:"entity" db:"entity"`
+	EntityID  string    `json:"entity_id" db:"entity_id"`
+	Operation ChangeOp  `json:"operation" db:"operation"`
+	Before    string    `json:"before" db:"before"`
+	After     string    `json:"after" db:"after"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// SQLChangeConfig configures a SQL change log stream
+type SQLChangeConfig struct {
+	// Entity is the value of the entity column for T. Defaults to the table name of T.
+	Entity string
+
+	// PollInterval is the delay between polls that found no changes. Defaults to 1s.
+	PollInterval time.Duration
+
+	// BatchSize is the number of records fetched per query. Defaults to 100.
+	BatchSize int
+
+	// CommitLag is how long a missing sequence number is waited for. Sequence numbers
+	// are assigned at insert but become visible at commit, so a record can appear after
+	// a later one; records above a missing number are re-read until it appears or a
+	// later record has been visible for CommitLag, after which its transaction is
+	// assumed rolled back. Defaults to 10s.
+	CommitLag time.Duration
+}
+
+// sqlChangeRepository adds a change stream read from a change log to a repository
+type sqlChangeRepository[T any] struct {
+	Repository[T]
+	log    Repository[ChangeRecord]
+	config SQLChangeConfig
+	now    func() time.Time
+}
+
+// NewSQLChangeRepository returns repo with a change stream that polls log for records
+// of T. Records are delivered once each, in sequence order except for records that
+// commit out of order, which are delivered when they appear. Resume tokens are sequence
+// numbers below which every record was delivered; they trail the stream by up to
+// SQLChangeConfig.CommitLag, so resuming may deliver a few events again.
+// Example: repo = gpa.NewSQLChangeRepository(repo, changeLog, gpa.SQLChangeConfig{Entity: "orders"})
+func NewSQLChangeRepository[T any](repo Repository[T], log Repository[ChangeRecord], config SQLChangeConfig) Repository[T] {
+	if config.Entity == "" {
+		if info, err := repo.GetEntityInfo(); err == nil && info != nil && info.TableName != "" {
+			config.Entity = info.TableName
+		} else {
+			config.Entity = entityName[T]()
+		}
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.CommitLag <= 0 {
+		config.CommitLag = 10 * time.Second
+	}
+	return &sqlChangeRepository[T]{Repository: repo, log: log, config: config, now: time.Now}
+}
+
+// QueryScored implements ScoredQuerier when the wrapped repository does
+func (r *sqlChangeRepository[T]) QueryScored(ctx context.Context, opts ...QueryOption) ([]Scored[T], error) {
+	return QueryScored(ctx, r.Repository, opts...)
+}
+
+// Changes implements ChangeStreamer
+func (r *sqlChangeRepository[T]) Changes(ctx context.Context, opts ChangeOptions) iter.Seq2[ChangeEvent[T], error] {
+	return func(yield func(ChangeEvent[T], error) bool) {
+		floor, err := r.startSeq(ctx, opts.ResumeAfter)
+		if err != nil {
+			yield(ChangeEvent[T]{}, err)
+			return
+		}
+
+		filter := []QueryOption{Where("entity", OpEqual, r.config.Entity)}
+		if len(opts.Ops) > 0 {
+			ops := make([]interface{}, len(opts.Ops))
+			for i, op := range opts.Ops {
+				ops[i] = string(op)
+			}
+			filter = append(filter, WhereIn("operation", ops))
+		}
+
+		// Every record up to floor was delivered; seen holds the delivered sequence
+		// numbers above it with the time they were first read
+		seen := make(map[int64]time.Time)
+		for {
+			records, err := r.poll(ctx, filter, floor, seen)
+			if err != nil && ctx.Err() == nil {
+				if !yield(ChangeEvent[T]{}, err) {
+					return
+				}
+			}
+			floor = advanceChangeFloor(floor, seen, r.now(), r.config.CommitLag)
+			for _, record := range records {
+				event, err := decodeChangeRecord[T](record, min(record.Seq, floor))
+				if !yield(event, err) {
+					return
+				}
+			}
+			if err == nil && len(records) >= r.config.BatchSize {
+				continue
+			}
+
+			timer := time.NewTimer(r.config.PollInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// poll reads the records above floor not in seen, up to about a batch of them, and adds
+// them to seen
+func (r *sqlChangeRepository[T]) poll(ctx context.Context, filter []QueryOption, floor int64, seen map[int64]time.Time) ([]*ChangeRecord, error) {
+	var fresh []*ChangeRecord
+	now := r.now()
+	for cursor := floor; len(fresh) < r.config.BatchSize; {
+		page, err := r.log.Query(ctx, append(filter[:len(filter):len(filter)],
+			Where("seq", OpGreaterThan, cursor),
+			OrderBy("seq", OrderAsc),
+			Limit(r.config.BatchSize),
+		)...)
+		if err != nil {
+			return fresh, err
+		}
+		for _, record := range page {
+			cursor = max(cursor, record.Seq)
+			if _, ok := seen[record.Seq]; !ok {
+				seen[record.Seq] = now
+				fresh = append(fresh, record)
+			}
+		}
+		if len(page) < r.config.BatchSize {
+			break
+		}
+	}
+	return fresh, nil
+}
+
+// advanceChangeFloor moves floor past delivered sequence numbers, and past a missing one
+// once a later record has been visible for lag, as its transaction must have rolled back
+// or belongs to records the stream does not read
+func advanceChangeFloor(floor int64, seen map[int64]time.Time, now time.Time, lag time.Duration) int64 {
+	for len(seen) > 0 {
+		if _, ok := seen[floor+1]; ok {
+			delete(seen, floor+1)
+			floor++
+			continue
+		}
+		next := int64(math.MaxInt64)
+		for seq := range seen {
+			next = min(next, seq)
+		}
+		if now.Sub(seen[next]) < lag {
+			break
+		}
+		floor = next - 1
+	}
+	return floor
+}
+
+// startSeq returns the sequence number to stream after
+func (r *sqlChangeRepository[T]) startSeq(ctx context.Context, token string) (int64, error) {
+	if token != "" {
+		seq, err := strconv.ParseInt(token, 10, 64)
+		if err != nil {
+			return 0, NewErrorWithCause(ErrorTypeInvalidArgument, "invalid resume token", err)
+		}
+		return seq, nil
+	}
+	latest, err := r.log.Query(ctx, Where("entity", OpEqual, r.config.Entity), OrderBy("seq", OrderDesc), Limit(1))
+	if err != nil || len(latest) == 0 {
+		return 0, err
+	}
+	return latest[0].Seq, nil
+}
+
+// decodeChangeRecord converts a change log row to an event resuming after resumeAfter
+func decodeChangeRecord[T any](record *ChangeRecord, resumeAfter int64) (ChangeEvent[T], error) {
+	event := ChangeEvent[T]{
+		Op:          record.Operation,
+		ID:          record.EntityID,
+		Timestamp:   record.CreatedAt,
+		ResumeToken: strconv.FormatInt(resumeAfter, 10),
+	}
+	for _, side := range []struct {
+		data   string
+		target **T
+	}{{record.Before, &event.Before}, {record.After, &event.After}} {
+		if side.data == "" {
+			continue
+		}
+		entity := new(T)
+		if err := json.Unmarshal([]byte(side.data), entity); err != nil {
+			return event, NewErrorWithCause(ErrorTypeSerialization, "cannot decode change record", err).WithEntity(record.Entity)
+		}
+		*side.target = entity
+	}
+	return event, nil
+}
+
+// PostgresChangeTrigger returns the SQL that installs a trigger copying every insert,
+// update and delete on table into logTable, tagged with entity. table must have an id
+// column; logTable needs the columns of ChangeRecord with seq as a bigserial.
+// Example: _, err := sqlProvider.RawExec(ctx, gpa.PostgresChangeTrigger("change_log", "orders", "orders"))
+func PostgresChangeTrigger(logTable, table, entity string) string {
+	function := "gpa_capture_" + table
+	return fmt.Sprintf(`CREATE OR REPLACE FUNCTION %[1]s() RETURNS trigger AS $$
+BEGIN
+	INSERT INTO %[2]s (entity, entity_id, operation, before, after, created_at)
+	VALUES (%[4]s,
+		CASE WHEN TG_OP = 'DELETE' THEN OLD.id ELSE NEW.id END::text,
+		lower(TG_OP),
+		CASE WHEN TG_OP <> 'INSERT' THEN row_to_json(OLD)::text ELSE '' END,
+		CASE WHEN TG_OP <> 'DELETE' THEN row_to_json(NEW)::text ELSE '' END,
+		now());
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS %[1]s ON %[3]s;
+CREATE TRIGGER %[1]s AFTER INSERT OR UPDATE OR DELETE ON %[3]s
+	FOR EACH ROW EXECUTE FUNCTION %[1]s();`, function, logTable, table, "'"+strings.ReplaceAll(entity, "'", "''")+"'")
+}
+
+// =====================================
+// Redis Keyspace Notifications
+// =====================================
+
+// KeyspaceChangeConfig configures a Redis keyspace notification stream
+type KeyspaceChangeConfig struct {
+	// KeyPrefix precedes the primary key in the keys holding T, e.g. "user:"
+	KeyPrefix string
+
+	// Database is the Redis database number of the keys. Defaults to 0.
+	Database int
+}
+
+// keyspaceDeletes are the keyspace events that remove a key
+var keyspaceDeletes = map[string]bool{"del": true, "expired": true, "evicted": true, "rename_from": true}
+
+// keyspaceIgnored are the keyspace events that do not change a value
+var keyspaceIgnored = map[string]bool{"expire": true, "persist": true, "new": true}
+
+// keyspaceChangeRepository adds a change stream fed by keyspace notifications to a repository
+type keyspaceChangeRepository[T any] struct {
+	Repository[T]
+	pubsub PubSubProvider
+	config KeyspaceChangeConfig
+}
+
+// NewKeyspaceChangeRepository returns repo with a change stream fed by the Redis keyspace
+// notifications of pubsub, which needs notify-keyspace-events to include K and the event
+// classes of the writes, e.g. "K$gx". Notifications carry no values, and Redis does not
+// tell inserts from updates: writes are ChangeUpdate events with After read through repo,
+// and deletions and expirations are ChangeDelete events with only ID set. Notifications
+// are not kept, so events published while no stream is subscribed are lost and streams
+// cannot resume; events have no ResumeToken.
+// Example: repo = gpa.NewKeyspaceChangeRepository(repo, redisProvider, gpa.KeyspaceChangeConfig{KeyPrefix: "user:"})
+func NewKeyspaceChangeRepository[T any](repo Repository[T], pubsub PubSubProvider, config KeyspaceChangeConfig) Repository[T] {
+	return &keyspaceChangeRepository[T]{Repository: repo, pubsub: pubsub, config: config}
+}
+
+// QueryScored implements ScoredQuerier when the wrapped repository does
+func (r *keyspaceChangeRepository[T]) QueryScored(ctx context.Context, opts ...QueryOption) ([]Scored[T], error) {
+	return QueryScored(ctx, r.Repository, opts...)
+}
+
+// Changes implements ChangeStreamer
+func (r *keyspaceChangeRepository[T]) Changes(ctx context.Context, opts ChangeOptions) iter.Seq2[ChangeEvent[T], error] {
+	return func(yield func(ChangeEvent[T], error) bool) {
+		if opts.ResumeAfter != "" {
+			yield(ChangeEvent[T]{}, NewError(ErrorTypeUnsupported, "keyspace notification streams cannot resume").WithEntity(entityName[T]()))
+			return
+		}
+		channelPrefix := fmt.Sprintf("__keyspace@%d__:", r.config.Database)
+		messages, err := r.pubsub.Subscribe(ctx, channelPrefix+EscapeKeyPattern(r.config.KeyPrefix)+"*")
+		if err != nil {
+			yield(ChangeEvent[T]{}, err)
+			return
+		}
+
+		for message := range messages {
+			name := string(message.Payload)
+			if keyspaceIgnored[name] {
+				continue
+			}
+			key := strings.TrimPrefix(message.Channel, channelPrefix)
+			event := ChangeEvent[T]{Op: ChangeUpdate, ID: strings.TrimPrefix(key, r.config.KeyPrefix), Timestamp: time.Now()}
+			if keyspaceDeletes[name] {
+				event.Op = ChangeDelete
+			}
+			if len(opts.Ops) > 0 && !slices.Contains(opts.Ops, event.Op) {
+				continue
+			}
+			if event.Op == ChangeUpdate {
+				after, err := r.FindByID(ctx, event.ID)
+				switch {
+				case IsNotFound(err):
+					// Deleted before it was read; its deletion follows
+					continue
+				case err != nil && ctx.Err() != nil:
+					return
+				case err != nil:
+					if !yield(ChangeEvent[T]{}, err) {
+						return
+					}
+					continue
+				}
+				event.After = after
+			}
+			if !yield(event, nil) {
+				return
+			}
+		}
+	}
+}
+
+// =====================================
+// Document Change Streams
+// =====================================
+
+// DocumentChangeRequest is passed as the pipeline of DocumentProvider.Watch by
+// NewDocumentChangeRepository. Providers run Pipeline and map the other fields to their
+// change stream options, as MongoDB's resumeAfter, fullDocument and
+// fullDocumentBeforeChange.
+type DocumentChangeRequest struct {
+	Pipeline                 []map[string]interface{}
+	ResumeAfter              map[string]interface{}
+	FullDocument             string
+	FullDocumentBeforeChange string
+}
+
+// DocumentChangeCursor is the change stream returned by DocumentProvider.Watch, as
+// *mongo.ChangeStream
+type DocumentChangeCursor interface {
+	Next(ctx context.Context) bool
+	Decode(val interface{}) error
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// documentChange is a MongoDB change event
+type documentChange[T any] struct {
+	ID struct {
+		Data string `bson:"_data"`
+	} `bson:"_id"`
+	OperationType string `bson:"operationType"`
+	DocumentKey   struct {
+		ID interface{} `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument             *T        `bson:"fullDocument"`
+	FullDocumentBeforeChange *T        `bson:"fullDocumentBeforeChange"`
+	WallTime                 time.Time `bson:"wallTime"`
+}
+
+// documentChangeOps maps change operations to MongoDB operation types
+var documentChangeOps = map[ChangeOp][]string{
+	ChangeInsert: {"insert"},
+	ChangeUpdate: {"update", "replace"},
+	ChangeDelete: {"delete"},
+}
+
+// documentChangeRepository adds a change stream of a document collection to a repository
+type documentChangeRepository[T any] struct {
+	Repository[T]
+	provider   DocumentProvider
+	collection string
+}
+
+// NewDocumentChangeRepository returns repo with a change stream of collection, opened
+// with provider.Watch. Updates carry the current document as After, and Before when the
+// collection records pre-images. Resume tokens are the _data of MongoDB's resume tokens.
+// Example: repo = gpa.NewDocumentChangeRepository(repo, mongoProvider, "orders")
+func NewDocumentChangeRepository[T any](repo Repository[T], provider DocumentProvider, collection string) Repository[T] {
+	return &documentChangeRepository[T]{Repository: repo, provider: provider, collection: collection}
+}
+
+// QueryScored implements ScoredQuerier when the wrapped repository does
+func (r *documentChangeRepository[T]) QueryScored(ctx context.Context, opts ...QueryOption) ([]Scored[T], error) {
+	return QueryScored(ctx, r.Repository, opts...)
+}
+
+// Changes implements ChangeStreamer
+func (r *documentChangeRepository[T]) Changes(ctx context.Context, opts ChangeOptions) iter.Seq2[ChangeEvent[T], error] {
+	return func(yield func(ChangeEvent[T], error) bool) {
+		ops := opts.Ops
+		if len(ops) == 0 {
+			ops = []ChangeOp{ChangeInsert, ChangeUpdate, ChangeDelete}
+		}
+		types := []interface{}{"invalidate"}
+		for _, op := range ops {
+			for _, name := range documentChangeOps[op] {
+				types = append(types, name)
+			}
+		}
+		request := &DocumentChangeRequest{
+			Pipeline:                 []map[string]interface{}{{"$match": map[string]interface{}{"operationType": map[string]interface{}{"$in": types}}}},
+			FullDocument:             "updateLookup",
+			FullDocumentBeforeChange: "whenAvailable",
+		}
+		if opts.ResumeAfter != "" {
+			request.ResumeAfter = map[string]interface{}{"_data": opts.ResumeAfter}
+		}
+
+		stream, err := r.provider.Watch(ctx, r.collection, request)
+		if err != nil {
+			yield(ChangeEvent[T]{}, err)
+			return
+		}
+		cursor, ok := stream.(DocumentChangeCursor)
+		if !ok {
+			yield(ChangeEvent[T]{}, NewError(ErrorTypeUnsupported, fmt.Sprintf("unsupported change stream %T", stream)).WithEntity(r.collection))
+			return
+		}
+		defer cursor.Close(context.WithoutCancel(ctx))
+
+		for cursor.Next(ctx) {
+			var change documentChange[T]
+			if err := cursor.Decode(&change); err != nil {
+				if !yield(ChangeEvent[T]{}, NewErrorWithCause(ErrorTypeSerialization, "cannot decode change event", err).WithEntity(r.collection)) {
+					return
+				}
+				continue
+			}
+			event := ChangeEvent[T]{
+				ID:          change.DocumentKey.ID,
+				Before:      change.FullDocumentBeforeChange,
+				Timestamp:   change.WallTime,
+				ResumeToken: change.ID.Data,
+			}
+			if event.Timestamp.IsZero() {
+				event.Timestamp = time.Now()
+			}
+			switch change.OperationType {
+			case "insert":
+				event.Op, event.After = ChangeInsert, change.FullDocument
+			case "update", "replace":
+				event.Op, event.After = ChangeUpdate, change.FullDocument
+			case "delete":
+				event.Op = ChangeDelete
+			case "invalidate":
+				yield(ChangeEvent[T]{}, NewError(ErrorTypeNotFound, "change stream invalidated: the collection was dropped or renamed").WithEntity(r.collection))
+				return
+			default:
+				continue
+			}
+			if !yield(event, nil) {
+				return
+			}
+		}
+		if err := cursor.Err(); err != nil && ctx.Err() == nil {
+			yield(ChangeEvent[T]{}, err)
+		}
+	}
+}
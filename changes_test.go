@@ -0,0 +1,287 @@
+package gpa
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// collectChanges reads n events from a stream, failing after a second
+func collectChanges[T any](t *testing.T, ctx context.Context, repo Repository[T], n int, opts ...ChangeOption) []ChangeEvent[T] {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	var events []ChangeEvent[T]
+	for event, err := range Changes(ctx, repo, opts...) {
+		if err != nil {
+			t.Fatalf("Unexpected stream error: %v", err)
+		}
+		events = append(events, event)
+		if len(events) == n {
+			break
+		}
+	}
+	if len(events) != n {
+		t.Fatalf("Expected %d events, got %d", n, len(events))
+	}
+	return events
+}
+
+func TestChanges_MemoryNotifications(t *testing.T) {
+	repo := NewMemoryRepository[memoryItem]()
+	ctx := context.Background()
+
+	go func() {
+		repo.Create(ctx, &memoryItem{Name: "pen", Price: 3})
+		repo.UpdatePartial(ctx, 1, map[string]interface{}{"price": 5})
+		repo.Delete(ctx, 1)
+	}()
+
+	events := collectChanges[memoryItem](t, ctx, repo, 3, ResumeAfter("0"))
+	if events[0].Op != ChangeInsert || events[0].Before != nil || events[0].After.Name != "pen" {
+		t.Errorf("Unexpected insert event: %+v", events[0])
+	}
+	if events[1].Op != ChangeUpdate || events[1].Before.Price != 3 || events[1].After.Price != 5 {
+		t.Errorf("Unexpected update event: %+v", events[1])
+	}
+	if events[2].Op != ChangeDelete || events[2].After != nil || events[2].ID != 1 {
+		t.Errorf("Unexpected delete event: %+v", events[2])
+	}
+	if events[2].ResumeToken != "3" || events[2].Timestamp.IsZero() {
+		t.Errorf("Expected resume token and timestamp, got %+v", events[2])
+	}
+}
+
+func TestChanges_ResumeAndFilter(t *testing.T) {
+	repo := seedMemoryItems(t)
+	ctx := context.Background()
+	repo.UpdatePartial(ctx, 3, map[string]interface{}{"price": 35})
+	repo.Delete(ctx, 1)
+
+	resumed := collectChanges[memoryItem](t, ctx, repo, 2, ResumeAfter("3"))
+	if resumed[0].Op != ChangeUpdate || resumed[1].Op != ChangeDelete {
+		t.Errorf("Expected update and delete after token 3, got %s, %s", resumed[0].Op, resumed[1].Op)
+	}
+
+	filtered := collectChanges[memoryItem](t, ctx, repo, 3, ResumeAfter("0"),
+		OnlyChanges(ChangeInsert, ChangeUpdate), ChangesWhere(WhereCondition("price", OpGreaterThan, 10)))
+	if filtered[0].After.Name != "book" || filtered[1].After.Name != "lamp" || filtered[2].Op != ChangeUpdate {
+		t.Errorf("Expected book and lamp inserts and the lamp update, got %+v", filtered)
+	}
+
+	for _, err := range Changes(ctx, repo, ResumeAfter("x")) {
+		if !IsErrorType(err, ErrorTypeInvalidArgument) {
+			t.Errorf("Expected invalid token error, got %v", err)
+		}
+		break
+	}
+}
+
+func TestChanges_Transaction(t *testing.T) {
+	repo := NewMemoryRepository[memoryItem]()
+	ctx := context.Background()
+
+	repo.Transaction(ctx, func(tx Transaction[memoryItem]) error {
+		tx.Create(ctx, &memoryItem{Name: "rolled back"})
+		return NewError(ErrorTypeValidation, "abort")
+	})
+	repo.Transaction(ctx, func(tx Transaction[memoryItem]) error {
+		return tx.Create(ctx, &memoryItem{Name: "committed"})
+	})
+
+	events := collectChanges[memoryItem](t, ctx, repo, 1, ResumeAfter("0"))
+	if events[0].After.Name != "committed" || events[0].ResumeToken != "1" {
+		t.Errorf("Expected only the committed insert, got %+v", events[0])
+	}
+}
+
+func TestChanges_Unsupported(t *testing.T) {
+	for _, err := range Changes(context.Background(), &mockRepository[memoryItem]{}) {
+		if !IsErrorType(err, ErrorTypeUnsupported) {
+			t.Errorf("Expected unsupported error, got %v", err)
+		}
+	}
+}
+
+func TestSQLChangeRepository(t *testing.T) {
+	log := &mockRepository[ChangeRecord]{items: []*ChangeRecord{
+		{Seq: 7, Entity: "items", EntityID: "1", Operation: ChangeInsert, After: `{"id":1,"name":"pen","price":3}`},
+		{Seq: 8, Entity: "items", EntityID: "1", Operation: ChangeDelete, Before: `{"id":1,"name":"pen","price":3}`},
+	}}
+	repo := NewSQLChangeRepository[memoryItem](&mockRepository[memoryItem]{}, log, SQLChangeConfig{Entity: "items"})
+
+	events := collectChanges[memoryItem](t, context.Background(), repo, 2, ResumeAfter("6"), OnlyChanges(ChangeInsert, ChangeDelete))
+	if events[0].After.Name != "pen" || events[1].Before.Price != 3 || events[1].ResumeToken != "8" {
+		t.Errorf("Unexpected decoded events: %+v", events)
+	}
+
+	query := NewQuery()
+	for _, opt := range log.lastOpts {
+		opt.Apply(query)
+	}
+	if len(query.Conditions) != 3 || query.Conditions[1].Operator() != OpIn || query.Conditions[2].Value() != int64(6) {
+		t.Errorf("Unexpected change log query: %s", query)
+	}
+
+	trigger := PostgresChangeTrigger("change_log", "items", "it's")
+	if !strings.Contains(trigger, "INSERT INTO change_log") || !strings.Contains(trigger, "'it''s'") || !strings.Contains(trigger, "ON items") {
+		t.Errorf("Unexpected trigger SQL: %s", trigger)
+	}
+}
+
+func TestSQLChangeRepository_OutOfOrderCommits(t *testing.T) {
+	log := NewMemoryRepository[ChangeRecord]()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	insert := func(seq int64) {
+		log.Create(ctx, &ChangeRecord{Seq: seq, Entity: "items", EntityID: fmt.Sprint(seq), Operation: ChangeUpdate, After: `{"id":1}`})
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	repo := NewSQLChangeRepository[memoryItem](&mockRepository[memoryItem]{}, log, SQLChangeConfig{Entity: "items", PollInterval: time.Millisecond, CommitLag: time.Minute})
+	repo.(*sqlChangeRepository[memoryItem]).now = func() time.Time { return now }
+
+	// 2 commits after 3, and 4 never commits
+	insert(1)
+	var ids, tokens []string
+	for event, err := range Changes(ctx, repo, ResumeAfter("0")) {
+		if err != nil {
+			t.Fatalf("Unexpected stream error: %v", err)
+		}
+		ids = append(ids, event.ID.(string))
+		tokens = append(tokens, event.ResumeToken)
+		switch len(tokens) {
+		case 1:
+			insert(3)
+		case 2:
+			insert(2)
+		case 3:
+			insert(5)
+		case 4:
+			now = now.Add(2 * time.Minute)
+			insert(6)
+		}
+		if len(tokens) == 5 {
+			break
+		}
+	}
+	if strings.Join(ids, ",") != "1,3,2,5,6" {
+		t.Errorf("Expected every record delivered once, got %v", ids)
+	}
+	if strings.Join(tokens, ",") != "1,1,2,3,6" {
+		t.Errorf("Expected resume tokens below undelivered records, got %v", tokens)
+	}
+}
+
+func TestKeyspaceChangeRepository(t *testing.T) {
+	provider := NewMemoryProvider()
+	items := NewMemoryRepository[memoryItem]()
+	ctx := context.Background()
+	items.Create(ctx, &memoryItem{Name: "pen", Price: 3})
+	repo := NewKeyspaceChangeRepository[memoryItem](items, provider, KeyspaceChangeConfig{KeyPrefix: "item:"})
+
+	go func() {
+		// Wait for the stream to subscribe; expire events are not reported
+		for n := int64(0); n == 0; n, _ = provider.Publish(ctx, "__keyspace@0__:item:1", []byte("expire")) {
+			time.Sleep(time.Millisecond)
+		}
+		provider.Publish(ctx, "__keyspace@0__:other:1", []byte("set"))
+		provider.Publish(ctx, "__keyspace@0__:item:9", []byte("set"))
+		provider.Publish(ctx, "__keyspace@0__:item:1", []byte("set"))
+		provider.Publish(ctx, "__keyspace@0__:item:2", []byte("expired"))
+	}()
+
+	events := collectChanges[memoryItem](t, ctx, repo, 2)
+	if events[0].Op != ChangeUpdate || events[0].ID != "1" || events[0].After == nil || events[0].After.Name != "pen" {
+		t.Errorf("Expected an update read through the repository, got %+v", events[0])
+	}
+	if events[1].Op != ChangeDelete || events[1].ID != "2" || events[1].After != nil {
+		t.Errorf("Expected a delete for the expired key, got %+v", events[1])
+	}
+
+	for _, err := range Changes(ctx, repo, ResumeAfter("1")) {
+		if !IsErrorType(err, ErrorTypeUnsupported) {
+			t.Errorf("Expected resuming to be unsupported, got %v", err)
+		}
+	}
+}
+
+// changeStreamProvider is a DocumentProvider whose Watch returns a fixed change stream
+type changeStreamProvider struct {
+	DocumentProvider
+	request *DocumentChangeRequest
+	changes []documentChange[memoryItem]
+}
+
+func (p *changeStreamProvider) Watch(ctx context.Context, collection string, pipeline interface{}) (interface{}, error) {
+	p.request = pipeline.(*DocumentChangeRequest)
+	return &changeCursor{changes: p.changes}, nil
+}
+
+// changeCursor is a DocumentChangeCursor over decoded changes
+type changeCursor struct {
+	changes []documentChange[memoryItem]
+	current documentChange[memoryItem]
+	closed  bool
+}
+
+func (c *changeCursor) Next(ctx context.Context) bool {
+	if len(c.changes) == 0 {
+		return false
+	}
+	c.current, c.changes = c.changes[0], c.changes[1:]
+	return true
+}
+
+func (c *changeCursor) Decode(val interface{}) error {
+	*val.(*documentChange[memoryItem]) = c.current
+	return nil
+}
+
+func (c *changeCursor) Err() error { return nil }
+
+func (c *changeCursor) Close(ctx context.Context) error {
+	c.closed = true
+	return nil
+}
+
+func TestDocumentChangeRepository(t *testing.T) {
+	change := func(token, op string, id int, after *memoryItem) documentChange[memoryItem] {
+		var c documentChange[memoryItem]
+		c.ID.Data, c.OperationType, c.DocumentKey.ID, c.FullDocument = token, op, id, after
+		return c
+	}
+	provider := &changeStreamProvider{changes: []documentChange[memoryItem]{
+		change("a1", "insert", 1, &memoryItem{ID: 1, Name: "pen"}),
+		change("a2", "replace", 1, &memoryItem{ID: 1, Name: "pencil"}),
+		change("a3", "delete", 1, nil),
+		change("a4", "invalidate", 0, nil),
+	}}
+	repo := NewDocumentChangeRepository[memoryItem](NewMemoryRepository[memoryItem](), provider, "items")
+
+	var events []ChangeEvent[memoryItem]
+	var streamErr error
+	for event, err := range Changes(context.Background(), repo, ResumeAfter("a0"), OnlyChanges(ChangeUpdate, ChangeDelete, ChangeInsert)) {
+		if err != nil {
+			streamErr = err
+			break
+		}
+		events = append(events, event)
+	}
+	if len(events) != 3 || events[0].Op != ChangeInsert || events[1].Op != ChangeUpdate || events[1].After.Name != "pencil" ||
+		events[2].Op != ChangeDelete || events[2].ID != 1 || events[2].ResumeToken != "a3" {
+		t.Errorf("Unexpected events: %+v", events)
+	}
+	if !IsErrorType(streamErr, ErrorTypeNotFound) {
+		t.Errorf("Expected the stream to end when invalidated, got %v", streamErr)
+	}
+	if provider.request.ResumeAfter["_data"] != "a0" || provider.request.FullDocument != "updateLookup" {
+		t.Errorf("Unexpected change stream request: %+v", provider.request)
+	}
+	match := provider.request.Pipeline[0]["$match"].(map[string]interface{})["operationType"].(map[string]interface{})["$in"].([]interface{})
+	if fmt.Sprint(match) != "[invalidate update replace delete insert]" {
+		t.Errorf("Expected operations pushed down, got %v", match)
+	}
+}
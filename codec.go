@@ -0,0 +1,453 @@
+package gpa
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// =====================================
+// Codecs
+// =====================================
+
+// Codec serializes values stored in key-value providers
+type Codec interface {
+	// Name identifies the codec in errors, e.g. "json"
+	Name() string
+	// ID is written in the envelope header so values can be decoded after the codec changes
+	ID() byte
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Codec IDs of the built-in and adapter codecs. IDs from 128 up are free for applications.
+const (
+	CodecIDJSON     byte = 1
+	CodecIDGob      byte = 2
+	CodecIDMsgpack  byte = 3
+	CodecIDProtobuf byte = 4
+)
+
+// JSONCodec encodes values with encoding/json
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string                               { return "json" }
+func (JSONCodec) ID() byte                                   { return CodecIDJSON }
+func (JSONCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// GobCodec encodes values with encoding/gob. Interface-typed fields need gob.Register.
+type GobCodec struct{}
+
+func (GobCodec) Name() string { return "gob" }
+func (GobCodec) ID() byte     { return CodecIDGob }
+
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// ProtoMessage is implemented by generated protobuf messages with Marshal/Unmarshal
+// methods (gogo/protobuf, vtprotobuf)
+type ProtoMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+// ProtobufCodec encodes values that implement ProtoMessage. For google.golang.org/protobuf
+// messages, use NewFuncCodec with proto.Marshal and proto.Unmarshal instead.
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) Name() string { return "protobuf" }
+func (ProtobufCodec) ID() byte     { return CodecIDProtobuf }
+
+func (ProtobufCodec) Marshal(v interface{}) ([]byte, error) {
+	message, ok := v.(ProtoMessage)
+	if !ok {
+		return nil, NewError(ErrorTypeSerialization, fmt.Sprintf("%T does not implement ProtoMessage", v))
+	}
+	return message.Marshal()
+}
+
+func (ProtobufCodec) Unmarshal(data []byte, v interface{}) error {
+	message, ok := v.(ProtoMessage)
+	if !ok {
+		return NewError(ErrorTypeSerialization, fmt.Sprintf("%T does not implement ProtoMessage", v))
+	}
+	return message.Unmarshal(data)
+}
+
+// funcCodec adapts a pair of functions to Codec
+type funcCodec struct {
+	name      string
+	id        byte
+	marshal   func(v interface{}) ([]byte, error)
+	unmarshal func(data []byte, v interface{}) error
+}
+
+func (c funcCodec) Name() string                               { return c.name }
+func (c funcCodec) ID() byte                                   { return c.id }
+func (c funcCodec) Marshal(v interface{}) ([]byte, error)      { return c.marshal(v) }
+func (c funcCodec) Unmarshal(data []byte, v interface{}) error { return c.unmarshal(data, v) }
+
+// NewFuncCodec builds a codec from marshal and unmarshal functions of a third-party library
+// Example: codec := gpa.NewFuncCodec("cbor", 130, cbor.Marshal, cbor.Unmarshal)
+func NewFuncCodec(name string, id byte, marshal func(v interface{}) ([]byte, error), unmarshal func(data []byte, v interface{}) error) Codec {
+	return funcCodec{name: name, id: id, marshal: marshal, unmarshal: unmarshal}
+}
+
+// MsgpackCodec builds the msgpack codec from a msgpack library's functions
+// Example: codec := gpa.MsgpackCodec(msgpack.Marshal, msgpack.Unmarshal)
+func MsgpackCodec(marshal func(v interface{}) ([]byte, error), unmarshal func(data []byte, v interface{}) error) Codec {
+	return NewFuncCodec("msgpack", CodecIDMsgpack, marshal, unmarshal)
+}
+
+// =====================================
+// Compression
+// =====================================
+
+// Compressor compresses encoded values
+type Compressor interface {
+	Name() string
+	// ID is written in the envelope header; 0 means uncompressed
+	ID() byte
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// Compressor IDs. zstd is reserved for NewFuncCompressor, as it is not in the standard library.
+const (
+	CompressionNone byte = 0
+	CompressionGzip byte = 1
+	CompressionZstd byte = 2
+)
+
+// GzipCompressor compresses with compress/gzip at the given level; 0 uses the default level
+type GzipCompressor struct {
+	Level int
+}
+
+func (GzipCompressor) Name() string { return "gzip" }
+func (GzipCompressor) ID() byte     { return CompressionGzip }
+
+func (c GzipCompressor) Compress(data []byte) ([]byte, error) {
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// funcCompressor adapts a pair of functions to Compressor
+type funcCompressor struct {
+	name       string
+	id         byte
+	compress   func([]byte) ([]byte, error)
+	decompress func([]byte) ([]byte, error)
+}
+
+func (c funcCompressor) Name() string                           { return c.name }
+func (c funcCompressor) ID() byte                               { return c.id }
+func (c funcCompressor) Compress(data []byte) ([]byte, error)   { return c.compress(data) }
+func (c funcCompressor) Decompress(data []byte) ([]byte, error) { return c.decompress(data) }
+
+// NewFuncCompressor builds a compressor from a third-party library's functions
+// Example: zstd := gpa.NewFuncCompressor("zstd", gpa.CompressionZstd, encodeAll, decodeAll)
+func NewFuncCompressor(name string, id byte, compress, decompress func([]byte) ([]byte, error)) Compressor {
+	return funcCompressor{name: name, id: id, compress: compress, decompress: decompress}
+}
+
+// =====================================
+// Registry and Envelope
+// =====================================
+
+var codecRegistry = struct {
+	sync.RWMutex
+	codecs      map[byte]Codec
+	compressors map[byte]Compressor
+}{
+	codecs:      map[byte]Codec{CodecIDJSON: JSONCodec{}, CodecIDGob: GobCodec{}, CodecIDProtobuf: ProtobufCodec{}},
+	compressors: map[byte]Compressor{CompressionGzip: GzipCompressor{}},
+}
+
+// RegisterCodec makes codec available for decoding values written with its ID,
+// replacing any codec registered with the same ID
+func RegisterCodec(codec Codec) {
+	codecRegistry.Lock()
+	defer codecRegistry.Unlock()
+	codecRegistry.codecs[codec.ID()] = codec
+}
+
+// RegisterCompressor makes compressor available for decoding values written with its ID
+func RegisterCompressor(compressor Compressor) {
+	codecRegistry.Lock()
+	defer codecRegistry.Unlock()
+	codecRegistry.compressors[compressor.ID()] = compressor
+}
+
+// envelopeVersion marks encoded values. It is not a valid first byte of UTF-8 text,
+// so values stored as plain JSON before envelopes existed are told apart.
+const envelopeVersion byte = 0xC1
+
+// EncodeValue encodes v with codec and optional compressor, prefixed by a three byte
+// header: the envelope version, the codec ID and the compressor ID.
+// Example: data, err := gpa.EncodeValue(gpa.JSONCodec{}, nil, user)
+func EncodeValue(codec Codec, compressor Compressor, v interface{}) ([]byte, error) {
+	payload, err := codec.Marshal(v)
+	if err != nil {
+		return nil, NewErrorWithCause(ErrorTypeSerialization, fmt.Sprintf("%s encoding failed", codec.Name()), err)
+	}
+	compression := CompressionNone
+	if compressor != nil {
+		compression = compressor.ID()
+		if payload, err = compressor.Compress(payload); err != nil {
+			return nil, NewErrorWithCause(ErrorTypeSerialization, fmt.Sprintf("%s compression failed", compressor.Name()), err)
+		}
+	}
+	return append([]byte{envelopeVersion, codec.ID(), compression}, payload...), nil
+}
+
+// DecodeValue decodes data written by EncodeValue into v. The codec and compressor are
+// chosen by the header; known are preferred over the registry. Data without a header is
+// decoded as JSON.
+// Example: err := gpa.DecodeValue(data, &user)
+func DecodeValue(data []byte, v interface{}, known ...interface{}) error {
+	if len(data) < 3 || data[0] != envelopeVersion {
+		if err := json.Unmarshal(data, v); err != nil {
+			return NewErrorWithCause(ErrorTypeSerialization, "value has no codec header and is not JSON", err)
+		}
+		return nil
+	}
+
+	codecID, compressionID, payload := data[1], data[2], data[3:]
+	codec, compressor := lookupCodec(codecID, compressionID, known)
+	if codec == nil {
+		return NewError(ErrorTypeSerialization, fmt.Sprintf("unknown codec %d", codecID))
+	}
+	if compressionID != CompressionNone {
+		if compressor == nil {
+			return NewError(ErrorTypeSerialization, fmt.Sprintf("unknown compressor %d", compressionID))
+		}
+		var err error
+		if payload, err = compressor.Decompress(payload); err != nil {
+			return NewErrorWithCause(ErrorTypeSerialization, fmt.Sprintf("%s decompression failed", compressor.Name()), err)
+		}
+	}
+	if err := codec.Unmarshal(payload, v); err != nil {
+		return NewErrorWithCause(ErrorTypeSerialization, fmt.Sprintf("%s decoding failed", codec.Name()), err)
+	}
+	return nil
+}
+
+// lookupCodec finds the codec and compressor for the given IDs among known, then in the registry
+func lookupCodec(codecID, compressionID byte, known []interface{}) (Codec, Compressor) {
+	var codec Codec
+	var compressor Compressor
+	for _, k := range known {
+		if c, ok := k.(Codec); ok && c.ID() == codecID && codec == nil {
+			codec = c
+		}
+		if c, ok := k.(Compressor); ok && c.ID() == compressionID && compressor == nil {
+			compressor = c
+		}
+	}
+	codecRegistry.RLock()
+	defer codecRegistry.RUnlock()
+	if codec == nil {
+		codec = codecRegistry.codecs[codecID]
+	}
+	if compressor == nil {
+		compressor = codecRegistry.compressors[compressionID]
+	}
+	return codec, compressor
+}
+
+// =====================================
+// Typed Key-Value Access
+// =====================================
+
+// KVStore stores values of type T in a KeyValueProvider using a codec and optional compressor.
+// NewKeyValueRepository offers the same storage as a TTLKeyValueRepository.
+type KVStore[T any] struct {
+	kv         KeyValueProvider
+	codec      Codec
+	compressor Compressor
+}
+
+// NewKVStore returns a typed store over kv. A nil codec uses JSON; a nil compressor disables compression.
+// Example: sessions := gpa.NewKVStore[Session](redis, gpa.GobCodec{}, gpa.GzipCompressor{})
+func NewKVStore[T any](kv KeyValueProvider, codec Codec, compressor Compressor) *KVStore[T] {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+	return &KVStore[T]{kv: kv, codec: codec, compressor: compressor}
+}
+
+// Set encodes value and stores it under key; a zero ttl means no expiration
+func (s *KVStore[T]) Set(ctx context.Context, key string, value *T, ttl time.Duration) error {
+	data, err := EncodeValue(s.codec, s.compressor, value)
+	if err != nil {
+		return err
+	}
+	return s.kv.Set(ctx, key, data, ttl)
+}
+
+// Get loads and decodes the value under key. Values written with another codec are
+// decoded by their header, so a store can switch codecs without migrating data first.
+func (s *KVStore[T]) Get(ctx context.Context, key string) (*T, error) {
+	raw, err := s.kv.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return decodeStored[T](raw, s.codec, s.compressor)
+}
+
+// Delete removes key
+func (s *KVStore[T]) Delete(ctx context.Context, key string) error {
+	return s.kv.Delete(ctx, key)
+}
+
+// Exists reports whether key is set
+func (s *KVStore[T]) Exists(ctx context.Context, key string) (bool, error) {
+	return s.kv.Exists(ctx, key)
+}
+
+// kvRepository adds codec-encoded key-value operations to a repository
+type kvRepository[T any] struct {
+	Repository[T]
+	store *KVStore[T]
+}
+
+// NewKeyValueRepository returns repo with the operations of TTLKeyValueRepository,
+// storing values in kv with codec and compressor as KVStore does. A nil codec uses
+// JSON; a nil compressor disables compression.
+// Example: sessions := gpa.NewKeyValueRepository[Session](repo, redis, gpa.GobCodec{}, nil)
+func NewKeyValueRepository[T any](repo Repository[T], kv KeyValueProvider, codec Codec, compressor Compressor) TTLKeyValueRepository[T] {
+	return &kvRepository[T]{Repository: repo, store: NewKVStore[T](kv, codec, compressor)}
+}
+
+// Set implements BasicKeyValueRepository; the value does not expire
+func (r *kvRepository[T]) Set(ctx context.Context, key string, value *T) error {
+	return r.store.Set(ctx, key, value, 0)
+}
+
+// Get implements BasicKeyValueRepository
+func (r *kvRepository[T]) Get(ctx context.Context, key string) (*T, error) {
+	return r.store.Get(ctx, key)
+}
+
+// DeleteKey implements BasicKeyValueRepository
+func (r *kvRepository[T]) DeleteKey(ctx context.Context, key string) error {
+	exists, err := r.store.kv.Exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return NewError(ErrorTypeNotFound, fmt.Sprintf("key %q not found", key)).WithEntity(entityName[T]())
+	}
+	return r.store.Delete(ctx, key)
+}
+
+// KeyExists implements BasicKeyValueRepository
+func (r *kvRepository[T]) KeyExists(ctx context.Context, key string) (bool, error) {
+	return r.store.Exists(ctx, key)
+}
+
+// SetWithTTL implements TTLKeyValueRepository
+func (r *kvRepository[T]) SetWithTTL(ctx context.Context, key string, value *T, ttl time.Duration) error {
+	return r.store.Set(ctx, key, value, ttl)
+}
+
+// GetTTL implements TTLKeyValueRepository
+func (r *kvRepository[T]) GetTTL(ctx context.Context, key string) (time.Duration, error) {
+	return r.store.kv.TTL(ctx, key)
+}
+
+// SetTTL implements TTLKeyValueRepository
+func (r *kvRepository[T]) SetTTL(ctx context.Context, key string, ttl time.Duration) error {
+	return r.store.kv.Expire(ctx, key, ttl)
+}
+
+// RemoveTTL implements TTLKeyValueRepository by storing the value again without a TTL,
+// since KeyValueProvider has no operation to persist a key
+func (r *kvRepository[T]) RemoveTTL(ctx context.Context, key string) error {
+	raw, err := r.store.kv.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	return r.store.kv.Set(ctx, key, raw, 0)
+}
+
+// decodeStored converts a value returned by KeyValueProvider.Get to *T. Byte and string
+// values are decoded; values the provider already decoded are converted.
+func decodeStored[T any](raw interface{}, known ...interface{}) (*T, error) {
+	var result T
+	switch v := raw.(type) {
+	case nil:
+		return nil, NewError(ErrorTypeNotFound, "key has no value").WithEntity(entityName[T]())
+	case []byte:
+		return &result, DecodeValue(v, &result, known...)
+	case string:
+		return &result, DecodeValue([]byte(v), &result, known...)
+	case T:
+		return &v, nil
+	case *T:
+		return v, nil
+	}
+
+	// Providers that decode values themselves return maps and other plain values
+	data, err := json.Marshal(raw)
+	if err == nil {
+		err = json.Unmarshal(data, &result)
+	}
+	if err != nil {
+		return nil, NewErrorWithCause(ErrorTypeSerialization, fmt.Sprintf("cannot convert %s to %s", reflect.TypeOf(raw), entityName[T]()), err)
+	}
+	return &result, nil
+}
+
+// GetAs loads the value under key from any KeyValueProvider as a T
+// Example: user, err := gpa.GetAs[User](ctx, kv, "user:1")
+func GetAs[T any](ctx context.Context, kv KeyValueProvider, key string) (*T, error) {
+	return NewKVStore[T](kv, nil, nil).Get(ctx, key)
+}
+
+// SetAs stores value under key in any KeyValueProvider, JSON encoded with a codec header
+// Example: err := gpa.SetAs(ctx, kv, "user:1", &user, time.Hour)
+func SetAs[T any](ctx context.Context, kv KeyValueProvider, key string, value *T, ttl time.Duration) error {
+	return NewKVStore[T](kv, nil, nil).Set(ctx, key, value, ttl)
+}
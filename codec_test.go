@@ -0,0 +1,161 @@
+package gpa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+type codecSession struct {
+	User  string
+	Roles []string
+}
+
+// protoSession implements ProtoMessage with a trivial wire format
+type protoSession struct {
+	User string
+}
+
+func (p *protoSession) Marshal() ([]byte, error) { return []byte("user=" + p.User), nil }
+func (p *protoSession) Unmarshal(data []byte) error {
+	p.User = strings.TrimPrefix(string(data), "user=")
+	return nil
+}
+
+func newCodecKV() *tracingKVProvider {
+	return &tracingKVProvider{mockProvider: newMockProvider("redis"), values: map[string]interface{}{}}
+}
+
+func TestEncodeValue_RoundTrip(t *testing.T) {
+	session := codecSession{User: "ada", Roles: []string{strings.Repeat("admin", 50)}}
+	custom := NewFuncCodec("custom-json", 200,
+		func(v interface{}) ([]byte, error) { return json.Marshal(v) },
+		func(data []byte, v interface{}) error { return json.Unmarshal(data, v) })
+
+	for _, codec := range []Codec{JSONCodec{}, GobCodec{}, custom} {
+		for _, compressor := range []Compressor{nil, GzipCompressor{}} {
+			data, err := EncodeValue(codec, compressor, &session)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", codec.Name(), err)
+			}
+			if data[0] != envelopeVersion || data[1] != codec.ID() {
+				t.Errorf("%s: unexpected header %v", codec.Name(), data[:3])
+			}
+
+			var decoded codecSession
+			if err := DecodeValue(data, &decoded, codec); err != nil || decoded.User != "ada" || decoded.Roles[0] != session.Roles[0] {
+				t.Errorf("%s/%v: expected round trip, got %+v (%v)", codec.Name(), compressor, decoded, err)
+			}
+		}
+	}
+
+	plain, _ := EncodeValue(JSONCodec{}, nil, &session)
+	gzipped, _ := EncodeValue(JSONCodec{}, GzipCompressor{}, &session)
+	if len(gzipped) >= len(plain) || gzipped[2] != CompressionGzip {
+		t.Errorf("Expected smaller gzip payload, got %d >= %d bytes", len(gzipped), len(plain))
+	}
+
+	unregistered, _ := EncodeValue(custom, nil, &session)
+	if err := DecodeValue(unregistered, &codecSession{}); !IsErrorType(err, ErrorTypeSerialization) {
+		t.Errorf("Expected unknown codec error for unregistered codec, got %v", err)
+	}
+}
+
+func TestDecodeValue_LegacyJSON(t *testing.T) {
+	var decoded codecSession
+	if err := DecodeValue([]byte(`{"User":"bob"}`), &decoded); err != nil || decoded.User != "bob" {
+		t.Errorf("Expected headerless JSON to decode, got %+v (%v)", decoded, err)
+	}
+	if err := DecodeValue([]byte("not json"), &decoded); !IsErrorType(err, ErrorTypeSerialization) {
+		t.Errorf("Expected serialization error, got %v", err)
+	}
+}
+
+func TestProtobufCodec(t *testing.T) {
+	data, err := EncodeValue(ProtobufCodec{}, nil, &protoSession{User: "cy"})
+	if err != nil || !bytes.HasSuffix(data, []byte("user=cy")) {
+		t.Fatalf("Unexpected encoding %q (%v)", data, err)
+	}
+	var decoded protoSession
+	if err := DecodeValue(data, &decoded); err != nil || decoded.User != "cy" {
+		t.Errorf("Expected registered protobuf codec to decode, got %+v (%v)", decoded, err)
+	}
+	if _, err := EncodeValue(ProtobufCodec{}, nil, codecSession{}); !IsErrorType(err, ErrorTypeSerialization) {
+		t.Errorf("Expected error for non-proto value, got %v", err)
+	}
+}
+
+func TestKVStore_CodecMigration(t *testing.T) {
+	kv := newCodecKV()
+	ctx := context.Background()
+
+	if err := SetAs(ctx, kv, "s:1", &codecSession{User: "ada"}, 0); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	gobStore := NewKVStore[codecSession](kv, GobCodec{}, GzipCompressor{})
+	old, err := gobStore.Get(ctx, "s:1")
+	if err != nil || old.User != "ada" {
+		t.Fatalf("Expected gob store to read JSON value, got %v (%v)", old, err)
+	}
+
+	gobStore.Set(ctx, "s:1", old, 0)
+	if raw := kv.values["s:1"].([]byte); raw[1] != CodecIDGob || raw[2] != CompressionGzip {
+		t.Errorf("Expected value rewritten with gob and gzip, got header %v", raw[:3])
+	}
+	migrated, err := GetAs[codecSession](ctx, kv, "s:1")
+	if err != nil || migrated.User != "ada" {
+		t.Errorf("Expected GetAs to read gob value, got %v (%v)", migrated, err)
+	}
+
+	kv.values["legacy"] = `{"User":"bob"}`
+	kv.values["decoded"] = map[string]interface{}{"User": "cy"}
+	for key, user := range map[string]string{"legacy": "bob", "decoded": "cy"} {
+		if got, err := GetAs[codecSession](ctx, kv, key); err != nil || got.User != user {
+			t.Errorf("%s: expected %s, got %v (%v)", key, user, got, err)
+		}
+	}
+	if _, err := GetAs[codecSession](ctx, kv, "missing"); !IsNotFound(err) {
+		t.Errorf("Expected not found, got %v", err)
+	}
+}
+
+func TestKeyValueRepository(t *testing.T) {
+	provider := NewMemoryProvider()
+	repo := NewKeyValueRepository[codecSession](NewMemoryRepository[codecSession](), provider, GobCodec{}, nil)
+	ctx := context.Background()
+
+	if err := repo.SetWithTTL(ctx, "s:1", &codecSession{User: "ada"}, time.Minute); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if raw, _ := provider.Get(ctx, "s:1"); raw.([]byte)[1] != CodecIDGob {
+		t.Errorf("Expected the value encoded with the codec, got %v", raw)
+	}
+	if session, err := repo.Get(ctx, "s:1"); err != nil || session.User != "ada" {
+		t.Errorf("Expected the stored session, got %v (%v)", session, err)
+	}
+	if ttl, _ := repo.GetTTL(ctx, "s:1"); ttl <= 0 {
+		t.Errorf("Expected a TTL, got %v", ttl)
+	}
+	if err := repo.RemoveTTL(ctx, "s:1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ttl, _ := repo.GetTTL(ctx, "s:1"); ttl != 0 {
+		t.Errorf("Expected no TTL, got %v", ttl)
+	}
+	if session, err := repo.Get(ctx, "s:1"); err != nil || session.User != "ada" {
+		t.Errorf("Expected the value kept when removing the TTL, got %v (%v)", session, err)
+	}
+
+	if err := repo.DeleteKey(ctx, "s:1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if exists, _ := repo.KeyExists(ctx, "s:1"); exists {
+		t.Error("Expected the key to be deleted")
+	}
+	if err := repo.DeleteKey(ctx, "s:1"); !IsNotFound(err) {
+		t.Errorf("Expected not found deleting a missing key, got %v", err)
+	}
+}
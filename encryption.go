@@ -0,0 +1,741 @@
+package gpa
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// =====================================
+// Key Management
+// =====================================
+
+// KeyProvider supplies the AES keys used for field encryption.
+// Keys are identified by an id that is stored with every ciphertext, so old
+// values stay readable after the current key is rotated.
+type KeyProvider interface {
+	// CurrentKey returns the key used to encrypt new values.
+	CurrentKey(ctx context.Context) (keyID string, key []byte, err error)
+
+	// Key returns the key with the given id, for decryption. Unknown ids are not reported
+	// as ErrorTypeNotFound, which callers would take for a missing entity.
+	Key(ctx context.Context, keyID string) ([]byte, error)
+
+	// KeyIDs returns the ids of all keys that may have encrypted stored values.
+	// Used to match deterministic ciphertexts written under rotated keys.
+	KeyIDs(ctx context.Context) ([]string, error)
+}
+
+// KeyRing is an in-memory KeyProvider holding a current key and any number of previous keys
+type KeyRing struct {
+	mutex   sync.RWMutex
+	current string
+	keys    map[string][]byte
+}
+
+// NewKeyRing creates a key ring whose current key is key.
+// Keys must be 16, 24 or 32 bytes long (AES-128, AES-192 or AES-256).
+// Example: keys, err := gpa.NewKeyRing("2024-01", key)
+func NewKeyRing(keyID string, key []byte) (*KeyRing, error) {
+	ring := &KeyRing{keys: make(map[string][]byte)}
+	if err := ring.Rotate(keyID, key); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+// Add adds a previous key, used only for decryption and deterministic lookups
+func (k *KeyRing) Add(keyID string, key []byte) error {
+	if err := validateKey(keyID, key); err != nil {
+		return err
+	}
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.keys[keyID] = append([]byte(nil), key...)
+	return nil
+}
+
+// Rotate adds key and makes it the current key. Previous keys remain available for decryption.
+func (k *KeyRing) Rotate(keyID string, key []byte) error {
+	if err := k.Add(keyID, key); err != nil {
+		return err
+	}
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.current = keyID
+	return nil
+}
+
+// CurrentKey implements KeyProvider
+func (k *KeyRing) CurrentKey(ctx context.Context) (string, []byte, error) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	return k.current, k.keys[k.current], nil
+}
+
+// Key implements KeyProvider
+func (k *KeyRing) Key(ctx context.Context, keyID string) ([]byte, error) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, NewError(ErrorTypeInternal, fmt.Sprintf("unknown encryption key %q", keyID))
+	}
+	return key, nil
+}
+
+// KeyIDs implements KeyProvider. The current key comes first.
+func (k *KeyRing) KeyIDs(ctx context.Context) ([]string, error) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		if id != k.current {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return append([]string{k.current}, ids...), nil
+}
+
+func validateKey(keyID string, key []byte) error {
+	if keyID == "" || strings.Contains(keyID, ":") {
+		return NewError(ErrorTypeInvalidArgument, fmt.Sprintf("invalid key id %q: must be non-empty and contain no ':'", keyID))
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return nil
+	}
+	return NewError(ErrorTypeInvalidArgument, fmt.Sprintf("invalid key length %d: must be 16, 24 or 32 bytes", len(key)))
+}
+
+// =====================================
+// Field Encryption
+// =====================================
+
+// EncryptedPrefix starts every value written by FieldEncryptor: "enc:v1:<key id>:<base64 nonce+ciphertext>"
+const EncryptedPrefix = "enc:v1:"
+
+// FieldEncryptor encrypts and decrypts entity fields tagged `gpa:"encrypt"` with AES-GCM.
+// Tag a field `gpa:"encrypt,deterministic"` to derive the nonce from the value, so equal
+// values produce equal ciphertexts and can be matched with equality conditions.
+// Deterministic encryption reveals which rows share a value; use it only for lookup fields.
+//
+// Encrypted fields must be string, *string or []byte. Empty values are stored as-is,
+// and stored values without EncryptedPrefix are read as plaintext, so existing data can
+// be encrypted gradually.
+type FieldEncryptor struct {
+	keys KeyProvider
+}
+
+// NewFieldEncryptor creates an encryptor using keys
+func NewFieldEncryptor(keys KeyProvider) *FieldEncryptor {
+	return &FieldEncryptor{keys: keys}
+}
+
+// Encrypt encrypts plaintext under the current key. field is authenticated with the
+// ciphertext, so a value cannot be copied into another field and still decrypt.
+func (e *FieldEncryptor) Encrypt(ctx context.Context, field string, plaintext []byte, deterministic bool) (string, error) {
+	keyID, key, err := e.keys.CurrentKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	return encryptWithKey(keyID, key, field, plaintext, deterministic)
+}
+
+// Decrypt decrypts a value produced by Encrypt. Values without EncryptedPrefix are returned unchanged.
+func (e *FieldEncryptor) Decrypt(ctx context.Context, field string, value string) ([]byte, error) {
+	rest, ok := strings.CutPrefix(value, EncryptedPrefix)
+	if !ok {
+		return []byte(value), nil
+	}
+	keyID, encoded, ok := strings.Cut(rest, ":")
+	if !ok {
+		return nil, NewError(ErrorTypeSerialization, fmt.Sprintf("malformed encrypted value in field %s", field))
+	}
+	key, err := e.keys.Key(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, NewErrorWithCause(ErrorTypeSerialization, fmt.Sprintf("malformed encrypted value in field %s", field), err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, NewError(ErrorTypeSerialization, fmt.Sprintf("malformed encrypted value in field %s", field))
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(field))
+	if err != nil {
+		return nil, NewErrorWithCause(ErrorTypeSerialization, fmt.Sprintf("cannot decrypt field %s", field), err)
+	}
+	return plaintext, nil
+}
+
+// DeterministicCiphertexts returns the ciphertexts of plaintext under every key,
+// for matching values written before a key rotation.
+func (e *FieldEncryptor) DeterministicCiphertexts(ctx context.Context, field string, plaintext []byte) ([]string, error) {
+	ids, err := e.keys.KeyIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ciphertexts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		key, err := e.keys.Key(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		ciphertext, err := encryptWithKey(id, key, field, plaintext, true)
+		if err != nil {
+			return nil, err
+		}
+		ciphertexts = append(ciphertexts, ciphertext)
+	}
+	return ciphertexts, nil
+}
+
+// EncryptEntity encrypts the tagged fields of entity, a pointer to a struct, in place
+func (e *FieldEncryptor) EncryptEntity(ctx context.Context, entity interface{}) error {
+	value := indirectValue(reflect.ValueOf(entity))
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+	for _, field := range encryptedFieldsOf(value.Type()) {
+		fieldValue := value.FieldByIndex(field.index)
+		plaintext, ok, err := readEncryptable(fieldValue, field.name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		ciphertext, err := e.Encrypt(ctx, field.name, plaintext, field.deterministic)
+		if err != nil {
+			return err
+		}
+		writeEncryptable(fieldValue, []byte(ciphertext))
+	}
+	return nil
+}
+
+// DecryptEntity decrypts the tagged fields of entity, a pointer to a struct, in place
+func (e *FieldEncryptor) DecryptEntity(ctx context.Context, entity interface{}) error {
+	value := indirectValue(reflect.ValueOf(entity))
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+	for _, field := range encryptedFieldsOf(value.Type()) {
+		fieldValue := value.FieldByIndex(field.index)
+		stored, ok, err := readEncryptable(fieldValue, field.name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		plaintext, err := e.Decrypt(ctx, field.name, string(stored))
+		if err != nil {
+			return err
+		}
+		writeEncryptable(fieldValue, plaintext)
+	}
+	return nil
+}
+
+func encryptWithKey(keyID string, key []byte, field string, plaintext []byte, deterministic bool) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if deterministic {
+		// Synthetic nonce: equal (field, plaintext) pairs get equal nonces under the same key
+		nonceKey := hmac.New(sha256.New, key)
+		nonceKey.Write([]byte("gpa field encryption nonce"))
+		mac := hmac.New(sha256.New, nonceKey.Sum(nil))
+		mac.Write([]byte(field))
+		mac.Write([]byte{0})
+		mac.Write(plaintext)
+		copy(nonce, mac.Sum(nil))
+	} else if _, err := rand.Read(nonce); err != nil {
+		return "", NewErrorWithCause(ErrorTypeInternal, "cannot generate nonce", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(field))
+	return EncryptedPrefix + keyID + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, NewErrorWithCause(ErrorTypeInvalidArgument, "invalid encryption key", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, NewErrorWithCause(ErrorTypeInternal, "cannot create AES-GCM cipher", err)
+	}
+	return aead, nil
+}
+
+// encryptedField describes a struct field tagged `gpa:"encrypt"`
+type encryptedField struct {
+	index         []int
+	name          string
+	deterministic bool
+	sf            reflect.StructField
+}
+
+var encryptedFieldCache sync.Map // reflect.Type -> []encryptedField
+
+// encryptedFieldsOf returns the encrypted fields of a struct type, including promoted fields
+func encryptedFieldsOf(t reflect.Type) []encryptedField {
+	if cached, ok := encryptedFieldCache.Load(t); ok {
+		return cached.([]encryptedField)
+	}
+
+	var fields []encryptedField
+	for _, sf := range reflect.VisibleFields(t) {
+		if !sf.IsExported() || sf.Anonymous {
+			continue
+		}
+		options := strings.Split(sf.Tag.Get("gpa"), ",")
+		if options[0] != "encrypt" {
+			continue
+		}
+		field := encryptedField{index: sf.Index, name: sf.Name, sf: sf}
+		for _, option := range options[1:] {
+			if strings.TrimSpace(option) == "deterministic" {
+				field.deterministic = true
+			}
+		}
+		fields = append(fields, field)
+	}
+
+	encryptedFieldCache.Store(t, fields)
+	return fields
+}
+
+// readEncryptable returns the bytes of a string, *string or []byte field.
+// Returns false for empty values, which are never encrypted.
+func readEncryptable(value reflect.Value, name string) ([]byte, bool, error) {
+	switch {
+	case value.Kind() == reflect.String:
+		return []byte(value.String()), value.Len() > 0, nil
+	case value.Kind() == reflect.Ptr && value.Type().Elem().Kind() == reflect.String:
+		if value.IsNil() || value.Elem().Len() == 0 {
+			return nil, false, nil
+		}
+		return []byte(value.Elem().String()), true, nil
+	case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8:
+		return value.Bytes(), value.Len() > 0, nil
+	}
+	return nil, false, NewError(ErrorTypeInvalidArgument,
+		fmt.Sprintf(`field %s tagged gpa:"encrypt" must be a string, *string or []byte, got %s`, name, value.Type()))
+}
+
+// writeEncryptable stores data into a string, *string or []byte field
+func writeEncryptable(value reflect.Value, data []byte) {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(string(data))
+	case reflect.Ptr:
+		str := reflect.New(value.Type().Elem())
+		str.Elem().SetString(string(data))
+		value.Set(str)
+	case reflect.Slice:
+		value.SetBytes(append([]byte(nil), data...))
+	}
+}
+
+// =====================================
+// Encrypted Repository
+// =====================================
+
+// encryptedRepository encrypts tagged fields before writes and decrypts them after reads
+type encryptedRepository[T any] struct {
+	repo      Repository[T]
+	encryptor *FieldEncryptor
+}
+
+// NewEncryptedRepository wraps repo so that fields tagged `gpa:"encrypt"` are encrypted
+// before Create, CreateBatch, Update and UpdatePartial, and decrypted after every read.
+// Entities passed to writes keep their plaintext values. Equality conditions (=, !=, IN, NOT IN)
+// on deterministic fields are rewritten to match the ciphertexts under every key; any other
+// condition on an encrypted field fails with ErrorTypeInvalidArgument.
+// Example: repo = NewEncryptedRepository(repo, keyRing)
+func NewEncryptedRepository[T any](repo Repository[T], keys KeyProvider) Repository[T] {
+	return &encryptedRepository[T]{repo: repo, encryptor: NewFieldEncryptor(keys)}
+}
+
+// encryptCopy encrypts entity in place and returns a function restoring the plaintext fields.
+// Fields set by the provider, such as generated ids, are kept.
+func (r *encryptedRepository[T]) encryptCopy(ctx context.Context, entity *T) (func(), error) {
+	if entity == nil {
+		return func() {}, nil
+	}
+	original := *entity
+	restore := func() {
+		value := reflect.ValueOf(entity).Elem()
+		plain := reflect.ValueOf(&original).Elem()
+		for _, field := range encryptedFieldsOf(value.Type()) {
+			value.FieldByIndex(field.index).Set(plain.FieldByIndex(field.index))
+		}
+	}
+	if err := r.encryptor.EncryptEntity(ctx, entity); err != nil {
+		restore()
+		return nil, err
+	}
+	return restore, nil
+}
+
+func (r *encryptedRepository[T]) decrypt(ctx context.Context, entity *T) (*T, error) {
+	if entity == nil {
+		return nil, nil
+	}
+	if err := r.encryptor.DecryptEntity(ctx, entity); err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+func (r *encryptedRepository[T]) decryptAll(ctx context.Context, entities []*T) ([]*T, error) {
+	for _, entity := range entities {
+		if entity == nil {
+			continue
+		}
+		if err := r.encryptor.DecryptEntity(ctx, entity); err != nil {
+			return nil, err
+		}
+	}
+	return entities, nil
+}
+
+// rewriteOptions rewrites conditions on encrypted fields in opts
+func (r *encryptedRepository[T]) rewriteOptions(ctx context.Context, opts []QueryOption) ([]QueryOption, error) {
+	rewritten := make([]QueryOption, len(opts))
+	for i, opt := range opts {
+		switch o := opt.(type) {
+		case ConditionOption:
+			condition, err := r.rewriteCondition(ctx, o.Condition)
+			if err != nil {
+				return nil, err
+			}
+			rewritten[i] = ConditionOption{Condition: condition}
+		case CompositeConditionOption:
+			conditions, err := r.rewriteConditions(ctx, o.Conditions)
+			if err != nil {
+				return nil, err
+			}
+			rewritten[i] = CompositeConditionOption{Conditions: conditions, Logic: o.Logic}
+		default:
+			rewritten[i] = opt
+		}
+	}
+	return rewritten, nil
+}
+
+func (r *encryptedRepository[T]) rewriteConditions(ctx context.Context, conditions []Condition) ([]Condition, error) {
+	rewritten := make([]Condition, len(conditions))
+	for i, condition := range conditions {
+		c, err := r.rewriteCondition(ctx, condition)
+		if err != nil {
+			return nil, err
+		}
+		rewritten[i] = c
+	}
+	return rewritten, nil
+}
+
+// rewriteCondition replaces plaintext values in conditions on encrypted fields with ciphertexts
+func (r *encryptedRepository[T]) rewriteCondition(ctx context.Context, condition Condition) (Condition, error) {
+	switch c := condition.(type) {
+	case nil:
+		return nil, nil
+	case CompositeCondition:
+		conditions, err := r.rewriteConditions(ctx, c.Conditions)
+		if err != nil {
+			return nil, err
+		}
+		return CompositeCondition{Conditions: conditions, Logic: c.Logic}, nil
+	case SubQueryCondition:
+		return c, nil
+	}
+
+	field, ok := r.encryptedField(condition.Field())
+	if !ok {
+		return condition, nil
+	}
+
+	op := condition.Operator()
+	switch op {
+	case OpIsNull, OpIsNotNull, OpExists, OpNotExists:
+		return condition, nil
+	case OpEqual, OpNotEqual, OpIn, OpNotIn:
+		if !field.deterministic {
+			break
+		}
+		var plaintexts []interface{}
+		if op == OpIn || op == OpNotIn {
+			list := reflect.ValueOf(condition.Value())
+			if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+				return nil, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("%s expects a slice value", op))
+			}
+			for i := 0; i < list.Len(); i++ {
+				plaintexts = append(plaintexts, list.Index(i).Interface())
+			}
+		} else {
+			plaintexts = []interface{}{condition.Value()}
+		}
+
+		var ciphertexts []interface{}
+		for _, plaintext := range plaintexts {
+			text := fmt.Sprint(plaintext)
+			if b, ok := plaintext.([]byte); ok {
+				text = string(b)
+			}
+			if text == "" {
+				// Empty values are stored unencrypted
+				ciphertexts = append(ciphertexts, "")
+				continue
+			}
+			values, err := r.encryptor.DeterministicCiphertexts(ctx, field.name, []byte(text))
+			if err != nil {
+				return nil, err
+			}
+			for _, value := range values {
+				ciphertexts = append(ciphertexts, value)
+			}
+		}
+
+		rewrittenOp := OpIn
+		if op == OpNotEqual || op == OpNotIn {
+			rewrittenOp = OpNotIn
+		}
+		return BasicCondition{FieldName: condition.Field(), Op: rewrittenOp, Val: ciphertexts}, nil
+	}
+
+	reason := "only equality conditions on deterministic fields are supported"
+	if field.deterministic {
+		reason = "only =, !=, IN and NOT IN are supported"
+	}
+	return nil, NewError(ErrorTypeInvalidArgument,
+		fmt.Sprintf("cannot use %s on encrypted field %s: %s", op, condition.Field(), reason))
+}
+
+// encryptedField finds the encrypted field a condition or update key refers to
+func (r *encryptedRepository[T]) encryptedField(name string) (encryptedField, bool) {
+	for _, field := range encryptedFieldsOf(reflect.TypeOf((*T)(nil)).Elem()) {
+		if fieldMatchesName(field.sf, name) {
+			return field, true
+		}
+	}
+	return encryptedField{}, false
+}
+
+func (r *encryptedRepository[T]) Create(ctx context.Context, entity *T) error {
+	restore, err := r.encryptCopy(ctx, entity)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	return r.repo.Create(ctx, entity)
+}
+
+func (r *encryptedRepository[T]) CreateBatch(ctx context.Context, entities []*T) error {
+	restores := make([]func(), 0, len(entities))
+	defer func() {
+		for _, restore := range restores {
+			restore()
+		}
+	}()
+	for _, entity := range entities {
+		restore, err := r.encryptCopy(ctx, entity)
+		if err != nil {
+			return err
+		}
+		restores = append(restores, restore)
+	}
+	return r.repo.CreateBatch(ctx, entities)
+}
+
+func (r *encryptedRepository[T]) FindByID(ctx context.Context, id interface{}) (*T, error) {
+	entity, err := r.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return r.decrypt(ctx, entity)
+}
+
+func (r *encryptedRepository[T]) FindAll(ctx context.Context, opts ...QueryOption) ([]*T, error) {
+	rewritten, err := r.rewriteOptions(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	entities, err := r.repo.FindAll(ctx, rewritten...)
+	if err != nil {
+		return nil, err
+	}
+	return r.decryptAll(ctx, entities)
+}
+
+func (r *encryptedRepository[T]) Update(ctx context.Context, entity *T) error {
+	restore, err := r.encryptCopy(ctx, entity)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	return r.repo.Update(ctx, entity)
+}
+
+func (r *encryptedRepository[T]) UpdatePartial(ctx context.Context, id interface{}, updates map[string]interface{}) error {
+	encrypted := make(map[string]interface{}, len(updates))
+	for key, value := range updates {
+		encrypted[key] = value
+		field, ok := r.encryptedField(key)
+		if !ok || value == nil {
+			continue
+		}
+		plaintext, ok, err := readEncryptable(reflect.ValueOf(value), field.name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		ciphertext, err := r.encryptor.Encrypt(ctx, field.name, plaintext, field.deterministic)
+		if err != nil {
+			return err
+		}
+		if _, isBytes := value.([]byte); isBytes {
+			encrypted[key] = []byte(ciphertext)
+		} else {
+			encrypted[key] = ciphertext
+		}
+	}
+	return r.repo.UpdatePartial(ctx, id, encrypted)
+}
+
+func (r *encryptedRepository[T]) Delete(ctx context.Context, id interface{}) error {
+	return r.repo.Delete(ctx, id)
+}
+
+func (r *encryptedRepository[T]) DeleteByCondition(ctx context.Context, condition Condition) error {
+	rewritten, err := r.rewriteCondition(ctx, condition)
+	if err != nil {
+		return err
+	}
+	return r.repo.DeleteByCondition(ctx, rewritten)
+}
+
+func (r *encryptedRepository[T]) Query(ctx context.Context, opts ...QueryOption) ([]*T, error) {
+	rewritten, err := r.rewriteOptions(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	entities, err := r.repo.Query(ctx, rewritten...)
+	if err != nil {
+		return nil, err
+	}
+	return r.decryptAll(ctx, entities)
+}
+
+func (r *encryptedRepository[T]) QueryScored(ctx context.Context, opts ...QueryOption) ([]Scored[T], error) {
+	rewritten, err := r.rewriteOptions(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	results, err := QueryScored(ctx, r.repo, rewritten...)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		if _, err := r.decrypt(ctx, result.Entity); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+func (r *encryptedRepository[T]) QueryOne(ctx context.Context, opts ...QueryOption) (*T, error) {
+	rewritten, err := r.rewriteOptions(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	entity, err := r.repo.QueryOne(ctx, rewritten...)
+	if err != nil {
+		return nil, err
+	}
+	return r.decrypt(ctx, entity)
+}
+
+func (r *encryptedRepository[T]) Count(ctx context.Context, opts ...QueryOption) (int64, error) {
+	rewritten, err := r.rewriteOptions(ctx, opts)
+	if err != nil {
+		return 0, err
+	}
+	return r.repo.Count(ctx, rewritten...)
+}
+
+func (r *encryptedRepository[T]) Exists(ctx context.Context, opts ...QueryOption) (bool, error) {
+	rewritten, err := r.rewriteOptions(ctx, opts)
+	if err != nil {
+		return false, err
+	}
+	return r.repo.Exists(ctx, rewritten...)
+}
+
+func (r *encryptedRepository[T]) Transaction(ctx context.Context, fn TransactionFunc[T]) error {
+	return r.repo.Transaction(ctx, func(tx Transaction[T]) error {
+		return fn(&encryptedTransaction[T]{
+			encryptedRepository: encryptedRepository[T]{repo: tx, encryptor: r.encryptor},
+			tx:                  tx,
+		})
+	})
+}
+
+// RawQuery decrypts the returned entities; conditions in the query itself are not rewritten
+func (r *encryptedRepository[T]) RawQuery(ctx context.Context, query string, args []interface{}) ([]*T, error) {
+	entities, err := r.repo.RawQuery(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return r.decryptAll(ctx, entities)
+}
+
+func (r *encryptedRepository[T]) RawExec(ctx context.Context, query string, args []interface{}) (Result, error) {
+	return r.repo.RawExec(ctx, query, args)
+}
+
+func (r *encryptedRepository[T]) GetEntityInfo() (*EntityInfo, error) {
+	return r.repo.GetEntityInfo()
+}
+
+func (r *encryptedRepository[T]) Close() error {
+	return r.repo.Close()
+}
+
+// encryptedTransaction encrypts and decrypts inside a transaction
+type encryptedTransaction[T any] struct {
+	encryptedRepository[T]
+	tx Transaction[T]
+}
+
+func (t *encryptedTransaction[T]) Commit() error                  { return t.tx.Commit() }
+func (t *encryptedTransaction[T]) Rollback() error                { return t.tx.Rollback() }
+func (t *encryptedTransaction[T]) SetSavepoint(name string) error { return t.tx.SetSavepoint(name) }
+func (t *encryptedTransaction[T]) RollbackToSavepoint(name string) error {
+	return t.tx.RollbackToSavepoint(name)
+}
@@ -0,0 +1,234 @@
+package gpa
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+type encryptedCustomer struct {
+	ID     int     `json:"id"`
+	Name   string  `json:"name"`
+	Email  string  `json:"email" gpa:"encrypt,deterministic"`
+	SSN    *string `json:"ssn" gpa:"encrypt"`
+	Notes  []byte  `json:"notes" gpa:"encrypt"`
+	Phone  string  `json:"phone" gpa:"encrypt"`
+	Status string  `json:"status"`
+}
+
+// storingRepository copies entities on write and read, like a real provider
+type storingRepository[T any] struct {
+	*mockRepository[T]
+}
+
+func (s storingRepository[T]) Create(ctx context.Context, entity *T) error {
+	stored := *entity
+	return s.mockRepository.Create(ctx, &stored)
+}
+
+func (s storingRepository[T]) FindByID(ctx context.Context, id interface{}) (*T, error) {
+	entity, err := s.mockRepository.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	copied := *entity
+	return &copied, nil
+}
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func TestKeyRing(t *testing.T) {
+	if _, err := NewKeyRing("k1", []byte("short")); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected invalid key length error, got %v", err)
+	}
+	if _, err := NewKeyRing("bad:id", testKey(1)); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected invalid key id error, got %v", err)
+	}
+
+	ring, _ := NewKeyRing("k1", testKey(1))
+	ring.Rotate("k2", testKey(2))
+	ctx := context.Background()
+
+	current, _, _ := ring.CurrentKey(ctx)
+	if current != "k2" {
+		t.Errorf("Expected current key k2, got %s", current)
+	}
+	ids, _ := ring.KeyIDs(ctx)
+	if strings.Join(ids, ",") != "k2,k1" {
+		t.Errorf("Expected key ids [k2 k1], got %v", ids)
+	}
+	if _, err := ring.Key(ctx, "k3"); !IsErrorType(err, ErrorTypeInternal) || IsNotFound(err) {
+		t.Errorf("Expected an internal error for an unknown key, got %v", err)
+	}
+}
+
+func TestFieldEncryptor_RoundTrip(t *testing.T) {
+	ring, _ := NewKeyRing("k1", testKey(1))
+	encryptor := NewFieldEncryptor(ring)
+	ctx := context.Background()
+
+	ciphertext, err := encryptor.Encrypt(ctx, "Phone", []byte("555-0100"), false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(ciphertext, EncryptedPrefix+"k1:") {
+		t.Errorf("Expected key id prefix, got %s", ciphertext)
+	}
+
+	again, _ := encryptor.Encrypt(ctx, "Phone", []byte("555-0100"), false)
+	if again == ciphertext {
+		t.Error("Expected randomized encryption to produce different ciphertexts")
+	}
+
+	plaintext, err := encryptor.Decrypt(ctx, "Phone", ciphertext)
+	if err != nil || string(plaintext) != "555-0100" {
+		t.Errorf("Expected round trip, got %q (%v)", plaintext, err)
+	}
+
+	if _, err := encryptor.Decrypt(ctx, "Email", ciphertext); err == nil {
+		t.Error("Expected ciphertext to be bound to its field")
+	}
+
+	legacy, _ := encryptor.Decrypt(ctx, "Phone", "plain value")
+	if string(legacy) != "plain value" {
+		t.Errorf("Expected unprefixed values to pass through, got %q", legacy)
+	}
+}
+
+func TestFieldEncryptor_Deterministic(t *testing.T) {
+	ring, _ := NewKeyRing("k1", testKey(1))
+	encryptor := NewFieldEncryptor(ring)
+	ctx := context.Background()
+
+	a, _ := encryptor.Encrypt(ctx, "Email", []byte("ada@example.com"), true)
+	b, _ := encryptor.Encrypt(ctx, "Email", []byte("ada@example.com"), true)
+	if a != b {
+		t.Error("Expected deterministic encryption to be stable")
+	}
+	other, _ := encryptor.Encrypt(ctx, "Backup", []byte("ada@example.com"), true)
+	if other == a {
+		t.Error("Expected deterministic ciphertexts to differ per field")
+	}
+
+	ring.Rotate("k2", testKey(2))
+	all, _ := encryptor.DeterministicCiphertexts(ctx, "Email", []byte("ada@example.com"))
+	if len(all) != 2 || all[1] != a {
+		t.Errorf("Expected ciphertexts under both keys, got %v", all)
+	}
+}
+
+func TestFieldEncryptor_SkipsEmptyFields(t *testing.T) {
+	ring, _ := NewKeyRing("k1", testKey(1))
+	encryptor := NewFieldEncryptor(ring)
+	ctx := context.Background()
+	ssn := "123-45-6789"
+	customer := &encryptedCustomer{SSN: &ssn, Notes: []byte("vip"), Phone: "555-0100"}
+
+	if err := encryptor.EncryptEntity(ctx, customer); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if customer.Email != "" {
+		t.Errorf("Expected the empty field to stay empty, got %q", customer.Email)
+	}
+	if !strings.HasPrefix(*customer.SSN, EncryptedPrefix) || !strings.HasPrefix(string(customer.Notes), EncryptedPrefix) || !strings.HasPrefix(customer.Phone, EncryptedPrefix) {
+		t.Fatalf("Expected fields after an empty one to be encrypted, got %+v", customer)
+	}
+
+	if err := encryptor.DecryptEntity(ctx, customer); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if *customer.SSN != ssn || string(customer.Notes) != "vip" || customer.Phone != "555-0100" {
+		t.Errorf("Expected fields after an empty one to be decrypted, got %+v", customer)
+	}
+}
+
+func TestEncryptedRepository_CreateAndFind(t *testing.T) {
+	ring, _ := NewKeyRing("k1", testKey(1))
+	mock := &mockRepository[encryptedCustomer]{}
+	repo := NewEncryptedRepository[encryptedCustomer](storingRepository[encryptedCustomer]{mock}, ring)
+	ctx := context.Background()
+
+	ssn := "123-45-6789"
+	customer := &encryptedCustomer{ID: 1, Name: "Ada", Email: "ada@example.com", SSN: &ssn, Notes: []byte("vip")}
+	if err := repo.Create(ctx, customer); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if customer.Email != "ada@example.com" || *customer.SSN != ssn || string(customer.Notes) != "vip" {
+		t.Errorf("Expected caller's entity to keep plaintext, got %+v", customer)
+	}
+
+	stored := mock.items[0]
+	if !strings.HasPrefix(stored.Email, EncryptedPrefix) || !strings.HasPrefix(*stored.SSN, EncryptedPrefix) ||
+		!bytes.HasPrefix(stored.Notes, []byte(EncryptedPrefix)) {
+		t.Errorf("Expected stored fields to be encrypted, got %+v", stored)
+	}
+	if stored.Name != "Ada" || stored.Phone != "" {
+		t.Errorf("Expected untagged and empty fields to be stored as-is, got %+v", stored)
+	}
+
+	found, err := repo.FindByID(ctx, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if found.Email != "ada@example.com" || *found.SSN != ssn || string(found.Notes) != "vip" {
+		t.Errorf("Expected decrypted entity, got %+v", found)
+	}
+}
+
+func TestEncryptedRepository_RewritesConditions(t *testing.T) {
+	ring, _ := NewKeyRing("k1", testKey(1))
+	ring.Rotate("k2", testKey(2))
+	mock := &mockRepository[encryptedCustomer]{}
+	repo := NewEncryptedRepository[encryptedCustomer](mock, ring)
+	ctx := context.Background()
+
+	if _, err := repo.Query(ctx, Where("email", OpEqual, "ada@example.com"), Where("status", OpEqual, "active")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	query := NewQuery()
+	for _, opt := range mock.lastOpts {
+		opt.Apply(query)
+	}
+	email := query.Conditions[0]
+	values, ok := email.Value().([]interface{})
+	if email.Operator() != OpIn || !ok || len(values) != 2 {
+		t.Fatalf("Expected email condition rewritten to IN over both keys, got %s %v", email.Operator(), email.Value())
+	}
+	if !strings.HasPrefix(values[0].(string), EncryptedPrefix+"k2:") {
+		t.Errorf("Expected ciphertext under current key first, got %v", values[0])
+	}
+	if query.Conditions[1].Value() != "active" {
+		t.Error("Expected unencrypted field condition to be unchanged")
+	}
+
+	if _, err := repo.Count(ctx, Where("phone", OpEqual, "555")); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected equality on randomized field to be rejected, got %v", err)
+	}
+	if _, err := repo.Query(ctx, WhereLike("email", "ada%")); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected LIKE on encrypted field to be rejected, got %v", err)
+	}
+	if _, err := repo.Query(ctx, WhereNull("ssn")); err != nil {
+		t.Errorf("Expected null checks on encrypted fields to be allowed, got %v", err)
+	}
+}
+
+func TestEncryptedRepository_UpdatePartial(t *testing.T) {
+	ring, _ := NewKeyRing("k1", testKey(1))
+	mock := &mockRepository[encryptedCustomer]{}
+	repo := NewEncryptedRepository[encryptedCustomer](mock, ring)
+
+	updates := map[string]interface{}{"phone": "555-0199", "status": "active"}
+	if err := repo.UpdatePartial(context.Background(), 1, updates); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(mock.lastUpdates["phone"].(string), EncryptedPrefix) {
+		t.Errorf("Expected phone update to be encrypted, got %v", mock.lastUpdates["phone"])
+	}
+	if mock.lastUpdates["status"] != "active" || updates["phone"] != "555-0199" {
+		t.Error("Expected other updates and the caller's map to be unchanged")
+	}
+}
@@ -0,0 +1,532 @@
+package gpa
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// =====================================
+// Driver Error Translation
+// =====================================
+
+// ErrorTranslator converts a native driver error into a GPAError.
+// Returns false if the error is not one the translator understands.
+type ErrorTranslator func(err error) (GPAError, bool)
+
+type namedTranslator struct {
+	name       string
+	translator ErrorTranslator
+}
+
+var (
+	translatorMutex sync.RWMutex
+	// customTranslators are registered by providers and run before the built-in ones
+	customTranslators []namedTranslator
+	// builtinTranslators recognise common drivers without importing them
+	builtinTranslators = []namedTranslator{
+		{"sqlstate", translateSQLStateError},
+		{"mysql", translateMySQLError},
+		{"sqlite", translateSQLiteError},
+		{"mongo", translateMongoError},
+		{"redis", translateRedisError},
+	}
+)
+
+// RegisterErrorTranslator registers a translator under name.
+// Registering the same name again replaces the previous translator.
+// Translators run in registration order, before the built-in translators.
+// Example: gpa.RegisterErrorTranslator("postgres", translatePgError)
+func RegisterErrorTranslator(name string, translator ErrorTranslator) {
+	translatorMutex.Lock()
+	defer translatorMutex.Unlock()
+
+	for i, existing := range customTranslators {
+		if existing.name == name {
+			customTranslators[i].translator = translator
+			return
+		}
+	}
+	customTranslators = append(customTranslators, namedTranslator{name: name, translator: translator})
+}
+
+// UnregisterErrorTranslator removes a translator registered with RegisterErrorTranslator
+func UnregisterErrorTranslator(name string) {
+	translatorMutex.Lock()
+	defer translatorMutex.Unlock()
+
+	for i, existing := range customTranslators {
+		if existing.name == name {
+			customTranslators = append(customTranslators[:i], customTranslators[i+1:]...)
+			return
+		}
+	}
+}
+
+// TranslateError converts a native driver error into a GPAError using the registered translators.
+// Errors that already contain a GPAError, and errors no translator recognises, are returned unchanged.
+// The original error is kept as the Cause of the translated error. Unless the translator
+// sets one, the Message is a generic description of the error type: driver messages can
+// name constraints, quote SQL or hosts, and the Message is shown to clients by NewProblemDetails.
+func TranslateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := AsGPAError(err); ok {
+		return err
+	}
+
+	translatorMutex.RLock()
+	translators := make([]namedTranslator, 0, len(customTranslators)+len(builtinTranslators))
+	translators = append(translators, customTranslators...)
+	translators = append(translators, builtinTranslators...)
+	translatorMutex.RUnlock()
+
+	for _, t := range translators {
+		if gpaErr, ok := t.translator(err); ok {
+			if gpaErr.Cause == nil {
+				gpaErr.Cause = err
+			}
+			if gpaErr.Message == "" {
+				gpaErr.Message = translatedMessage(gpaErr.Type)
+			}
+			return gpaErr
+		}
+	}
+	return err
+}
+
+// AnnotateError translates err and records the operation and entity on the resulting GPAError.
+// Fields that are already set are left alone. Errors that can't be translated are
+// wrapped as ErrorTypeDatabase so the context is never lost.
+// Example: return gpa.AnnotateError(err, "Create", "users")
+func AnnotateError(err error, op, entity string) error {
+	if err == nil {
+		return nil
+	}
+	gpaErr, ok := AsGPAError(TranslateError(err))
+	if !ok {
+		gpaErr = NewErrorWithCause(ErrorTypeDatabase, translatedMessage(ErrorTypeDatabase), err)
+	}
+	if gpaErr.Op == "" {
+		gpaErr.Op = op
+	}
+	if gpaErr.Entity == "" {
+		gpaErr.Entity = entity
+	}
+	return gpaErr
+}
+
+// translatedMessages describe translated errors without driver details
+var translatedMessages = map[ErrorType]string{
+	ErrorTypeDuplicate:       "a record with the same key already exists",
+	ErrorTypeConstraint:      "the change violates a constraint",
+	ErrorTypeValidation:      "a required value is missing or invalid",
+	ErrorTypeTransaction:     "the transaction conflicted with another one",
+	ErrorTypeTimeout:         "the database did not respond in time",
+	ErrorTypeConnection:      "the database is unavailable",
+	ErrorTypePermission:      "the operation is not permitted",
+	ErrorTypeNotFound:        "not found",
+	ErrorTypeInvalidArgument: "a value is invalid",
+}
+
+// translatedMessage returns the message of a translated error of the given type
+func translatedMessage(errorType ErrorType) string {
+	if message, ok := translatedMessages[errorType]; ok {
+		return message
+	}
+	return "database error"
+}
+
+// =====================================
+// Code Classification
+// =====================================
+
+// ErrorTypeForSQLState maps an ANSI SQLSTATE code to an ErrorType
+func ErrorTypeForSQLState(state string) ErrorType {
+	switch state {
+	case "23505":
+		return ErrorTypeDuplicate
+	case "23502":
+		return ErrorTypeValidation
+	case CodeSerializationFailure, CodeDeadlockDetected:
+		return ErrorTypeTransaction
+	case "57014":
+		return ErrorTypeTimeout
+	case "42501":
+		return ErrorTypePermission
+	}
+	switch {
+	case strings.HasPrefix(state, "23"):
+		return ErrorTypeConstraint
+	case strings.HasPrefix(state, "08"), strings.HasPrefix(state, "57P"):
+		return ErrorTypeConnection
+	case strings.HasPrefix(state, "22"):
+		return ErrorTypeInvalidArgument
+	case strings.HasPrefix(state, "28"):
+		return ErrorTypePermission
+	case strings.HasPrefix(state, "40"), strings.HasPrefix(state, "25"):
+		return ErrorTypeTransaction
+	}
+	return ErrorTypeDatabase
+}
+
+// ErrorTypeForMySQLCode maps a MySQL server or client error number to an ErrorType
+func ErrorTypeForMySQLCode(code int) ErrorType {
+	switch code {
+	case 1062, 1586:
+		return ErrorTypeDuplicate
+	case 1048, 1364:
+		return ErrorTypeValidation
+	case 1216, 1217, 1451, 1452, 3819:
+		return ErrorTypeConstraint
+	case 1213:
+		return ErrorTypeTransaction
+	case 1205, 3024:
+		return ErrorTypeTimeout
+	case 1044, 1045, 1142, 1143:
+		return ErrorTypePermission
+	case 1040, 1053, 2002, 2003, 2006, 2013:
+		return ErrorTypeConnection
+	case 1146:
+		return ErrorTypeNotFound
+	}
+	return ErrorTypeDatabase
+}
+
+// ErrorTypeForSQLiteCode maps a SQLite primary or extended result code to an ErrorType
+func ErrorTypeForSQLiteCode(code int) ErrorType {
+	switch code {
+	case 1555, 2067: // SQLITE_CONSTRAINT_PRIMARYKEY, SQLITE_CONSTRAINT_UNIQUE
+		return ErrorTypeDuplicate
+	case 1299: // SQLITE_CONSTRAINT_NOTNULL
+		return ErrorTypeValidation
+	}
+	switch code & 0xff {
+	case 19: // SQLITE_CONSTRAINT
+		return ErrorTypeConstraint
+	case 5, 6: // SQLITE_BUSY, SQLITE_LOCKED
+		return ErrorTypeTransaction
+	case 3, 8, 23: // SQLITE_PERM, SQLITE_READONLY, SQLITE_AUTH
+		return ErrorTypePermission
+	case 14: // SQLITE_CANTOPEN
+		return ErrorTypeConnection
+	}
+	return ErrorTypeDatabase
+}
+
+// mongoErrorCodes lists the server codes recognised by ErrorTypeForMongoCode
+var mongoErrorCodes = []int{11000, 11001, 12582, 50, 112, 251, 13, 18, 121, 6, 7, 89, 91, 189, 9001, 10107, 11600, 11602, 13435, 13436}
+
+// ErrorTypeForMongoCode maps a MongoDB server error code to an ErrorType
+func ErrorTypeForMongoCode(code int) ErrorType {
+	switch code {
+	case 11000, 11001, 12582:
+		return ErrorTypeDuplicate
+	case 50:
+		return ErrorTypeTimeout
+	case 112, 251:
+		return ErrorTypeTransaction
+	case 13, 18:
+		return ErrorTypePermission
+	case 121:
+		return ErrorTypeValidation
+	case 6, 7, 89, 91, 189, 9001, 10107, 11600, 11602, 13435, 13436:
+		return ErrorTypeConnection
+	}
+	return ErrorTypeDatabase
+}
+
+// =====================================
+// Built-in Translators
+// =====================================
+
+var (
+	// Postgres: Key (email)=(a@b.c) already exists.
+	pgKeyDetail = regexp.MustCompile(`Key \(([^)]+)\)=`)
+	// MySQL: Duplicate entry 'a@b.c' for key 'users.idx_email'
+	mysqlDuplicateKey = regexp.MustCompile(`for key '([^']+)'`)
+	// MySQL: CONSTRAINT `fk_orders_user` FOREIGN KEY (`user_id`)
+	mysqlForeignKey = regexp.MustCompile("CONSTRAINT `([^`]+)` FOREIGN KEY \\(([^)]+)\\)")
+	// SQLite: UNIQUE constraint failed: users.email, users.tenant_id
+	sqliteConstraint = regexp.MustCompile(`constraint failed: (.+)$`)
+	// MongoDB: E11000 duplicate key error collection: app.users index: email_1 dup key: { email: "a@b.c" }
+	mongoDuplicateKey = regexp.MustCompile(`collection: \S+?\.(\S+) index: (\S+) dup key: \{ ?([^}]*)\}`)
+)
+
+// translateSQLStateError handles drivers exposing SQLState() such as lib/pq and pgx
+func translateSQLStateError(err error) (GPAError, bool) {
+	var stater interface{ SQLState() string }
+	if !asInterface(err, &stater) {
+		return GPAError{}, false
+	}
+	state := stater.SQLState()
+	if state == "" {
+		return GPAError{}, false
+	}
+
+	gpaErr := GPAError{
+		Type:       ErrorTypeForSQLState(state),
+		SQLState:   state,
+		DriverCode: state,
+		Code:       state,
+		Constraint: driverString(stater, "Constraint", "ConstraintName"),
+		Entity:     driverString(stater, "Table", "TableName"),
+	}
+	if column := driverString(stater, "Column", "ColumnName"); column != "" {
+		gpaErr = gpaErr.WithFields(column)
+	} else if match := pgKeyDetail.FindStringSubmatch(driverString(stater, "Detail")); match != nil {
+		gpaErr = gpaErr.WithFields(splitFieldList(match[1])...)
+	}
+	return gpaErr, true
+}
+
+// translateMySQLError handles go-sql-driver/mysql's MySQLError
+func translateMySQLError(err error) (GPAError, bool) {
+	native, ok := findDriverError(err, "MySQLError")
+	if !ok {
+		return GPAError{}, false
+	}
+	number, ok := driverInt(native, "Number")
+	if !ok {
+		return GPAError{}, false
+	}
+
+	message := driverString(native, "Message")
+	gpaErr := GPAError{
+		Type:       ErrorTypeForMySQLCode(number),
+		DriverCode: strconv.Itoa(number),
+		Code:       strconv.Itoa(number),
+		SQLState:   driverString(native, "SQLState"),
+	}
+	if number == 1213 {
+		gpaErr = gpaErr.WithRetryable()
+	}
+	if match := mysqlDuplicateKey.FindStringSubmatch(message); match != nil {
+		gpaErr.Constraint = match[1]
+		if table, _, found := strings.Cut(match[1], "."); found {
+			gpaErr.Entity = table
+		}
+	} else if match := mysqlForeignKey.FindStringSubmatch(message); match != nil {
+		gpaErr.Constraint = match[1]
+		gpaErr = gpaErr.WithFields(splitFieldList(match[2])...)
+	}
+	return gpaErr, true
+}
+
+// translateSQLiteError handles mattn/go-sqlite3's Error
+func translateSQLiteError(err error) (GPAError, bool) {
+	native, ok := findDriverError(err, "Error")
+	if !ok {
+		return GPAError{}, false
+	}
+	// Both codes must be present so that unrelated types named Error aren't mistaken for SQLite's
+	primary, hasPrimary := driverInt(native, "Code")
+	code, hasExtended := driverInt(native, "ExtendedCode")
+	if !hasPrimary || !hasExtended {
+		return GPAError{}, false
+	}
+	if code == 0 {
+		code = primary
+	}
+
+	gpaErr := GPAError{
+		Type:       ErrorTypeForSQLiteCode(code),
+		DriverCode: strconv.Itoa(code),
+		Code:       strconv.Itoa(code),
+	}
+	if gpaErr.Type == ErrorTypeTransaction {
+		// SQLITE_BUSY and SQLITE_LOCKED clear once the competing writer finishes
+		gpaErr = gpaErr.WithRetryable()
+	}
+	if match := sqliteConstraint.FindStringSubmatch(native.Error()); match != nil {
+		for _, column := range strings.Split(match[1], ",") {
+			table, field, found := strings.Cut(strings.TrimSpace(column), ".")
+			if !found {
+				continue
+			}
+			gpaErr.Entity = table
+			gpaErr = gpaErr.WithFields(append(gpaErr.Fields(), field)...)
+		}
+	}
+	return gpaErr, true
+}
+
+// translateMongoError handles mongo-driver server errors via their HasErrorCode method
+func translateMongoError(err error) (GPAError, bool) {
+	var server interface{ HasErrorCode(int) bool }
+	if !asInterface(err, &server) {
+		return GPAError{}, false
+	}
+
+	for _, code := range mongoErrorCodes {
+		if !server.HasErrorCode(code) {
+			continue
+		}
+		gpaErr := GPAError{
+			Type:       ErrorTypeForMongoCode(code),
+			DriverCode: strconv.Itoa(code),
+			Code:       strconv.Itoa(code),
+		}
+		if code == 112 || code == 251 {
+			// WriteConflict and NoSuchTransaction abort the transaction
+			gpaErr = gpaErr.WithRetryable()
+		}
+		if match := mongoDuplicateKey.FindStringSubmatch(err.Error()); match != nil {
+			gpaErr.Entity = match[1]
+			gpaErr.Constraint = match[2]
+			for _, pair := range strings.Split(match[3], ",") {
+				if field, _, found := strings.Cut(pair, ":"); found {
+					gpaErr = gpaErr.WithFields(append(gpaErr.Fields(), strings.TrimSpace(field))...)
+				}
+			}
+		}
+		return gpaErr, true
+	}
+	return GPAError{}, false
+}
+
+// translateRedisError handles go-redis replies, marked by their RedisError method and
+// identified by their message prefix
+func translateRedisError(err error) (GPAError, bool) {
+	var reply interface {
+		error
+		RedisError()
+	}
+	if !asInterface(err, &reply) {
+		return GPAError{}, false
+	}
+	msg := reply.Error()
+	if msg == "redis: nil" {
+		return GPAError{Type: ErrorTypeNotFound}, true
+	}
+
+	prefix, _, _ := strings.Cut(msg, " ")
+	var errorType ErrorType
+	switch prefix {
+	case "LOADING", "READONLY", "MASTERDOWN", "CLUSTERDOWN", "TRYAGAIN", "MOVED", "ASK":
+		errorType = ErrorTypeConnection
+	case "NOAUTH", "WRONGPASS", "NOPERM":
+		errorType = ErrorTypePermission
+	case "WRONGTYPE":
+		errorType = ErrorTypeInvalidArgument
+	case "BUSY":
+		errorType = ErrorTypeTimeout
+	case "EXECABORT":
+		errorType = ErrorTypeTransaction
+	case "OOM":
+		errorType = ErrorTypeDatabase
+	default:
+		return GPAError{}, false
+	}
+	return GPAError{Type: errorType, DriverCode: prefix, Code: prefix}, true
+}
+
+// =====================================
+// Reflection Helpers
+// =====================================
+
+// asInterface walks err's chain looking for an error implementing the interface pointed to by target
+func asInterface[I any](err error, target *I) bool {
+	for err != nil {
+		if v, ok := err.(I); ok {
+			*target = v
+			return true
+		}
+		unwrapper, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return false
+		}
+		err = unwrapper.Unwrap()
+	}
+	return false
+}
+
+// findDriverError walks err's chain for an error whose struct type has the given name
+func findDriverError(err error, typeName string) (error, bool) {
+	for err != nil {
+		t := reflect.TypeOf(err)
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Name() == typeName {
+			return err, true
+		}
+		unwrapper, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return nil, false
+		}
+		err = unwrapper.Unwrap()
+	}
+	return nil, false
+}
+
+// driverField returns the first exported struct field of v matching one of names
+func driverField(v interface{}, names ...string) (reflect.Value, bool) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return reflect.Value{}, false
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	for _, name := range names {
+		if field := rv.FieldByName(name); field.IsValid() && field.CanInterface() {
+			return field, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// driverString reads a string (or byte array) field from a driver error struct
+func driverString(v interface{}, names ...string) string {
+	field, ok := driverField(v, names...)
+	if !ok {
+		return ""
+	}
+	switch field.Kind() {
+	case reflect.String:
+		return field.String()
+	case reflect.Array:
+		if field.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, field.Len())
+			for i := range b {
+				b[i] = byte(field.Index(i).Uint())
+			}
+			return strings.TrimRight(string(b), "\x00")
+		}
+	}
+	return ""
+}
+
+// driverInt reads an integer field from a driver error struct
+func driverInt(v interface{}, names ...string) (int, bool) {
+	field, ok := driverField(v, names...)
+	if !ok {
+		return 0, false
+	}
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(field.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(field.Uint()), true
+	}
+	return 0, false
+}
+
+// splitFieldList splits a driver column list such as "tenant_id, email" or "`user_id`"
+func splitFieldList(list string) []string {
+	var fields []string
+	for _, field := range strings.Split(list, ",") {
+		field = strings.Trim(strings.TrimSpace(field), "`\"")
+		if field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
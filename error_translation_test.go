@@ -0,0 +1,288 @@
+package gpa
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// pqError mimics lib/pq's Error: SQLState() plus Constraint/Table/Column fields
+type pqError struct {
+	Code       string
+	Message    string
+	Detail     string
+	Table      string
+	Column     string
+	Constraint string
+}
+
+func (e *pqError) Error() string    { return "pq: " + e.Message }
+func (e *pqError) SQLState() string { return e.Code }
+
+// MySQLError mimics go-sql-driver/mysql's MySQLError
+type MySQLError struct {
+	Number   uint16
+	SQLState [5]byte
+	Message  string
+}
+
+func (e *MySQLError) Error() string { return fmt.Sprintf("Error %d: %s", e.Number, e.Message) }
+
+// Error mimics mattn/go-sqlite3's Error, which the translator matches by type name
+type Error struct {
+	Code         int
+	ExtendedCode int
+	msg          string
+}
+
+func (e Error) Error() string { return e.msg }
+
+// mongoServerError mimics mongo-driver's ServerError interface
+type mongoServerError struct {
+	codes   []int
+	message string
+}
+
+func (e mongoServerError) Error() string { return e.message }
+
+// redisReply mimics go-redis's RedisError reply type
+type redisReply string
+
+func (e redisReply) Error() string { return string(e) }
+func (redisReply) RedisError()     {}
+func (e mongoServerError) HasErrorCode(code int) bool {
+	for _, c := range e.codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func TestGPAErrorContextFields(t *testing.T) {
+	err := NewError(ErrorTypeDuplicate, "email already exists").
+		WithOp("Create").
+		WithEntity("users").
+		WithFields("email").
+		WithConstraint("users_email_key").
+		WithDriverCode("23505").
+		WithSQLState("23505")
+
+	if err.Op != "Create" || err.Entity != "users" || err.Constraint != "users_email_key" {
+		t.Errorf("Unexpected context fields: %+v", err)
+	}
+	if len(err.Fields()) != 1 || err.Fields()[0] != "email" {
+		t.Errorf("Expected fields [email], got %v", err.Fields())
+	}
+	if err.Error() != "Create users: duplicate: email already exists" {
+		t.Errorf("Unexpected error message: %s", err.Error())
+	}
+
+	plain := NewError(ErrorTypeNotFound, "user not found")
+	if plain.Error() != "not_found: user not found" {
+		t.Errorf("Expected message without context prefix, got %s", plain.Error())
+	}
+}
+
+func TestTranslateError_SQLState(t *testing.T) {
+	native := &pqError{
+		Code:       "23505",
+		Message:    `duplicate key value violates unique constraint "users_email_key"`,
+		Detail:     "Key (tenant_id, email)=(1, a@b.c) already exists.",
+		Table:      "users",
+		Constraint: "users_email_key",
+	}
+
+	translated := TranslateError(fmt.Errorf("insert: %w", native))
+	gpaErr, ok := AsGPAError(translated)
+	if !ok {
+		t.Fatalf("Expected GPAError, got %T", translated)
+	}
+	if gpaErr.Type != ErrorTypeDuplicate {
+		t.Errorf("Expected duplicate, got %s", gpaErr.Type)
+	}
+	if gpaErr.SQLState != "23505" || gpaErr.Constraint != "users_email_key" || gpaErr.Entity != "users" {
+		t.Errorf("Unexpected context: %+v", gpaErr)
+	}
+	if strings.Join(gpaErr.Fields(), ",") != "tenant_id,email" {
+		t.Errorf("Expected fields from detail, got %v", gpaErr.Fields())
+	}
+	if !errors.Is(translated, native) {
+		t.Error("Expected native error to remain in the chain")
+	}
+}
+
+func TestTranslateError_SerializationIsRetryable(t *testing.T) {
+	translated := TranslateError(&pqError{Code: "40001", Message: "could not serialize access"})
+	if !IsTransaction(translated) || !IsRetryable(translated) {
+		t.Errorf("Expected retryable transaction error, got %v", translated)
+	}
+}
+
+func TestTranslateError_MySQL(t *testing.T) {
+	native := &MySQLError{
+		Number:   1062,
+		SQLState: [5]byte{'2', '3', '0', '0', '0'},
+		Message:  "Duplicate entry 'a@b.c' for key 'users.idx_email'",
+	}
+
+	gpaErr, ok := AsGPAError(TranslateError(native))
+	if !ok {
+		t.Fatal("Expected GPAError")
+	}
+	if gpaErr.Type != ErrorTypeDuplicate || gpaErr.DriverCode != "1062" || gpaErr.SQLState != "23000" {
+		t.Errorf("Unexpected translation: %+v", gpaErr)
+	}
+	if gpaErr.Constraint != "users.idx_email" || gpaErr.Entity != "users" {
+		t.Errorf("Expected constraint and table from message, got %+v", gpaErr)
+	}
+
+	deadlock, _ := AsGPAError(TranslateError(&MySQLError{Number: 1213, Message: "Deadlock found"}))
+	if !deadlock.Retryable() || deadlock.Code != "1213" || deadlock.DriverCode != "1213" {
+		t.Errorf("Expected MySQL deadlock to be retryable with its native code, got %+v", deadlock)
+	}
+}
+
+func TestTranslateError_SQLite(t *testing.T) {
+	native := Error{Code: 19, ExtendedCode: 2067, msg: "UNIQUE constraint failed: users.email"}
+
+	gpaErr, ok := AsGPAError(TranslateError(native))
+	if !ok {
+		t.Fatal("Expected GPAError")
+	}
+	if gpaErr.Type != ErrorTypeDuplicate || gpaErr.DriverCode != "2067" {
+		t.Errorf("Unexpected translation: %+v", gpaErr)
+	}
+	if gpaErr.Entity != "users" || len(gpaErr.Fields()) != 1 || gpaErr.Fields()[0] != "email" {
+		t.Errorf("Expected entity and field from message, got %+v", gpaErr)
+	}
+
+	busy, _ := AsGPAError(TranslateError(Error{Code: 5, ExtendedCode: 5, msg: "database is locked"}))
+	if !IsNotApplied(busy) || busy.Code != "5" {
+		t.Errorf("Expected SQLITE_BUSY to be retryable with its native code, got %+v", busy)
+	}
+}
+
+func TestTranslateError_Mongo(t *testing.T) {
+	native := mongoServerError{
+		codes:   []int{11000},
+		message: `E11000 duplicate key error collection: app.users index: email_1 dup key: { email: "a@b.c" }`,
+	}
+
+	gpaErr, ok := AsGPAError(TranslateError(native))
+	if !ok {
+		t.Fatal("Expected GPAError")
+	}
+	if gpaErr.Type != ErrorTypeDuplicate || gpaErr.Constraint != "email_1" || gpaErr.Entity != "users" {
+		t.Errorf("Unexpected translation: %+v", gpaErr)
+	}
+	if len(gpaErr.Fields()) != 1 || gpaErr.Fields()[0] != "email" {
+		t.Errorf("Expected fields [email], got %v", gpaErr.Fields())
+	}
+
+	conflict, _ := AsGPAError(TranslateError(mongoServerError{codes: []int{112}, message: "WriteConflict"}))
+	if !conflict.Retryable() || conflict.Code != "112" {
+		t.Errorf("Expected write conflicts to be retryable with their native code, got %+v", conflict)
+	}
+}
+
+func TestTranslateError_Redis(t *testing.T) {
+	if !IsNotFound(TranslateError(redisReply("redis: nil"))) {
+		t.Error("Expected redis nil to translate to not found")
+	}
+	if !IsConnection(TranslateError(fmt.Errorf("set: %w", redisReply("READONLY You can't write against a read only replica.")))) {
+		t.Error("Expected READONLY to translate to connection error")
+	}
+	for _, msg := range []string{"redis: nil", "BUSY reading config", "OOM"} {
+		if plain := errors.New(msg); TranslateError(plain) != plain {
+			t.Errorf("Expected %q from another source to be returned unchanged", msg)
+		}
+	}
+}
+
+func TestTranslateError_Passthrough(t *testing.T) {
+	plain := errors.New("something else")
+	if TranslateError(plain) != plain {
+		t.Error("Expected unknown errors to be returned unchanged")
+	}
+
+	existing := NewError(ErrorTypeValidation, "bad")
+	if !errors.Is(TranslateError(existing), ErrValidation) {
+		t.Error("Expected GPAError to be returned unchanged")
+	}
+
+	if TranslateError(nil) != nil {
+		t.Error("Expected nil to stay nil")
+	}
+}
+
+func TestRegisterErrorTranslator(t *testing.T) {
+	sentinel := errors.New("custom driver: row locked")
+	RegisterErrorTranslator("custom", func(err error) (GPAError, bool) {
+		if !errors.Is(err, sentinel) {
+			return GPAError{}, false
+		}
+		return GPAError{Type: ErrorTypeTimeout, DriverCode: "LOCKED"}, true
+	})
+	defer UnregisterErrorTranslator("custom")
+
+	gpaErr, ok := AsGPAError(TranslateError(sentinel))
+	if !ok || gpaErr.Type != ErrorTypeTimeout || gpaErr.DriverCode != "LOCKED" {
+		t.Errorf("Expected custom translation, got %+v", gpaErr)
+	}
+	if gpaErr.Message != "the database did not respond in time" {
+		t.Errorf("Expected a generic message, got %s", gpaErr.Message)
+	}
+
+	UnregisterErrorTranslator("custom")
+	if _, ok := AsGPAError(TranslateError(sentinel)); ok {
+		t.Error("Expected translator to be removed")
+	}
+}
+
+func TestAnnotateError(t *testing.T) {
+	annotated := AnnotateError(&pqError{Code: "23503", Message: "fk violation"}, "Delete", "orders")
+	gpaErr, _ := AsGPAError(annotated)
+	if gpaErr.Type != ErrorTypeConstraint || gpaErr.Op != "Delete" || gpaErr.Entity != "orders" {
+		t.Errorf("Unexpected annotation: %+v", gpaErr)
+	}
+
+	wrapped, _ := AsGPAError(AnnotateError(errors.New("disk full"), "Create", "users"))
+	if wrapped.Type != ErrorTypeDatabase || wrapped.Op != "Create" {
+		t.Errorf("Expected unknown error wrapped as database error, got %+v", wrapped)
+	}
+
+	if AnnotateError(nil, "Create", "users") != nil {
+		t.Error("Expected nil to stay nil")
+	}
+}
+
+func TestErrorTypeForCodes(t *testing.T) {
+	sqlStates := map[string]ErrorType{
+		"23505": ErrorTypeDuplicate,
+		"23503": ErrorTypeConstraint,
+		"23502": ErrorTypeValidation,
+		"40P01": ErrorTypeTransaction,
+		"08006": ErrorTypeConnection,
+		"57014": ErrorTypeTimeout,
+		"28P01": ErrorTypePermission,
+		"22001": ErrorTypeInvalidArgument,
+		"XX000": ErrorTypeDatabase,
+	}
+	for state, expected := range sqlStates {
+		if got := ErrorTypeForSQLState(state); got != expected {
+			t.Errorf("SQLSTATE %s: expected %s, got %s", state, expected, got)
+		}
+	}
+
+	if ErrorTypeForMySQLCode(1452) != ErrorTypeConstraint {
+		t.Error("Expected MySQL 1452 to be a constraint error")
+	}
+	if ErrorTypeForSQLiteCode(787) != ErrorTypeConstraint {
+		t.Error("Expected SQLITE_CONSTRAINT_FOREIGNKEY to be a constraint error")
+	}
+	if ErrorTypeForMongoCode(50) != ErrorTypeTimeout {
+		t.Error("Expected Mongo 50 to be a timeout")
+	}
+}
@@ -1,6 +1,10 @@
 package gpa
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 // =====================================
 // Error Handling
@@ -12,14 +16,78 @@ type GPAError struct {
 	Message string
 	Cause   error
 	Code    string
+
+	// Op is the repository or provider operation that failed, e.g. "Create".
+	Op string
+	// Entity is the entity, table or collection the operation targeted.
+	Entity string
+	// Constraint is the name of the violated constraint or index, if known.
+	Constraint string
+	// DriverCode is the native error code reported by the driver, e.g. "1062" or "11000".
+	DriverCode string
+	// SQLState is the ANSI SQLSTATE code reported by SQL drivers, e.g. "23505".
+	SQLState string
+	// details holds slice-valued context behind a pointer, so GPAError stays comparable
+	// and errors can still be compared with == through the error interface
+	details *errorDetails
+}
+
+// errorDetails is the slice-valued context of a GPAError, and flags drivers set
+type errorDetails struct {
+	fields     []string
+	violations []FieldViolation
+	retryable  bool
+}
+
+// withDetails returns a copy of the error with a copy of its details, safe to modify
+func (e GPAError) withDetails() (GPAError, *errorDetails) {
+	details := &errorDetails{}
+	if e.details != nil {
+		*details = *e.details
+	}
+	e.details = details
+	return e, details
+}
+
+// FieldViolation describes a single field that failed validation
+type FieldViolation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"message"`
 }
 
-// Error implements the error interface
+// Sentinel errors for use with errors.Is.
+// Any GPAError matches the sentinel of the same Type, even when wrapped:
+//
+//	if errors.Is(err, gpa.ErrNotFound) { ... }
+var (
+	ErrNotFound        = GPAError{Type: ErrorTypeNotFound, Message: "not found"}
+	ErrDuplicate       = GPAError{Type: ErrorTypeDuplicate, Message: "duplicate"}
+	ErrValidation      = GPAError{Type: ErrorTypeValidation, Message: "validation failed"}
+	ErrConnection      = GPAError{Type: ErrorTypeConnection, Message: "connection failed"}
+	ErrTimeout         = GPAError{Type: ErrorTypeTimeout, Message: "timeout"}
+	ErrPermission      = GPAError{Type: ErrorTypePermission, Message: "permission denied"}
+	ErrConstraint      = GPAError{Type: ErrorTypeConstraint, Message: "constraint violation"}
+	ErrTransaction     = GPAError{Type: ErrorTypeTransaction, Message: "transaction failed"}
+	ErrUnsupported     = GPAError{Type: ErrorTypeUnsupported, Message: "unsupported operation"}
+	ErrInternal        = GPAError{Type: ErrorTypeInternal, Message: "internal error"}
+	ErrSerialization   = GPAError{Type: ErrorTypeSerialization, Message: "serialization failed"}
+	ErrInvalidArgument = GPAError{Type: ErrorTypeInvalidArgument, Message: "invalid argument"}
+	ErrDatabase        = GPAError{Type: ErrorTypeDatabase, Message: "database error"}
+	ErrLocked          = GPAError{Type: ErrorTypeLocked, Message: "locked"}
+)
+
+// Error implements the error interface.
+// The operation and entity, when set, prefix the message.
 func (e GPAError) Error() string {
+	msg := fmt.Sprintf("%s: %s", e.Type, e.Message)
 	if e.Cause != nil {
-		return fmt.Sprintf("%s: %s (caused by: %v)", e.Type, e.Message, e.Cause)
+		msg = fmt.Sprintf("%s (caused by: %v)", msg, e.Cause)
 	}
-	return fmt.Sprintf("%s: %s", e.Type, e.Message)
+	if prefix := strings.TrimSpace(e.Op + " " + e.Entity); prefix != "" {
+		msg = prefix + ": " + msg
+	}
+	return msg
 }
 
 // Unwrap returns the underlying error
@@ -27,10 +95,30 @@ func (e GPAError) Unwrap() error {
 	return e.Cause
 }
 
-// Is checks if the error is of a specific type
+// Is checks if the error is of a specific type.
+// Matches both GPAError and *GPAError targets, including the sentinel errors.
 func (e GPAError) Is(target error) bool {
-	if targetGPAError, ok := target.(GPAError); ok {
-		return e.Type == targetGPAError.Type
+	switch t := target.(type) {
+	case GPAError:
+		return e.Type == t.Type
+	case *GPAError:
+		return t != nil && e.Type == t.Type
+	}
+	return false
+}
+
+// As lets errors.As extract a GPAError regardless of whether it was
+// returned by value or by pointer: a *GPAError in the chain satisfies a
+// GPAError target, and a GPAError satisfies a *GPAError target.
+func (e GPAError) As(target interface{}) bool {
+	switch t := target.(type) {
+	case *GPAError:
+		*t = e
+		return true
+	case **GPAError:
+		copied := e
+		*t = &copied
+		return true
 	}
 	return false
 }
@@ -61,50 +149,118 @@ func NewErrorWithCode(errorType ErrorType, message string, code string) GPAError
 	}
 }
 
+// WithOp returns a copy of the error with the operation set
+func (e GPAError) WithOp(op string) GPAError {
+	e.Op = op
+	return e
+}
+
+// WithEntity returns a copy of the error with the entity set
+func (e GPAError) WithEntity(entity string) GPAError {
+	e.Entity = entity
+	return e
+}
+
+// WithFields returns a copy of the error with the involved fields set
+func (e GPAError) WithFields(fields ...string) GPAError {
+	e, details := e.withDetails()
+	details.fields = fields
+	return e
+}
+
+// Fields lists the fields involved, e.g. the columns of a violated unique key
+func (e GPAError) Fields() []string {
+	if e.details == nil {
+		return nil
+	}
+	return e.details.fields
+}
+
+// WithConstraint returns a copy of the error with the violated constraint set
+func (e GPAError) WithConstraint(constraint string) GPAError {
+	e.Constraint = constraint
+	return e
+}
+
+// WithDriverCode returns a copy of the error with the native driver code set
+func (e GPAError) WithDriverCode(code string) GPAError {
+	e.DriverCode = code
+	return e
+}
+
+// WithSQLState returns a copy of the error with the SQLSTATE code set
+func (e GPAError) WithSQLState(state string) GPAError {
+	e.SQLState = state
+	return e
+}
+
+// WithViolations returns a copy of the error with the field violations set
+func (e GPAError) WithViolations(violations ...FieldViolation) GPAError {
+	e, details := e.withDetails()
+	details.violations = violations
+	return e
+}
+
+// Violations lists the individual field failures of a validation error
+func (e GPAError) Violations() []FieldViolation {
+	if e.details == nil {
+		return nil
+	}
+	return e.details.violations
+}
+
+// WithRetryable returns a copy of the error marked as retryable, for failures that
+// clear on their own and that no SQLSTATE describes, such as SQLite's SQLITE_BUSY.
+// A retryable transaction error means the transaction was rolled back; see IsNotApplied.
+func (e GPAError) WithRetryable() GPAError {
+	e, details := e.withDetails()
+	details.retryable = true
+	return e
+}
+
+// AsGPAError finds the first GPAError in err's chain.
+// Works with errors wrapped by fmt.Errorf("%w") and with *GPAError values.
+func AsGPAError(err error) (GPAError, bool) {
+	var gpaErr GPAError
+	if err == nil || !errors.As(err, &gpaErr) {
+		return GPAError{}, false
+	}
+	return gpaErr, true
+}
+
 // IsNotFound checks if an error is a "not found" error
 func IsNotFound(err error) bool {
-	if gpaErr, ok := err.(GPAError); ok {
-		return gpaErr.Type == ErrorTypeNotFound
-	}
-	return false
+	return IsErrorType(err, ErrorTypeNotFound)
 }
 
 // IsDuplicate checks if an error is a "duplicate" error
 func IsDuplicate(err error) bool {
-	if gpaErr, ok := err.(GPAError); ok {
-		return gpaErr.Type == ErrorTypeDuplicate
-	}
-	return false
+	return IsErrorType(err, ErrorTypeDuplicate)
 }
 
 // IsValidation checks if an error is a "validation" error
 func IsValidation(err error) bool {
-	if gpaErr, ok := err.(GPAError); ok {
-		return gpaErr.Type == ErrorTypeValidation
-	}
-	return false
+	return IsErrorType(err, ErrorTypeValidation)
 }
 
 // IsConnection checks if an error is a "connection" error
 func IsConnection(err error) bool {
-	if gpaErr, ok := err.(GPAError); ok {
-		return gpaErr.Type == ErrorTypeConnection
-	}
-	return false
+	return IsErrorType(err, ErrorTypeConnection)
 }
 
 // IsTransaction checks if an error is a "transaction" error
 func IsTransaction(err error) bool {
-	if gpaErr, ok := err.(GPAError); ok {
-		return gpaErr.Type == ErrorTypeTransaction
-	}
-	return false
+	return IsErrorType(err, ErrorTypeTransaction)
+}
+
+// IsLocked checks if an error is a "locked" error
+func IsLocked(err error) bool {
+	return IsErrorType(err, ErrorTypeLocked)
 }
 
-// IsErrorType checks if an error is of a specific type
+// IsErrorType checks if the first GPAError in err's chain is of a specific type.
+// Use errors.Is with a sentinel such as ErrNotFound to match any GPAError in the chain.
 func IsErrorType(err error, errorType ErrorType) bool {
-	if gpaErr, ok := err.(GPAError); ok {
-		return gpaErr.Type == errorType
-	}
-	return false
-}
\ No newline at end of file
+	gpaErr, ok := AsGPAError(err)
+	return ok && gpaErr.Type == errorType
+}
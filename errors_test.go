@@ -2,6 +2,7 @@ package gpa
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 )
 
@@ -81,6 +82,29 @@ func TestGPAErrorIs(t *testing.T) {
 	}
 }
 
+func TestGPAErrorComparable(t *testing.T) {
+	var err error = ErrNotFound
+	if err != ErrNotFound {
+		t.Error("Expected a sentinel to equal itself through the error interface")
+	}
+
+	detailed := NewError(ErrorTypeValidation, "invalid").
+		WithFields("email").
+		WithViolations(FieldViolation{Field: "email", Message: "is required"})
+	err = detailed
+	if err == ErrValidation {
+		t.Error("Expected an error with details not to equal the sentinel")
+	}
+	if err != error(detailed) {
+		t.Error("Expected an error to equal itself through the error interface")
+	}
+
+	copied := detailed.WithFields("name")
+	if len(detailed.Fields()) != 1 || detailed.Fields()[0] != "email" || len(copied.Violations()) != 1 {
+		t.Errorf("Expected With methods to copy details, got %v and %v", detailed.Fields(), copied.Violations())
+	}
+}
+
 func TestNewError(t *testing.T) {
 	err := NewError(ErrorTypeValidation, "validation failed")
 
@@ -245,6 +269,7 @@ func TestErrorTypeString(t *testing.T) {
 		{ErrorTypeTimeout, "timeout"},
 		{ErrorTypePermission, "permission"},
 		{ErrorTypeDatabase, "database"},
+		{ErrorTypeLocked, "locked"},
 	}
 
 	for _, tt := range tests {
@@ -273,4 +298,119 @@ func TestChainedErrors(t *testing.T) {
 	if errorMsg == "" {
 		t.Error("Expected non-empty error message")
 	}
-}
\ No newline at end of file
+}
+
+func TestPredicatesWithWrappedErrors(t *testing.T) {
+	wrapped := fmt.Errorf("loading user: %w", NewError(ErrorTypeNotFound, "user not found"))
+	doubleWrapped := fmt.Errorf("handler: %w", wrapped)
+
+	if !IsNotFound(wrapped) {
+		t.Error("Expected IsNotFound to see through fmt.Errorf wrapping")
+	}
+	if !IsNotFound(doubleWrapped) {
+		t.Error("Expected IsNotFound to see through multiple wrapping layers")
+	}
+	if !IsErrorType(doubleWrapped, ErrorTypeNotFound) {
+		t.Error("Expected IsErrorType to see through wrapping")
+	}
+	if IsDuplicate(wrapped) {
+		t.Error("Expected IsDuplicate to return false for wrapped not found error")
+	}
+	if IsNotFound(nil) {
+		t.Error("Expected IsNotFound to return false for nil")
+	}
+}
+
+func TestPredicatesWithPointerErrors(t *testing.T) {
+	ptr := &GPAError{Type: ErrorTypeDuplicate, Message: "email taken"}
+	wrapped := fmt.Errorf("create: %w", ptr)
+
+	if !IsDuplicate(ptr) {
+		t.Error("Expected IsDuplicate to accept *GPAError")
+	}
+	if !IsDuplicate(wrapped) {
+		t.Error("Expected IsDuplicate to accept wrapped *GPAError")
+	}
+	if !errors.Is(wrapped, ErrDuplicate) {
+		t.Error("Expected errors.Is to match sentinel against wrapped *GPAError")
+	}
+	if !errors.Is(NewError(ErrorTypeDuplicate, "dup"), &GPAError{Type: ErrorTypeDuplicate}) {
+		t.Error("Expected errors.Is to match a *GPAError target")
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	tests := []struct {
+		sentinel  GPAError
+		errorType ErrorType
+	}{
+		{ErrNotFound, ErrorTypeNotFound},
+		{ErrDuplicate, ErrorTypeDuplicate},
+		{ErrValidation, ErrorTypeValidation},
+		{ErrConnection, ErrorTypeConnection},
+		{ErrTimeout, ErrorTypeTimeout},
+		{ErrPermission, ErrorTypePermission},
+		{ErrConstraint, ErrorTypeConstraint},
+		{ErrTransaction, ErrorTypeTransaction},
+		{ErrUnsupported, ErrorTypeUnsupported},
+		{ErrInternal, ErrorTypeInternal},
+		{ErrSerialization, ErrorTypeSerialization},
+		{ErrInvalidArgument, ErrorTypeInvalidArgument},
+		{ErrDatabase, ErrorTypeDatabase},
+		{ErrLocked, ErrorTypeLocked},
+	}
+
+	for _, tt := range tests {
+		err := fmt.Errorf("wrapped: %w", NewError(tt.errorType, "something failed"))
+		if !errors.Is(err, tt.sentinel) {
+			t.Errorf("Expected errors.Is to match sentinel for %s", tt.errorType)
+		}
+		if errors.Is(errors.New("plain"), tt.sentinel) {
+			t.Errorf("Expected plain error not to match sentinel for %s", tt.errorType)
+		}
+	}
+
+	if errors.Is(NewError(ErrorTypeNotFound, "missing"), ErrDuplicate) {
+		t.Error("Expected sentinel of a different type not to match")
+	}
+}
+
+func TestAsGPAError(t *testing.T) {
+	original := NewErrorWithCode(ErrorTypeConstraint, "fk violation", "23503")
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"value", original},
+		{"pointer", &original},
+		{"wrapped value", fmt.Errorf("ctx: %w", original)},
+		{"wrapped pointer", fmt.Errorf("ctx: %w", &original)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gpaErr, ok := AsGPAError(tt.err)
+			if !ok {
+				t.Fatal("Expected AsGPAError to succeed")
+			}
+			if gpaErr.Code != "23503" {
+				t.Errorf("Expected code '23503', got '%s'", gpaErr.Code)
+			}
+
+			var value GPAError
+			if !errors.As(tt.err, &value) || value.Type != ErrorTypeConstraint {
+				t.Error("Expected errors.As into GPAError to succeed")
+			}
+
+			var ptr *GPAError
+			if !errors.As(tt.err, &ptr) || ptr.Type != ErrorTypeConstraint {
+				t.Error("Expected errors.As into *GPAError to succeed")
+			}
+		})
+	}
+
+	if _, ok := AsGPAError(errors.New("plain")); ok {
+		t.Error("Expected AsGPAError to fail for plain error")
+	}
+}
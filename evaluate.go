@@ -0,0 +1,295 @@
+package gpa
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// =====================================
+// In-Memory Condition Evaluation
+// =====================================
+
+// MatchCondition reports whether entity satisfies condition, evaluated in memory.
+// entity may be a struct, a pointer to one, or a map[string]interface{}. Fields are
+// resolved by Go name or json, db, bson or gorm column tag; dotted paths such as
+// "address.city" descend into nested structs and maps. Missing and nil fields are NULL.
+// Subquery conditions are not supported.
+// Example: ok, err := gpa.MatchCondition(post, gpa.WhereCondition("published", gpa.OpEqual, true))
+func MatchCondition(entity interface{}, condition Condition) (bool, error) {
+	switch c := condition.(type) {
+	case nil:
+		return true, nil
+	case CompositeCondition:
+		return matchComposite(entity, c)
+	case *CompositeCondition:
+		return matchComposite(entity, *c)
+	case SubQueryCondition, *SubQueryCondition:
+		return false, NewError(ErrorTypeUnsupported, "subquery conditions cannot be evaluated in memory")
+	case SearchCondition:
+		return matchSearch(entity, c), nil
+	case *SearchCondition:
+		return matchSearch(entity, *c), nil
+	}
+
+	actual, found := resolveFieldPath(reflect.ValueOf(entity), condition.Field())
+	return matchOperator(actual, found, condition.Operator(), condition.Value())
+}
+
+// MatchConditions reports whether entity satisfies every condition
+func MatchConditions(entity interface{}, conditions []Condition) (bool, error) {
+	for _, condition := range conditions {
+		ok, err := MatchCondition(entity, condition)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchComposite(entity interface{}, c CompositeCondition) (bool, error) {
+	switch c.Logic {
+	case LogicOr:
+		for _, condition := range c.Conditions {
+			ok, err := MatchCondition(entity, condition)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				return true, nil
+			}
+		}
+		return len(c.Conditions) == 0, nil
+	case LogicNot:
+		ok, err := MatchConditions(entity, c.Conditions)
+		return !ok && err == nil, err
+	default:
+		return MatchConditions(entity, c.Conditions)
+	}
+}
+
+// resolveFieldPath finds the value of a possibly dotted field path.
+// Returns false if the path does not exist or crosses a nil value.
+func resolveFieldPath(value reflect.Value, path string) (reflect.Value, bool) {
+	for _, part := range strings.Split(path, ".") {
+		value = indirectValue(value)
+		if !value.IsValid() {
+			return reflect.Value{}, false
+		}
+		switch value.Kind() {
+		case reflect.Struct:
+			field, _, ok := lookupStructField(value, part)
+			if !ok {
+				return reflect.Value{}, false
+			}
+			value = field
+		case reflect.Map:
+			if value.Type().Key().Kind() != reflect.String {
+				return reflect.Value{}, false
+			}
+			value = value.MapIndex(reflect.ValueOf(part).Convert(value.Type().Key()))
+			if !value.IsValid() {
+				return reflect.Value{}, false
+			}
+		default:
+			return reflect.Value{}, false
+		}
+	}
+	return indirectValue(value), true
+}
+
+// indirectValue dereferences pointers and interfaces, returning an invalid Value for nil
+func indirectValue(value reflect.Value) reflect.Value {
+	for value.IsValid() && (value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface) {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+		value = value.Elem()
+	}
+	return value
+}
+
+func matchOperator(actual reflect.Value, found bool, op Operator, expected interface{}) (bool, error) {
+	isNull := !found || !actual.IsValid()
+
+	switch op {
+	case OpIsNull:
+		return isNull, nil
+	case OpIsNotNull:
+		return !isNull, nil
+	case OpExists:
+		return found, nil
+	case OpNotExists:
+		return !found, nil
+	}
+	if isNull {
+		// SQL semantics: comparisons with NULL are never true
+		return false, nil
+	}
+
+	switch op {
+	case OpNear, OpWithin, OpIntersects:
+		return matchGeo(actual, op, expected)
+	case OpEqual:
+		return valuesEqual(actual, expected), nil
+	case OpNotEqual:
+		return !valuesEqual(actual, expected), nil
+	case OpGreaterThan, OpGreaterThanOrEqual, OpLessThan, OpLessThanOrEqual:
+		cmp, err := compareValues(actual, reflect.ValueOf(expected))
+		if err != nil {
+			return false, err
+		}
+		switch op {
+		case OpGreaterThan:
+			return cmp > 0, nil
+		case OpGreaterThanOrEqual:
+			return cmp >= 0, nil
+		case OpLessThan:
+			return cmp < 0, nil
+		default:
+			return cmp <= 0, nil
+		}
+	case OpIn, OpNotIn:
+		in := false
+		list := reflect.ValueOf(expected)
+		if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+			return false, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("%s expects a slice value", op))
+		}
+		for i := 0; i < list.Len(); i++ {
+			if valuesEqual(actual, list.Index(i).Interface()) {
+				in = true
+				break
+			}
+		}
+		return in == (op == OpIn), nil
+	case OpBetween, OpNotBetween:
+		bounds := reflect.ValueOf(expected)
+		if (bounds.Kind() != reflect.Slice && bounds.Kind() != reflect.Array) || bounds.Len() != 2 {
+			return false, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("%s expects two bounds", op))
+		}
+		low, err := compareValues(actual, bounds.Index(0))
+		if err != nil {
+			return false, err
+		}
+		high, err := compareValues(actual, bounds.Index(1))
+		if err != nil {
+			return false, err
+		}
+		between := low >= 0 && high <= 0
+		return between == (op == OpBetween), nil
+	case OpLike, OpNotLike:
+		pattern, ok := expected.(string)
+		if !ok || actual.Kind() != reflect.String {
+			return false, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("%s expects string operands", op))
+		}
+		matched := likePattern(pattern).MatchString(actual.String())
+		return matched == (op == OpLike), nil
+	case OpContains:
+		if actual.Kind() == reflect.Slice || actual.Kind() == reflect.Array {
+			for i := 0; i < actual.Len(); i++ {
+				if valuesEqual(indirectValue(actual.Index(i)), expected) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+		return actual.Kind() == reflect.String && strings.Contains(actual.String(), fmt.Sprint(expected)), nil
+	case OpStartsWith:
+		return actual.Kind() == reflect.String && strings.HasPrefix(actual.String(), fmt.Sprint(expected)), nil
+	case OpEndsWith:
+		return actual.Kind() == reflect.String && strings.HasSuffix(actual.String(), fmt.Sprint(expected)), nil
+	case OpRegex:
+		re, err := regexp.Compile(fmt.Sprint(expected))
+		if err != nil {
+			return false, NewErrorWithCause(ErrorTypeInvalidArgument, "invalid regular expression", err)
+		}
+		return actual.Kind() == reflect.String && re.MatchString(actual.String()), nil
+	}
+	return false, NewError(ErrorTypeUnsupported, fmt.Sprintf("operator %s cannot be evaluated in memory", op))
+}
+
+// valuesEqual compares a field value with a condition value, treating numbers of any type as equal by value
+func valuesEqual(actual reflect.Value, expected interface{}) bool {
+	expectedValue := indirectValue(reflect.ValueOf(expected))
+	if !actual.IsValid() || !expectedValue.IsValid() {
+		return actual.IsValid() == expectedValue.IsValid()
+	}
+	if cmp, err := compareValues(actual, expectedValue); err == nil {
+		return cmp == 0
+	}
+	if actual.CanInterface() {
+		return reflect.DeepEqual(actual.Interface(), expectedValue.Interface())
+	}
+	return false
+}
+
+// compareValues orders two numbers, strings, bools or times.
+// Returns an error if the values are not comparable.
+func compareValues(a, b reflect.Value) (int, error) {
+	a, b = indirectValue(a), indirectValue(b)
+	if !a.IsValid() || !b.IsValid() {
+		return 0, NewError(ErrorTypeInvalidArgument, "cannot compare NULL")
+	}
+
+	if af, ok := numericValue(a); ok {
+		if bf, ok := numericValue(b); ok {
+			switch {
+			case af < bf:
+				return -1, nil
+			case af > bf:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	if a.Kind() == reflect.String && b.Kind() == reflect.String {
+		return strings.Compare(a.String(), b.String()), nil
+	}
+	if a.Kind() == reflect.Bool && b.Kind() == reflect.Bool {
+		if a.Bool() == b.Bool() {
+			return 0, nil
+		}
+		if !a.Bool() {
+			return -1, nil
+		}
+		return 1, nil
+	}
+	timeType := reflect.TypeOf(time.Time{})
+	if a.Type() == timeType && b.Type() == timeType {
+		return a.Interface().(time.Time).Compare(b.Interface().(time.Time)), nil
+	}
+	return 0, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("cannot compare %s with %s", a.Type(), b.Type()))
+}
+
+// numericValue converts any integer, unsigned or float value to float64
+func numericValue(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// likePattern converts a SQL LIKE pattern (% and _ wildcards) to an anchored regular expression
+func likePattern(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?s)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
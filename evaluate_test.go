@@ -0,0 +1,125 @@
+package gpa
+
+import (
+	"testing"
+	"time"
+)
+
+type evalAddress struct {
+	City string `json:"city"`
+}
+
+type evalEntity struct {
+	ID        int          `json:"id"`
+	Name      string       `json:"name"`
+	Score     float64      `json:"score"`
+	Tags      []string     `json:"tags"`
+	Nickname  *string      `json:"nickname"`
+	Address   *evalAddress `json:"address"`
+	CreatedAt time.Time    `json:"created_at"`
+	Active    bool         `db:"is_active"`
+}
+
+func TestMatchCondition_Operators(t *testing.T) {
+	created := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	entity := &evalEntity{
+		ID:        7,
+		Name:      "Widget Pro",
+		Score:     4.5,
+		Tags:      []string{"new", "sale"},
+		Address:   &evalAddress{City: "Lisbon"},
+		CreatedAt: created,
+		Active:    true,
+	}
+
+	tests := []struct {
+		name      string
+		condition Condition
+		expected  bool
+	}{
+		{"equal int", WhereCondition("id", OpEqual, 7), true},
+		{"equal across numeric types", WhereCondition("id", OpEqual, int64(7)), true},
+		{"not equal", WhereCondition("name", OpNotEqual, "Widget"), true},
+		{"greater than", WhereCondition("score", OpGreaterThan, 4), true},
+		{"less than or equal", WhereCondition("score", OpLessThanOrEqual, 4.4), false},
+		{"in", WhereCondition("id", OpIn, []interface{}{1, 7}), true},
+		{"not in", WhereCondition("id", OpNotIn, []int{1, 2}), true},
+		{"between", WhereCondition("score", OpBetween, []interface{}{4, 5}), true},
+		{"like", WhereCondition("name", OpLike, "Widget%"), true},
+		{"like single char", WhereCondition("name", OpLike, "W_dget Pro"), true},
+		{"not like", WhereCondition("name", OpNotLike, "%Basic%"), true},
+		{"contains slice", WhereCondition("tags", OpContains, "sale"), true},
+		{"contains string", WhereCondition("name", OpContains, "get"), true},
+		{"starts with", WhereCondition("name", OpStartsWith, "Wid"), true},
+		{"ends with", WhereCondition("name", OpEndsWith, "Pro"), true},
+		{"regex", WhereCondition("name", OpRegex, `^W\w+ P`), true},
+		{"is null", WhereCondition("nickname", OpIsNull, nil), true},
+		{"null never equals", WhereCondition("nickname", OpEqual, ""), false},
+		{"is not null", WhereCondition("address", OpIsNotNull, nil), true},
+		{"nested path", WhereCondition("address.city", OpEqual, "Lisbon"), true},
+		{"db tag", WhereCondition("is_active", OpEqual, true), true},
+		{"time", WhereCondition("created_at", OpGreaterThan, created.Add(-time.Hour)), true},
+		{"missing field is null", WhereCondition("missing", OpIsNull, nil), true},
+		{"missing field not equal", WhereCondition("missing", OpEqual, 1), false},
+	}
+
+	for _, tt := range tests {
+		got, err := MatchCondition(entity, tt.condition)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestMatchCondition_Composite(t *testing.T) {
+	entity := evalEntity{ID: 1, Name: "a"}
+
+	or := CompositeCondition{Logic: LogicOr, Conditions: []Condition{
+		WhereCondition("id", OpEqual, 2),
+		WhereCondition("name", OpEqual, "a"),
+	}}
+	if ok, _ := MatchCondition(entity, or); !ok {
+		t.Error("Expected OR to match")
+	}
+
+	and := CompositeCondition{Logic: LogicAnd, Conditions: []Condition{
+		WhereCondition("id", OpEqual, 2),
+		WhereCondition("name", OpEqual, "a"),
+	}}
+	if ok, _ := MatchCondition(entity, and); ok {
+		t.Error("Expected AND not to match")
+	}
+
+	not := CompositeCondition{Logic: LogicNot, Conditions: []Condition{WhereCondition("id", OpEqual, 2)}}
+	if ok, _ := MatchCondition(entity, not); !ok {
+		t.Error("Expected NOT to match")
+	}
+}
+
+func TestMatchCondition_Maps(t *testing.T) {
+	doc := map[string]interface{}{
+		"status": "active",
+		"owner":  map[string]interface{}{"id": 42},
+	}
+	if ok, _ := MatchCondition(doc, WhereCondition("owner.id", OpEqual, 42)); !ok {
+		t.Error("Expected nested map lookup to match")
+	}
+	if ok, _ := MatchCondition(doc, WhereCondition("status", OpIn, []string{"active", "pending"})); !ok {
+		t.Error("Expected IN on map field to match")
+	}
+}
+
+func TestMatchCondition_Errors(t *testing.T) {
+	entity := evalEntity{Name: "a"}
+
+	if _, err := MatchCondition(entity, WhereCondition("name", OpGreaterThan, 5)); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected invalid argument comparing string with number, got %v", err)
+	}
+	if _, err := MatchCondition(entity, SubQueryCondition{FieldName: "id"}); !IsErrorType(err, ErrorTypeUnsupported) {
+		t.Errorf("Expected unsupported for subqueries, got %v", err)
+	}
+}
@@ -50,6 +50,10 @@ func ExampleProviderUsage() {
 	if kvProvider, ok := AsKeyValueProvider(redisProvider); ok {
 		ctx := context.Background()
 
+		// Namespace keys so services and environments sharing Redis cannot collide;
+		// "user:1" below is stored as "prod:accounts:user:1"
+		kvProvider = NewNamespacedKeyValueProvider(kvProvider, KeyNamespace{Environment: "prod", Prefix: "accounts"})
+
 		// Use Redis-specific operations
 		err := kvProvider.Set(ctx, "user:1", "John Doe", 5*time.Minute)
 		if err == nil {
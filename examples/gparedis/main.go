@@ -282,7 +282,7 @@ func main() {
 				"skills":   "Go,Redis,Microservices",
 			}
 
-			err = redisRepo.HMSet(ctx, hashKey, hashData)
+			_, err = redisRepo.HSet(ctx, hashKey, hashData)
 			if err != nil {
 				log.Printf("Failed to set hash: %v", err)
 			} else {
@@ -307,7 +307,7 @@ func main() {
 
 			// Increment counters
 			loginCountKey := "user:1:login_count"
-			newCount, err := redisRepo.Incr(ctx, loginCountKey)
+			newCount, err := redisRepo.Increment(ctx, loginCountKey, 1)
 			if err != nil {
 				log.Printf("Failed to increment counter: %v", err)
 			} else {
@@ -316,7 +316,7 @@ func main() {
 
 			// Increment by value
 			pageViewsKey := "user:1:page_views"
-			newViews, err := redisRepo.IncrBy(ctx, pageViewsKey, 5)
+			newViews, err := redisRepo.Increment(ctx, pageViewsKey, 5)
 			if err != nil {
 				log.Printf("Failed to increment by value: %v", err)
 			} else {
@@ -333,7 +333,7 @@ func main() {
 			}
 
 			for _, action := range actions {
-				err = redisRepo.LPush(ctx, recentActionsKey, action)
+				_, err = redisRepo.LPush(ctx, recentActionsKey, action)
 				if err != nil {
 					log.Printf("Failed to push to list: %v", err)
 				}
@@ -360,7 +360,7 @@ func main() {
 			skillsSetKey := "user:1:skills"
 			skills := []string{"Go", "Redis", "Docker", "Kubernetes", "MongoDB"}
 			for _, skill := range skills {
-				err = redisRepo.SAdd(ctx, skillsSetKey, skill)
+				_, err = redisRepo.SAdd(ctx, skillsSetKey, skill)
 				if err != nil {
 					log.Printf("Failed to add to set: %v", err)
 				}
@@ -392,7 +392,7 @@ func main() {
 			}
 
 			for userID, score := range developers {
-				err = redisRepo.ZAdd(ctx, leaderboardKey, score, userID)
+				_, err = redisRepo.ZAdd(ctx, leaderboardKey, gpa.ZMember[string]{Member: userID, Score: score})
 				if err != nil {
 					log.Printf("Failed to add to sorted set: %v", err)
 				}
@@ -569,24 +569,16 @@ func main() {
 
 	/*
 		if redisRepo, ok := userRepo.(gpa.RedisRepository[User]); ok {
-			// Rate limiting
-			rateLimitKey := "rate_limit:user:1:api_calls"
-
-			// Allow 10 API calls per minute
-			currentCalls, err := redisRepo.Incr(ctx, rateLimitKey)
+			// Rate limiting: allow 10 API calls per minute
+			limiter, err := gpa.NewRateLimiter(provider, gpa.RateLimit{Algorithm: gpa.SlidingWindowLog, Limit: 10, Period: time.Minute})
 			if err != nil {
-				log.Printf("Failed to increment rate limit: %v", err)
+				log.Printf("Failed to create rate limiter: %v", err)
+			} else if res, err := limiter.Allow(ctx, "user:1:api_calls"); err != nil {
+				log.Printf("Failed to check rate limit: %v", err)
+			} else if res.Allowed {
+				fmt.Printf("✓ API call allowed (%d/10 left this minute)\n", res.Remaining)
 			} else {
-				if currentCalls == 1 {
-					// First call in this minute, set expiration
-					redisRepo.Expire(ctx, rateLimitKey, time.Minute)
-				}
-
-				if currentCalls <= 10 {
-					fmt.Printf("✓ API call allowed (%d/10 this minute)\n", currentCalls)
-				} else {
-					fmt.Printf("✗ Rate limit exceeded (%d/10 this minute)\n", currentCalls)
-				}
+				fmt.Printf("✗ Rate limit exceeded, retry in %v\n", res.RetryAfter)
 			}
 
 			// Distributed locking
@@ -620,7 +612,7 @@ func main() {
 			}
 
 			for _, notification := range notifications {
-				err = redisRepo.LPush(ctx, notificationKey, notification)
+				_, err = redisRepo.LPush(ctx, notificationKey, notification)
 				if err != nil {
 					log.Printf("Failed to add notification: %v", err)
 				}
@@ -0,0 +1,672 @@
+package gpa
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// =====================================
+// GeoJSON Types
+// =====================================
+
+// GeoShape is a GeoJSON geometry. Coordinates are WGS84 longitude/latitude pairs.
+type GeoShape interface {
+	// GeoJSON returns the geometry as a GeoJSON object, e.g. for MongoDB queries
+	GeoJSON() map[string]interface{}
+	// WKT returns the geometry as Well-Known Text, e.g. for PostGIS and SpatiaLite
+	WKT() string
+}
+
+// Point is a GeoJSON Point
+type Point struct {
+	Lon float64
+	Lat float64
+}
+
+// LineString is a GeoJSON LineString
+type LineString []Point
+
+// Polygon is a GeoJSON Polygon. The first ring is the exterior, the others are holes.
+// Rings may be given open or closed.
+type Polygon [][]Point
+
+// MultiPolygon is a GeoJSON MultiPolygon
+type MultiPolygon []Polygon
+
+// NewPoint returns the point at longitude lon and latitude lat
+// Example: office := gpa.NewPoint(-73.9857, 40.7484)
+func NewPoint(lon, lat float64) Point {
+	return Point{Lon: lon, Lat: lat}
+}
+
+func (p Point) coordinates() []float64 { return []float64{p.Lon, p.Lat} }
+
+func (l LineString) coordinates() [][]float64 {
+	coords := make([][]float64, len(l))
+	for i, p := range l {
+		coords[i] = p.coordinates()
+	}
+	return coords
+}
+
+func (p Polygon) coordinates() [][][]float64 {
+	rings := make([][][]float64, len(p))
+	for i, ring := range p {
+		rings[i] = LineString(closeRing(ring)).coordinates()
+	}
+	return rings
+}
+
+func (m MultiPolygon) coordinates() [][][][]float64 {
+	polygons := make([][][][]float64, len(m))
+	for i, polygon := range m {
+		polygons[i] = polygon.coordinates()
+	}
+	return polygons
+}
+
+// GeoJSON implements GeoShape
+func (p Point) GeoJSON() map[string]interface{} {
+	return map[string]interface{}{"type": "Point", "coordinates": p.coordinates()}
+}
+
+// GeoJSON implements GeoShape
+func (l LineString) GeoJSON() map[string]interface{} {
+	return map[string]interface{}{"type": "LineString", "coordinates": l.coordinates()}
+}
+
+// GeoJSON implements GeoShape
+func (p Polygon) GeoJSON() map[string]interface{} {
+	return map[string]interface{}{"type": "Polygon", "coordinates": p.coordinates()}
+}
+
+// GeoJSON implements GeoShape
+func (m MultiPolygon) GeoJSON() map[string]interface{} {
+	return map[string]interface{}{"type": "MultiPolygon", "coordinates": m.coordinates()}
+}
+
+// WKT implements GeoShape
+func (p Point) WKT() string {
+	return "POINT(" + wktPoint(p) + ")"
+}
+
+// WKT implements GeoShape
+func (l LineString) WKT() string {
+	return "LINESTRING" + wktRing(l)
+}
+
+// WKT implements GeoShape
+func (p Polygon) WKT() string {
+	return "POLYGON" + wktPolygon(p)
+}
+
+// WKT implements GeoShape
+func (m MultiPolygon) WKT() string {
+	parts := make([]string, len(m))
+	for i, polygon := range m {
+		parts[i] = wktPolygon(polygon)
+	}
+	return "MULTIPOLYGON(" + strings.Join(parts, ",") + ")"
+}
+
+func wktPoint(p Point) string {
+	return fmt.Sprintf("%g %g", p.Lon, p.Lat)
+}
+
+func wktRing(points []Point) string {
+	parts := make([]string, len(points))
+	for i, p := range points {
+		parts[i] = wktPoint(p)
+	}
+	return "(" + strings.Join(parts, ",") + ")"
+}
+
+func wktPolygon(p Polygon) string {
+	rings := make([]string, len(p))
+	for i, ring := range p {
+		rings[i] = wktRing(closeRing(ring))
+	}
+	return "(" + strings.Join(rings, ",") + ")"
+}
+
+// closeRing returns ring with its first point repeated at the end, if it is not already
+func closeRing(ring []Point) []Point {
+	if len(ring) > 0 && ring[0] != ring[len(ring)-1] {
+		return append(ring[:len(ring):len(ring)], ring[0])
+	}
+	return ring
+}
+
+// MarshalJSON encodes the point as GeoJSON
+func (p Point) MarshalJSON() ([]byte, error) { return json.Marshal(p.GeoJSON()) }
+
+// MarshalJSON encodes the line as GeoJSON
+func (l LineString) MarshalJSON() ([]byte, error) { return json.Marshal(l.GeoJSON()) }
+
+// MarshalJSON encodes the polygon as GeoJSON
+func (p Polygon) MarshalJSON() ([]byte, error) { return json.Marshal(p.GeoJSON()) }
+
+// MarshalJSON encodes the polygons as GeoJSON
+func (m MultiPolygon) MarshalJSON() ([]byte, error) { return json.Marshal(m.GeoJSON()) }
+
+// UnmarshalJSON decodes a GeoJSON Point
+func (p *Point) UnmarshalJSON(data []byte) error {
+	var coords []float64
+	if err := unmarshalGeoJSON(data, "Point", &coords); err != nil {
+		return err
+	}
+	if len(coords) < 2 {
+		return NewError(ErrorTypeSerialization, "GeoJSON point needs two coordinates")
+	}
+	*p = Point{Lon: coords[0], Lat: coords[1]}
+	return nil
+}
+
+// UnmarshalJSON decodes a GeoJSON LineString
+func (l *LineString) UnmarshalJSON(data []byte) error {
+	var coords [][]float64
+	if err := unmarshalGeoJSON(data, "LineString", &coords); err != nil {
+		return err
+	}
+	points, err := pointsFrom(coords)
+	*l = points
+	return err
+}
+
+// UnmarshalJSON decodes a GeoJSON Polygon
+func (p *Polygon) UnmarshalJSON(data []byte) error {
+	var coords [][][]float64
+	if err := unmarshalGeoJSON(data, "Polygon", &coords); err != nil {
+		return err
+	}
+	polygon, err := polygonFrom(coords)
+	*p = polygon
+	return err
+}
+
+// UnmarshalJSON decodes a GeoJSON MultiPolygon
+func (m *MultiPolygon) UnmarshalJSON(data []byte) error {
+	var coords [][][][]float64
+	if err := unmarshalGeoJSON(data, "MultiPolygon", &coords); err != nil {
+		return err
+	}
+	polygons := make(MultiPolygon, len(coords))
+	for i, rings := range coords {
+		polygon, err := polygonFrom(rings)
+		if err != nil {
+			return err
+		}
+		polygons[i] = polygon
+	}
+	*m = polygons
+	return nil
+}
+
+// unmarshalGeoJSON decodes the coordinates of a GeoJSON object of the given type
+func unmarshalGeoJSON(data []byte, geoType string, coords interface{}) error {
+	var object struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return NewErrorWithCause(ErrorTypeSerialization, "invalid GeoJSON", err)
+	}
+	if object.Type != geoType {
+		return NewError(ErrorTypeSerialization, fmt.Sprintf("expected GeoJSON %s, got %q", geoType, object.Type))
+	}
+	if err := json.Unmarshal(object.Coordinates, coords); err != nil {
+		return NewErrorWithCause(ErrorTypeSerialization, "invalid GeoJSON coordinates", err)
+	}
+	return nil
+}
+
+func pointsFrom(coords [][]float64) ([]Point, error) {
+	points := make([]Point, len(coords))
+	for i, c := range coords {
+		if len(c) < 2 {
+			return nil, NewError(ErrorTypeSerialization, "GeoJSON position needs two coordinates")
+		}
+		points[i] = Point{Lon: c[0], Lat: c[1]}
+	}
+	return points, nil
+}
+
+func polygonFrom(coords [][][]float64) (Polygon, error) {
+	polygon := make(Polygon, len(coords))
+	for i, ring := range coords {
+		points, err := pointsFrom(ring)
+		if err != nil {
+			return nil, err
+		}
+		polygon[i] = points
+	}
+	return polygon, nil
+}
+
+// =====================================
+// Geospatial Query Options
+// =====================================
+
+// GeoNear is the value of an OpNear condition. Distances are in meters.
+type GeoNear struct {
+	Point       Point
+	MaxDistance float64
+	MinDistance float64
+}
+
+// Near matches entities whose geometry at field lies within maxDistance meters of point.
+// MongoDB and the in-memory provider return the nearest first unless the query has orders.
+// Example: places, err := repo.Query(ctx, gpa.Near("location", gpa.NewPoint(-73.98, 40.75), 1000))
+func Near(field string, point Point, maxDistance float64) QueryOption {
+	return ConditionOption{Condition: BasicCondition{FieldName: field, Op: OpNear, Val: GeoNear{Point: point, MaxDistance: maxDistance}}}
+}
+
+// Within matches entities whose geometry at field lies entirely inside shape
+// Example: places, err := repo.Query(ctx, gpa.Within("location", downtown))
+func Within(field string, shape GeoShape) QueryOption {
+	return ConditionOption{Condition: BasicCondition{FieldName: field, Op: OpWithin, Val: shape}}
+}
+
+// Intersects matches entities whose geometry at field shares at least one point with shape
+// Example: roads, err := repo.Query(ctx, gpa.Intersects("path", district))
+func Intersects(field string, shape GeoShape) QueryOption {
+	return ConditionOption{Condition: BasicCondition{FieldName: field, Op: OpIntersects, Val: shape}}
+}
+
+// =====================================
+// SQL Translation
+// =====================================
+
+// SpatialDialect selects the SQL functions used by SpatialSQL
+type SpatialDialect string
+
+const (
+	SpatialPostGIS    SpatialDialect = "postgis"
+	SpatialSpatiaLite SpatialDialect = "spatialite"
+)
+
+// sqlIdentifier restricts column and table names that are interpolated into generated SQL
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// SpatialSQL translates an OpNear, OpWithin or OpIntersects condition to a SQL predicate
+// with ? placeholders for SQL providers. Geometries are passed as WKT in SRID 4326, and
+// PostGIS distances are computed on the geography type, in meters.
+// Example: clause, args, err := gpa.SpatialSQL(gpa.SpatialPostGIS, condition)
+func SpatialSQL(dialect SpatialDialect, condition Condition) (string, []interface{}, error) {
+	column := condition.Field()
+	if !sqlIdentifier.MatchString(column) {
+		return "", nil, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("invalid spatial column %q", column))
+	}
+
+	geomFromText := "ST_GeomFromText"
+	if dialect == SpatialSpatiaLite {
+		geomFromText = "GeomFromText"
+	} else if dialect != SpatialPostGIS {
+		return "", nil, NewError(ErrorTypeUnsupported, fmt.Sprintf("unknown spatial dialect %q", dialect))
+	}
+
+	switch condition.Operator() {
+	case OpNear:
+		near, ok := condition.Value().(GeoNear)
+		if !ok {
+			return "", nil, NewError(ErrorTypeInvalidArgument, "near conditions expect a GeoNear value")
+		}
+		// A MaxDistance of 0 is unlimited, as in MongoDB and the in-memory provider
+		var clauses []string
+		var args []interface{}
+		if near.MaxDistance > 0 {
+			if dialect == SpatialPostGIS {
+				clauses = append(clauses, fmt.Sprintf("ST_DWithin(%s::geography, ST_GeogFromText(?), ?)", column))
+				args = []interface{}{"SRID=4326;" + near.Point.WKT(), near.MaxDistance}
+			} else {
+				clauses = append(clauses, fmt.Sprintf("ST_Distance(%s, MakePoint(?, ?, 4326), 1) <= ?", column))
+				args = []interface{}{near.Point.Lon, near.Point.Lat, near.MaxDistance}
+			}
+		}
+		if near.MinDistance > 0 {
+			distance, distanceArgs, _ := SpatialDistanceSQL(dialect, column, near.Point)
+			clauses = append(clauses, distance+" >= ?")
+			args = append(append(args, distanceArgs...), near.MinDistance)
+		}
+		if len(clauses) == 0 {
+			return column + " IS NOT NULL", nil, nil
+		}
+		return strings.Join(clauses, " AND "), args, nil
+	case OpWithin, OpIntersects:
+		shape, ok := condition.Value().(GeoShape)
+		if !ok {
+			return "", nil, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("%s conditions expect a GeoShape value", condition.Operator()))
+		}
+		function := "ST_Within"
+		if condition.Operator() == OpIntersects {
+			function = "ST_Intersects"
+		}
+		return fmt.Sprintf("%s(%s, %s(?, 4326))", function, column, geomFromText), []interface{}{shape.WKT()}, nil
+	}
+	return "", nil, NewError(ErrorTypeUnsupported, fmt.Sprintf("operator %s is not a spatial operator", condition.Operator()))
+}
+
+// SpatialDistanceSQL returns an expression for the distance in meters between column and
+// point, for ordering results of a Near query by distance
+// Example: expr, args, err := gpa.SpatialDistanceSQL(gpa.SpatialPostGIS, "location", point)
+func SpatialDistanceSQL(dialect SpatialDialect, column string, point Point) (string, []interface{}, error) {
+	if !sqlIdentifier.MatchString(column) {
+		return "", nil, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("invalid spatial column %q", column))
+	}
+	switch dialect {
+	case SpatialPostGIS:
+		return fmt.Sprintf("ST_Distance(%s::geography, ST_GeogFromText(?))", column), []interface{}{"SRID=4326;" + point.WKT()}, nil
+	case SpatialSpatiaLite:
+		return fmt.Sprintf("ST_Distance(%s, MakePoint(?, ?, 4326), 1)", column), []interface{}{point.Lon, point.Lat}, nil
+	}
+	return "", nil, NewError(ErrorTypeUnsupported, fmt.Sprintf("unknown spatial dialect %q", dialect))
+}
+
+// =====================================
+// In-Memory Evaluation
+// =====================================
+
+// earthRadius is the mean Earth radius in meters
+const earthRadius = 6371008.8
+
+// Distance returns the great-circle distance between a and b in meters, using the haversine formula
+func Distance(a, b Point) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// matchGeo evaluates a spatial operator. Coordinates are treated as planar except for
+// distances, which is accurate enough for shapes that do not span large areas.
+func matchGeo(actual reflect.Value, op Operator, expected interface{}) (bool, error) {
+	shape, ok := toGeoShape(actual)
+	if !ok {
+		return false, nil
+	}
+
+	switch op {
+	case OpNear:
+		near, ok := expected.(GeoNear)
+		if !ok {
+			return false, NewError(ErrorTypeInvalidArgument, "near conditions expect a GeoNear value")
+		}
+		point, ok := shape.(Point)
+		if !ok {
+			return false, NewError(ErrorTypeUnsupported, "near conditions can only be evaluated on points in memory")
+		}
+		distance := Distance(point, near.Point)
+		return distance >= near.MinDistance && (near.MaxDistance <= 0 || distance <= near.MaxDistance), nil
+	case OpWithin, OpIntersects:
+		target, ok := expected.(GeoShape)
+		if !ok {
+			return false, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("%s conditions expect a GeoShape value", op))
+		}
+		if op == OpWithin {
+			return shapeWithin(shape, target), nil
+		}
+		return shapesIntersect(shape, target), nil
+	}
+	return false, NewError(ErrorTypeUnsupported, fmt.Sprintf("operator %s is not a spatial operator", op))
+}
+
+// toGeoShape converts a field value to a shape. GeoShape values, GeoJSON documents and
+// legacy [lon, lat] coordinate pairs are recognized.
+func toGeoShape(value reflect.Value) (GeoShape, bool) {
+	value = indirectValue(value)
+	if !value.IsValid() {
+		return nil, false
+	}
+	if shape, ok := value.Interface().(GeoShape); ok {
+		return shape, true
+	}
+
+	switch value.Kind() {
+	case reflect.Map:
+		data, err := json.Marshal(value.Interface())
+		if err != nil {
+			return nil, false
+		}
+		var object struct {
+			Type string `json:"type"`
+		}
+		json.Unmarshal(data, &object)
+		var shape GeoShape
+		switch object.Type {
+		case "Point":
+			var p Point
+			err = json.Unmarshal(data, &p)
+			shape = p
+		case "LineString":
+			var l LineString
+			err = json.Unmarshal(data, &l)
+			shape = l
+		case "Polygon":
+			var p Polygon
+			err = json.Unmarshal(data, &p)
+			shape = p
+		case "MultiPolygon":
+			var m MultiPolygon
+			err = json.Unmarshal(data, &m)
+			shape = m
+		default:
+			return nil, false
+		}
+		return shape, err == nil
+	case reflect.Slice, reflect.Array:
+		if value.Len() != 2 {
+			return nil, false
+		}
+		lon, lonOK := numericValue(indirectValue(value.Index(0)))
+		lat, latOK := numericValue(indirectValue(value.Index(1)))
+		return Point{Lon: lon, Lat: lat}, lonOK && latOK
+	}
+	return nil, false
+}
+
+// shapeParts splits a shape into its vertices, edges and polygon areas
+func shapeParts(shape GeoShape) (points []Point, edges [][2]Point, areas []Polygon) {
+	addRing := func(ring []Point) {
+		ring = closeRing(ring)
+		points = append(points, ring...)
+		for i := 1; i < len(ring); i++ {
+			edges = append(edges, [2]Point{ring[i-1], ring[i]})
+		}
+	}
+	switch s := shape.(type) {
+	case Point:
+		points = []Point{s}
+	case LineString:
+		points = append(points, s...)
+		for i := 1; i < len(s); i++ {
+			edges = append(edges, [2]Point{s[i-1], s[i]})
+		}
+	case Polygon:
+		for _, ring := range s {
+			addRing(ring)
+		}
+		areas = []Polygon{s}
+	case MultiPolygon:
+		for _, polygon := range s {
+			for _, ring := range polygon {
+				addRing(ring)
+			}
+		}
+		areas = s
+	}
+	return points, edges, areas
+}
+
+// shapeWithin reports whether every vertex of shape lies inside an area of target
+// and no edge of shape crosses the boundary of target
+func shapeWithin(shape, target GeoShape) bool {
+	points, edges, _ := shapeParts(shape)
+	_, targetEdges, areas := shapeParts(target)
+	if len(areas) == 0 || len(points) == 0 {
+		return false
+	}
+	for _, p := range points {
+		if !inAnyArea(p, areas) {
+			return false
+		}
+	}
+	for _, e := range edges {
+		for _, te := range targetEdges {
+			if segmentsCross(e[0], e[1], te[0], te[1]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// shapesIntersect reports whether two shapes share at least one point
+func shapesIntersect(a, b GeoShape) bool {
+	aPoints, aEdges, aAreas := shapeParts(a)
+	bPoints, bEdges, bAreas := shapeParts(b)
+	for _, p := range aPoints {
+		if inAnyArea(p, bAreas) || onAnyEdge(p, bEdges) || containsPoint(bPoints, p) && len(bEdges) == 0 {
+			return true
+		}
+	}
+	for _, p := range bPoints {
+		if inAnyArea(p, aAreas) || onAnyEdge(p, aEdges) {
+			return true
+		}
+	}
+	for _, ae := range aEdges {
+		for _, be := range bEdges {
+			if segmentsIntersect(ae[0], ae[1], be[0], be[1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsPoint(points []Point, p Point) bool {
+	for _, q := range points {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
+
+func inAnyArea(p Point, areas []Polygon) bool {
+	for _, area := range areas {
+		if pointInPolygon(p, area) {
+			return true
+		}
+	}
+	return false
+}
+
+func onAnyEdge(p Point, edges [][2]Point) bool {
+	for _, e := range edges {
+		if orientation(e[0], e[1], p) == 0 && onSegment(e[0], e[1], p) {
+			return true
+		}
+	}
+	return false
+}
+
+// pointInPolygon reports whether p lies inside the exterior ring of polygon and outside
+// its holes. Points on the boundary count as inside.
+func pointInPolygon(p Point, polygon Polygon) bool {
+	if len(polygon) == 0 {
+		return false
+	}
+	inRing := func(ring []Point) (inside, boundary bool) {
+		ring = closeRing(ring)
+		for i := 1; i < len(ring); i++ {
+			a, b := ring[i-1], ring[i]
+			if orientation(a, b, p) == 0 && onSegment(a, b, p) {
+				return true, true
+			}
+			if (a.Lat > p.Lat) != (b.Lat > p.Lat) &&
+				p.Lon < (b.Lon-a.Lon)*(p.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lon {
+				inside = !inside
+			}
+		}
+		return inside, false
+	}
+
+	if inside, _ := inRing(polygon[0]); !inside {
+		return false
+	}
+	for _, hole := range polygon[1:] {
+		if inside, boundary := inRing(hole); inside && !boundary {
+			return false
+		}
+	}
+	return true
+}
+
+// orientation returns the sign of the cross product of (b-a) and (c-a)
+func orientation(a, b, c Point) int {
+	cross := (b.Lon-a.Lon)*(c.Lat-a.Lat) - (b.Lat-a.Lat)*(c.Lon-a.Lon)
+	switch {
+	case math.Abs(cross) < 1e-12:
+		return 0
+	case cross > 0:
+		return 1
+	}
+	return -1
+}
+
+// onSegment reports whether the collinear point p lies between a and b
+func onSegment(a, b, p Point) bool {
+	return math.Min(a.Lon, b.Lon) <= p.Lon && p.Lon <= math.Max(a.Lon, b.Lon) &&
+		math.Min(a.Lat, b.Lat) <= p.Lat && p.Lat <= math.Max(a.Lat, b.Lat)
+}
+
+// segmentsIntersect reports whether segments ab and cd share a point
+func segmentsIntersect(a, b, c, d Point) bool {
+	o1, o2, o3, o4 := orientation(a, b, c), orientation(a, b, d), orientation(c, d, a), orientation(c, d, b)
+	if o1 != o2 && o3 != o4 {
+		return true
+	}
+	return (o1 == 0 && onSegment(a, b, c)) || (o2 == 0 && onSegment(a, b, d)) ||
+		(o3 == 0 && onSegment(c, d, a)) || (o4 == 0 && onSegment(c, d, b))
+}
+
+// segmentsCross reports whether segments ab and cd properly cross, not just touch
+func segmentsCross(a, b, c, d Point) bool {
+	o1, o2, o3, o4 := orientation(a, b, c), orientation(a, b, d), orientation(c, d, a), orientation(c, d, b)
+	return o1*o2 < 0 && o3*o4 < 0
+}
+
+// nearCondition returns the first top-level OpNear condition, if any
+func nearCondition(conditions []Condition) (string, GeoNear, bool) {
+	for _, c := range conditions {
+		if near, ok := c.Value().(GeoNear); ok && c.Operator() == OpNear {
+			return c.Field(), near, true
+		}
+	}
+	return "", GeoNear{}, false
+}
+
+// sortByDistance orders entities by the distance of the point at field from origin, nearest first
+func sortByDistance[T any](entities []*T, field string, origin Point) {
+	distances := make(map[*T]float64, len(entities))
+	for _, entity := range entities {
+		distances[entity] = math.Inf(1)
+		if value, ok := resolveFieldPath(reflect.ValueOf(entity), field); ok {
+			if point, ok := toGeoShape(value); ok {
+				if p, ok := point.(Point); ok {
+					distances[entity] = Distance(p, origin)
+				}
+			}
+		}
+	}
+	sort.SliceStable(entities, func(i, j int) bool {
+		return distances[entities[i]] < distances[entities[j]]
+	})
+}
@@ -0,0 +1,217 @@
+package gpa
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type geoPlace struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Location Point  `json:"location"`
+}
+
+type geoRoad struct {
+	ID   int        `json:"id"`
+	Path LineString `json:"path"`
+}
+
+// square returns the axis-aligned square polygon from (x0, y0) to (x1, y1)
+func square(x0, y0, x1, y1 float64) Polygon {
+	return Polygon{{{x0, y0}, {x1, y0}, {x1, y1}, {x0, y1}}}
+}
+
+func TestGeoJSON_RoundTrip(t *testing.T) {
+	polygon := Polygon{{{0, 0}, {4, 0}, {4, 4}, {0, 4}}, {{1, 1}, {2, 1}, {2, 2}}}
+	data, err := json.Marshal(polygon)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `{"coordinates":[[[0,0],[4,0],[4,4],[0,4],[0,0]],[[1,1],[2,1],[2,2],[1,1]]],"type":"Polygon"}`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	var decoded Polygon
+	if err := json.Unmarshal(data, &decoded); err != nil || len(decoded) != 2 || len(decoded[0]) != 5 {
+		t.Errorf("Expected closed rings after decoding, got %v (%v)", decoded, err)
+	}
+	var point Point
+	if err := json.Unmarshal(data, &point); !IsErrorType(err, ErrorTypeSerialization) {
+		t.Errorf("Expected type mismatch error, got %v", err)
+	}
+
+	if wkt := (MultiPolygon{square(0, 0, 1, 1)}).WKT(); wkt != "MULTIPOLYGON(((0 0,1 0,1 1,0 1,0 0)))" {
+		t.Errorf("Unexpected WKT: %s", wkt)
+	}
+	if wkt := NewPoint(-73.5, 40.25).WKT(); wkt != "POINT(-73.5 40.25)" {
+		t.Errorf("Unexpected WKT: %s", wkt)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	paris, london := NewPoint(2.3522, 48.8566), NewPoint(-0.1276, 51.5072)
+	if d := Distance(paris, london); math.Abs(d-343_500) > 1_000 {
+		t.Errorf("Expected about 343.5km from Paris to London, got %.0fm", d)
+	}
+	if d := Distance(paris, paris); d != 0 {
+		t.Errorf("Expected zero distance, got %f", d)
+	}
+}
+
+func TestPointInPolygon(t *testing.T) {
+	donut := Polygon{{{0, 0}, {4, 0}, {4, 4}, {0, 4}}, {{1, 1}, {3, 1}, {3, 3}, {1, 3}}}
+	tests := []struct {
+		point    Point
+		expected bool
+	}{
+		{Point{0.5, 0.5}, true},
+		{Point{2, 2}, false},
+		{Point{1, 2}, true},
+		{Point{4, 2}, true},
+		{Point{5, 2}, false},
+	}
+	for _, test := range tests {
+		if got := pointInPolygon(test.point, donut); got != test.expected {
+			t.Errorf("%v: expected %v, got %v", test.point, test.expected, got)
+		}
+	}
+}
+
+func TestMemoryRepository_GeoQueries(t *testing.T) {
+	repo := NewMemoryRepository[geoPlace]()
+	ctx := context.Background()
+	repo.CreateBatch(ctx, []*geoPlace{
+		{Name: "far", Location: NewPoint(0.01, 0)},
+		{Name: "near", Location: NewPoint(0.001, 0)},
+		{Name: "away", Location: NewPoint(1, 1)},
+	})
+
+	places, err := repo.Query(ctx, Near("location", NewPoint(0, 0), 2_000))
+	if err != nil || len(places) != 2 || places[0].Name != "near" || places[1].Name != "far" {
+		t.Fatalf("Expected near then far, got %v (%v)", places, err)
+	}
+	places, _ = repo.Query(ctx, Near("location", NewPoint(0, 0), 2_000), OrderBy("name", OrderAsc))
+	if places[0].Name != "far" {
+		t.Errorf("Expected explicit order to win over distance, got %v", places)
+	}
+
+	within, err := repo.Query(ctx, Within("location", MultiPolygon{square(0.5, 0.5, 2, 2), square(-1, -1, 0.005, 1)}))
+	if err != nil || len(within) != 2 || within[0].Name != "near" || within[1].Name != "away" {
+		t.Errorf("Expected near and away within the multipolygon, got %v (%v)", within, err)
+	}
+
+	roads := NewMemoryRepository[geoRoad]()
+	roads.CreateBatch(ctx, []*geoRoad{
+		{Path: LineString{{-1, 2}, {5, 2}}},
+		{Path: LineString{{1, 1}, {2, 2}}},
+		{Path: LineString{{5, 5}, {6, 6}}},
+	})
+	area := square(0, 0, 3, 3)
+	if crossing, _ := roads.Count(ctx, Intersects("path", area)); crossing != 2 {
+		t.Errorf("Expected 2 roads intersecting the area, got %d", crossing)
+	}
+	if inside, _ := roads.Query(ctx, Within("path", area)); len(inside) != 1 || inside[0].ID != 2 {
+		t.Errorf("Expected only the contained road, got %v", inside)
+	}
+}
+
+func TestMatchCondition_GeoDocuments(t *testing.T) {
+	doc := map[string]interface{}{
+		"loc":    map[string]interface{}{"type": "Point", "coordinates": []interface{}{1.0, 1.0}},
+		"legacy": []interface{}{1.0, 1.0},
+	}
+	area := square(0, 0, 2, 2)
+	for _, field := range []string{"loc", "legacy"} {
+		if ok, err := MatchCondition(doc, WhereCondition(field, OpWithin, area)); err != nil || !ok {
+			t.Errorf("%s: expected point within area, got %v (%v)", field, ok, err)
+		}
+	}
+	if ok, _ := MatchCondition(doc, WhereCondition("loc", OpIntersects, NewPoint(1, 1))); !ok {
+		t.Error("Expected equal points to intersect")
+	}
+	if _, err := MatchCondition(doc, WhereCondition("loc", OpWithin, "not a shape")); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected invalid argument error, got %v", err)
+	}
+}
+
+func TestConditionDocument_Geo(t *testing.T) {
+	near, err := ConditionDocument(WhereCondition("loc", OpNear, GeoNear{Point: NewPoint(1, 2), MaxDistance: 500}))
+	expected := map[string]interface{}{"loc": map[string]interface{}{"$nearSphere": map[string]interface{}{
+		"$geometry":    map[string]interface{}{"type": "Point", "coordinates": []float64{1, 2}},
+		"$maxDistance": 500.0,
+	}}}
+	if err != nil || !reflect.DeepEqual(near, expected) {
+		t.Errorf("Expected %v, got %v (%v)", expected, near, err)
+	}
+
+	within, _ := ConditionDocument(WhereCondition("loc", OpWithin, square(0, 0, 1, 1)))
+	geometry := within["loc"].(map[string]interface{})["$geoWithin"].(map[string]interface{})["$geometry"]
+	if geometry.(map[string]interface{})["type"] != "Polygon" {
+		t.Errorf("Expected $geoWithin polygon, got %v", within)
+	}
+	if intersects, _ := ConditionDocument(WhereCondition("loc", OpIntersects, LineString{{0, 0}, {1, 1}})); intersects["loc"].(map[string]interface{})["$geoIntersects"] == nil {
+		t.Errorf("Expected $geoIntersects, got %v", intersects)
+	}
+}
+
+func TestSpatialSQL(t *testing.T) {
+	tests := []struct {
+		dialect   SpatialDialect
+		condition Condition
+		clause    string
+		args      []interface{}
+	}{
+		{SpatialPostGIS, WhereCondition("location", OpNear, GeoNear{Point: NewPoint(1, 2), MaxDistance: 50}),
+			"ST_DWithin(location::geography, ST_GeogFromText(?), ?)", []interface{}{"SRID=4326;POINT(1 2)", 50.0}},
+		{SpatialSpatiaLite, WhereCondition("location", OpNear, GeoNear{Point: NewPoint(1, 2), MaxDistance: 50}),
+			"ST_Distance(location, MakePoint(?, ?, 4326), 1) <= ?", []interface{}{1.0, 2.0, 50.0}},
+		{SpatialPostGIS, WhereCondition("location", OpNear, GeoNear{Point: NewPoint(1, 2)}),
+			"location IS NOT NULL", nil},
+		{SpatialSpatiaLite, WhereCondition("location", OpNear, GeoNear{Point: NewPoint(1, 2), MinDistance: 10}),
+			"ST_Distance(location, MakePoint(?, ?, 4326), 1) >= ?", []interface{}{1.0, 2.0, 10.0}},
+		{SpatialPostGIS, WhereCondition("p.area", OpWithin, NewPoint(1, 2)),
+			"ST_Within(p.area, ST_GeomFromText(?, 4326))", []interface{}{"POINT(1 2)"}},
+		{SpatialSpatiaLite, WhereCondition("area", OpIntersects, LineString{{0, 0}, {1, 1}}),
+			"ST_Intersects(area, GeomFromText(?, 4326))", []interface{}{"LINESTRING(0 0,1 1)"}},
+	}
+	for _, test := range tests {
+		clause, args, err := SpatialSQL(test.dialect, test.condition)
+		if err != nil || clause != test.clause || !reflect.DeepEqual(args, test.args) {
+			t.Errorf("%s: expected %s %v, got %s %v (%v)", test.condition, test.clause, test.args, clause, args, err)
+		}
+	}
+
+	if _, _, err := SpatialSQL(SpatialPostGIS, WhereCondition("loc; DROP TABLE x", OpWithin, NewPoint(0, 0))); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected invalid column error, got %v", err)
+	}
+	if _, _, err := SpatialSQL(SpatialPostGIS, WhereCondition("loc", OpEqual, 1)); !IsErrorType(err, ErrorTypeUnsupported) {
+		t.Errorf("Expected unsupported operator error, got %v", err)
+	}
+}
+
+func TestPipeline_GeoNear(t *testing.T) {
+	docs := []map[string]interface{}{
+		{"name": "b", "loc": map[string]interface{}{"type": "Point", "coordinates": []interface{}{0.01, 0.0}}},
+		{"name": "a", "loc": []interface{}{0.001, 0.0}},
+		{"name": "c", "loc": []interface{}{3.0, 3.0}},
+	}
+	p := NewPipeline().GeoNear("loc", GeoNear{Point: NewPoint(0, 0), MaxDistance: 5_000}, "dist")
+
+	out, err := EvaluatePipeline(docs, p, nil)
+	if err != nil || len(out) != 2 || out[0]["name"] != "a" || out[1]["dist"].(float64) < 1_000 {
+		t.Fatalf("Expected a then b with distances, got %v (%v)", out, err)
+	}
+	if _, ok := docs[0]["dist"]; ok {
+		t.Error("Expected input documents to be left unchanged")
+	}
+
+	stages, _ := p.Stages()
+	geoNear := stages[0]["$geoNear"].(map[string]interface{})
+	if geoNear["key"] != "loc" || geoNear["distanceField"] != "dist" || geoNear["maxDistance"] != 5_000.0 || geoNear["spherical"] != true {
+		t.Errorf("Unexpected $geoNear stage: %v", geoNear)
+	}
+}
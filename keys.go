@@ -0,0 +1,509 @@
+package gpa
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// =====================================
+// Key Patterns
+// =====================================
+
+// keyPatternChars are the characters with a meaning in Keys and Scan glob patterns
+const keyPatternChars = `*?[]\`
+
+// EscapeKeyPattern escapes glob characters so s matches only itself in Keys and Scan
+// patterns. Redis and path.Match both use backslash escapes.
+// Example: keys, err := kv.Keys(ctx, gpa.EscapeKeyPattern(userInput)+":*")
+func EscapeKeyPattern(s string) string {
+	if !strings.ContainsAny(s, keyPatternChars) {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(keyPatternChars, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// =====================================
+// Key Templates
+// =====================================
+
+// KeyTemplate builds the keys of T from a template like "user:{id}:profile".
+// {id} is the primary key from EntityInfo.PrimaryKey; other placeholders name fields.
+type KeyTemplate[T any] struct {
+	template string
+	info     *EntityInfo
+}
+
+// Key returns a key template for T. The primary key is found from struct tags like
+// memory repositories do; use WithEntityInfo to take it from a repository instead.
+// An empty template defaults to "<entity>:{id}".
+// Example: profileKey := gpa.Key[User]("user:{id}:profile"); key, err := profileKey.For(&user)
+func Key[T any](template string) KeyTemplate[T] {
+	if template == "" {
+		template = strings.ToLower(entityName[T]()) + ":{id}"
+	}
+	return KeyTemplate[T]{template: template, info: memoryEntityInfo[T]()}
+}
+
+// WithEntityInfo returns the template using info for the primary key
+// Example: info, _ := repo.GetEntityInfo(); key := gpa.Key[User]("user:{id}").WithEntityInfo(info)
+func (k KeyTemplate[T]) WithEntityInfo(info *EntityInfo) KeyTemplate[T] {
+	k.info = info
+	return k
+}
+
+// String returns the template
+func (k KeyTemplate[T]) String() string {
+	return k.template
+}
+
+// expand writes the template with literals passed through literal and placeholders
+// replaced by value
+func (k KeyTemplate[T]) expand(literal func(string) string, value func(name string) (string, error)) (string, error) {
+	var b strings.Builder
+	rest := k.template
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			open = len(rest)
+		}
+		if strings.IndexByte(rest[:open], '}') >= 0 {
+			return "", NewError(ErrorTypeInvalidArgument, fmt.Sprintf("unexpected } in key template %q", k.template))
+		}
+		b.WriteString(literal(rest[:open]))
+		if open == len(rest) {
+			break
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return "", NewError(ErrorTypeInvalidArgument, fmt.Sprintf("unclosed placeholder in key template %q", k.template))
+		}
+		name := rest[open+1 : open+end]
+		if name == "" || strings.ContainsAny(name, "{") {
+			return "", NewError(ErrorTypeInvalidArgument, fmt.Sprintf("invalid placeholder in key template %q", k.template))
+		}
+		v, err := value(name)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(v)
+		rest = rest[open+end+1:]
+	}
+	return b.String(), nil
+}
+
+// For returns the key of entity
+func (k KeyTemplate[T]) For(entity *T) (string, error) {
+	return k.expand(func(s string) string { return s }, func(name string) (string, error) {
+		if name == "id" {
+			id, err := entityPrimaryKey(entity, k.info)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprint(id), nil
+		}
+		field, ok := resolveFieldPath(reflect.ValueOf(entity), name)
+		if !ok || !field.IsValid() {
+			return "", NewError(ErrorTypeInvalidArgument, fmt.Sprintf("key template %q: no value for {%s}", k.template, name)).WithEntity(entityName[T]())
+		}
+		return fmt.Sprint(field.Interface()), nil
+	})
+}
+
+// ID returns the key for the entity with the given primary key. The template may
+// only contain the {id} placeholder.
+// Example: key, err := gpa.Key[User]("user:{id}").ID(42)
+func (k KeyTemplate[T]) ID(id interface{}) (string, error) {
+	return k.expand(func(s string) string { return s }, func(name string) (string, error) {
+		if name != "id" {
+			return "", NewError(ErrorTypeInvalidArgument, fmt.Sprintf("key template %q needs {%s}, use For", k.template, name)).WithEntity(entityName[T]())
+		}
+		return fmt.Sprint(id), nil
+	})
+}
+
+// Pattern returns a Keys and Scan pattern matching every key of the template, with
+// literal parts escaped and placeholders matching anything
+// Example: pattern, _ := gpa.Key[User]("user:{id}:profile").Pattern() // "user:*:profile"
+func (k KeyTemplate[T]) Pattern() (string, error) {
+	return k.expand(EscapeKeyPattern, func(string) (string, error) { return "*", nil })
+}
+
+// =====================================
+// Key Namespaces
+// =====================================
+
+// KeyNamespace prefixes keys so services, environments and tenants sharing a store
+// cannot collide: "<Environment>:<Prefix>:<tenant>:<key>", skipping empty parts.
+type KeyNamespace struct {
+	// Environment separates deployments sharing a store, e.g. "staging"
+	Environment string
+
+	// Prefix separates services or repositories, e.g. "billing"
+	Prefix string
+
+	// Tenant adds the tenant from WithTenant. Keys cannot be built without one.
+	Tenant bool
+
+	// Separator joins the parts. Defaults to ":".
+	Separator string
+}
+
+// separator returns the configured separator or ":"
+func (n KeyNamespace) separator() string {
+	if n.Separator == "" {
+		return ":"
+	}
+	return n.Separator
+}
+
+// prefix returns the namespace prefix for ctx, ending with the separator
+func (n KeyNamespace) prefix(ctx context.Context) (string, error) {
+	sep := n.separator()
+	var b strings.Builder
+	for _, part := range []string{n.Environment, n.Prefix} {
+		if part != "" {
+			b.WriteString(part)
+			b.WriteString(sep)
+		}
+	}
+	if n.Tenant {
+		tenantID, err := requireTenant(ctx)
+		if err != nil {
+			return "", err
+		}
+		tenant := fmt.Sprint(tenantID)
+		// A tenant containing the separator or glob characters could reach another tenant's keys
+		if tenant == "" || strings.Contains(tenant, sep) || strings.ContainsAny(tenant, keyPatternChars) {
+			return "", NewError(ErrorTypeInvalidArgument, fmt.Sprintf("tenant %q cannot be used in keys", tenant))
+		}
+		b.WriteString(tenant)
+		b.WriteString(sep)
+	}
+	return b.String(), nil
+}
+
+// Key returns key within the namespace
+// Example: key, err := ns.Key(ctx, "user:1") // "prod:billing:acme:user:1"
+func (n KeyNamespace) Key(ctx context.Context, key string) (string, error) {
+	prefix, err := n.prefix(ctx)
+	if err != nil {
+		return "", err
+	}
+	return prefix + key, nil
+}
+
+// Pattern returns pattern within the namespace, with the namespace escaped
+func (n KeyNamespace) Pattern(ctx context.Context, pattern string) (string, error) {
+	prefix, err := n.prefix(ctx)
+	if err != nil {
+		return "", err
+	}
+	return EscapeKeyPattern(prefix) + pattern, nil
+}
+
+// =====================================
+// Namespaced Key-Value Provider
+// =====================================
+
+// namespacedKV applies a KeyNamespace to every key of a KeyValueProvider
+type namespacedKV struct {
+	KeyValueProvider
+	namespace KeyNamespace
+}
+
+// namespacedAtomicKV adds the atomic operations of the wrapped provider
+type namespacedAtomicKV struct {
+	*namespacedKV
+	atomic AtomicKeyValueProvider
+}
+
+// namespacedTransactionalKV adds Watch, namespacing the watched keys and the keys
+// of the transaction
+type namespacedTransactionalKV struct {
+	*namespacedAtomicKV
+	transactional TransactionalKeyValueProvider
+}
+
+// namespacedScripts adds Eval, namespacing the keys passed to the script. It is
+// combined with each of the wrappers above.
+type namespacedScripts struct {
+	scripts ScriptingKeyValueProvider
+	ns      KeyNamespace
+}
+
+type namespacedScriptingKV struct {
+	*namespacedKV
+	namespacedScripts
+}
+
+type namespacedAtomicScriptingKV struct {
+	*namespacedAtomicKV
+	namespacedScripts
+}
+
+type namespacedTransactionalScriptingKV struct {
+	*namespacedTransactionalKV
+	namespacedScripts
+}
+
+// NewNamespacedKeyValueProvider wraps kv so every key is placed in namespace, without
+// callers changing their keys. Keys and Scan return keys without the namespace.
+// The result implements AtomicKeyValueProvider, TransactionalKeyValueProvider and
+// ScriptingKeyValueProvider when kv does, so locks, rate limiters and transactions
+// can use it. Scripts get namespaced KEYS; keys they build from ARGV are not
+// namespaced. Hash, list, set and sorted set commands are not forwarded: use
+// KeyNamespace.Key with the underlying client for those.
+// Example: kv = gpa.NewNamespacedKeyValueProvider(kv, gpa.KeyNamespace{Environment: "prod", Prefix: "billing", Tenant: true})
+func NewNamespacedKeyValueProvider(kv KeyValueProvider, namespace KeyNamespace) KeyValueProvider {
+	base := &namespacedKV{KeyValueProvider: kv, namespace: namespace}
+	var wrapped KeyValueProvider = base
+	var atomicKV *namespacedAtomicKV
+	var transactionalKV *namespacedTransactionalKV
+	if atomic, ok := kv.(AtomicKeyValueProvider); ok {
+		atomicKV = &namespacedAtomicKV{namespacedKV: base, atomic: atomic}
+		wrapped = atomicKV
+		if transactional, ok := kv.(TransactionalKeyValueProvider); ok {
+			transactionalKV = &namespacedTransactionalKV{namespacedAtomicKV: atomicKV, transactional: transactional}
+			wrapped = transactionalKV
+		}
+	}
+
+	scripting, ok := kv.(ScriptingKeyValueProvider)
+	if !ok {
+		return wrapped
+	}
+	scripts := namespacedScripts{scripts: scripting, ns: namespace}
+	switch {
+	case transactionalKV != nil:
+		return &namespacedTransactionalScriptingKV{namespacedTransactionalKV: transactionalKV, namespacedScripts: scripts}
+	case atomicKV != nil:
+		return &namespacedAtomicScriptingKV{namespacedAtomicKV: atomicKV, namespacedScripts: scripts}
+	default:
+		return &namespacedScriptingKV{namespacedKV: base, namespacedScripts: scripts}
+	}
+}
+
+// Set implements KeyValueProvider
+func (p *namespacedKV) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	key, err := p.namespace.Key(ctx, key)
+	if err != nil {
+		return err
+	}
+	return p.KeyValueProvider.Set(ctx, key, value, ttl)
+}
+
+// Get implements KeyValueProvider
+func (p *namespacedKV) Get(ctx context.Context, key string) (interface{}, error) {
+	key, err := p.namespace.Key(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return p.KeyValueProvider.Get(ctx, key)
+}
+
+// Delete implements KeyValueProvider
+func (p *namespacedKV) Delete(ctx context.Context, key string) error {
+	key, err := p.namespace.Key(ctx, key)
+	if err != nil {
+		return err
+	}
+	return p.KeyValueProvider.Delete(ctx, key)
+}
+
+// Exists implements KeyValueProvider
+func (p *namespacedKV) Exists(ctx context.Context, key string) (bool, error) {
+	key, err := p.namespace.Key(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	return p.KeyValueProvider.Exists(ctx, key)
+}
+
+// Expire implements KeyValueProvider
+func (p *namespacedKV) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	key, err := p.namespace.Key(ctx, key)
+	if err != nil {
+		return err
+	}
+	return p.KeyValueProvider.Expire(ctx, key, ttl)
+}
+
+// TTL implements KeyValueProvider
+func (p *namespacedKV) TTL(ctx context.Context, key string) (time.Duration, error) {
+	key, err := p.namespace.Key(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return p.KeyValueProvider.TTL(ctx, key)
+}
+
+// Keys implements KeyValueProvider, matching pattern within the namespace
+func (p *namespacedKV) Keys(ctx context.Context, pattern string) ([]string, error) {
+	prefix, err := p.namespace.prefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := p.KeyValueProvider.Keys(ctx, EscapeKeyPattern(prefix)+pattern)
+	return trimKeyPrefix(keys, prefix), err
+}
+
+// Scan implements KeyScanner. Providers without Scan are read with Keys in one page.
+func (p *namespacedKV) Scan(ctx context.Context, cursor uint64, pattern string, count int64) ([]string, uint64, error) {
+	prefix, err := p.namespace.prefix(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	scanner, ok := p.KeyValueProvider.(KeyScanner)
+	if !ok {
+		keys, err := p.KeyValueProvider.Keys(ctx, EscapeKeyPattern(prefix)+pattern)
+		return trimKeyPrefix(keys, prefix), 0, err
+	}
+	keys, next, err := scanner.Scan(ctx, cursor, EscapeKeyPattern(prefix)+pattern, count)
+	return trimKeyPrefix(keys, prefix), next, err
+}
+
+// trimKeyPrefix removes prefix from each key
+func trimKeyPrefix(keys []string, prefix string) []string {
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, prefix)
+	}
+	return keys
+}
+
+// SetIfAbsent implements AtomicKeyValueProvider
+func (p *namespacedAtomicKV) SetIfAbsent(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	key, err := p.namespace.Key(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	return p.atomic.SetIfAbsent(ctx, key, value, ttl)
+}
+
+// CompareAndDelete implements AtomicKeyValueProvider
+func (p *namespacedAtomicKV) CompareAndDelete(ctx context.Context, key string, expected interface{}) (bool, error) {
+	key, err := p.namespace.Key(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	return p.atomic.CompareAndDelete(ctx, key, expected)
+}
+
+// CompareAndExpire implements AtomicKeyValueProvider
+func (p *namespacedAtomicKV) CompareAndExpire(ctx context.Context, key string, expected interface{}, ttl time.Duration) (bool, error) {
+	key, err := p.namespace.Key(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	return p.atomic.CompareAndExpire(ctx, key, expected, ttl)
+}
+
+// Increment implements AtomicKeyValueProvider
+func (p *namespacedAtomicKV) Increment(ctx context.Context, key string, delta int64) (int64, error) {
+	key, err := p.namespace.Key(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return p.atomic.Increment(ctx, key, delta)
+}
+
+// CompareAndSwap implements AtomicKeyValueProvider
+func (p *namespacedAtomicKV) CompareAndSwap(ctx context.Context, key string, expected, value interface{}, ttl time.Duration) (bool, error) {
+	key, err := p.namespace.Key(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	return p.atomic.CompareAndSwap(ctx, key, expected, value, ttl)
+}
+
+// GetAndSet implements AtomicKeyValueProvider
+func (p *namespacedAtomicKV) GetAndSet(ctx context.Context, key string, value interface{}, ttl time.Duration) (interface{}, error) {
+	key, err := p.namespace.Key(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return p.atomic.GetAndSet(ctx, key, value, ttl)
+}
+
+// Watch implements TransactionalKeyValueProvider
+func (p *namespacedTransactionalKV) Watch(ctx context.Context, fn func(tx KVTx) error, keys ...string) error {
+	prefix, err := p.namespace.prefix(ctx)
+	if err != nil {
+		return err
+	}
+	namespaced := make([]string, len(keys))
+	for i, key := range keys {
+		namespaced[i] = prefix + key
+	}
+	return p.transactional.Watch(ctx, func(tx KVTx) error {
+		return fn(&namespacedKVTx{tx: tx, prefix: prefix})
+	}, namespaced...)
+}
+
+// namespacedKVTx prefixes the keys of a KVTx. The prefix is resolved once by Watch,
+// as Set and Delete take no context.
+type namespacedKVTx struct {
+	tx     KVTx
+	prefix string
+}
+
+// Get implements KVTx
+func (t *namespacedKVTx) Get(ctx context.Context, key string) (interface{}, error) {
+	return t.tx.Get(ctx, t.prefix+key)
+}
+
+// Set implements KVTx
+func (t *namespacedKVTx) Set(key string, value interface{}, ttl time.Duration) {
+	t.tx.Set(t.prefix+key, value, ttl)
+}
+
+// Delete implements KVTx
+func (t *namespacedKVTx) Delete(key string) {
+	t.tx.Delete(t.prefix + key)
+}
+
+// Eval implements ScriptingKeyValueProvider
+func (s namespacedScripts) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	prefix, err := s.ns.prefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	namespaced := make([]string, len(keys))
+	for i, key := range keys {
+		namespaced[i] = prefix + key
+	}
+	return s.scripts.Eval(ctx, script, namespaced, args...)
+}
+
+// updater returns the in-memory updates of the wrapped provider within the namespace,
+// for rate limiters
+func (p *namespacedKV) updater() (kvUpdater, bool) {
+	store, ok := p.KeyValueProvider.(kvUpdater)
+	if !ok {
+		return nil, false
+	}
+	return namespacedUpdater{store: store, namespace: p.namespace}, true
+}
+
+// namespacedUpdater prefixes the keys of a kvUpdater
+type namespacedUpdater struct {
+	store     kvUpdater
+	namespace KeyNamespace
+}
+
+func (u namespacedUpdater) updateKV(ctx context.Context, key string, fn func(current interface{}) (interface{}, time.Duration)) error {
+	key, err := u.namespace.Key(ctx, key)
+	if err != nil {
+		return err
+	}
+	return u.store.updateKV(ctx, key, fn)
+}
@@ -0,0 +1,174 @@
+package gpa
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+)
+
+type keyedAccount struct {
+	AccountID int    `json:"account_id" gorm:"primaryKey"`
+	Region    string `json:"region"`
+}
+
+func TestEscapeKeyPattern(t *testing.T) {
+	tests := map[string]string{
+		"user:1":     "user:1",
+		"a*b?":       `a\*b\?`,
+		`x[1]\y`:     `x\[1\]\\y`,
+		"unicode:é*": `unicode:é\*`,
+	}
+	for input, expected := range tests {
+		if got := EscapeKeyPattern(input); got != expected {
+			t.Errorf("EscapeKeyPattern(%q): expected %q, got %q", input, expected, got)
+		}
+	}
+
+	provider := NewMemoryProvider()
+	ctx := context.Background()
+	provider.Set(ctx, "tag:*", 1, 0)
+	provider.Set(ctx, "tag:go", 1, 0)
+	if keys, _ := provider.Keys(ctx, EscapeKeyPattern("tag:*")); len(keys) != 1 || keys[0] != "tag:*" {
+		t.Errorf("Expected escaped pattern to match only itself, got %v", keys)
+	}
+}
+
+func TestKeyTemplate(t *testing.T) {
+	account := &keyedAccount{AccountID: 7, Region: "eu"}
+
+	key, err := Key[keyedAccount]("account:{id}:{region}").For(account)
+	if err != nil || key != "account:7:eu" {
+		t.Errorf("Expected account:7:eu, got %q (%v)", key, err)
+	}
+	if key, _ := Key[keyedAccount]("").ID(7); key != "keyedaccount:7" {
+		t.Errorf("Expected default template, got %q", key)
+	}
+	if _, err := Key[keyedAccount]("account:{id}:{region}").ID(7); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected ID to reject other placeholders, got %v", err)
+	}
+
+	info := &EntityInfo{PrimaryKey: []string{"Region"}}
+	if key, _ := Key[keyedAccount]("region:{id}").WithEntityInfo(info).For(account); key != "region:eu" {
+		t.Errorf("Expected primary key from entity info, got %q", key)
+	}
+
+	if pattern, err := Key[keyedAccount]("acct[{region}]:{id}").Pattern(); err != nil || pattern != `acct\[*\]:*` {
+		t.Errorf("Expected escaped pattern, got %q (%v)", pattern, err)
+	}
+	for _, template := range []string{"account:{id", "account:id}", "account:{}"} {
+		if _, err := Key[keyedAccount](template).For(account); !IsErrorType(err, ErrorTypeInvalidArgument) {
+			t.Errorf("%q: expected invalid template error, got %v", template, err)
+		}
+	}
+	if _, err := Key[keyedAccount]("account:{missing}").For(account); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected error for unknown field, got %v", err)
+	}
+}
+
+func TestNamespacedKeyValueProvider(t *testing.T) {
+	store := NewMemoryProvider()
+	kv := NewNamespacedKeyValueProvider(store, KeyNamespace{Environment: "prod", Prefix: "billing", Tenant: true})
+	acme := WithTenant(context.Background(), "acme")
+	globex := WithTenant(context.Background(), "globex")
+
+	kv.Set(acme, "user:1", "ada", 0)
+	kv.Set(globex, "user:1", "bob", 0)
+	if value, _ := store.Get(context.Background(), "prod:billing:acme:user:1"); value != "ada" {
+		t.Errorf("Expected namespaced key in the store, got %v", value)
+	}
+	if value, _ := kv.Get(globex, "user:1"); value != "bob" {
+		t.Errorf("Expected tenants to be isolated, got %v", value)
+	}
+
+	keys, _ := kv.Keys(acme, "user:*")
+	if len(keys) != 1 || keys[0] != "user:1" {
+		t.Errorf("Expected stripped keys of one tenant, got %v", keys)
+	}
+	var scanned []string
+	for key, err := range ScanKeys(globex, kv.(KeyScanner), "*", 10) {
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		scanned = append(scanned, key)
+	}
+	sort.Strings(scanned)
+	if len(scanned) != 1 || scanned[0] != "user:1" {
+		t.Errorf("Expected scan within the tenant, got %v", scanned)
+	}
+
+	if _, err := kv.Get(context.Background(), "user:1"); !IsErrorType(err, ErrorTypePermission) {
+		t.Errorf("Expected missing tenant to fail closed, got %v", err)
+	}
+	if _, err := kv.Keys(WithTenant(context.Background(), "*"), "*"); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected glob tenant to be rejected, got %v", err)
+	}
+
+	atomic, ok := AsAtomicKeyValueProvider(kv)
+	if !ok {
+		t.Fatal("Expected atomic operations to be kept")
+	}
+	if n, _ := atomic.Increment(acme, "hits", 2); n != 2 {
+		t.Errorf("Expected counter 2, got %d", n)
+	}
+	if ok, _ := atomic.SetIfAbsent(acme, "user:1", "eve", time.Minute); ok {
+		t.Error("Expected existing namespaced key to be seen")
+	}
+	if _, ok := AsAtomicKeyValueProvider(NewNamespacedKeyValueProvider(newCodecKV(), KeyNamespace{Prefix: "x"})); ok {
+		t.Error("Expected no atomic operations for a basic provider")
+	}
+}
+
+func TestNamespacedKeyValueProvider_Forwarding(t *testing.T) {
+	store := NewMemoryProvider()
+	kv := NewNamespacedKeyValueProvider(store, KeyNamespace{Prefix: "billing", Tenant: true})
+	acme := WithTenant(context.Background(), "acme")
+
+	transactional, ok := kv.(TransactionalKeyValueProvider)
+	if !ok {
+		t.Fatal("Expected transactions to be kept")
+	}
+	kv.Set(acme, "balance", int64(10), 0)
+	err := transactional.Watch(acme, func(tx KVTx) error {
+		balance, err := tx.Get(acme, "balance")
+		if err != nil {
+			return err
+		}
+		tx.Set("balance", balance.(int64)-3, 0)
+		tx.Delete("pending")
+		return nil
+	}, "balance")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if value, _ := store.Get(context.Background(), "billing:acme:balance"); value != int64(7) {
+		t.Errorf("Expected the transaction to write the namespaced key, got %v", value)
+	}
+	if err := transactional.Watch(context.Background(), func(KVTx) error { return nil }, "balance"); !IsErrorType(err, ErrorTypePermission) {
+		t.Errorf("Expected missing tenant to fail closed, got %v", err)
+	}
+
+	limiter, err := NewRateLimiter(kv, RateLimit{Algorithm: TokenBucket, Limit: 1, Period: time.Minute, KeyPrefix: "rl:"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res, err := limiter.Allow(acme, "k"); err != nil || !res.Allowed {
+		t.Errorf("Expected the first request to be allowed, got %+v (%v)", res, err)
+	}
+	if ok, _ := store.Exists(context.Background(), "billing:acme:rl:k"); !ok {
+		t.Error("Expected the bucket under the namespaced key")
+	}
+	if res, _ := limiter.Allow(WithTenant(context.Background(), "globex"), "k"); !res.Allowed {
+		t.Errorf("Expected tenants to have separate buckets, got %+v", res)
+	}
+
+	scripted := &scriptedKVProvider{tracingKVProvider: newCodecKV(), reply: "OK"}
+	scripting, ok := NewNamespacedKeyValueProvider(scripted, KeyNamespace{Prefix: "billing"}).(ScriptingKeyValueProvider)
+	if !ok {
+		t.Fatal("Expected scripts to be kept")
+	}
+	scripting.Eval(context.Background(), "return 1", []string{"a", "b"}, "arg")
+	if len(scripted.keys) != 2 || scripted.keys[0] != "billing:a" || scripted.keys[1] != "billing:b" || scripted.args[0] != "arg" {
+		t.Errorf("Expected namespaced KEYS and untouched ARGV, got %v %v", scripted.keys, scripted.args)
+	}
+}
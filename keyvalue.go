@@ -101,12 +101,34 @@ type IncrementKeyValueRepository interface {
 	Decrement(ctx context.Context, key string, delta int64) (int64, error)
 }
 
+// ConditionalKeyValueRepository provides conditional writes for safe read-modify-write.
+// Redis implements them with SET NX, GETSET and short Lua scripts.
+type ConditionalKeyValueRepository[T any] interface {
+	BasicKeyValueRepository[T]
+
+	// CompareAndSwap stores value only if the current value equals expected.
+	// A nil expected value means the key must not exist.
+	// Returns false without writing if the value changed.
+	// Example: swapped, err := CompareAndSwap(ctx, "user:123", old, updated)
+	CompareAndSwap(ctx context.Context, key string, expected, value *T) (bool, error)
+
+	// SetIfAbsent stores value only if the key does not exist.
+	// Returns true if the value was stored.
+	// Example: created, err := SetIfAbsent(ctx, "user:123", user)
+	SetIfAbsent(ctx context.Context, key string, value *T) (bool, error)
+
+	// GetAndSet stores value and returns the previous value.
+	// Returns nil if the key did not exist.
+	// Example: previous, err := GetAndSet(ctx, "config:current", config)
+	GetAndSet(ctx context.Context, key string, value *T) (*T, error)
+}
+
 // PatternKeyValueRepository provides pattern-based key operations.
 // Useful for finding keys that match certain patterns.
 type PatternKeyValueRepository interface {
 	// Keys returns all keys matching the given pattern.
 	// Uses glob-style patterns (*, ?, [abc], etc.).
-	// WARNING: Can be slow with large datasets - use with caution.
+	// WARNING: Can be slow with large datasets - prefer ScanKeys, which pages with Scan.
 	// Example: keys, err := Keys(ctx, "user:*")
 	Keys(ctx context.Context, pattern string) ([]string, error)
 
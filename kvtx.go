@@ -0,0 +1,176 @@
+package gpa
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// =====================================
+// Key-Value Transactions
+// =====================================
+
+// KVTx is an optimistic key-value transaction. Reads see current values; writes are
+// queued and applied together when the transaction commits.
+type KVTx interface {
+	// Get reads the current value of key, returning ErrorTypeNotFound if it is missing.
+	// Only watched keys are checked for changes at commit.
+	Get(ctx context.Context, key string) (interface{}, error)
+
+	// Set queues a write of value to key
+	Set(key string, value interface{}, ttl time.Duration)
+
+	// Delete queues the deletion of key
+	Delete(key string)
+}
+
+// kvWrite is a write queued on a KVTx
+type kvWrite struct {
+	key    string
+	value  interface{}
+	ttl    time.Duration
+	delete bool
+}
+
+// NewWatchConflictError returns the error Watch reports when watched keys changed
+// before commit. It is retryable, so Retry and KVTransaction run the transaction again.
+func NewWatchConflictError(keys ...string) error {
+	return NewError(ErrorTypeTransaction, fmt.Sprintf("watched keys %v changed", keys)).WithRetryable()
+}
+
+// KVTransaction runs fn in an optimistic transaction watching keys, and runs it again
+// when another client changed a watched key before commit. fn may run several times,
+// so it should have no side effects besides the writes queued on tx. A zero policy
+// uses DefaultRetryPolicy. Timeouts and connection errors are only retried when
+// policy.RetryWrites is set, since the writes may have been applied before they occurred.
+// Example:
+//
+//	err := gpa.KVTransaction(ctx, kv, gpa.RetryPolicy{}, func(tx gpa.KVTx) error {
+//	    from, _ := tx.Get(ctx, "balance:a")
+//	    to, _ := tx.Get(ctx, "balance:b")
+//	    tx.Set("balance:a", toInt(from)-10, 0)
+//	    tx.Set("balance:b", toInt(to)+10, 0)
+//	    return nil
+//	}, "balance:a", "balance:b")
+func KVTransaction(ctx context.Context, kv TransactionalKeyValueProvider, policy RetryPolicy, fn func(tx KVTx) error, keys ...string) error {
+	if policy.MaxAttempts == 0 && policy.InitialBackoff == 0 {
+		policy = DefaultRetryPolicy()
+	}
+	return Retry(ctx, policy.forWrites(), func(ctx context.Context) error {
+		return kv.Watch(ctx, fn, keys...)
+	})
+}
+
+// =====================================
+// Conditional Writes
+// =====================================
+
+// atomic returns the store's provider as an AtomicKeyValueProvider
+func (s *KVStore[T]) atomic() (AtomicKeyValueProvider, error) {
+	if kv, ok := s.kv.(AtomicKeyValueProvider); ok {
+		return kv, nil
+	}
+	return nil, NewError(ErrorTypeUnsupported, "provider does not support conditional writes").WithEntity(entityName[T]())
+}
+
+// SetIfAbsent stores value under key only if key does not exist, reporting whether it did
+// Example: created, err := store.SetIfAbsent(ctx, "user:1", &user, 0)
+func (s *KVStore[T]) SetIfAbsent(ctx context.Context, key string, value *T, ttl time.Duration) (bool, error) {
+	kv, err := s.atomic()
+	if err != nil {
+		return false, err
+	}
+	data, err := EncodeValue(s.codec, s.compressor, value)
+	if err != nil {
+		return false, err
+	}
+	return kv.SetIfAbsent(ctx, key, data, ttl)
+}
+
+// GetAndSet stores value under key and returns the previous value, nil if there was none
+func (s *KVStore[T]) GetAndSet(ctx context.Context, key string, value *T, ttl time.Duration) (*T, error) {
+	kv, err := s.atomic()
+	if err != nil {
+		return nil, err
+	}
+	data, err := EncodeValue(s.codec, s.compressor, value)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := kv.GetAndSet(ctx, key, data, ttl)
+	if err != nil || previous == nil {
+		return nil, err
+	}
+	return decodeStored[T](previous, s.codec, s.compressor)
+}
+
+// load returns the stored value of key and its decoding, both nil if key is missing
+func (s *KVStore[T]) load(ctx context.Context, key string) (interface{}, *T, error) {
+	raw, err := s.kv.Get(ctx, key)
+	if IsNotFound(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	current, err := decodeStored[T](raw, s.codec, s.compressor)
+	return raw, current, err
+}
+
+// CompareAndSwap stores value under key only if the current value equals expected, or
+// if key does not exist when expected is nil. Values are compared decoded, so values
+// written with another codec still match; the swap is conditional on the stored bytes.
+// Example: swapped, err := store.CompareAndSwap(ctx, "user:1", old, &updated, 0)
+func (s *KVStore[T]) CompareAndSwap(ctx context.Context, key string, expected, value *T, ttl time.Duration) (bool, error) {
+	kv, err := s.atomic()
+	if err != nil {
+		return false, err
+	}
+	raw, current, err := s.load(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if (expected == nil) != (current == nil) || (current != nil && !reflect.DeepEqual(current, expected)) {
+		return false, nil
+	}
+	data, err := EncodeValue(s.codec, s.compressor, value)
+	if err != nil {
+		return false, err
+	}
+	return kv.CompareAndSwap(ctx, key, raw, data, ttl)
+}
+
+// Update reads the value of key, nil if missing, and stores what fn returns, retrying
+// with the default policy when another client wrote the key in between.
+// fn may run several times. Other errors are returned, as the write may have been applied.
+// Example: user, err := store.Update(ctx, "user:1", 0, func(u *User) (*User, error) { u.Visits++; return u, nil })
+func (s *KVStore[T]) Update(ctx context.Context, key string, ttl time.Duration, fn func(current *T) (*T, error)) (*T, error) {
+	kv, err := s.atomic()
+	if err != nil {
+		return nil, err
+	}
+	var result *T
+	err = Retry(ctx, DefaultRetryPolicy().forWrites(), func(ctx context.Context) error {
+		raw, current, err := s.load(ctx, key)
+		if err != nil {
+			return err
+		}
+		next, err := fn(current)
+		if err != nil {
+			return err
+		}
+		data, err := EncodeValue(s.codec, s.compressor, next)
+		if err != nil {
+			return err
+		}
+		if swapped, err := kv.CompareAndSwap(ctx, key, raw, data, ttl); err != nil {
+			return err
+		} else if !swapped {
+			return NewWatchConflictError(key)
+		}
+		result = next
+		return nil
+	})
+	return result, err
+}
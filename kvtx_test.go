@@ -0,0 +1,191 @@
+package gpa
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type kvCounter struct {
+	Name  string
+	Count int
+}
+
+func TestMemoryProvider_CompareAndSwap(t *testing.T) {
+	provider := NewMemoryProvider()
+	ctx := context.Background()
+
+	if ok, _ := provider.CompareAndSwap(ctx, "k", nil, "v1", 0); !ok {
+		t.Error("Expected swap of a missing key with nil expected")
+	}
+	if ok, _ := provider.CompareAndSwap(ctx, "k", nil, "v2", 0); ok {
+		t.Error("Expected nil expected to fail on an existing key")
+	}
+	if ok, _ := provider.CompareAndSwap(ctx, "k", []byte("v1"), "v2", time.Minute); !ok {
+		t.Error("Expected swap when bytes equal the stored string")
+	}
+	if ok, _ := provider.CompareAndSwap(ctx, "k", "v1", "v3", 0); ok {
+		t.Error("Expected swap to fail on a stale value")
+	}
+	if ttl, _ := provider.TTL(ctx, "k"); ttl <= 0 {
+		t.Errorf("Expected swap to set the ttl, got %v", ttl)
+	}
+
+	previous, _ := provider.GetAndSet(ctx, "k", "v4", 0)
+	if previous != "v2" {
+		t.Errorf("Expected previous value v2, got %v", previous)
+	}
+	if previous, _ := provider.GetAndSet(ctx, "new", "x", 0); previous != nil {
+		t.Errorf("Expected nil for a missing key, got %v", previous)
+	}
+}
+
+func TestMemoryProvider_Watch(t *testing.T) {
+	provider := NewMemoryProvider()
+	ctx := context.Background()
+	provider.Set(ctx, "a", int64(10), 0)
+	provider.Set(ctx, "b", int64(0), 0)
+
+	err := provider.Watch(ctx, func(tx KVTx) error {
+		a, _ := tx.Get(ctx, "a")
+		tx.Set("a", a.(int64)-3, 0)
+		tx.Set("b", int64(3), 0)
+		tx.Delete("gone")
+		provider.Set(ctx, "a", int64(10), 0) // concurrent write of the same value
+		return nil
+	}, "a", "b")
+	if !IsErrorType(err, ErrorTypeTransaction) || !IsRetryable(err) {
+		t.Fatalf("Expected retryable conflict, got %v", err)
+	}
+	if b, _ := provider.Get(ctx, "b"); b != int64(0) {
+		t.Errorf("Expected no writes after a conflict, got b=%v", b)
+	}
+
+	attempts := 0
+	err = KVTransaction(ctx, provider, RetryPolicy{MaxAttempts: 3}, func(tx KVTx) error {
+		attempts++
+		a, _ := tx.Get(ctx, "a")
+		b, _ := tx.Get(ctx, "b")
+		if attempts == 1 {
+			provider.Increment(ctx, "b", 1)
+		}
+		tx.Set("a", a.(int64)-3, 0)
+		tx.Set("b", b.(int64)+3, 0)
+		return nil
+	}, "a", "b")
+	if err != nil || attempts != 2 {
+		t.Fatalf("Expected success on the second attempt, got %v after %d", err, attempts)
+	}
+	a, _ := provider.Get(ctx, "a")
+	b, _ := provider.Get(ctx, "b")
+	if a != int64(7) || b != int64(4) {
+		t.Errorf("Expected a=7 b=4, got a=%v b=%v", a, b)
+	}
+}
+
+func TestKVStore_ConditionalWrites(t *testing.T) {
+	provider := NewMemoryProvider()
+	store := NewKVStore[kvCounter](provider, nil, nil)
+	ctx := context.Background()
+
+	if ok, err := store.SetIfAbsent(ctx, "c", &kvCounter{Name: "hits"}, 0); !ok || err != nil {
+		t.Fatalf("Expected first SetIfAbsent to store, got %v (%v)", ok, err)
+	}
+	if ok, _ := store.SetIfAbsent(ctx, "c", &kvCounter{Name: "other"}, 0); ok {
+		t.Error("Expected second SetIfAbsent to be rejected")
+	}
+
+	// A value written with another codec still compares equal once decoded
+	NewKVStore[kvCounter](provider, GobCodec{}, nil).Set(ctx, "c", &kvCounter{Name: "hits", Count: 1}, 0)
+	if ok, _ := store.CompareAndSwap(ctx, "c", &kvCounter{Name: "hits"}, &kvCounter{Name: "hits", Count: 9}, 0); ok {
+		t.Error("Expected swap to fail on a stale expected value")
+	}
+	if ok, err := store.CompareAndSwap(ctx, "c", &kvCounter{Name: "hits", Count: 1}, &kvCounter{Name: "hits", Count: 2}, 0); !ok || err != nil {
+		t.Errorf("Expected swap across codecs, got %v (%v)", ok, err)
+	}
+
+	previous, err := store.GetAndSet(ctx, "c", &kvCounter{Name: "hits", Count: 5}, 0)
+	if err != nil || previous.Count != 2 {
+		t.Errorf("Expected previous count 2, got %+v (%v)", previous, err)
+	}
+
+	calls := 0
+	updated, err := store.Update(ctx, "c", 0, func(c *kvCounter) (*kvCounter, error) {
+		if calls++; calls == 1 {
+			store.Set(ctx, "c", &kvCounter{Name: "hits", Count: 100}, 0)
+		}
+		c.Count++
+		return c, nil
+	})
+	if err != nil || calls != 2 || updated.Count != 101 {
+		t.Errorf("Expected update retried after a concurrent write, got %+v after %d calls (%v)", updated, calls, err)
+	}
+	created, err := store.Update(ctx, "fresh", 0, func(c *kvCounter) (*kvCounter, error) {
+		if c != nil {
+			t.Errorf("Expected nil for a missing key, got %+v", c)
+		}
+		return &kvCounter{Name: "fresh", Count: 1}, nil
+	})
+	if err != nil || created.Count != 1 {
+		t.Errorf("Expected update to create the key, got %+v (%v)", created, err)
+	}
+
+	if _, err := NewKVStore[kvCounter](newCodecKV(), nil, nil).SetIfAbsent(ctx, "c", &kvCounter{}, 0); !IsErrorType(err, ErrorTypeUnsupported) {
+		t.Errorf("Expected unsupported error without atomic operations, got %v", err)
+	}
+}
+
+// lostReplyKV applies writes and then reports a lost connection, as when the
+// connection drops after EXEC
+type lostReplyKV struct {
+	*MemoryProvider
+}
+
+func (p lostReplyKV) Watch(ctx context.Context, fn func(tx KVTx) error, keys ...string) error {
+	if err := p.MemoryProvider.Watch(ctx, fn, keys...); err != nil {
+		return err
+	}
+	return NewError(ErrorTypeConnection, "connection reset after EXEC")
+}
+
+func (p lostReplyKV) CompareAndSwap(ctx context.Context, key string, expected, value interface{}, ttl time.Duration) (bool, error) {
+	if _, err := p.MemoryProvider.CompareAndSwap(ctx, key, expected, value, ttl); err != nil {
+		return false, err
+	}
+	return false, NewError(ErrorTypeConnection, "connection reset after CAS")
+}
+
+func TestKVTransaction_NoRetryAfterLostReply(t *testing.T) {
+	provider := NewMemoryProvider()
+	kv := lostReplyKV{provider}
+	ctx := context.Background()
+	provider.Set(ctx, "a", int64(10), 0)
+
+	attempts := 0
+	err := KVTransaction(ctx, kv, RetryPolicy{MaxAttempts: 3}, func(tx KVTx) error {
+		attempts++
+		a, _ := tx.Get(ctx, "a")
+		tx.Set("a", a.(int64)-3, 0)
+		return nil
+	}, "a")
+	if !IsErrorType(err, ErrorTypeConnection) || attempts != 1 {
+		t.Errorf("Expected the connection error without a retry, got %v after %d attempts", err, attempts)
+	}
+	if a, _ := provider.Get(ctx, "a"); a != int64(7) {
+		t.Errorf("Expected the writes applied once, got a=%v", a)
+	}
+
+	store := NewKVStore[kvCounter](kv, nil, nil)
+	store.Set(ctx, "c", &kvCounter{Name: "visits"}, 0)
+	calls := 0
+	if _, err := store.Update(ctx, "c", 0, func(c *kvCounter) (*kvCounter, error) {
+		calls++
+		c.Count++
+		return c, nil
+	}); !IsErrorType(err, ErrorTypeConnection) || calls != 1 {
+		t.Errorf("Expected the connection error without a retry, got %v after %d calls", err, calls)
+	}
+	if c, _ := store.Get(ctx, "c"); c == nil || c.Count != 1 {
+		t.Errorf("Expected the update applied once, got %+v", c)
+	}
+}
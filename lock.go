@@ -0,0 +1,391 @@
+package gpa
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// =====================================
+// Distributed Locks
+// =====================================
+
+// DistributedLock is a held distributed lock
+type DistributedLock interface {
+	// Key is the name the lock was acquired under
+	Key() string
+	// Token is the fencing token: every later acquisition of the same key gets a larger
+	// one, so storage can reject writes from a holder whose lock has since expired
+	Token() int64
+	// Refresh extends the lock to ttl from now. Returns ErrorTypeLocked if the lock was lost.
+	Refresh(ctx context.Context, ttl time.Duration) error
+	// Release gives up the lock. Releasing twice is not an error.
+	Release(ctx context.Context) error
+	// Done is closed once the lock is released or lost
+	Done() <-chan struct{}
+}
+
+// Locker acquires locks that exclude other processes, e.g. for cron jobs and migrations
+type Locker interface {
+	// Acquire waits until key is free and locks it for ttl. The lock is released when
+	// ctx is canceled.
+	// Example: lock, err := locker.Acquire(ctx, "migrations", 30*time.Second)
+	Acquire(ctx context.Context, key string, ttl time.Duration) (DistributedLock, error)
+
+	// TryAcquire locks key if it is free and returns ErrorTypeLocked otherwise
+	// Example: lock, err := locker.TryAcquire(ctx, "cron:report", time.Minute)
+	TryAcquire(ctx context.Context, key string, ttl time.Duration) (DistributedLock, error)
+}
+
+// LockerConfig configures a Locker
+type LockerConfig struct {
+	// RetryInterval is how often Acquire retries a held lock. Defaults to 100ms.
+	RetryInterval time.Duration
+	// AutoRenew refreshes held locks every third of their TTL until they are released
+	AutoRenew bool
+	// KeyPrefix is prepended to lock keys in key-value stores. Defaults to "lock:".
+	KeyPrefix string
+	// OnError is called with renewal errors that did not lose the lock
+	OnError func(key string, err error)
+}
+
+// lockBackend holds locks in a particular store. owner identifies one acquisition.
+type lockBackend interface {
+	acquire(ctx context.Context, key, owner string, ttl time.Duration) (token int64, acquired bool, err error)
+	refresh(ctx context.Context, key, owner string, ttl time.Duration) (bool, error)
+	release(ctx context.Context, key, owner string) (bool, error)
+}
+
+// locker implements Locker on a backend
+type locker struct {
+	backend lockBackend
+	config  LockerConfig
+}
+
+func newLocker(backend lockBackend, config LockerConfig) *locker {
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = 100 * time.Millisecond
+	}
+	if config.KeyPrefix == "" {
+		config.KeyPrefix = "lock:"
+	}
+	return &locker{backend: backend, config: config}
+}
+
+func (l *locker) TryAcquire(ctx context.Context, key string, ttl time.Duration) (DistributedLock, error) {
+	if l.config.AutoRenew && ttl <= 0 {
+		return nil, NewError(ErrorTypeInvalidArgument, "auto-renewed locks need a positive ttl")
+	}
+	owner := newRandomID()
+	token, acquired, err := l.backend.acquire(ctx, key, owner, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, NewError(ErrorTypeLocked, fmt.Sprintf("lock %q is held", key))
+	}
+
+	held := &heldLock{locker: l, key: key, owner: owner, token: token, ttl: ttl, done: make(chan struct{})}
+	go held.watch(ctx)
+	return held, nil
+}
+
+func (l *locker) Acquire(ctx context.Context, key string, ttl time.Duration) (DistributedLock, error) {
+	for {
+		lock, err := l.TryAcquire(ctx, key, ttl)
+		if err == nil || !IsLocked(err) {
+			return lock, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, NewErrorWithCause(ErrorTypeTimeout, fmt.Sprintf("gave up waiting for lock %q", key), ctx.Err())
+		case <-time.After(l.config.RetryInterval):
+		}
+	}
+}
+
+// heldLock implements DistributedLock
+type heldLock struct {
+	locker *locker
+	key    string
+	owner  string
+	token  int64
+
+	mu   sync.Mutex
+	ttl  time.Duration
+	done chan struct{}
+}
+
+func (h *heldLock) Key() string           { return h.key }
+func (h *heldLock) Token() int64          { return h.token }
+func (h *heldLock) Done() <-chan struct{} { return h.done }
+
+// finish closes done once, reporting whether this call closed it
+func (h *heldLock) finish() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	select {
+	case <-h.done:
+		return false
+	default:
+		close(h.done)
+		return true
+	}
+}
+
+func (h *heldLock) Refresh(ctx context.Context, ttl time.Duration) error {
+	select {
+	case <-h.done:
+		return NewError(ErrorTypeLocked, fmt.Sprintf("lock %q is no longer held", h.key))
+	default:
+	}
+	h.mu.Lock()
+	if ttl <= 0 {
+		ttl = h.ttl
+	}
+	h.ttl = ttl
+	h.mu.Unlock()
+
+	ok, err := h.locker.backend.refresh(ctx, h.key, h.owner, ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		h.finish()
+		return NewError(ErrorTypeLocked, fmt.Sprintf("lock %q was lost", h.key))
+	}
+	return nil
+}
+
+func (h *heldLock) Release(ctx context.Context) error {
+	if !h.finish() {
+		return nil
+	}
+	ok, err := h.locker.backend.release(ctx, h.key, h.owner)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return NewError(ErrorTypeLocked, fmt.Sprintf("lock %q expired before it was released", h.key))
+	}
+	return nil
+}
+
+// watch renews the lock when configured and releases it when ctx is canceled
+func (h *heldLock) watch(ctx context.Context) {
+	var renew <-chan time.Time
+	if h.locker.config.AutoRenew {
+		ticker := time.NewTicker(h.ttl / 3)
+		defer ticker.Stop()
+		renew = ticker.C
+	}
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ctx.Done():
+			h.Release(context.Background())
+			return
+		case <-renew:
+			if err := h.Refresh(ctx, 0); err != nil && !IsLocked(err) && h.locker.config.OnError != nil {
+				h.locker.config.OnError(h.key, err)
+			}
+		}
+	}
+}
+
+// WithLock runs fn while holding key. The context passed to fn is canceled if the lock
+// is lost, and the lock is released when fn returns.
+// Example: err := gpa.WithLock(ctx, locker, "cron:report", time.Minute, func(ctx context.Context, lock gpa.DistributedLock) error { ... })
+func WithLock(ctx context.Context, locker Locker, key string, ttl time.Duration, fn func(ctx context.Context, lock DistributedLock) error) error {
+	lock, err := locker.TryAcquire(ctx, key, ttl)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-lock.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err = fn(ctx, lock)
+	if releaseErr := lock.Release(context.Background()); err == nil {
+		err = releaseErr
+	}
+	return err
+}
+
+// =====================================
+// Key-Value Locks
+// =====================================
+
+// kvLockBackend stores the owner under the lock key with SET NX semantics and keeps a
+// never-expiring counter per key for fencing tokens
+type kvLockBackend struct {
+	kv     AtomicKeyValueProvider
+	prefix string
+}
+
+// NewKVLocker returns a Locker that stores locks in kv. Locks expire after their TTL
+// unless refreshed, so a crashed holder cannot block others forever.
+// Example: locker := gpa.NewKVLocker(redis, gpa.LockerConfig{AutoRenew: true})
+func NewKVLocker(kv AtomicKeyValueProvider, config LockerConfig) Locker {
+	l := newLocker(nil, config)
+	l.backend = &kvLockBackend{kv: kv, prefix: l.config.KeyPrefix}
+	return l
+}
+
+func (b *kvLockBackend) acquire(ctx context.Context, key, owner string, ttl time.Duration) (int64, bool, error) {
+	if ttl <= 0 {
+		return 0, false, NewError(ErrorTypeInvalidArgument, "key-value locks need a positive ttl")
+	}
+	acquired, err := b.kv.SetIfAbsent(ctx, b.prefix+key, owner, ttl)
+	if err != nil || !acquired {
+		return 0, false, err
+	}
+	token, err := b.kv.Increment(ctx, b.prefix+key+":fence", 1)
+	if err != nil {
+		b.kv.CompareAndDelete(ctx, b.prefix+key, owner)
+		return 0, false, err
+	}
+	return token, true, nil
+}
+
+func (b *kvLockBackend) refresh(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	return b.kv.CompareAndExpire(ctx, b.prefix+key, owner, ttl)
+}
+
+func (b *kvLockBackend) release(ctx context.Context, key, owner string) (bool, error) {
+	return b.kv.CompareAndDelete(ctx, b.prefix+key, owner)
+}
+
+// =====================================
+// SQL Advisory Locks
+// =====================================
+
+// LockDialect selects the advisory lock functions used by a SQL Locker
+type LockDialect string
+
+const (
+	// LockPostgres uses pg_try_advisory_lock on a hash of the key; tokens come from txid_current()
+	LockPostgres LockDialect = "postgres"
+	// LockMySQL uses GET_LOCK; tokens come from UUID_SHORT(), which increases per server
+	LockMySQL LockDialect = "mysql"
+)
+
+// sqlLockBackend holds each lock on its own connection, since advisory locks belong to
+// the database session that took them
+type sqlLockBackend struct {
+	db      *sql.DB
+	dialect LockDialect
+
+	mu    sync.Mutex
+	conns map[string]*sql.Conn
+}
+
+// NewSQLLocker returns a Locker using the advisory locks of provider's database, whose DB()
+// must be a *sql.DB. Advisory locks last as long as the session, so the TTL is not enforced
+// by the database; Refresh only checks that the session is still alive.
+// Example: locker, err := gpa.NewSQLLocker(provider, gpa.LockPostgres, gpa.LockerConfig{})
+func NewSQLLocker(provider SQLProvider, dialect LockDialect, config LockerConfig) (Locker, error) {
+	db, ok := provider.DB().(*sql.DB)
+	if !ok || db == nil {
+		return nil, NewError(ErrorTypeUnsupported, fmt.Sprintf("advisory locks need a *sql.DB, got %T", provider.DB()))
+	}
+	if dialect != LockPostgres && dialect != LockMySQL {
+		return nil, NewError(ErrorTypeUnsupported, fmt.Sprintf("unknown lock dialect %q", dialect))
+	}
+	return newLocker(&sqlLockBackend{db: db, dialect: dialect, conns: map[string]*sql.Conn{}}, config), nil
+}
+
+// advisoryKey maps a lock key to the argument of the dialect's lock functions
+func (b *sqlLockBackend) advisoryKey(key string) interface{} {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	if b.dialect == LockPostgres {
+		return int64(h.Sum64())
+	}
+	// MySQL lock names are limited to 64 characters
+	if len(key) > 64 {
+		return fmt.Sprintf("%s#%016x", key[:47], h.Sum64())
+	}
+	return key
+}
+
+func (b *sqlLockBackend) acquire(ctx context.Context, key, owner string, ttl time.Duration) (int64, bool, error) {
+	conn, err := b.db.Conn(ctx)
+	if err != nil {
+		return 0, false, NewErrorWithCause(ErrorTypeConnection, "cannot open lock session", err)
+	}
+
+	lockQuery, tokenQuery := "SELECT pg_try_advisory_lock($1)", "SELECT txid_current()"
+	if b.dialect == LockMySQL {
+		lockQuery, tokenQuery = "SELECT GET_LOCK(?, 0) = 1", "SELECT UUID_SHORT() & 9223372036854775807"
+	}
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, lockQuery, b.advisoryKey(key)).Scan(&acquired); err != nil || !acquired {
+		conn.Close()
+		if err != nil {
+			return 0, false, NewErrorWithCause(ErrorTypeDatabase, fmt.Sprintf("cannot lock %q", key), err)
+		}
+		return 0, false, nil
+	}
+	var token int64
+	if err := conn.QueryRowContext(ctx, tokenQuery).Scan(&token); err != nil {
+		b.unlock(context.Background(), conn, key)
+		conn.Close()
+		return 0, false, NewErrorWithCause(ErrorTypeDatabase, "cannot read fencing token", err)
+	}
+
+	b.mu.Lock()
+	b.conns[owner] = conn
+	b.mu.Unlock()
+	return token, true, nil
+}
+
+func (b *sqlLockBackend) refresh(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	b.mu.Lock()
+	conn, ok := b.conns[owner]
+	b.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	if err := conn.PingContext(ctx); err != nil {
+		b.release(context.Background(), key, owner)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (b *sqlLockBackend) release(ctx context.Context, key, owner string) (bool, error) {
+	b.mu.Lock()
+	conn, ok := b.conns[owner]
+	delete(b.conns, owner)
+	b.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	defer conn.Close()
+	return b.unlock(ctx, conn, key)
+}
+
+// unlock releases key on conn. Closing a *sql.Conn only returns it to the pool, so the
+// session and its locks would otherwise outlive the lock.
+func (b *sqlLockBackend) unlock(ctx context.Context, conn *sql.Conn, key string) (bool, error) {
+	unlockQuery := "SELECT pg_advisory_unlock($1)"
+	if b.dialect == LockMySQL {
+		unlockQuery = "SELECT RELEASE_LOCK(?) = 1"
+	}
+	var released bool
+	if err := conn.QueryRowContext(ctx, unlockQuery, b.advisoryKey(key)).Scan(&released); err != nil {
+		return false, NewErrorWithCause(ErrorTypeDatabase, fmt.Sprintf("cannot unlock %q", key), err)
+	}
+	return released, nil
+}
@@ -0,0 +1,214 @@
+package gpa
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// advisoryDriver is a database/sql driver that emulates Postgres advisory locks per session
+type advisoryDriver struct {
+	mu     sync.Mutex
+	holder map[int64]*advisoryConn
+	txid   int64
+	unlock int
+}
+
+func (d *advisoryDriver) Open(name string) (driver.Conn, error) { return &advisoryConn{driver: d}, nil }
+
+type advisoryConn struct{ driver *advisoryDriver }
+
+func (c *advisoryConn) Prepare(query string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *advisoryConn) Close() error                              { return nil }
+func (c *advisoryConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+func (c *advisoryConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	d := c.driver
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch query {
+	case "SELECT pg_try_advisory_lock($1)":
+		key := args[0].Value.(int64)
+		if holder, held := d.holder[key]; held && holder != c {
+			return &advisoryRows{value: false}, nil
+		}
+		d.holder[key] = c
+		return &advisoryRows{value: true}, nil
+	case "SELECT txid_current()":
+		d.txid++
+		return &advisoryRows{value: d.txid}, nil
+	case "SELECT pg_advisory_unlock($1)":
+		key := args[0].Value.(int64)
+		held := d.holder[key] == c
+		delete(d.holder, key)
+		d.unlock++
+		return &advisoryRows{value: held}, nil
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+type advisoryRows struct {
+	value driver.Value
+	read  bool
+}
+
+func (r *advisoryRows) Columns() []string { return []string{"result"} }
+func (r *advisoryRows) Close() error      { return nil }
+func (r *advisoryRows) Next(dest []driver.Value) error {
+	if r.read {
+		return io.EOF
+	}
+	r.read = true
+	dest[0] = r.value
+	return nil
+}
+
+var advisory = &advisoryDriver{holder: map[int64]*advisoryConn{}}
+
+func init() {
+	sql.Register("gpa-advisory", advisory)
+}
+
+// advisorySQLProvider exposes a *sql.DB as an SQLProvider
+type advisorySQLProvider struct {
+	SQLProvider
+	db *sql.DB
+}
+
+func (p *advisorySQLProvider) DB() interface{} { return p.db }
+
+func TestKVLocker(t *testing.T) {
+	provider := NewMemoryProvider()
+	locker := NewKVLocker(provider, LockerConfig{RetryInterval: time.Millisecond})
+	ctx := context.Background()
+
+	first, err := locker.TryAcquire(ctx, "cron", time.Minute)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := locker.TryAcquire(ctx, "cron", time.Minute); !IsLocked(err) {
+		t.Fatalf("Expected locked error, got %v", err)
+	}
+	if owner, _ := provider.Get(ctx, "lock:cron"); owner == nil {
+		t.Error("Expected lock stored under the prefixed key")
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := locker.Acquire(waitCtx, "cron", time.Minute); !IsErrorType(err, ErrorTypeTimeout) {
+		t.Errorf("Expected timeout while lock is held, got %v", err)
+	}
+
+	if err := first.Release(ctx); err != nil {
+		t.Fatalf("Unexpected release error: %v", err)
+	}
+	if err := first.Release(ctx); err != nil {
+		t.Errorf("Expected second release to be a no-op, got %v", err)
+	}
+	second, err := locker.Acquire(ctx, "cron", time.Minute)
+	if err != nil || second.Token() <= first.Token() {
+		t.Fatalf("Expected increasing fencing token, got %v after %d (%v)", second, first.Token(), err)
+	}
+
+	// Simulate expiry and takeover by another process
+	provider.Set(ctx, "lock:cron", "someone-else", time.Minute)
+	if err := second.Refresh(ctx, time.Minute); !IsLocked(err) {
+		t.Errorf("Expected lost lock on refresh, got %v", err)
+	}
+	select {
+	case <-second.Done():
+	default:
+		t.Error("Expected Done to be closed after losing the lock")
+	}
+	if value, _ := provider.Get(ctx, "lock:cron"); value != "someone-else" {
+		t.Errorf("Expected the other owner's lock to be untouched, got %v", value)
+	}
+}
+
+func TestKVLocker_AutoRenewAndCancel(t *testing.T) {
+	provider := NewMemoryProvider()
+	locker := NewKVLocker(provider, LockerConfig{AutoRenew: true})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	lock, err := locker.TryAcquire(ctx, "job", 30*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if exists, _ := provider.Exists(context.Background(), "lock:job"); !exists {
+		t.Fatal("Expected auto-renewal to keep the lock past its ttl")
+	}
+
+	cancel()
+	select {
+	case <-lock.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Expected the lock to be released when its context was canceled")
+	}
+	if exists, _ := provider.Exists(context.Background(), "lock:job"); exists {
+		t.Error("Expected the lock key to be deleted")
+	}
+
+	if _, err := locker.TryAcquire(context.Background(), "job", 0); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected invalid ttl error, got %v", err)
+	}
+}
+
+func TestWithLock(t *testing.T) {
+	locker := NewKVLocker(NewMemoryProvider(), LockerConfig{})
+	ctx := context.Background()
+
+	ran := false
+	err := WithLock(ctx, locker, "report", time.Minute, func(ctx context.Context, lock DistributedLock) error {
+		ran = true
+		return WithLock(ctx, locker, "report", time.Minute, func(context.Context, DistributedLock) error { return nil })
+	})
+	if !ran || !IsLocked(err) {
+		t.Errorf("Expected nested acquisition to fail with locked error, got %v", err)
+	}
+	if err := WithLock(ctx, locker, "report", time.Minute, func(context.Context, DistributedLock) error { return nil }); err != nil {
+		t.Errorf("Expected lock to be released after the first run, got %v", err)
+	}
+}
+
+func TestSQLLocker(t *testing.T) {
+	db, err := sql.Open("gpa-advisory", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer db.Close()
+	locker, err := NewSQLLocker(&advisorySQLProvider{db: db}, LockPostgres, LockerConfig{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx := context.Background()
+
+	first, err := locker.TryAcquire(ctx, "migrations", time.Minute)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := locker.TryAcquire(ctx, "migrations", time.Minute); !IsLocked(err) {
+		t.Fatalf("Expected locked error from another session, got %v", err)
+	}
+	if err := first.Refresh(ctx, time.Minute); err != nil {
+		t.Errorf("Expected live session to refresh, got %v", err)
+	}
+
+	unlocks := advisory.unlock
+	if err := first.Release(ctx); err != nil || advisory.unlock != unlocks+1 {
+		t.Fatalf("Expected explicit unlock on release, got %v", err)
+	}
+	second, err := locker.TryAcquire(ctx, "migrations", time.Minute)
+	if err != nil || second.Token() <= first.Token() {
+		t.Fatalf("Expected reacquisition with a larger token, got %v (%v)", second, err)
+	}
+	second.Release(ctx)
+
+	if _, err := NewSQLLocker(&advisorySQLProvider{}, LockPostgres, LockerConfig{}); !IsErrorType(err, ErrorTypeUnsupported) {
+		t.Errorf("Expected unsupported error without *sql.DB, got %v", err)
+	}
+}
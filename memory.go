@@ -0,0 +1,798 @@
+package gpa
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =====================================
+// In-Memory Provider
+// =====================================
+
+// MemoryProvider is a Provider that keeps data in process memory.
+// It is meant for tests, prototypes and as a reference for provider behavior.
+type MemoryProvider struct {
+	mu     sync.Mutex
+	repos  map[reflect.Type]interface{}
+	closed bool
+
+	kvMu  sync.Mutex
+	kv    map[string]memoryEntry
+	kvSeq uint64
+	now   func() time.Time
+
+	// streamAdded is closed when an entry is added to any stream; kvMu guards it
+	streamAdded chan struct{}
+
+	subMu sync.RWMutex
+	subs  map[*memorySubscriber]struct{}
+}
+
+// NewMemoryProvider returns an empty in-memory provider
+// Example: provider := gpa.NewMemoryProvider(); users := gpa.GetMemoryRepository[User](provider)
+func NewMemoryProvider() *MemoryProvider {
+	return &MemoryProvider{repos: make(map[reflect.Type]interface{}), kv: make(map[string]memoryEntry), now: time.Now}
+}
+
+// GetMemoryRepository returns the provider's repository for T, creating it on first use.
+// Pipelines run on it can look up the other repositories of the provider by table name.
+func GetMemoryRepository[T any](provider *MemoryProvider) *MemoryRepository[T] {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	key := reflect.TypeOf((*T)(nil)).Elem()
+	if repo, ok := provider.repos[key]; ok {
+		return repo.(*MemoryRepository[T])
+	}
+	repo := NewMemoryRepository[T]()
+	repo.lookup = provider.collection
+	provider.repos[key] = repo
+	return repo
+}
+
+// memoryCollection is the type-independent view of a MemoryRepository used by lookups
+type memoryCollection interface {
+	collectionName() string
+	documents() ([]map[string]interface{}, error)
+}
+
+// collection returns the documents of the repository whose table name is name
+func (p *MemoryProvider) collection(name string) ([]map[string]interface{}, error) {
+	p.mu.Lock()
+	var found memoryCollection
+	for _, repo := range p.repos {
+		if c := repo.(memoryCollection); c.collectionName() == name {
+			found = c
+			break
+		}
+	}
+	p.mu.Unlock()
+	if found == nil {
+		return nil, NewError(ErrorTypeNotFound, fmt.Sprintf("collection %q not found", name))
+	}
+	return found.documents()
+}
+
+// Configure implements Provider. The in-memory provider has nothing to configure.
+func (p *MemoryProvider) Configure(config Config) error {
+	return nil
+}
+
+// Health implements Provider
+func (p *MemoryProvider) Health() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return NewError(ErrorTypeConnection, "memory provider is closed")
+	}
+	return nil
+}
+
+// Close implements Provider
+func (p *MemoryProvider) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.closeSubscriptions()
+	return nil
+}
+
+// SupportedFeatures implements Provider
+func (p *MemoryProvider) SupportedFeatures() []Feature {
+	return []Feature{FeatureTransactions, FeatureStreaming, FeatureTTL, FeatureAtomicOps, FeaturePubSub, FeatureAggregation, FeatureGeoSpatial, FeatureFullText}
+}
+
+// ProviderInfo implements Provider
+func (p *MemoryProvider) ProviderInfo() ProviderInfo {
+	return ProviderInfo{
+		Name:         "memory",
+		Version:      "1.0.0",
+		DatabaseType: DatabaseTypeMemory,
+		Features:     p.SupportedFeatures(),
+	}
+}
+
+// =====================================
+// In-Memory Repository
+// =====================================
+
+// memoryChangeHistory is the number of change events kept for resuming streams
+const memoryChangeHistory = 1024
+
+// memoryState holds the rows of a MemoryRepository
+type memoryState[T any] struct {
+	rows   map[string]*T
+	order  []string
+	nextID int64
+}
+
+func (s *memoryState[T]) clone() *memoryState[T] {
+	rows := make(map[string]*T, len(s.rows))
+	for key, row := range s.rows {
+		rows[key] = row
+	}
+	return &memoryState[T]{rows: rows, order: append([]string(nil), s.order...), nextID: s.nextID}
+}
+
+// MemoryRepository is a Repository[T] backed by process memory. Queries are evaluated
+// with MatchCondition, entities are copied on the way in and out, and zero integer or
+// string primary keys are generated on Create. Transactions are serializable: they hold
+// the repository lock until they finish, so use tx rather than the repository inside fn.
+// Changes streams every committed write.
+type MemoryRepository[T any] struct {
+	mu    sync.Mutex
+	state *memoryState[T]
+	info  *EntityInfo
+	feed  *memoryFeed[T]
+
+	// notify receives the events of every write; transactions redirect it to a buffer
+	notify func(events ...ChangeEvent[T])
+
+	// lookup resolves the collections of Lookup pipeline stages
+	lookup func(collection string) ([]map[string]interface{}, error)
+}
+
+// NewMemoryRepository returns an empty in-memory repository
+// Example: repo := gpa.NewMemoryRepository[User]()
+func NewMemoryRepository[T any]() *MemoryRepository[T] {
+	r := &MemoryRepository[T]{
+		state: &memoryState[T]{rows: make(map[string]*T)},
+		info:  memoryEntityInfo[T](),
+		feed:  newMemoryFeed[T](),
+	}
+	r.notify = r.feed.publish
+	return r
+}
+
+// Create implements Repository
+func (r *MemoryRepository[T]) Create(ctx context.Context, entity *T) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	event, err := r.insert(entity)
+	if err != nil {
+		return err
+	}
+	r.notify(event)
+	return nil
+}
+
+// CreateBatch implements Repository. Either all entities are created or none.
+func (r *MemoryRepository[T]) CreateBatch(ctx context.Context, entities []*T) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	saved := r.state.clone()
+	events := make([]ChangeEvent[T], 0, len(entities))
+	for _, entity := range entities {
+		event, err := r.insert(entity)
+		if err != nil {
+			r.state = saved
+			return err
+		}
+		events = append(events, event)
+	}
+	r.notify(events...)
+	return nil
+}
+
+// FindByID implements Repository
+func (r *MemoryRepository[T]) FindByID(ctx context.Context, id interface{}) (*T, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	row, ok := r.state.rows[memoryKey(id)]
+	if !ok {
+		return nil, r.notFound()
+	}
+	copied := *row
+	return &copied, nil
+}
+
+// FindAll implements Repository
+func (r *MemoryRepository[T]) FindAll(ctx context.Context, opts ...QueryOption) ([]*T, error) {
+	return r.Query(ctx, opts...)
+}
+
+// Update implements Repository
+func (r *MemoryRepository[T]) Update(ctx context.Context, entity *T) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id, err := entityPrimaryKey(entity, r.info)
+	if err != nil {
+		return err
+	}
+	key := memoryKey(id)
+	before, ok := r.state.rows[key]
+	if !ok {
+		return r.notFound()
+	}
+	after := *entity
+	r.state.rows[key] = &after
+	r.notify(r.event(ChangeUpdate, before, &after))
+	return nil
+}
+
+// UpdatePartial implements Repository
+func (r *MemoryRepository[T]) UpdatePartial(ctx context.Context, id interface{}, updates map[string]interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := memoryKey(id)
+	before, ok := r.state.rows[key]
+	if !ok {
+		return r.notFound()
+	}
+	after := *before
+	applyUpdates(reflect.ValueOf(&after).Elem(), updates)
+	if newID, err := entityPrimaryKey(&after, r.info); err != nil || memoryKey(newID) != key {
+		return NewError(ErrorTypeInvalidArgument, "cannot change the primary key").WithEntity(r.info.Name)
+	}
+	r.state.rows[key] = &after
+	r.notify(r.event(ChangeUpdate, before, &after))
+	return nil
+}
+
+// Delete implements Repository
+func (r *MemoryRepository[T]) Delete(ctx context.Context, id interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := memoryKey(id)
+	before, ok := r.state.rows[key]
+	if !ok {
+		return r.notFound()
+	}
+	r.remove(key)
+	r.notify(r.event(ChangeDelete, before, nil))
+	return nil
+}
+
+// DeleteByCondition implements Repository
+func (r *MemoryRepository[T]) DeleteByCondition(ctx context.Context, condition Condition) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var matched []string
+	for _, key := range r.state.order {
+		ok, err := MatchCondition(r.state.rows[key], condition)
+		if err != nil {
+			return err
+		}
+		if ok {
+			matched = append(matched, key)
+		}
+	}
+	events := make([]ChangeEvent[T], 0, len(matched))
+	for _, key := range matched {
+		events = append(events, r.event(ChangeDelete, r.state.rows[key], nil))
+		r.remove(key)
+	}
+	r.notify(events...)
+	return nil
+}
+
+// Query implements Repository. Conditions, orders, limit and offset are applied;
+// field selection, joins, grouping and preloads are ignored.
+func (r *MemoryRepository[T]) Query(ctx context.Context, opts ...QueryOption) ([]*T, error) {
+	scored, err := r.QueryScored(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*T, len(scored))
+	for i, result := range scored {
+		results[i] = result.Entity
+	}
+	return results, nil
+}
+
+// QueryScored implements ScoredQuerier. Search conditions are scored by TF-IDF
+// over the whole collection.
+func (r *MemoryRepository[T]) QueryScored(ctx context.Context, opts ...QueryOption) ([]Scored[T], error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	query := NewQuery()
+	for _, opt := range opts {
+		opt.Apply(query)
+	}
+	matched, err := r.match(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var scores map[*T]float64
+	if search, ok := searchCondition(query.Conditions); ok {
+		corpus := make([]*T, len(r.state.order))
+		for i, key := range r.state.order {
+			corpus[i] = r.state.rows[key]
+		}
+		scores = scoreEntities(corpus, matched, search)
+	}
+	if field, near, ok := nearCondition(query.Conditions); ok && len(query.Orders) == 0 {
+		sortByDistance(matched, field, near.Point)
+	} else if err := sortEntities(matched, query.Orders, scores); err != nil {
+		return nil, err
+	}
+	matched = pageEntities(matched, query.Offset, query.Limit)
+
+	results := make([]Scored[T], len(matched))
+	for i, row := range matched {
+		copied := *row
+		results[i] = Scored[T]{Entity: &copied, Score: scores[row]}
+	}
+	return results, nil
+}
+
+// QueryOne implements Repository
+func (r *MemoryRepository[T]) QueryOne(ctx context.Context, opts ...QueryOption) (*T, error) {
+	results, err := r.Query(ctx, append(opts, Limit(1))...)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, r.notFound()
+	}
+	return results[0], nil
+}
+
+// Count implements Repository. Limit and offset are ignored.
+func (r *MemoryRepository[T]) Count(ctx context.Context, opts ...QueryOption) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	query := NewQuery()
+	for _, opt := range opts {
+		opt.Apply(query)
+	}
+	matched, err := r.match(query)
+	return int64(len(matched)), err
+}
+
+// Exists implements Repository
+func (r *MemoryRepository[T]) Exists(ctx context.Context, opts ...QueryOption) (bool, error) {
+	count, err := r.Count(ctx, opts...)
+	return count > 0, err
+}
+
+// Transaction implements Repository. fn works on a copy of the data that replaces
+// the repository's data when fn returns nil; change events are published on commit.
+func (r *MemoryRepository[T]) Transaction(ctx context.Context, fn TransactionFunc[T]) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tx := &memoryTransaction[T]{
+		MemoryRepository: &MemoryRepository[T]{state: r.state.clone(), info: r.info, feed: r.feed, lookup: r.lookup},
+		savepoints:       make(map[string]memorySavepoint[T]),
+	}
+	tx.MemoryRepository.notify = func(events ...ChangeEvent[T]) {
+		tx.pending = append(tx.pending, events...)
+	}
+	tx.apply = func() {
+		r.state = tx.MemoryRepository.state
+		r.notify(tx.pending...)
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if tx.done {
+		return nil
+	}
+	return tx.Commit()
+}
+
+// RawQuery is not supported by the in-memory repository
+func (r *MemoryRepository[T]) RawQuery(ctx context.Context, query string, args []interface{}) ([]*T, error) {
+	return nil, NewError(ErrorTypeUnsupported, "raw queries are not supported in memory").WithEntity(r.info.Name)
+}
+
+// RawExec is not supported by the in-memory repository
+func (r *MemoryRepository[T]) RawExec(ctx context.Context, query string, args []interface{}) (Result, error) {
+	return nil, NewError(ErrorTypeUnsupported, "raw statements are not supported in memory").WithEntity(r.info.Name)
+}
+
+// GetEntityInfo implements Repository
+func (r *MemoryRepository[T]) GetEntityInfo() (*EntityInfo, error) {
+	return r.info, nil
+}
+
+// Close implements Repository. Data is kept, so the repository can still be used.
+func (r *MemoryRepository[T]) Close() error {
+	return nil
+}
+
+// RunPipeline implements PipelineRunner. Entities are converted to documents with their
+// json encoding, so stages refer to fields by json name. Lookup stages can reach the other
+// repositories of the MemoryProvider the repository came from.
+func (r *MemoryRepository[T]) RunPipeline(ctx context.Context, p *Pipeline) ([]map[string]interface{}, error) {
+	docs, err := r.documents()
+	if err != nil {
+		return nil, err
+	}
+	lookup := func(collection string) ([]map[string]interface{}, error) {
+		switch {
+		case collection == r.collectionName():
+			return r.documents()
+		case r.lookup != nil:
+			return r.lookup(collection)
+		}
+		return nil, NewError(ErrorTypeNotFound, fmt.Sprintf("collection %q not found", collection))
+	}
+	return EvaluatePipeline(docs, p, lookup)
+}
+
+func (r *MemoryRepository[T]) collectionName() string {
+	return r.info.TableName
+}
+
+// documents returns every entity as a document, in insertion order
+func (r *MemoryRepository[T]) documents() ([]map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	docs := make([]map[string]interface{}, 0, len(r.state.order))
+	for _, key := range r.state.order {
+		doc, err := toDocument(r.state.rows[key])
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// Changes implements ChangeStreamer. Resume tokens are sequence numbers; only the
+// last 1024 events are kept, and resuming from an older token fails with ErrorTypeNotFound.
+func (r *MemoryRepository[T]) Changes(ctx context.Context, opts ChangeOptions) iter.Seq2[ChangeEvent[T], error] {
+	return r.feed.stream(ctx, opts.ResumeAfter)
+}
+
+// insert stores a copy of entity, generating a zero primary key, and returns the insert event
+func (r *MemoryRepository[T]) insert(entity *T) (ChangeEvent[T], error) {
+	if err := r.generateID(entity); err != nil {
+		return ChangeEvent[T]{}, err
+	}
+	id, err := entityPrimaryKey(entity, r.info)
+	if err != nil {
+		return ChangeEvent[T]{}, err
+	}
+	key := memoryKey(id)
+	if _, exists := r.state.rows[key]; exists {
+		return ChangeEvent[T]{}, NewError(ErrorTypeDuplicate, fmt.Sprintf("%s %s already exists", r.info.Name, key)).WithEntity(r.info.Name)
+	}
+	stored := *entity
+	r.state.rows[key] = &stored
+	r.state.order = append(r.state.order, key)
+	return r.event(ChangeInsert, nil, &stored), nil
+}
+
+// generateID assigns the next sequence number to a zero integer key, or a random id to an empty string key
+func (r *MemoryRepository[T]) generateID(entity *T) error {
+	if len(r.info.PrimaryKey) == 0 {
+		return NewError(ErrorTypeInvalidArgument, "cannot determine the entity's primary key").WithEntity(r.info.Name)
+	}
+	field, _, ok := lookupStructField(reflect.ValueOf(entity).Elem(), r.info.PrimaryKey[0])
+	if !ok || !field.IsZero() || !field.CanSet() {
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		r.state.nextID++
+		field.SetInt(r.state.nextID)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		r.state.nextID++
+		field.SetUint(uint64(r.state.nextID))
+	case reflect.String:
+		field.SetString(newRandomID())
+	}
+	return nil
+}
+
+// remove deletes the row with key
+func (r *MemoryRepository[T]) remove(key string) {
+	delete(r.state.rows, key)
+	for i, k := range r.state.order {
+		if k == key {
+			r.state.order = append(r.state.order[:i], r.state.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// match returns the rows satisfying the query's conditions in insertion order
+func (r *MemoryRepository[T]) match(query *Query) ([]*T, error) {
+	if len(query.SubQueries) > 0 {
+		return nil, NewError(ErrorTypeUnsupported, "subqueries are not supported in memory").WithEntity(r.info.Name)
+	}
+	var matched []*T
+	for _, key := range r.state.order {
+		row := r.state.rows[key]
+		ok, err := MatchConditions(row, query.Conditions)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, row)
+		}
+	}
+	return matched, nil
+}
+
+// event builds a change event with copies of before and after
+func (r *MemoryRepository[T]) event(op ChangeOp, before, after *T) ChangeEvent[T] {
+	event := ChangeEvent[T]{Op: op}
+	if before != nil {
+		copied := *before
+		event.Before = &copied
+		event.ID, _ = entityPrimaryKey(before, r.info)
+	}
+	if after != nil {
+		copied := *after
+		event.After = &copied
+		event.ID, _ = entityPrimaryKey(after, r.info)
+	}
+	return event
+}
+
+func (r *MemoryRepository[T]) notFound() error {
+	return NewError(ErrorTypeNotFound, r.info.Name+" not found").WithEntity(r.info.Name)
+}
+
+// memoryKey converts a primary key to a map key, so that 1, int64(1) and "1" find the same row
+func memoryKey(id interface{}) string {
+	return fmt.Sprint(id)
+}
+
+// memoryEntityInfo derives entity metadata from the struct type of T.
+// The primary key is the field tagged gorm:"primaryKey" or bun:",pk", else the field named ID.
+func memoryEntityInfo[T any]() *EntityInfo {
+	info := &EntityInfo{Name: entityName[T](), TableName: entityName[T]()}
+	structType := reflect.TypeOf((*T)(nil)).Elem()
+	if structType.Kind() != reflect.Struct {
+		return info
+	}
+
+	var fallback string
+	for _, field := range reflect.VisibleFields(structType) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+		name := fieldDisplayName(field)
+		tagged := strings.Contains(strings.ToLower(field.Tag.Get("gorm")), "primarykey") ||
+			strings.Contains(strings.ToLower(field.Tag.Get("gorm")), "primary_key") ||
+			strings.Contains(","+field.Tag.Get("bun")+",", ",pk,")
+		if tagged && len(info.PrimaryKey) == 0 {
+			info.PrimaryKey = []string{name}
+		}
+		if field.Name == "ID" && fallback == "" {
+			fallback = name
+		}
+		info.Fields = append(info.Fields, FieldInfo{Name: name, Type: field.Type, Tag: string(field.Tag), IsPrimaryKey: tagged})
+	}
+	if len(info.PrimaryKey) == 0 && fallback != "" {
+		info.PrimaryKey = []string{fallback}
+		for i := range info.Fields {
+			info.Fields[i].IsPrimaryKey = info.Fields[i].Name == fallback
+		}
+	}
+	return info
+}
+
+// sortEntities orders entities by the given orders, comparing values like MatchCondition.
+// NULLs sort first in ascending order. RelevanceField sorts by scores at its position
+// among the orders.
+func sortEntities[T any](entities []*T, orders []Order, scores map[*T]float64) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	var sortErr error
+	sort.SliceStable(entities, func(i, j int) bool {
+		a, b := reflect.ValueOf(entities[i]), reflect.ValueOf(entities[j])
+		for _, order := range orders {
+			if order.Field == RelevanceField {
+				if cmp := compareScores(scores[entities[i]], scores[entities[j]]); cmp != 0 {
+					if strings.EqualFold(string(order.Direction), string(OrderDesc)) {
+						return cmp > 0
+					}
+					return cmp < 0
+				}
+				continue
+			}
+			av, aok := resolveFieldPath(a, order.Field)
+			bv, bok := resolveFieldPath(b, order.Field)
+			aok, bok = aok && av.IsValid(), bok && bv.IsValid()
+			var cmp int
+			switch {
+			case !aok && !bok:
+				continue
+			case !aok:
+				cmp = -1
+			case !bok:
+				cmp = 1
+			default:
+				var err error
+				if cmp, err = compareValues(av, bv); err != nil {
+					sortErr = err
+					return false
+				}
+			}
+			if cmp == 0 {
+				continue
+			}
+			if strings.EqualFold(string(order.Direction), string(OrderDesc)) {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+	return sortErr
+}
+
+// pageEntities applies offset and limit
+func pageEntities[T any](entities []*T, offset, limit *int) []*T {
+	if offset != nil && *offset > 0 {
+		if *offset >= len(entities) {
+			return nil
+		}
+		entities = entities[*offset:]
+	}
+	if limit != nil && *limit >= 0 && *limit < len(entities) {
+		entities = entities[:*limit]
+	}
+	return entities
+}
+
+// =====================================
+// In-Memory Transactions
+// =====================================
+
+// memorySavepoint is a snapshot of a transaction
+type memorySavepoint[T any] struct {
+	state   *memoryState[T]
+	pending int
+}
+
+// memoryTransaction is a MemoryRepository over a private copy of the data
+type memoryTransaction[T any] struct {
+	*MemoryRepository[T]
+	pending    []ChangeEvent[T]
+	savepoints map[string]memorySavepoint[T]
+	apply      func()
+	done       bool
+}
+
+func (tx *memoryTransaction[T]) Commit() error {
+	if tx.done {
+		return NewError(ErrorTypeTransaction, "transaction already finished")
+	}
+	tx.done = true
+	tx.apply()
+	return nil
+}
+
+func (tx *memoryTransaction[T]) Rollback() error {
+	if tx.done {
+		return nil
+	}
+	tx.done = true
+	tx.pending = nil
+	return nil
+}
+
+func (tx *memoryTransaction[T]) SetSavepoint(name string) error {
+	tx.savepoints[name] = memorySavepoint[T]{state: tx.state.clone(), pending: len(tx.pending)}
+	return nil
+}
+
+func (tx *memoryTransaction[T]) RollbackToSavepoint(name string) error {
+	savepoint, ok := tx.savepoints[name]
+	if !ok {
+		return NewError(ErrorTypeTransaction, fmt.Sprintf("savepoint %q does not exist", name))
+	}
+	tx.state = savepoint.state.clone()
+	tx.pending = tx.pending[:savepoint.pending]
+	return nil
+}
+
+// =====================================
+// In-Memory Change Feed
+// =====================================
+
+// memoryFeed keeps recent change events and wakes up streams on every publish
+type memoryFeed[T any] struct {
+	mu      sync.Mutex
+	seq     int64
+	history []ChangeEvent[T]
+	changed chan struct{}
+}
+
+func newMemoryFeed[T any]() *memoryFeed[T] {
+	return &memoryFeed[T]{changed: make(chan struct{})}
+}
+
+// publish assigns sequence numbers and timestamps to events and stores them
+func (f *memoryFeed[T]) publish(events ...ChangeEvent[T]) {
+	if len(events) == 0 {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	for _, event := range events {
+		f.seq++
+		event.ResumeToken = strconv.FormatInt(f.seq, 10)
+		event.Timestamp = now
+		f.history = append(f.history, event)
+	}
+	if over := len(f.history) - memoryChangeHistory; over > 0 {
+		f.history = append(f.history[:0:0], f.history[over:]...)
+	}
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// stream yields events after token until ctx is done
+func (f *memoryFeed[T]) stream(ctx context.Context, token string) iter.Seq2[ChangeEvent[T], error] {
+	return func(yield func(ChangeEvent[T], error) bool) {
+		f.mu.Lock()
+		last := f.seq
+		f.mu.Unlock()
+		if token != "" {
+			seq, err := strconv.ParseInt(token, 10, 64)
+			if err != nil {
+				yield(ChangeEvent[T]{}, NewErrorWithCause(ErrorTypeInvalidArgument, "invalid resume token", err))
+				return
+			}
+			last = seq
+		}
+
+		for {
+			f.mu.Lock()
+			first := f.seq - int64(len(f.history)) + 1
+			if last > f.seq {
+				last = f.seq
+			}
+			if last+1 < first {
+				f.mu.Unlock()
+				yield(ChangeEvent[T]{}, NewError(ErrorTypeNotFound, "resume token is no longer in the change history"))
+				return
+			}
+			events := append([]ChangeEvent[T](nil), f.history[last+1-first:]...)
+			changed := f.changed
+			f.mu.Unlock()
+
+			for _, event := range events {
+				if !yield(event, nil) {
+					return
+				}
+				last++
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+			}
+		}
+	}
+}
@@ -0,0 +1,880 @@
+package gpa
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// =====================================
+// In-Memory Key-Value Store
+// =====================================
+
+// memoryEntry is a stored value with an optional expiry
+type memoryEntry struct {
+	value     interface{}
+	expiresAt time.Time
+	version   uint64
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// expiry converts a TTL to an absolute expiry; zero or negative means none
+func (p *MemoryProvider) expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return p.now().Add(ttl)
+}
+
+// put stores e under key with a new version, so transactions can detect the write.
+// kvMu must be held.
+func (p *MemoryProvider) put(key string, e memoryEntry) {
+	p.kvSeq++
+	e.version = p.kvSeq
+	p.kv[key] = e
+}
+
+// entry returns the live entry for key, dropping it if it expired. kvMu must be held.
+func (p *MemoryProvider) entry(key string) (memoryEntry, bool) {
+	e, ok := p.kv[key]
+	if ok && e.expired(p.now()) {
+		delete(p.kv, key)
+		return memoryEntry{}, false
+	}
+	return e, ok
+}
+
+// copyKVValue copies byte slices so callers cannot modify stored values
+func copyKVValue(value interface{}) interface{} {
+	if b, ok := value.([]byte); ok {
+		return bytes.Clone(b)
+	}
+	return value
+}
+
+// kvValuesEqual compares stored values, treating strings and byte slices alike
+func kvValuesEqual(a, b interface{}) bool {
+	if ab, ok := a.([]byte); ok {
+		a = string(ab)
+	}
+	if bb, ok := b.([]byte); ok {
+		b = string(bb)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// updateKV replaces the value at key with fn's result under the store lock, so
+// read-modify-write algorithms run atomically. A zero ttl keeps the key forever.
+func (p *MemoryProvider) updateKV(ctx context.Context, key string, fn func(current interface{}) (interface{}, time.Duration)) error {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	e, _ := p.entry(key)
+	value, ttl := fn(e.value)
+	p.put(key, memoryEntry{value: value, expiresAt: p.expiry(ttl)})
+	return nil
+}
+
+// Client implements KeyValueProvider; the in-memory provider is its own client
+func (p *MemoryProvider) Client() interface{} {
+	return p
+}
+
+// Set implements KeyValueProvider. A zero ttl keeps the value until it is deleted.
+func (p *MemoryProvider) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	p.put(key, memoryEntry{value: copyKVValue(value), expiresAt: p.expiry(ttl)})
+	return nil
+}
+
+// Get implements KeyValueProvider
+func (p *MemoryProvider) Get(ctx context.Context, key string) (interface{}, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	e, ok := p.entry(key)
+	if !ok {
+		return nil, NewError(ErrorTypeNotFound, fmt.Sprintf("key %q not found", key))
+	}
+	return copyKVValue(e.value), nil
+}
+
+// MGet implements BatchKeyValueProvider
+func (p *MemoryProvider) MGet(ctx context.Context, keys []string) (map[string]interface{}, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	values := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		if e, ok := p.entry(key); ok {
+			values[key] = copyKVValue(e.value)
+		}
+	}
+	return values, nil
+}
+
+// Delete implements KeyValueProvider. Deleting a missing key is not an error.
+func (p *MemoryProvider) Delete(ctx context.Context, key string) error {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	delete(p.kv, key)
+	return nil
+}
+
+// Exists implements KeyValueProvider
+func (p *MemoryProvider) Exists(ctx context.Context, key string) (bool, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	_, ok := p.entry(key)
+	return ok, nil
+}
+
+// Keys implements KeyValueProvider with path.Match glob patterns, in sorted order
+func (p *MemoryProvider) Keys(ctx context.Context, pattern string) ([]string, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	var keys []string
+	for key := range p.kv {
+		if _, ok := p.entry(key); !ok {
+			continue
+		}
+		matched, err := path.Match(pattern, key)
+		if err != nil {
+			return nil, NewErrorWithCause(ErrorTypeInvalidArgument, fmt.Sprintf("invalid key pattern %q", pattern), err)
+		}
+		if matched {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Scan implements KeyScanner. Keys are visited in hash order and the cursor is the next
+// hash to visit, so keys added or deleted during a scan do not shift it, as in Redis.
+func (p *MemoryProvider) Scan(ctx context.Context, cursor uint64, pattern string, count int64) ([]string, uint64, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, 0, NewErrorWithCause(ErrorTypeInvalidArgument, fmt.Sprintf("invalid key pattern %q", pattern), err)
+	}
+	if count <= 0 {
+		count = 10
+	}
+
+	type hashedKey struct {
+		hash uint64
+		key  string
+	}
+	var pending []hashedKey
+	p.kvMu.Lock()
+	for key := range p.kv {
+		if _, ok := p.entry(key); !ok {
+			continue
+		}
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		if hash := uint64(h.Sum32()); hash >= cursor {
+			pending = append(pending, hashedKey{hash: hash, key: key})
+		}
+	}
+	p.kvMu.Unlock()
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].hash != pending[j].hash {
+			return pending[i].hash < pending[j].hash
+		}
+		return pending[i].key < pending[j].key
+	})
+
+	// Keys sharing a hash are returned together so the cursor never splits them
+	var keys []string
+	i := 0
+	for ; i < len(pending) && (int64(i) < count || pending[i].hash == pending[i-1].hash); i++ {
+		if matched, _ := path.Match(pattern, pending[i].key); matched {
+			keys = append(keys, pending[i].key)
+		}
+	}
+	if i == len(pending) {
+		return keys, 0, nil
+	}
+	return keys, pending[i-1].hash + 1, nil
+}
+
+// Expire implements KeyValueProvider. A zero ttl removes the expiry.
+func (p *MemoryProvider) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	e, ok := p.entry(key)
+	if !ok {
+		return NewError(ErrorTypeNotFound, fmt.Sprintf("key %q not found", key))
+	}
+	e.expiresAt = p.expiry(ttl)
+	p.put(key, e)
+	return nil
+}
+
+// TTL implements KeyValueProvider. Returns 0 if the key does not exist or never expires.
+func (p *MemoryProvider) TTL(ctx context.Context, key string) (time.Duration, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	e, ok := p.entry(key)
+	if !ok || e.expiresAt.IsZero() {
+		return 0, nil
+	}
+	return e.expiresAt.Sub(p.now()), nil
+}
+
+// SetIfAbsent implements AtomicKeyValueProvider
+func (p *MemoryProvider) SetIfAbsent(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	if _, ok := p.entry(key); ok {
+		return false, nil
+	}
+	p.put(key, memoryEntry{value: copyKVValue(value), expiresAt: p.expiry(ttl)})
+	return true, nil
+}
+
+// CompareAndDelete implements AtomicKeyValueProvider
+func (p *MemoryProvider) CompareAndDelete(ctx context.Context, key string, expected interface{}) (bool, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	e, ok := p.entry(key)
+	if !ok || !kvValuesEqual(e.value, expected) {
+		return false, nil
+	}
+	delete(p.kv, key)
+	return true, nil
+}
+
+// CompareAndExpire implements AtomicKeyValueProvider
+func (p *MemoryProvider) CompareAndExpire(ctx context.Context, key string, expected interface{}, ttl time.Duration) (bool, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	e, ok := p.entry(key)
+	if !ok || !kvValuesEqual(e.value, expected) {
+		return false, nil
+	}
+	e.expiresAt = p.expiry(ttl)
+	p.put(key, e)
+	return true, nil
+}
+
+// CompareAndSwap implements AtomicKeyValueProvider
+func (p *MemoryProvider) CompareAndSwap(ctx context.Context, key string, expected, value interface{}, ttl time.Duration) (bool, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	e, ok := p.entry(key)
+	if ok != (expected != nil) || (ok && !kvValuesEqual(e.value, expected)) {
+		return false, nil
+	}
+	p.put(key, memoryEntry{value: copyKVValue(value), expiresAt: p.expiry(ttl)})
+	return true, nil
+}
+
+// GetAndSet implements AtomicKeyValueProvider
+func (p *MemoryProvider) GetAndSet(ctx context.Context, key string, value interface{}, ttl time.Duration) (interface{}, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	e, _ := p.entry(key)
+	p.put(key, memoryEntry{value: copyKVValue(value), expiresAt: p.expiry(ttl)})
+	return e.value, nil
+}
+
+// memoryKVTx queues the writes of a MemoryProvider transaction
+type memoryKVTx struct {
+	provider *MemoryProvider
+	writes   []kvWrite
+}
+
+// Get implements KVTx
+func (tx *memoryKVTx) Get(ctx context.Context, key string) (interface{}, error) {
+	return tx.provider.Get(ctx, key)
+}
+
+// Set implements KVTx
+func (tx *memoryKVTx) Set(key string, value interface{}, ttl time.Duration) {
+	tx.writes = append(tx.writes, kvWrite{key: key, value: copyKVValue(value), ttl: ttl})
+}
+
+// Delete implements KVTx
+func (tx *memoryKVTx) Delete(key string) {
+	tx.writes = append(tx.writes, kvWrite{key: key, delete: true})
+}
+
+// Watch implements TransactionalKeyValueProvider. Every write bumps a key's version,
+// so a watched key counts as changed even if it was set back to the same value.
+func (p *MemoryProvider) Watch(ctx context.Context, fn func(tx KVTx) error, keys ...string) error {
+	p.kvMu.Lock()
+	versions := make(map[string]uint64, len(keys))
+	for _, key := range keys {
+		e, _ := p.entry(key)
+		versions[key] = e.version
+	}
+	p.kvMu.Unlock()
+
+	tx := &memoryKVTx{provider: p}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return NewErrorWithCause(ErrorTypeTimeout, "transaction canceled", err)
+	}
+
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	for key, version := range versions {
+		if e, _ := p.entry(key); e.version != version {
+			return NewWatchConflictError(key)
+		}
+	}
+	for _, w := range tx.writes {
+		if w.delete {
+			delete(p.kv, w.key)
+		} else {
+			p.put(w.key, memoryEntry{value: w.value, expiresAt: p.expiry(w.ttl)})
+		}
+	}
+	return nil
+}
+
+// Increment implements AtomicKeyValueProvider. The counter keeps its expiry.
+func (p *MemoryProvider) Increment(ctx context.Context, key string, delta int64) (int64, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	e, _ := p.entry(key)
+	var current int64
+	switch v := e.value.(type) {
+	case nil:
+	case int64:
+		current = v
+	case int:
+		current = int64(v)
+	case []byte:
+		parsed, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			return 0, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("value of %q is not an integer", key))
+		}
+		current = parsed
+	case string:
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("value of %q is not an integer", key))
+		}
+		current = parsed
+	default:
+		return 0, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("value of %q is not an integer", key))
+	}
+	e.value = current + delta
+	p.put(key, e)
+	return current + delta, nil
+}
+
+// =====================================
+// In-Memory Data Structures
+// =====================================
+
+// structureAt returns the structure of type V stored at key. If the key is missing,
+// the zero V and false are returned. kvMu must be held.
+func structureAt[V any](p *MemoryProvider, key string) (V, bool, error) {
+	var zero V
+	e, ok := p.entry(key)
+	if !ok {
+		return zero, false, nil
+	}
+	v, ok := e.value.(V)
+	if !ok {
+		return zero, false, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("key %q holds a %T, not a %T", key, e.value, zero))
+	}
+	return v, true, nil
+}
+
+// storeStructure stores v at key, keeping the key's expiry, or deletes the key if
+// empty is true. kvMu must be held.
+func (p *MemoryProvider) storeStructure(key string, v interface{}, empty bool) {
+	if empty {
+		delete(p.kv, key)
+		return
+	}
+	e := p.kv[key]
+	e.value = v
+	p.put(key, e)
+}
+
+// redisRange converts inclusive, possibly negative Redis indexes to a slice range of n elements
+func redisRange(start, stop int64, n int) (int, int) {
+	if start < 0 {
+		start += int64(n)
+	}
+	if stop < 0 {
+		stop += int64(n)
+	}
+	start = max(start, 0)
+	stop = min(stop, int64(n)-1)
+	if start > stop {
+		return 0, 0
+	}
+	return int(start), int(stop) + 1
+}
+
+// HSet implements HashRepository
+func (p *MemoryProvider) HSet(ctx context.Context, key string, values map[string]interface{}) (int64, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	hash, _, err := structureAt[map[string]string](p, key)
+	if err != nil {
+		return 0, err
+	}
+	if hash == nil {
+		hash = map[string]string{}
+	}
+	var added int64
+	for field, value := range values {
+		if _, ok := hash[field]; !ok {
+			added++
+		}
+		if b, ok := value.([]byte); ok {
+			hash[field] = string(b)
+		} else {
+			hash[field] = fmt.Sprint(value)
+		}
+	}
+	p.storeStructure(key, hash, len(hash) == 0)
+	return added, nil
+}
+
+// HGet implements HashRepository
+func (p *MemoryProvider) HGet(ctx context.Context, key, field string) (string, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	hash, _, err := structureAt[map[string]string](p, key)
+	if err != nil {
+		return "", err
+	}
+	value, ok := hash[field]
+	if !ok {
+		return "", NewError(ErrorTypeNotFound, fmt.Sprintf("field %q of %q not found", field, key))
+	}
+	return value, nil
+}
+
+// HMGet implements HashRepository
+func (p *MemoryProvider) HMGet(ctx context.Context, key string, fields ...string) (map[string]string, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	hash, _, err := structureAt[map[string]string](p, key)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]string{}
+	for _, field := range fields {
+		if value, ok := hash[field]; ok {
+			result[field] = value
+		}
+	}
+	return result, nil
+}
+
+// HGetAll implements HashRepository
+func (p *MemoryProvider) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	hash, _, err := structureAt[map[string]string](p, key)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string, len(hash))
+	for field, value := range hash {
+		result[field] = value
+	}
+	return result, nil
+}
+
+// HDel implements HashRepository
+func (p *MemoryProvider) HDel(ctx context.Context, key string, fields ...string) (int64, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	hash, ok, err := structureAt[map[string]string](p, key)
+	if err != nil || !ok {
+		return 0, err
+	}
+	var removed int64
+	for _, field := range fields {
+		if _, ok := hash[field]; ok {
+			delete(hash, field)
+			removed++
+		}
+	}
+	p.storeStructure(key, hash, len(hash) == 0)
+	return removed, nil
+}
+
+// HExists implements HashRepository
+func (p *MemoryProvider) HExists(ctx context.Context, key, field string) (bool, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	hash, _, err := structureAt[map[string]string](p, key)
+	_, ok := hash[field]
+	return ok, err
+}
+
+// HIncrBy implements HashRepository
+func (p *MemoryProvider) HIncrBy(ctx context.Context, key, field string, delta int64) (int64, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	hash, _, err := structureAt[map[string]string](p, key)
+	if err != nil {
+		return 0, err
+	}
+	if hash == nil {
+		hash = map[string]string{}
+	}
+	var current int64
+	if value, ok := hash[field]; ok {
+		if current, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return 0, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("field %q of %q is not an integer", field, key))
+		}
+	}
+	hash[field] = strconv.FormatInt(current+delta, 10)
+	p.storeStructure(key, hash, false)
+	return current + delta, nil
+}
+
+// push adds values to the front or back of the list at key
+func (p *MemoryProvider) push(key string, values []string, front bool) (int64, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	list, _, err := structureAt[[]string](p, key)
+	if err != nil {
+		return 0, err
+	}
+	if front {
+		prepended := make([]string, 0, len(list)+len(values))
+		for i := len(values) - 1; i >= 0; i-- {
+			prepended = append(prepended, values[i])
+		}
+		list = append(prepended, list...)
+	} else {
+		list = append(list, values...)
+	}
+	p.storeStructure(key, list, len(list) == 0)
+	return int64(len(list)), nil
+}
+
+// pop removes the first or last element of the list at key
+func (p *MemoryProvider) pop(key string, front bool) (string, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	list, _, err := structureAt[[]string](p, key)
+	if err != nil {
+		return "", err
+	}
+	if len(list) == 0 {
+		return "", NewError(ErrorTypeNotFound, fmt.Sprintf("list %q is empty", key))
+	}
+	var value string
+	if front {
+		value, list = list[0], list[1:]
+	} else {
+		value, list = list[len(list)-1], list[:len(list)-1]
+	}
+	p.storeStructure(key, list, len(list) == 0)
+	return value, nil
+}
+
+// LPush implements ListRepository. Values are prepended one by one, as in Redis.
+func (p *MemoryProvider) LPush(ctx context.Context, key string, values ...string) (int64, error) {
+	return p.push(key, values, true)
+}
+
+// RPush implements ListRepository
+func (p *MemoryProvider) RPush(ctx context.Context, key string, values ...string) (int64, error) {
+	return p.push(key, values, false)
+}
+
+// LPop implements ListRepository
+func (p *MemoryProvider) LPop(ctx context.Context, key string) (string, error) {
+	return p.pop(key, true)
+}
+
+// RPop implements ListRepository
+func (p *MemoryProvider) RPop(ctx context.Context, key string) (string, error) {
+	return p.pop(key, false)
+}
+
+// LRange implements ListRepository
+func (p *MemoryProvider) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	list, _, err := structureAt[[]string](p, key)
+	if err != nil {
+		return nil, err
+	}
+	lo, hi := redisRange(start, stop, len(list))
+	return append([]string{}, list[lo:hi]...), nil
+}
+
+// LLen implements ListRepository
+func (p *MemoryProvider) LLen(ctx context.Context, key string) (int64, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	list, _, err := structureAt[[]string](p, key)
+	return int64(len(list)), err
+}
+
+// LTrim implements ListRepository
+func (p *MemoryProvider) LTrim(ctx context.Context, key string, start, stop int64) error {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	list, ok, err := structureAt[[]string](p, key)
+	if err != nil || !ok {
+		return err
+	}
+	lo, hi := redisRange(start, stop, len(list))
+	list = append([]string{}, list[lo:hi]...)
+	p.storeStructure(key, list, len(list) == 0)
+	return nil
+}
+
+// SAdd implements SetRepository
+func (p *MemoryProvider) SAdd(ctx context.Context, key string, members ...string) (int64, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	set, _, err := structureAt[map[string]struct{}](p, key)
+	if err != nil {
+		return 0, err
+	}
+	if set == nil {
+		set = map[string]struct{}{}
+	}
+	var added int64
+	for _, member := range members {
+		if _, ok := set[member]; !ok {
+			set[member] = struct{}{}
+			added++
+		}
+	}
+	p.storeStructure(key, set, len(set) == 0)
+	return added, nil
+}
+
+// SRem implements SetRepository
+func (p *MemoryProvider) SRem(ctx context.Context, key string, members ...string) (int64, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	set, ok, err := structureAt[map[string]struct{}](p, key)
+	if err != nil || !ok {
+		return 0, err
+	}
+	var removed int64
+	for _, member := range members {
+		if _, ok := set[member]; ok {
+			delete(set, member)
+			removed++
+		}
+	}
+	p.storeStructure(key, set, len(set) == 0)
+	return removed, nil
+}
+
+// SIsMember implements SetRepository
+func (p *MemoryProvider) SIsMember(ctx context.Context, key string, member string) (bool, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	set, _, err := structureAt[map[string]struct{}](p, key)
+	_, ok := set[member]
+	return ok, err
+}
+
+// SMembers implements SetRepository. Members are returned sorted.
+func (p *MemoryProvider) SMembers(ctx context.Context, key string) ([]string, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	set, _, err := structureAt[map[string]struct{}](p, key)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]string, 0, len(set))
+	for member := range set {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+// SCard implements SetRepository
+func (p *MemoryProvider) SCard(ctx context.Context, key string) (int64, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	set, _, err := structureAt[map[string]struct{}](p, key)
+	return int64(len(set)), err
+}
+
+// sortedMembers returns the members of zset ordered by score, then member
+func sortedMembers(zset map[string]float64) []ZMember[string] {
+	members := make([]ZMember[string], 0, len(zset))
+	for member, score := range zset {
+		members = append(members, ZMember[string]{Member: member, Score: score})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Score != members[j].Score {
+			return members[i].Score < members[j].Score
+		}
+		return members[i].Member < members[j].Member
+	})
+	return members
+}
+
+// ZAdd implements SortedSetRepository
+func (p *MemoryProvider) ZAdd(ctx context.Context, key string, members ...ZMember[string]) (int64, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	zset, _, err := structureAt[map[string]float64](p, key)
+	if err != nil {
+		return 0, err
+	}
+	if zset == nil {
+		zset = map[string]float64{}
+	}
+	var added int64
+	for _, m := range members {
+		if _, ok := zset[m.Member]; !ok {
+			added++
+		}
+		zset[m.Member] = m.Score
+	}
+	p.storeStructure(key, zset, len(zset) == 0)
+	return added, nil
+}
+
+// ZIncrBy implements SortedSetRepository
+func (p *MemoryProvider) ZIncrBy(ctx context.Context, key string, delta float64, member string) (float64, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	zset, _, err := structureAt[map[string]float64](p, key)
+	if err != nil {
+		return 0, err
+	}
+	if zset == nil {
+		zset = map[string]float64{}
+	}
+	zset[member] += delta
+	p.storeStructure(key, zset, false)
+	return zset[member], nil
+}
+
+// ZScore implements SortedSetRepository
+func (p *MemoryProvider) ZScore(ctx context.Context, key string, member string) (float64, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	zset, _, err := structureAt[map[string]float64](p, key)
+	if err != nil {
+		return 0, err
+	}
+	score, ok := zset[member]
+	if !ok {
+		return 0, NewError(ErrorTypeNotFound, fmt.Sprintf("member %q of %q not found", member, key))
+	}
+	return score, nil
+}
+
+// ZRem implements SortedSetRepository
+func (p *MemoryProvider) ZRem(ctx context.Context, key string, members ...string) (int64, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	zset, ok, err := structureAt[map[string]float64](p, key)
+	if err != nil || !ok {
+		return 0, err
+	}
+	var removed int64
+	for _, member := range members {
+		if _, ok := zset[member]; ok {
+			delete(zset, member)
+			removed++
+		}
+	}
+	p.storeStructure(key, zset, len(zset) == 0)
+	return removed, nil
+}
+
+// ZRange implements SortedSetRepository
+func (p *MemoryProvider) ZRange(ctx context.Context, key string, start, stop int64) ([]ZMember[string], error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	zset, _, err := structureAt[map[string]float64](p, key)
+	if err != nil {
+		return nil, err
+	}
+	members := sortedMembers(zset)
+	lo, hi := redisRange(start, stop, len(members))
+	return members[lo:hi], nil
+}
+
+// ZRevRange implements SortedSetRepository
+func (p *MemoryProvider) ZRevRange(ctx context.Context, key string, start, stop int64) ([]ZMember[string], error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	zset, _, err := structureAt[map[string]float64](p, key)
+	if err != nil {
+		return nil, err
+	}
+	members := sortedMembers(zset)
+	for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+		members[i], members[j] = members[j], members[i]
+	}
+	lo, hi := redisRange(start, stop, len(members))
+	return members[lo:hi], nil
+}
+
+// ZRangeByScore implements SortedSetRepository
+func (p *MemoryProvider) ZRangeByScore(ctx context.Context, key string, min, max float64, offset, count int64) ([]ZMember[string], error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	zset, _, err := structureAt[map[string]float64](p, key)
+	if err != nil {
+		return nil, err
+	}
+	var matched []ZMember[string]
+	for _, m := range sortedMembers(zset) {
+		if m.Score >= min && m.Score <= max {
+			matched = append(matched, m)
+		}
+	}
+	if offset >= int64(len(matched)) {
+		return nil, nil
+	}
+	matched = matched[offset:]
+	if count > 0 && count < int64(len(matched)) {
+		matched = matched[:count]
+	}
+	return matched, nil
+}
+
+// ZRank implements SortedSetRepository
+func (p *MemoryProvider) ZRank(ctx context.Context, key string, member string) (int64, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	zset, _, err := structureAt[map[string]float64](p, key)
+	if err != nil {
+		return 0, err
+	}
+	for i, m := range sortedMembers(zset) {
+		if m.Member == member {
+			return int64(i), nil
+		}
+	}
+	return 0, NewError(ErrorTypeNotFound, fmt.Sprintf("member %q of %q not found", member, key))
+}
+
+// ZCard implements SortedSetRepository
+func (p *MemoryProvider) ZCard(ctx context.Context, key string) (int64, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	zset, _, err := structureAt[map[string]float64](p, key)
+	return int64(len(zset)), err
+}
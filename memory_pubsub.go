@@ -0,0 +1,89 @@
+package gpa
+
+import (
+	"context"
+	"fmt"
+	"path"
+)
+
+// =====================================
+// In-Memory Pub/Sub
+// =====================================
+
+// memorySubscriberBuffer is the number of messages a subscriber can fall behind
+// before further messages to it are dropped
+const memorySubscriberBuffer = 64
+
+// memorySubscriber is a subscription to a MemoryProvider
+type memorySubscriber struct {
+	patterns []string
+	messages chan Message
+	cancel   context.CancelFunc
+}
+
+// Publish implements PubSubProvider. Subscribers whose buffer is full miss the message.
+func (p *MemoryProvider) Publish(ctx context.Context, channel string, payload []byte) (int64, error) {
+	if err := p.Health(); err != nil {
+		return 0, err
+	}
+	p.subMu.RLock()
+	defer p.subMu.RUnlock()
+	var received int64
+	for sub := range p.subs {
+		pattern, ok := matchChannel(sub.patterns, channel)
+		if !ok {
+			continue
+		}
+		if !IsChannelPattern(pattern) {
+			pattern = ""
+		}
+		select {
+		case sub.messages <- Message{Channel: channel, Pattern: pattern, Payload: append([]byte(nil), payload...)}:
+			received++
+		default:
+		}
+	}
+	return received, nil
+}
+
+// Subscribe implements PubSubProvider with path.Match glob patterns
+func (p *MemoryProvider) Subscribe(ctx context.Context, patterns ...string) (<-chan Message, error) {
+	if len(patterns) == 0 {
+		return nil, NewError(ErrorTypeInvalidArgument, "at least one channel pattern is required")
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, NewErrorWithCause(ErrorTypeInvalidArgument, fmt.Sprintf("invalid channel pattern %q", pattern), err)
+		}
+	}
+	if err := p.Health(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &memorySubscriber{patterns: patterns, messages: make(chan Message, memorySubscriberBuffer), cancel: cancel}
+	p.subMu.Lock()
+	if p.subs == nil {
+		p.subs = make(map[*memorySubscriber]struct{})
+	}
+	p.subs[sub] = struct{}{}
+	p.subMu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		p.subMu.Lock()
+		delete(p.subs, sub)
+		close(sub.messages)
+		p.subMu.Unlock()
+	}()
+	return sub.messages, nil
+}
+
+// closeSubscriptions ends all subscriptions of the provider
+func (p *MemoryProvider) closeSubscriptions() {
+	p.subMu.RLock()
+	defer p.subMu.RUnlock()
+	for sub := range p.subs {
+		sub.cancel()
+	}
+}
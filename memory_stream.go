@@ -0,0 +1,284 @@
+package gpa
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =====================================
+// In-Memory Streams
+// =====================================
+
+// streamID is a stream entry ID: a millisecond timestamp and a sequence number
+type streamID struct {
+	ms, seq uint64
+}
+
+func (id streamID) String() string {
+	return strconv.FormatUint(id.ms, 10) + "-" + strconv.FormatUint(id.seq, 10)
+}
+
+func (id streamID) less(other streamID) bool {
+	return id.ms < other.ms || id.ms == other.ms && id.seq < other.seq
+}
+
+// parseStreamID parses "ms-seq", or "ms" with the sequence defaulting to seq.
+// "-" and "+" are the smallest and largest IDs.
+func parseStreamID(id string, seq uint64) (streamID, error) {
+	switch id {
+	case "-":
+		return streamID{}, nil
+	case "+":
+		return streamID{ms: math.MaxUint64, seq: math.MaxUint64}, nil
+	}
+	msPart, seqPart, hasSeq := strings.Cut(id, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err == nil && hasSeq {
+		seq, err = strconv.ParseUint(seqPart, 10, 64)
+	}
+	if err != nil {
+		return streamID{}, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("invalid stream ID %q", id))
+	}
+	return streamID{ms: ms, seq: seq}, nil
+}
+
+// memoryStreamEntry is an entry of a memoryStream
+type memoryStreamEntry struct {
+	id    streamID
+	value map[string]string
+}
+
+// memoryStreamGroup is a consumer group: the last ID delivered to it and the
+// delivered entries not yet acknowledged, by ID
+type memoryStreamGroup struct {
+	delivered streamID
+	pending   map[streamID]string
+}
+
+// memoryStream is a stream stored in the key-value map
+type memoryStream struct {
+	entries []memoryStreamEntry
+	last    streamID
+	groups  map[string]*memoryStreamGroup
+}
+
+// after returns up to count messages with IDs above id; count <= 0 returns all
+func (s *memoryStream) after(key string, id streamID, count int64) []StreamMessage[map[string]string] {
+	var messages []StreamMessage[map[string]string]
+	for _, entry := range s.entries {
+		if count > 0 && int64(len(messages)) >= count {
+			break
+		}
+		if id.less(entry.id) {
+			messages = append(messages, StreamMessage[map[string]string]{ID: entry.id.String(), Stream: key, Value: maps.Clone(entry.value)})
+		}
+	}
+	return messages
+}
+
+// stream returns the stream at key, creating it if create is set. kvMu must be held.
+func (p *MemoryProvider) stream(key string, create bool) (*memoryStream, error) {
+	stream, ok, err := structureAt[*memoryStream](p, key)
+	if err != nil || ok || !create {
+		return stream, err
+	}
+	stream = &memoryStream{groups: map[string]*memoryStreamGroup{}}
+	p.storeStructure(key, stream, false)
+	return stream, nil
+}
+
+// awaitStream runs read under kvMu until it returns messages, ctx ends or block
+// passes. A block of zero or less reads once.
+func (p *MemoryProvider) awaitStream(ctx context.Context, block time.Duration, read func() ([]StreamMessage[map[string]string], error)) ([]StreamMessage[map[string]string], error) {
+	var deadline <-chan time.Time
+	if block > 0 {
+		timer := time.NewTimer(block)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	for {
+		p.kvMu.Lock()
+		messages, err := read()
+		if err != nil || len(messages) > 0 || deadline == nil {
+			p.kvMu.Unlock()
+			return messages, err
+		}
+		if p.streamAdded == nil {
+			p.streamAdded = make(chan struct{})
+		}
+		added := p.streamAdded
+		p.kvMu.Unlock()
+
+		select {
+		case <-added:
+		case <-deadline:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// XAdd implements StreamRepository. IDs are the provider clock in milliseconds with a
+// sequence number, increasing even if the clock goes back.
+func (p *MemoryProvider) XAdd(ctx context.Context, stream string, value map[string]string) (string, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	s, err := p.stream(stream, true)
+	if err != nil {
+		return "", err
+	}
+	id := streamID{ms: uint64(p.now().UnixMilli())}
+	if !s.last.less(id) {
+		id = streamID{ms: s.last.ms, seq: s.last.seq + 1}
+	}
+	s.entries = append(s.entries, memoryStreamEntry{id: id, value: maps.Clone(value)})
+	s.last = id
+	p.storeStructure(stream, s, false)
+	if p.streamAdded != nil {
+		close(p.streamAdded)
+		p.streamAdded = nil
+	}
+	return id.String(), nil
+}
+
+// XLen implements StreamRepository
+func (p *MemoryProvider) XLen(ctx context.Context, stream string) (int64, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	s, err := p.stream(stream, false)
+	if err != nil || s == nil {
+		return 0, err
+	}
+	return int64(len(s.entries)), nil
+}
+
+// XRange implements StreamRepository
+func (p *MemoryProvider) XRange(ctx context.Context, stream, start, end string, count int64) ([]StreamMessage[map[string]string], error) {
+	from, err := parseStreamID(start, 0)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseStreamID(end, math.MaxUint64)
+	if err != nil {
+		return nil, err
+	}
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	s, err := p.stream(stream, false)
+	if err != nil || s == nil {
+		return nil, err
+	}
+	var messages []StreamMessage[map[string]string]
+	for _, entry := range s.entries {
+		if count > 0 && int64(len(messages)) >= count {
+			break
+		}
+		if !entry.id.less(from) && !to.less(entry.id) {
+			messages = append(messages, StreamMessage[map[string]string]{ID: entry.id.String(), Stream: stream, Value: maps.Clone(entry.value)})
+		}
+	}
+	return messages, nil
+}
+
+// XRead implements StreamRepository. "$" reads only entries added after the call.
+func (p *MemoryProvider) XRead(ctx context.Context, stream, lastID string, count int64, block time.Duration) ([]StreamMessage[map[string]string], error) {
+	var after streamID
+	if lastID == "$" {
+		p.kvMu.Lock()
+		s, err := p.stream(stream, false)
+		if s != nil {
+			after = s.last
+		}
+		p.kvMu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if after, err = parseStreamID(lastID, 0); err != nil {
+			return nil, err
+		}
+	}
+	return p.awaitStream(ctx, block, func() ([]StreamMessage[map[string]string], error) {
+		s, err := p.stream(stream, false)
+		if err != nil || s == nil {
+			return nil, err
+		}
+		return s.after(stream, after, count), nil
+	})
+}
+
+// XGroupCreate implements StreamRepository. Returns ErrorTypeDuplicate if the group exists.
+func (p *MemoryProvider) XGroupCreate(ctx context.Context, stream, group, start string) error {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	s, err := p.stream(stream, true)
+	if err != nil {
+		return err
+	}
+	if _, exists := s.groups[group]; exists {
+		return NewError(ErrorTypeDuplicate, fmt.Sprintf("consumer group %q of %q already exists", group, stream))
+	}
+	delivered := s.last
+	if start != "$" {
+		if delivered, err = parseStreamID(start, 0); err != nil {
+			return err
+		}
+	}
+	s.groups[group] = &memoryStreamGroup{delivered: delivered, pending: map[streamID]string{}}
+	return nil
+}
+
+// XReadGroup implements StreamRepository. Delivered entries stay pending for the
+// consumer until they are acknowledged with XAck.
+func (p *MemoryProvider) XReadGroup(ctx context.Context, stream, group, consumer string, count int64, block time.Duration) ([]StreamMessage[map[string]string], error) {
+	return p.awaitStream(ctx, block, func() ([]StreamMessage[map[string]string], error) {
+		s, err := p.stream(stream, false)
+		if err != nil {
+			return nil, err
+		}
+		var g *memoryStreamGroup
+		if s != nil {
+			g = s.groups[group]
+		}
+		if g == nil {
+			return nil, NewError(ErrorTypeNotFound, fmt.Sprintf("consumer group %q of %q not found", group, stream))
+		}
+		messages := s.after(stream, g.delivered, count)
+		for _, message := range messages {
+			id, _ := parseStreamID(message.ID, 0)
+			g.pending[id] = consumer
+			g.delivered = id
+		}
+		return messages, nil
+	})
+}
+
+// XAck implements StreamRepository
+func (p *MemoryProvider) XAck(ctx context.Context, stream, group string, ids ...string) (int64, error) {
+	p.kvMu.Lock()
+	defer p.kvMu.Unlock()
+	s, err := p.stream(stream, false)
+	if err != nil || s == nil || s.groups[group] == nil {
+		return 0, err
+	}
+	pending := s.groups[group].pending
+	var acked int64
+	for _, raw := range ids {
+		id, err := parseStreamID(raw, 0)
+		if err != nil {
+			return acked, err
+		}
+		if _, ok := pending[id]; ok {
+			delete(pending, id)
+			acked++
+		}
+	}
+	return acked, nil
+}
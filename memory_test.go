@@ -0,0 +1,209 @@
+package gpa
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+type memoryItem struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Price int    `json:"price"`
+}
+
+type memoryToken struct {
+	Token string `json:"token" gorm:"primaryKey"`
+	User  int    `json:"user"`
+}
+
+func seedMemoryItems(t *testing.T) *MemoryRepository[memoryItem] {
+	t.Helper()
+	repo := NewMemoryRepository[memoryItem]()
+	err := repo.CreateBatch(context.Background(), []*memoryItem{
+		{Name: "pen", Price: 3}, {Name: "book", Price: 12}, {Name: "lamp", Price: 30},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return repo
+}
+
+func TestMemoryRepository_CRUD(t *testing.T) {
+	repo := NewMemoryRepository[memoryItem]()
+	ctx := context.Background()
+
+	item := &memoryItem{Name: "pen", Price: 3}
+	if err := repo.Create(ctx, item); err != nil || item.ID != 1 {
+		t.Fatalf("Expected generated id 1, got %d (%v)", item.ID, err)
+	}
+	if err := repo.Create(ctx, &memoryItem{ID: 1}); !IsDuplicate(err) {
+		t.Errorf("Expected duplicate error, got %v", err)
+	}
+
+	found, err := repo.FindByID(ctx, "1")
+	if err != nil || found.Name != "pen" {
+		t.Fatalf("Expected to find pen by string id, got %v (%v)", found, err)
+	}
+	found.Name = "changed"
+	if again, _ := repo.FindByID(ctx, 1); again.Name != "pen" {
+		t.Error("Expected stored entity to be isolated from returned copies")
+	}
+
+	if err := repo.UpdatePartial(ctx, 1, map[string]interface{}{"price": 4}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := repo.UpdatePartial(ctx, 1, map[string]interface{}{"id": 9}); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected primary key change to be rejected, got %v", err)
+	}
+	if err := repo.Update(ctx, &memoryItem{ID: 2}); !IsNotFound(err) {
+		t.Errorf("Expected not found on update, got %v", err)
+	}
+	if found, _ := repo.FindByID(ctx, 1); found.Price != 4 {
+		t.Errorf("Expected price 4, got %d", found.Price)
+	}
+
+	if err := repo.Delete(ctx, 1); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := repo.FindByID(ctx, 1); !IsNotFound(err) {
+		t.Errorf("Expected not found after delete, got %v", err)
+	}
+}
+
+func TestMemoryRepository_GeneratesStringKeys(t *testing.T) {
+	repo := NewMemoryRepository[memoryToken]()
+	token := &memoryToken{User: 1}
+	repo.Create(context.Background(), token)
+
+	info, _ := repo.GetEntityInfo()
+	if len(info.PrimaryKey) != 1 || info.PrimaryKey[0] != "token" || token.Token == "" {
+		t.Errorf("Expected generated tagged string key, got %v / %q", info.PrimaryKey, token.Token)
+	}
+}
+
+func TestMemoryRepository_Query(t *testing.T) {
+	repo := seedMemoryItems(t)
+	ctx := context.Background()
+
+	items, err := repo.Query(ctx, Where("price", OpGreaterThan, 5), OrderBy("price", OrderDesc))
+	if err != nil || len(items) != 2 || items[0].Name != "lamp" {
+		t.Fatalf("Expected lamp then book, got %v (%v)", items, err)
+	}
+
+	items, _ = repo.Query(ctx, OrderBy("name", OrderAsc), Offset(1), Limit(1))
+	if len(items) != 1 || items[0].Name != "lamp" {
+		t.Errorf("Expected second item by name, got %v", items)
+	}
+
+	if count, _ := repo.Count(ctx, WhereIn("name", []interface{}{"pen", "lamp"}), Limit(1)); count != 2 {
+		t.Errorf("Expected count to ignore limit, got %d", count)
+	}
+	if one, err := repo.QueryOne(ctx, WhereLike("name", "bo%")); err != nil || one.Price != 12 {
+		t.Errorf("Expected book, got %v (%v)", one, err)
+	}
+	if _, err := repo.QueryOne(ctx, Where("price", OpGreaterThan, 100)); !IsNotFound(err) {
+		t.Errorf("Expected not found, got %v", err)
+	}
+
+	repo.DeleteByCondition(ctx, WhereCondition("price", OpLessThan, 20))
+	if count, _ := repo.Count(ctx); count != 1 {
+		t.Errorf("Expected 1 item left, got %d", count)
+	}
+	if _, err := repo.RawQuery(ctx, "SELECT 1", nil); !IsErrorType(err, ErrorTypeUnsupported) {
+		t.Errorf("Expected raw queries to be unsupported, got %v", err)
+	}
+}
+
+func TestMemoryRepository_Transaction(t *testing.T) {
+	repo := seedMemoryItems(t)
+	ctx := context.Background()
+
+	err := repo.Transaction(ctx, func(tx Transaction[memoryItem]) error {
+		tx.Delete(ctx, 1)
+		if count, _ := tx.Count(ctx); count != 2 {
+			t.Errorf("Expected delete to be visible inside the transaction, got %d", count)
+		}
+		return NewError(ErrorTypeValidation, "abort")
+	})
+	if !IsErrorType(err, ErrorTypeValidation) {
+		t.Fatalf("Expected abort error, got %v", err)
+	}
+	if count, _ := repo.Count(ctx); count != 3 {
+		t.Errorf("Expected rollback to keep 3 items, got %d", count)
+	}
+
+	repo.Transaction(ctx, func(tx Transaction[memoryItem]) error {
+		tx.Create(ctx, &memoryItem{Name: "cup"})
+		tx.SetSavepoint("before_delete")
+		tx.Delete(ctx, 2)
+		return tx.RollbackToSavepoint("before_delete")
+	})
+	if count, _ := repo.Count(ctx); count != 4 {
+		t.Errorf("Expected commit up to the savepoint, got %d items", count)
+	}
+	if _, err := repo.FindByID(ctx, 2); err != nil {
+		t.Errorf("Expected delete after savepoint to be rolled back, got %v", err)
+	}
+}
+
+func TestMemoryProvider(t *testing.T) {
+	provider := NewMemoryProvider()
+	if GetMemoryRepository[memoryItem](provider) != GetMemoryRepository[memoryItem](provider) {
+		t.Error("Expected one repository per entity type")
+	}
+	if provider.ProviderInfo().DatabaseType != DatabaseTypeMemory {
+		t.Error("Expected memory database type")
+	}
+	for _, feature := range []Feature{FeatureAggregation, FeatureGeoSpatial, FeatureFullText} {
+		if !slices.Contains(provider.SupportedFeatures(), feature) {
+			t.Errorf("Expected feature %s to be supported", feature)
+		}
+	}
+	provider.Close()
+	if err := provider.Health(); err == nil {
+		t.Error("Expected unhealthy provider after close")
+	}
+}
+
+func TestMemoryProvider_KeyValue(t *testing.T) {
+	provider := NewMemoryProvider()
+	now := time.Unix(1000, 0)
+	provider.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	provider.Set(ctx, "user:1", []byte("ada"), time.Minute)
+	provider.Set(ctx, "user:2", "bob", 0)
+	if keys, _ := provider.Keys(ctx, "user:*"); len(keys) != 2 || keys[0] != "user:1" {
+		t.Errorf("Expected sorted matching keys, got %v", keys)
+	}
+	if ttl, _ := provider.TTL(ctx, "user:1"); ttl != time.Minute {
+		t.Errorf("Expected 1m ttl, got %v", ttl)
+	}
+
+	if ok, _ := provider.SetIfAbsent(ctx, "user:1", "other", 0); ok {
+		t.Error("Expected SetIfAbsent to keep the existing value")
+	}
+	if ok, _ := provider.CompareAndDelete(ctx, "user:1", "bob"); ok {
+		t.Error("Expected CompareAndDelete to fail on a different value")
+	}
+	if ok, _ := provider.CompareAndExpire(ctx, "user:1", "ada", 2*time.Minute); !ok {
+		t.Error("Expected CompareAndExpire to match bytes against a string")
+	}
+
+	now = now.Add(3 * time.Minute)
+	if _, err := provider.Get(ctx, "user:1"); !IsNotFound(err) {
+		t.Errorf("Expected expired key to be gone, got %v", err)
+	}
+	if ok, _ := provider.SetIfAbsent(ctx, "user:1", "cy", 0); !ok {
+		t.Error("Expected SetIfAbsent to succeed after expiry")
+	}
+
+	if n, err := provider.Increment(ctx, "hits", 2); err != nil || n != 2 {
+		t.Errorf("Expected counter 2, got %d (%v)", n, err)
+	}
+	if _, err := provider.Increment(ctx, "user:2", 1); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected non-integer error, got %v", err)
+	}
+}
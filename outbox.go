@@ -0,0 +1,304 @@
+package gpa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// =====================================
+// Outbox Messages
+// =====================================
+
+// OutboxMessage is a domain event stored in the outbox until it has been published.
+// Delivery is at-least-once, so consumers should deduplicate by ID.
+type OutboxMessage struct {
+	ID            string     `json:"id" db:"id"`
+	Topic         string     `json:"topic" db:"topic"`
+	PartitionKey  string     `json:"partition_key" db:"partition_key"`
+	Payload       []byte     `json:"payload" db:"payload"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	Attempts      int        `json:"attempts" db:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" db:"next_attempt_at"`
+	LastError     string     `json:"last_error" db:"last_error"`
+	DeliveredAt   *time.Time `json:"delivered_at" db:"delivered_at"`
+	FailedAt      *time.Time `json:"failed_at" db:"failed_at"`
+}
+
+// NewOutboxMessage creates a message for topic. Payloads of type []byte are stored as-is,
+// anything else is encoded as JSON.
+// Example: msg, err := gpa.NewOutboxMessage("orders.created", OrderCreated{ID: order.ID})
+func NewOutboxMessage(topic string, payload interface{}) (OutboxMessage, error) {
+	if topic == "" {
+		return OutboxMessage{}, NewError(ErrorTypeInvalidArgument, "outbox message requires a topic")
+	}
+	data, ok := payload.([]byte)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return OutboxMessage{}, NewErrorWithCause(ErrorTypeSerialization, "cannot encode outbox payload", err)
+		}
+	}
+	now := time.Now()
+	return OutboxMessage{
+		ID:            newRandomID(),
+		Topic:         topic,
+		Payload:       data,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}, nil
+}
+
+// =====================================
+// Outbox Stores
+// =====================================
+
+// OutboxStore persists outbox messages
+type OutboxStore interface {
+	// Enqueue stores messages using tx, so that they commit or roll back with the
+	// surrounding transaction. Every Transaction[T] is an Executor.
+	Enqueue(ctx context.Context, tx Executor, messages ...OutboxMessage) error
+
+	// Pending returns up to limit undelivered messages that are due at now, oldest first.
+	Pending(ctx context.Context, now time.Time, limit int) ([]OutboxMessage, error)
+
+	// MarkDelivered records that the message was published.
+	MarkDelivered(ctx context.Context, id string, at time.Time) error
+
+	// MarkFailed stores the Attempts, NextAttemptAt, LastError and FailedAt of msg.
+	MarkFailed(ctx context.Context, msg OutboxMessage) error
+}
+
+// SQLOutboxStore keeps messages in a SQL table. Enqueue inserts with raw SQL on the given
+// transaction; the relay side reads and updates through Repository. The table is taken from
+// the repository's entity info and defaults to "outbox"; its columns are the db tags of
+// OutboxMessage.
+type SQLOutboxStore struct {
+	Repository Repository[OutboxMessage]
+
+	table func() string
+}
+
+// NewSQLOutboxStore returns a store backed by repo
+// Example: store := gpa.NewSQLOutboxStore(gpagorm.GetRepository[gpa.OutboxMessage](provider))
+func NewSQLOutboxStore(repo Repository[OutboxMessage]) *SQLOutboxStore {
+	return &SQLOutboxStore{
+		Repository: repo,
+		table: sync.OnceValue(func() string {
+			if info, err := repo.GetEntityInfo(); err == nil && info != nil && info.TableName != "" {
+				return info.TableName
+			}
+			return "outbox"
+		}),
+	}
+}
+
+// Enqueue implements OutboxStore. A nil tx inserts through the repository, outside any transaction.
+func (s *SQLOutboxStore) Enqueue(ctx context.Context, tx Executor, messages ...OutboxMessage) error {
+	if tx == nil {
+		tx = s.Repository
+	}
+	query := fmt.Sprintf("INSERT INTO %s (id, topic, partition_key, payload, created_at, attempts, next_attempt_at) VALUES (?, ?, ?, ?, ?, ?, ?)", s.table())
+	for _, msg := range messages {
+		if msg.ID == "" || msg.Topic == "" {
+			return NewError(ErrorTypeInvalidArgument, "outbox message requires an id and a topic")
+		}
+		if _, err := tx.RawExec(ctx, query, []interface{}{
+			msg.ID, msg.Topic, msg.PartitionKey, msg.Payload, msg.CreatedAt, msg.Attempts, msg.NextAttemptAt,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pending implements OutboxStore
+func (s *SQLOutboxStore) Pending(ctx context.Context, now time.Time, limit int) ([]OutboxMessage, error) {
+	found, err := s.Repository.Query(ctx,
+		WhereNull("delivered_at"),
+		WhereNull("failed_at"),
+		Where("next_attempt_at", OpLessThanOrEqual, now),
+		OrderBy("created_at", OrderAsc),
+		Limit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]OutboxMessage, 0, len(found))
+	for _, msg := range found {
+		messages = append(messages, *msg)
+	}
+	return messages, nil
+}
+
+// MarkDelivered implements OutboxStore
+func (s *SQLOutboxStore) MarkDelivered(ctx context.Context, id string, at time.Time) error {
+	return s.Repository.UpdatePartial(ctx, id, map[string]interface{}{"delivered_at": at})
+}
+
+// MarkFailed implements OutboxStore
+func (s *SQLOutboxStore) MarkFailed(ctx context.Context, msg OutboxMessage) error {
+	return s.Repository.UpdatePartial(ctx, msg.ID, map[string]interface{}{
+		"attempts":        msg.Attempts,
+		"next_attempt_at": msg.NextAttemptAt,
+		"last_error":      msg.LastError,
+		"failed_at":       msg.FailedAt,
+	})
+}
+
+// =====================================
+// Publishers
+// =====================================
+
+// OutboxPublisher delivers outbox messages to a broker
+type OutboxPublisher interface {
+	Publish(ctx context.Context, msg OutboxMessage) error
+}
+
+// ChannelPublisher publishes messages to an in-process channel
+type ChannelPublisher struct {
+	messages chan OutboxMessage
+}
+
+// NewChannelPublisher returns a publisher whose channel holds up to buffer messages.
+// Publish blocks while the buffer is full.
+// Example: pub := gpa.NewChannelPublisher(64); go func() { for msg := range pub.Messages() { handle(msg) } }()
+func NewChannelPublisher(buffer int) *ChannelPublisher {
+	return &ChannelPublisher{messages: make(chan OutboxMessage, buffer)}
+}
+
+// Publish implements OutboxPublisher
+func (p *ChannelPublisher) Publish(ctx context.Context, msg OutboxMessage) error {
+	select {
+	case p.messages <- msg:
+		return nil
+	case <-ctx.Done():
+		return NewErrorWithCause(ErrorTypeTimeout, "outbox channel is full", ctx.Err())
+	}
+}
+
+// Messages returns the channel messages are published to
+func (p *ChannelPublisher) Messages() <-chan OutboxMessage {
+	return p.messages
+}
+
+// =====================================
+// Relay
+// =====================================
+
+// OutboxRelayConfig configures an OutboxRelay
+type OutboxRelayConfig struct {
+	// BatchSize is the number of messages fetched per poll. Defaults to 100.
+	BatchSize int
+
+	// PollInterval is the delay between polls that found no work. Defaults to 1s.
+	PollInterval time.Duration
+
+	// Retry controls redelivery of failed messages. InitialBackoff, MaxBackoff, Multiplier
+	// and Jitter set the delay before the next attempt; after MaxAttempts attempts the
+	// message is marked failed and no longer retried. MaxAttempts below 1 retries forever.
+	// Defaults to DefaultRetryPolicy() with MaxAttempts 10 when MaxAttempts and
+	// InitialBackoff are both zero.
+	Retry RetryPolicy
+
+	// OnError is called for every failed publish or store error, if set.
+	OnError func(msg OutboxMessage, err error)
+}
+
+// OutboxRelay polls an OutboxStore and dispatches due messages to a publisher
+type OutboxRelay struct {
+	store     OutboxStore
+	publisher OutboxPublisher
+	config    OutboxRelayConfig
+	now       func() time.Time
+}
+
+// NewOutboxRelay returns a relay from store to publisher
+// Example: go gpa.NewOutboxRelay(store, publisher, gpa.OutboxRelayConfig{}).Run(ctx)
+func NewOutboxRelay(store OutboxStore, publisher OutboxPublisher, config OutboxRelayConfig) *OutboxRelay {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.Retry.MaxAttempts == 0 && config.Retry.InitialBackoff == 0 {
+		config.Retry = DefaultRetryPolicy()
+		config.Retry.MaxAttempts = 10
+	}
+	return &OutboxRelay{store: store, publisher: publisher, config: config, now: time.Now}
+}
+
+// RelayOnce dispatches one batch of due messages and returns how many were delivered.
+// A failed publish is rescheduled and does not stop the batch; store errors are returned.
+func (r *OutboxRelay) RelayOnce(ctx context.Context) (int, error) {
+	messages, err := r.store.Pending(ctx, r.now(), r.config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, msg := range messages {
+		if err := ctx.Err(); err != nil {
+			return delivered, err
+		}
+		if err := r.publisher.Publish(ctx, msg); err != nil {
+			r.reportError(msg, err)
+			if err := r.store.MarkFailed(ctx, r.failed(msg, err)); err != nil {
+				return delivered, err
+			}
+			continue
+		}
+		if err := r.store.MarkDelivered(ctx, msg.ID, r.now()); err != nil {
+			// the message will be published again on the next poll
+			r.reportError(msg, err)
+			return delivered, err
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+// Run relays messages until ctx is done. Full batches are followed immediately by the next
+// poll; otherwise the relay waits PollInterval. Store errors are reported through OnError
+// and retried on the next poll.
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	for {
+		delivered, err := r.RelayOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.reportError(OutboxMessage{}, err)
+		}
+		if err == nil && delivered == r.config.BatchSize {
+			continue
+		}
+
+		timer := time.NewTimer(r.config.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// failed returns msg with its next attempt scheduled, or marked failed once attempts run out
+func (r *OutboxRelay) failed(msg OutboxMessage, err error) OutboxMessage {
+	now := r.now()
+	msg.Attempts++
+	msg.LastError = err.Error()
+	if r.config.Retry.MaxAttempts > 0 && msg.Attempts >= r.config.Retry.MaxAttempts {
+		msg.FailedAt = &now
+		return msg
+	}
+	msg.NextAttemptAt = now.Add(r.config.Retry.backoff(msg.Attempts))
+	return msg
+}
+
+func (r *OutboxRelay) reportError(msg OutboxMessage, err error) {
+	if r.config.OnError != nil {
+		r.config.OnError(msg, err)
+	}
+}
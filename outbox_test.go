@@ -0,0 +1,220 @@
+package gpa
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryOutboxStore keeps messages in a map
+type memoryOutboxStore struct {
+	messages map[string]*OutboxMessage
+}
+
+func newMemoryOutboxStore(messages ...OutboxMessage) *memoryOutboxStore {
+	s := &memoryOutboxStore{messages: map[string]*OutboxMessage{}}
+	s.Enqueue(context.Background(), nil, messages...)
+	return s
+}
+
+func (s *memoryOutboxStore) Enqueue(ctx context.Context, tx Executor, messages ...OutboxMessage) error {
+	for i := range messages {
+		msg := messages[i]
+		s.messages[msg.ID] = &msg
+	}
+	return nil
+}
+
+func (s *memoryOutboxStore) Pending(ctx context.Context, now time.Time, limit int) ([]OutboxMessage, error) {
+	var pending []OutboxMessage
+	for _, msg := range s.messages {
+		if msg.DeliveredAt == nil && msg.FailedAt == nil && !msg.NextAttemptAt.After(now) {
+			pending = append(pending, *msg)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].CreatedAt.Before(pending[j].CreatedAt) })
+	if len(pending) > limit {
+		pending = pending[:limit]
+	}
+	return pending, nil
+}
+
+func (s *memoryOutboxStore) MarkDelivered(ctx context.Context, id string, at time.Time) error {
+	s.messages[id].DeliveredAt = &at
+	return nil
+}
+
+func (s *memoryOutboxStore) MarkFailed(ctx context.Context, msg OutboxMessage) error {
+	*s.messages[msg.ID] = msg
+	return nil
+}
+
+// flakyPublisher fails the first failures publishes
+type flakyPublisher struct {
+	failures  int
+	published []string
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, msg OutboxMessage) error {
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("broker unavailable")
+	}
+	p.published = append(p.published, msg.ID)
+	return nil
+}
+
+func TestNewOutboxMessage(t *testing.T) {
+	msg, err := NewOutboxMessage("orders.created", map[string]int{"id": 7})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if msg.ID == "" || string(msg.Payload) != `{"id":7}` || msg.NextAttemptAt.IsZero() {
+		t.Errorf("Unexpected message: %+v", msg)
+	}
+
+	raw, _ := NewOutboxMessage("raw", []byte("bytes"))
+	if string(raw.Payload) != "bytes" {
+		t.Errorf("Expected []byte payload to be stored as-is, got %q", raw.Payload)
+	}
+
+	if _, err := NewOutboxMessage("", nil); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected invalid argument without topic, got %v", err)
+	}
+}
+
+func TestSQLOutboxStore_EnqueueInTransaction(t *testing.T) {
+	orders := &mockRepository[auditedAccount]{}
+	outbox := &mockRepository[OutboxMessage]{info: &EntityInfo{TableName: "events_outbox"}}
+	store := NewSQLOutboxStore(outbox)
+	ctx := context.Background()
+
+	msg, _ := NewOutboxMessage("accounts.opened", []byte("{}"))
+	err := orders.Transaction(ctx, func(tx Transaction[auditedAccount]) error {
+		if err := tx.Create(ctx, &auditedAccount{ID: 1}); err != nil {
+			return err
+		}
+		return store.Enqueue(ctx, tx, msg)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if orders.callCount("RawExec") != 1 || outbox.callCount("RawExec") != 0 {
+		t.Errorf("Expected insert on the transaction, got %d tx / %d outside", orders.callCount("RawExec"), outbox.callCount("RawExec"))
+	}
+
+	store.Enqueue(ctx, nil, msg)
+	if outbox.callCount("RawExec") != 1 {
+		t.Error("Expected nil tx to insert through the repository")
+	}
+
+	if err := store.Enqueue(ctx, nil, OutboxMessage{ID: "x"}); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected invalid argument without topic, got %v", err)
+	}
+}
+
+func TestSQLOutboxStore_PendingAndMarks(t *testing.T) {
+	outbox := &mockRepository[OutboxMessage]{items: []*OutboxMessage{{ID: "m1"}}}
+	store := NewSQLOutboxStore(outbox)
+	ctx := context.Background()
+
+	pending, err := store.Pending(ctx, time.Now(), 10)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("Expected one pending message, got %v (%v)", pending, err)
+	}
+	query := NewQuery()
+	for _, opt := range outbox.lastOpts {
+		opt.Apply(query)
+	}
+	if len(query.Conditions) != 3 || query.Conditions[0].Operator() != OpIsNull || query.Limit == nil || *query.Limit != 10 {
+		t.Errorf("Unexpected pending query: %s", query)
+	}
+
+	store.MarkFailed(ctx, OutboxMessage{ID: "m1", Attempts: 2, LastError: "boom"})
+	if outbox.lastUpdates["attempts"] != 2 || outbox.lastUpdates["last_error"] != "boom" {
+		t.Errorf("Unexpected failure updates: %v", outbox.lastUpdates)
+	}
+	store.MarkDelivered(ctx, "m1", time.Now())
+	if _, ok := outbox.lastUpdates["delivered_at"]; !ok {
+		t.Errorf("Expected delivered_at update, got %v", outbox.lastUpdates)
+	}
+}
+
+func TestOutboxRelay_DeliversAndRetries(t *testing.T) {
+	first, _ := NewOutboxMessage("a", []byte("1"))
+	second, _ := NewOutboxMessage("b", []byte("2"))
+	second.CreatedAt = first.CreatedAt.Add(time.Millisecond)
+	store := newMemoryOutboxStore(first, second)
+	publisher := &flakyPublisher{failures: 1}
+
+	var reported []error
+	relay := NewOutboxRelay(store, publisher, OutboxRelayConfig{
+		Retry:   RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Minute},
+		OnError: func(msg OutboxMessage, err error) { reported = append(reported, err) },
+	})
+	ctx := context.Background()
+
+	delivered, err := relay.RelayOnce(ctx)
+	if err != nil || delivered != 1 {
+		t.Fatalf("Expected one delivery, got %d (%v)", delivered, err)
+	}
+	failed := store.messages[first.ID]
+	if failed.Attempts != 1 || failed.LastError != "broker unavailable" || !failed.NextAttemptAt.After(time.Now()) || len(reported) != 1 {
+		t.Errorf("Expected first message rescheduled, got %+v", failed)
+	}
+	if store.messages[second.ID].DeliveredAt == nil {
+		t.Error("Expected second message marked delivered")
+	}
+
+	if delivered, _ := relay.RelayOnce(ctx); delivered != 0 {
+		t.Error("Expected rescheduled message not to be due yet")
+	}
+
+	relay.now = func() time.Time { return time.Now().Add(time.Hour) }
+	publisher.failures = 1
+	relay.RelayOnce(ctx)
+	if failed := store.messages[first.ID]; failed.FailedAt == nil || failed.Attempts != 2 {
+		t.Errorf("Expected message marked failed after max attempts, got %+v", failed)
+	}
+	if pending, _ := store.Pending(ctx, relay.now(), 10); len(pending) != 0 {
+		t.Errorf("Expected failed message to leave the queue, got %d pending", len(pending))
+	}
+}
+
+func TestOutboxRelay_RunWithChannelPublisher(t *testing.T) {
+	msg, _ := NewOutboxMessage("orders.created", []byte("{}"))
+	store := newMemoryOutboxStore(msg)
+	publisher := NewChannelPublisher(1)
+	relay := NewOutboxRelay(store, publisher, OutboxRelayConfig{PollInterval: time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- relay.Run(ctx) }()
+
+	select {
+	case got := <-publisher.Messages():
+		if got.ID != msg.ID {
+			t.Errorf("Expected %s, got %s", msg.ID, got.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected message on the channel")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Expected Run to stop cleanly, got %v", err)
+	}
+}
+
+func TestChannelPublisher_FullBuffer(t *testing.T) {
+	publisher := NewChannelPublisher(0)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	err := publisher.Publish(ctx, OutboxMessage{ID: "m1"})
+	if !IsErrorType(err, ErrorTypeTimeout) || !strings.Contains(err.Error(), "full") {
+		t.Errorf("Expected timeout on a full channel, got %v", err)
+	}
+}
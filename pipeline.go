@@ -0,0 +1,753 @@
+package gpa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// =====================================
+// Aggregation Pipelines
+// =====================================
+
+// Pipeline is a typed aggregation pipeline. It renders to MongoDB stages for
+// DocumentRepository.Aggregate and can be evaluated in memory with EvaluatePipeline.
+// Documents are addressed by their stored field names, e.g. json or bson tags.
+// Example:
+//
+//	p := gpa.NewPipeline().
+//	    Match(gpa.WhereCondition("status", gpa.OpEqual, "paid")).
+//	    Group("customer_id", gpa.Sum("total", "amount"), gpa.Count("orders")).
+//	    Sort("total", gpa.OrderDesc).
+//	    Limit(10)
+//	top, err := gpa.AggregateAs[CustomerTotal](ctx, orders, p)
+type Pipeline struct {
+	stages []pipelineStage
+}
+
+// pipelineStage is one stage; kind selects which of the other fields are set
+type pipelineStage struct {
+	kind         string
+	conditions   []Condition
+	groupKey     string
+	accumulators []Accumulator
+	include      []string
+	computed     []DocumentElement
+	orders       []Order
+	count        int
+	path         string
+	preserve     bool
+	from         string
+	localField   string
+	foreignField string
+	as           string
+	facets       map[string]*Pipeline
+	near         GeoNear
+}
+
+// Accumulator computes one output field of a Group stage
+type Accumulator struct {
+	// Name is the output field
+	Name string
+	// Op is the MongoDB accumulator, e.g. "$sum"
+	Op string
+	// Field is the input field; empty for Count
+	Field string
+}
+
+// Sum adds the values of field. Example: gpa.Sum("total", "amount")
+func Sum(name, field string) Accumulator { return Accumulator{Name: name, Op: "$sum", Field: field} }
+
+// Avg averages the numeric values of field
+func Avg(name, field string) Accumulator { return Accumulator{Name: name, Op: "$avg", Field: field} }
+
+// Min keeps the smallest value of field
+func Min(name, field string) Accumulator { return Accumulator{Name: name, Op: "$min", Field: field} }
+
+// Max keeps the largest value of field
+func Max(name, field string) Accumulator { return Accumulator{Name: name, Op: "$max", Field: field} }
+
+// First keeps the value of field in the first document of each group
+func First(name, field string) Accumulator {
+	return Accumulator{Name: name, Op: "$first", Field: field}
+}
+
+// Last keeps the value of field in the last document of each group
+func Last(name, field string) Accumulator { return Accumulator{Name: name, Op: "$last", Field: field} }
+
+// Push collects the values of field into an array
+func Push(name, field string) Accumulator { return Accumulator{Name: name, Op: "$push", Field: field} }
+
+// AddToSet collects the distinct values of field into an array
+func AddToSet(name, field string) Accumulator {
+	return Accumulator{Name: name, Op: "$addToSet", Field: field}
+}
+
+// Count counts the documents of each group
+func Count(name string) Accumulator { return Accumulator{Name: name, Op: "$sum"} }
+
+// DocumentElement is a key-value pair of an OrderedDocument
+type DocumentElement struct {
+	Key   string
+	Value interface{}
+}
+
+// OrderedDocument is a document whose key order matters, such as a $sort specification.
+// It has the same shape as bson.D, so providers can convert it directly.
+type OrderedDocument []DocumentElement
+
+// NewPipeline returns an empty pipeline
+func NewPipeline() *Pipeline {
+	return &Pipeline{}
+}
+
+func (p *Pipeline) add(stage pipelineStage) *Pipeline {
+	p.stages = append(p.stages, stage)
+	return p
+}
+
+// Match keeps documents satisfying every condition
+func (p *Pipeline) Match(conditions ...Condition) *Pipeline {
+	return p.add(pipelineStage{kind: "$match", conditions: conditions})
+}
+
+// Group groups documents by key, or all documents when key is empty. The key becomes
+// the _id of each output document, next to the accumulated fields.
+func (p *Pipeline) Group(key string, accumulators ...Accumulator) *Pipeline {
+	return p.add(pipelineStage{kind: "$group", groupKey: key, accumulators: accumulators})
+}
+
+// Project keeps only the given fields and _id. Dotted paths keep nested fields.
+func (p *Pipeline) Project(fields ...string) *Pipeline {
+	return p.add(pipelineStage{kind: "$project", include: fields})
+}
+
+// ProjectAs adds a projection of path under name. Consecutive Project and ProjectAs
+// calls are merged into one stage.
+// Example: p.Project("total").ProjectAs("city", "address.city")
+func (p *Pipeline) ProjectAs(name, path string) *Pipeline {
+	if n := len(p.stages); n > 0 && p.stages[n-1].kind == "$project" {
+		p.stages[n-1].computed = append(p.stages[n-1].computed, DocumentElement{Key: name, Value: path})
+		return p
+	}
+	return p.add(pipelineStage{kind: "$project", computed: []DocumentElement{{Key: name, Value: path}}})
+}
+
+// Sort orders documents by field. Consecutive Sort calls form one multi-key sort.
+func (p *Pipeline) Sort(field string, direction OrderDirection) *Pipeline {
+	order := Order{Field: field, Direction: direction}
+	if n := len(p.stages); n > 0 && p.stages[n-1].kind == "$sort" {
+		p.stages[n-1].orders = append(p.stages[n-1].orders, order)
+		return p
+	}
+	return p.add(pipelineStage{kind: "$sort", orders: []Order{order}})
+}
+
+// Limit keeps the first n documents
+func (p *Pipeline) Limit(n int) *Pipeline {
+	return p.add(pipelineStage{kind: "$limit", count: n})
+}
+
+// Skip drops the first n documents
+func (p *Pipeline) Skip(n int) *Pipeline {
+	return p.add(pipelineStage{kind: "$skip", count: n})
+}
+
+// Unwind outputs one document per element of the array at path. With preserveEmpty,
+// documents whose array is missing or empty are kept instead of dropped.
+func (p *Pipeline) Unwind(path string, preserveEmpty bool) *Pipeline {
+	return p.add(pipelineStage{kind: "$unwind", path: strings.TrimPrefix(path, "$"), preserve: preserveEmpty})
+}
+
+// Lookup adds to each document, under as, the documents of collection from whose
+// foreignField equals the document's localField.
+func (p *Pipeline) Lookup(from, localField, foreignField, as string) *Pipeline {
+	return p.add(pipelineStage{kind: "$lookup", from: from, localField: localField, foreignField: foreignField, as: as})
+}
+
+// Facet runs several sub-pipelines over the same documents and outputs a single
+// document with the results of each under its name.
+func (p *Pipeline) Facet(facets map[string]*Pipeline) *Pipeline {
+	return p.add(pipelineStage{kind: "$facet", facets: facets})
+}
+
+// GeoNear keeps the documents whose point at field lies within near.MaxDistance meters of
+// near.Point, nearest first, and stores the distance in distanceField. MongoDB requires
+// it to be the first stage.
+// Example: p := gpa.NewPipeline().GeoNear("location", gpa.GeoNear{Point: here, MaxDistance: 500}, "dist")
+func (p *Pipeline) GeoNear(field string, near GeoNear, distanceField string) *Pipeline {
+	return p.add(pipelineStage{kind: "$geoNear", path: field, near: near, as: distanceField})
+}
+
+// Stages renders the pipeline as MongoDB aggregation stages.
+// Sort stages are rendered as OrderedDocument to keep their key order.
+func (p *Pipeline) Stages() ([]map[string]interface{}, error) {
+	stages := make([]map[string]interface{}, 0, len(p.stages))
+	for _, stage := range p.stages {
+		var spec interface{}
+		switch stage.kind {
+		case "$match":
+			var condition Condition = CompositeCondition{Logic: LogicAnd, Conditions: stage.conditions}
+			if len(stage.conditions) == 1 {
+				condition = stage.conditions[0]
+			}
+			filter, err := ConditionDocument(condition)
+			if err != nil {
+				return nil, err
+			}
+			spec = filter
+		case "$group":
+			group := map[string]interface{}{"_id": nil}
+			if stage.groupKey != "" {
+				group["_id"] = "$" + stage.groupKey
+			}
+			for _, acc := range stage.accumulators {
+				var input interface{} = 1
+				if acc.Field != "" {
+					input = "$" + acc.Field
+				}
+				group[acc.Name] = map[string]interface{}{acc.Op: input}
+			}
+			spec = group
+		case "$project":
+			project := map[string]interface{}{}
+			for _, field := range stage.include {
+				project[field] = 1
+			}
+			for _, element := range stage.computed {
+				project[element.Key] = "$" + element.Value.(string)
+			}
+			spec = project
+		case "$sort":
+			sort := make(OrderedDocument, len(stage.orders))
+			for i, order := range stage.orders {
+				direction := 1
+				if strings.EqualFold(string(order.Direction), string(OrderDesc)) {
+					direction = -1
+				}
+				sort[i] = DocumentElement{Key: order.Field, Value: direction}
+			}
+			spec = sort
+		case "$limit", "$skip":
+			spec = stage.count
+		case "$unwind":
+			spec = map[string]interface{}{"path": "$" + stage.path, "preserveNullAndEmptyArrays": stage.preserve}
+		case "$lookup":
+			spec = map[string]interface{}{"from": stage.from, "localField": stage.localField, "foreignField": stage.foreignField, "as": stage.as}
+		case "$facet":
+			facets := map[string]interface{}{}
+			for name, sub := range stage.facets {
+				subStages, err := sub.Stages()
+				if err != nil {
+					return nil, err
+				}
+				facets[name] = subStages
+			}
+			spec = facets
+		case "$geoNear":
+			geoNear := map[string]interface{}{"near": stage.near.Point.GeoJSON(), "key": stage.path, "distanceField": stage.as, "spherical": true}
+			if stage.near.MaxDistance > 0 {
+				geoNear["maxDistance"] = stage.near.MaxDistance
+			}
+			if stage.near.MinDistance > 0 {
+				geoNear["minDistance"] = stage.near.MinDistance
+			}
+			spec = geoNear
+		}
+		stages = append(stages, map[string]interface{}{stage.kind: spec})
+	}
+	return stages, nil
+}
+
+// ConditionDocument translates a condition to a MongoDB query document.
+// LIKE patterns become anchored regular expressions; subquery and EXISTS conditions are not supported.
+// Example: filter, err := gpa.ConditionDocument(gpa.WhereCondition("age", gpa.OpGreaterThan, 18)) // {"age": {"$gt": 18}}
+func ConditionDocument(condition Condition) (map[string]interface{}, error) {
+	if composite, ok := condition.(CompositeCondition); ok {
+		parts := make([]interface{}, 0, len(composite.Conditions))
+		for _, c := range composite.Conditions {
+			part, err := ConditionDocument(c)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, part)
+		}
+		switch composite.Logic {
+		case LogicOr:
+			return map[string]interface{}{"$or": parts}, nil
+		case LogicNot:
+			return map[string]interface{}{"$nor": []interface{}{map[string]interface{}{"$and": parts}}}, nil
+		default:
+			if len(parts) == 0 {
+				return map[string]interface{}{}, nil
+			}
+			return map[string]interface{}{"$and": parts}, nil
+		}
+	}
+
+	field, value := condition.Field(), condition.Value()
+	operand := func(op string, v interface{}) (map[string]interface{}, error) {
+		return map[string]interface{}{field: map[string]interface{}{op: v}}, nil
+	}
+	switch condition.Operator() {
+	case OpEqual:
+		return map[string]interface{}{field: value}, nil
+	case OpNotEqual:
+		return operand("$ne", value)
+	case OpGreaterThan:
+		return operand("$gt", value)
+	case OpGreaterThanOrEqual:
+		return operand("$gte", value)
+	case OpLessThan:
+		return operand("$lt", value)
+	case OpLessThanOrEqual:
+		return operand("$lte", value)
+	case OpIn:
+		return operand("$in", value)
+	case OpNotIn:
+		return operand("$nin", value)
+	case OpIsNull:
+		return map[string]interface{}{field: nil}, nil
+	case OpIsNotNull:
+		return operand("$ne", nil)
+	case OpLike:
+		return operand("$regex", likePattern(fmt.Sprint(value)).String())
+	case OpNotLike:
+		return operand("$not", map[string]interface{}{"$regex": likePattern(fmt.Sprint(value)).String()})
+	case OpContains:
+		if s, ok := value.(string); ok {
+			return operand("$regex", regexp.QuoteMeta(s))
+		}
+		return map[string]interface{}{field: value}, nil
+	case OpStartsWith:
+		return operand("$regex", "^"+regexp.QuoteMeta(fmt.Sprint(value)))
+	case OpEndsWith:
+		return operand("$regex", regexp.QuoteMeta(fmt.Sprint(value))+"$")
+	case OpRegex:
+		return operand("$regex", fmt.Sprint(value))
+	case OpSearch:
+		return map[string]interface{}{"$text": map[string]interface{}{"$search": fmt.Sprint(value)}}, nil
+	case OpNear:
+		near, ok := value.(GeoNear)
+		if !ok {
+			return nil, NewError(ErrorTypeInvalidArgument, "near conditions expect a GeoNear value")
+		}
+		nearSphere := map[string]interface{}{"$geometry": near.Point.GeoJSON()}
+		if near.MaxDistance > 0 {
+			nearSphere["$maxDistance"] = near.MaxDistance
+		}
+		if near.MinDistance > 0 {
+			nearSphere["$minDistance"] = near.MinDistance
+		}
+		return operand("$nearSphere", nearSphere)
+	case OpWithin, OpIntersects:
+		shape, ok := value.(GeoShape)
+		if !ok {
+			return nil, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("%s conditions expect a GeoShape value", condition.Operator()))
+		}
+		if condition.Operator() == OpWithin {
+			return operand("$geoWithin", map[string]interface{}{"$geometry": shape.GeoJSON()})
+		}
+		return operand("$geoIntersects", map[string]interface{}{"$geometry": shape.GeoJSON()})
+	case OpBetween, OpNotBetween:
+		bounds := reflect.ValueOf(value)
+		if (bounds.Kind() != reflect.Slice && bounds.Kind() != reflect.Array) || bounds.Len() != 2 {
+			return nil, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("%s expects two bounds", condition.Operator()))
+		}
+		low, high := bounds.Index(0).Interface(), bounds.Index(1).Interface()
+		if condition.Operator() == OpBetween {
+			return map[string]interface{}{field: map[string]interface{}{"$gte": low, "$lte": high}}, nil
+		}
+		return map[string]interface{}{"$or": []interface{}{
+			map[string]interface{}{field: map[string]interface{}{"$lt": low}},
+			map[string]interface{}{field: map[string]interface{}{"$gt": high}},
+		}}, nil
+	}
+	return nil, NewError(ErrorTypeUnsupported, fmt.Sprintf("operator %s cannot be used in a document filter", condition.Operator()))
+}
+
+// =====================================
+// Running Pipelines
+// =====================================
+
+// PipelineRunner is implemented by repositories that evaluate pipelines themselves,
+// such as MemoryRepository
+type PipelineRunner interface {
+	RunPipeline(ctx context.Context, p *Pipeline) ([]map[string]interface{}, error)
+}
+
+// AggregateAs runs p on repo and decodes each output document into R using its json tags.
+// repo must implement PipelineRunner or DocumentRepository[T].
+// Example: totals, err := gpa.AggregateAs[CustomerTotal](ctx, orders, p)
+func AggregateAs[R any, T any](ctx context.Context, repo Repository[T], p *Pipeline) ([]R, error) {
+	var docs []map[string]interface{}
+	var err error
+	switch r := repo.(type) {
+	case PipelineRunner:
+		docs, err = r.RunPipeline(ctx, p)
+	case DocumentRepository[T]:
+		var stages []map[string]interface{}
+		if stages, err = p.Stages(); err == nil {
+			docs, err = r.Aggregate(ctx, stages)
+		}
+	default:
+		return nil, NewError(ErrorTypeUnsupported, "repository does not support aggregation pipelines").WithEntity(entityName[T]())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]R, len(docs))
+	for i, doc := range docs {
+		data, err := json.Marshal(doc)
+		if err == nil {
+			err = json.Unmarshal(data, &results[i])
+		}
+		if err != nil {
+			return nil, NewErrorWithCause(ErrorTypeSerialization, "cannot decode aggregation result", err)
+		}
+	}
+	return results, nil
+}
+
+// EvaluatePipeline runs p over docs in memory. lookup returns the documents of a
+// collection for Lookup stages and may be nil if the pipeline has none.
+func EvaluatePipeline(docs []map[string]interface{}, p *Pipeline, lookup func(collection string) ([]map[string]interface{}, error)) ([]map[string]interface{}, error) {
+	var err error
+	for _, stage := range p.stages {
+		switch stage.kind {
+		case "$match":
+			matched := docs[:0:0]
+			for _, doc := range docs {
+				ok, err := MatchConditions(doc, stage.conditions)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					matched = append(matched, doc)
+				}
+			}
+			docs = matched
+		case "$group":
+			docs, err = evaluateGroup(docs, stage)
+		case "$project":
+			docs = evaluateProject(docs, stage)
+		case "$sort":
+			ptrs := make([]*map[string]interface{}, len(docs))
+			for i := range docs {
+				ptrs[i] = &docs[i]
+			}
+			if err = sortEntities(ptrs, stage.orders, nil); err == nil {
+				sorted := make([]map[string]interface{}, len(ptrs))
+				for i, ptr := range ptrs {
+					sorted[i] = *ptr
+				}
+				docs = sorted
+			}
+		case "$limit":
+			docs = pageDocuments(docs, 0, stage.count)
+		case "$skip":
+			docs = pageDocuments(docs, stage.count, -1)
+		case "$unwind":
+			docs = evaluateUnwind(docs, stage)
+		case "$lookup":
+			if lookup == nil {
+				return nil, NewError(ErrorTypeUnsupported, "lookup stages need a collection source")
+			}
+			var foreign []map[string]interface{}
+			if foreign, err = lookup(stage.from); err == nil {
+				docs = evaluateLookup(docs, foreign, stage)
+			}
+		case "$facet":
+			result := make(map[string]interface{}, len(stage.facets))
+			for name, sub := range stage.facets {
+				out, err := EvaluatePipeline(append([]map[string]interface{}(nil), docs...), sub, lookup)
+				if err != nil {
+					return nil, err
+				}
+				result[name] = out
+			}
+			docs = []map[string]interface{}{result}
+		case "$geoNear":
+			docs, err = evaluateGeoNear(docs, stage)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+// fieldAt returns the value at a dotted path of doc, or nil
+func fieldAt(doc map[string]interface{}, path string) (interface{}, bool) {
+	value, ok := resolveFieldPath(reflect.ValueOf(doc), path)
+	if !ok || !value.IsValid() {
+		return nil, ok
+	}
+	return value.Interface(), true
+}
+
+// setFieldAt sets the value at a dotted path of doc, creating nested documents as needed
+func setFieldAt(doc map[string]interface{}, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := doc[part].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			doc[part] = next
+		}
+		doc = next
+	}
+	doc[parts[len(parts)-1]] = value
+}
+
+// evaluateGroup groups documents by the stage key, keeping groups in first-seen order
+func evaluateGroup(docs []map[string]interface{}, stage pipelineStage) ([]map[string]interface{}, error) {
+	type group struct {
+		doc    map[string]interface{}
+		counts map[string]int
+		seen   map[string]map[string]bool
+	}
+	var order []string
+	groups := map[string]*group{}
+
+	for _, doc := range docs {
+		var key interface{}
+		if stage.groupKey != "" {
+			key, _ = fieldAt(doc, stage.groupKey)
+		}
+		id := fmt.Sprintf("%T:%v", key, key)
+		g, ok := groups[id]
+		if !ok {
+			g = &group{doc: map[string]interface{}{"_id": key}, counts: map[string]int{}, seen: map[string]map[string]bool{}}
+			groups[id] = g
+			order = append(order, id)
+		}
+
+		for _, acc := range stage.accumulators {
+			var value interface{} = 1
+			found := true
+			if acc.Field != "" {
+				value, found = fieldAt(doc, acc.Field)
+			}
+			current, exists := g.doc[acc.Name]
+			switch acc.Op {
+			case "$sum", "$avg":
+				n, ok := numericValue(indirectValue(reflect.ValueOf(value)))
+				if !exists {
+					g.doc[acc.Name] = float64(0)
+				}
+				if ok {
+					g.doc[acc.Name] = g.doc[acc.Name].(float64) + n
+					g.counts[acc.Name]++
+				}
+			case "$min", "$max":
+				if !found || value == nil {
+					continue
+				}
+				if !exists {
+					g.doc[acc.Name] = value
+					continue
+				}
+				cmp, err := compareValues(reflect.ValueOf(value), reflect.ValueOf(current))
+				if err != nil {
+					return nil, err
+				}
+				if (acc.Op == "$min" && cmp < 0) || (acc.Op == "$max" && cmp > 0) {
+					g.doc[acc.Name] = value
+				}
+			case "$first":
+				if !exists {
+					g.doc[acc.Name] = value
+				}
+			case "$last":
+				g.doc[acc.Name] = value
+			case "$push", "$addToSet":
+				list, _ := current.([]interface{})
+				if acc.Op == "$addToSet" {
+					if g.seen[acc.Name] == nil {
+						g.seen[acc.Name] = map[string]bool{}
+					}
+					valueKey := fmt.Sprintf("%T:%v", value, value)
+					if g.seen[acc.Name][valueKey] {
+						g.doc[acc.Name] = list
+						continue
+					}
+					g.seen[acc.Name][valueKey] = true
+				}
+				g.doc[acc.Name] = append(list, value)
+			default:
+				return nil, NewError(ErrorTypeUnsupported, fmt.Sprintf("accumulator %s cannot be evaluated in memory", acc.Op))
+			}
+		}
+	}
+
+	results := make([]map[string]interface{}, 0, len(order))
+	for _, id := range order {
+		g := groups[id]
+		for _, acc := range stage.accumulators {
+			if acc.Op != "$avg" {
+				continue
+			}
+			if g.counts[acc.Name] == 0 {
+				g.doc[acc.Name] = nil
+			} else {
+				g.doc[acc.Name] = g.doc[acc.Name].(float64) / float64(g.counts[acc.Name])
+			}
+		}
+		results = append(results, g.doc)
+	}
+	return results, nil
+}
+
+// evaluateProject keeps _id and the projected fields of each document
+func evaluateProject(docs []map[string]interface{}, stage pipelineStage) []map[string]interface{} {
+	results := make([]map[string]interface{}, len(docs))
+	for i, doc := range docs {
+		projected := map[string]interface{}{}
+		if id, ok := doc["_id"]; ok {
+			projected["_id"] = id
+		}
+		for _, field := range stage.include {
+			if value, ok := fieldAt(doc, field); ok {
+				setFieldAt(projected, field, value)
+			}
+		}
+		for _, element := range stage.computed {
+			value, _ := fieldAt(doc, element.Value.(string))
+			projected[element.Key] = value
+		}
+		results[i] = projected
+	}
+	return results
+}
+
+// evaluateUnwind outputs one document per array element at the stage path
+func evaluateUnwind(docs []map[string]interface{}, stage pipelineStage) []map[string]interface{} {
+	var results []map[string]interface{}
+	for _, doc := range docs {
+		value, _ := fieldAt(doc, stage.path)
+		list := reflect.ValueOf(value)
+		if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+			if value != nil {
+				// MongoDB treats a non-array operand as a single element array
+				results = append(results, doc)
+			} else if stage.preserve {
+				results = append(results, doc)
+			}
+			continue
+		}
+		if list.Len() == 0 && stage.preserve {
+			unwound := copyDocument(doc)
+			setFieldAt(unwound, stage.path, nil)
+			results = append(results, unwound)
+		}
+		for i := 0; i < list.Len(); i++ {
+			unwound := copyDocument(doc)
+			setFieldAt(unwound, stage.path, list.Index(i).Interface())
+			results = append(results, unwound)
+		}
+	}
+	return results
+}
+
+// evaluateLookup joins foreign documents whose foreignField equals the local field
+func evaluateLookup(docs, foreign []map[string]interface{}, stage pipelineStage) []map[string]interface{} {
+	results := make([]map[string]interface{}, len(docs))
+	for i, doc := range docs {
+		local, _ := fieldAt(doc, stage.localField)
+		matches := []interface{}{}
+		for _, other := range foreign {
+			value, found := resolveFieldPath(reflect.ValueOf(other), stage.foreignField)
+			if found && valuesEqual(value, local) {
+				matches = append(matches, other)
+			}
+		}
+		joined := copyDocument(doc)
+		setFieldAt(joined, stage.as, matches)
+		results[i] = joined
+	}
+	return results
+}
+
+// copyDocument copies doc and its nested documents
+func copyDocument(doc map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(doc))
+	for key, value := range doc {
+		if nested, ok := value.(map[string]interface{}); ok {
+			value = copyDocument(nested)
+		}
+		copied[key] = value
+	}
+	return copied
+}
+
+// evaluateGeoNear filters docs by distance from the stage's point and sorts them nearest first
+func evaluateGeoNear(docs []map[string]interface{}, stage pipelineStage) ([]map[string]interface{}, error) {
+	type placed struct {
+		doc      map[string]interface{}
+		distance float64
+	}
+	var kept []placed
+	for _, doc := range docs {
+		value, ok := resolveFieldPath(reflect.ValueOf(doc), stage.path)
+		if !ok {
+			continue
+		}
+		shape, ok := toGeoShape(value)
+		if !ok {
+			continue
+		}
+		point, ok := shape.(Point)
+		if !ok {
+			return nil, NewError(ErrorTypeUnsupported, "geoNear stages can only be evaluated on points in memory")
+		}
+		distance := Distance(point, stage.near.Point)
+		if distance < stage.near.MinDistance || (stage.near.MaxDistance > 0 && distance > stage.near.MaxDistance) {
+			continue
+		}
+		out := copyDocument(doc)
+		if stage.as != "" {
+			setFieldAt(out, stage.as, distance)
+		}
+		kept = append(kept, placed{out, distance})
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].distance < kept[j].distance })
+
+	result := make([]map[string]interface{}, len(kept))
+	for i, p := range kept {
+		result[i] = p.doc
+	}
+	return result, nil
+}
+
+// pageDocuments skips offset documents and keeps at most limit; a negative limit keeps all
+func pageDocuments(docs []map[string]interface{}, offset, limit int) []map[string]interface{} {
+	if offset >= len(docs) {
+		return nil
+	}
+	if offset > 0 {
+		docs = docs[offset:]
+	}
+	if limit >= 0 && limit < len(docs) {
+		docs = docs[:limit]
+	}
+	return docs
+}
+
+// toDocument converts an entity to a document using its json encoding
+func toDocument(entity interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return nil, NewErrorWithCause(ErrorTypeSerialization, "cannot encode entity as a document", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, NewErrorWithCause(ErrorTypeSerialization, "cannot encode entity as a document", err)
+	}
+	return doc, nil
+}
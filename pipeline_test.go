@@ -0,0 +1,193 @@
+package gpa
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type pipelineOrder struct {
+	ID       int      `json:"id"`
+	Customer string   `json:"customer"`
+	Status   string   `json:"status"`
+	Amount   float64  `json:"amount"`
+	Tags     []string `json:"tags"`
+}
+
+type pipelineCustomer struct {
+	ID   string `json:"id"`
+	Tier string `json:"tier"`
+}
+
+type customerTotal struct {
+	Customer string  `json:"_id"`
+	Total    float64 `json:"total"`
+	Orders   int     `json:"orders"`
+}
+
+// aggregatingRepository records the stages passed to Aggregate
+type aggregatingRepository[T any] struct {
+	DocumentRepository[T]
+	stages []map[string]interface{}
+	result []map[string]interface{}
+}
+
+func (r *aggregatingRepository[T]) Aggregate(ctx context.Context, pipeline []map[string]interface{}) ([]map[string]interface{}, error) {
+	r.stages = pipeline
+	return r.result, nil
+}
+
+func seedPipelineOrders(t *testing.T, provider *MemoryProvider) *MemoryRepository[pipelineOrder] {
+	t.Helper()
+	repo := GetMemoryRepository[pipelineOrder](provider)
+	err := repo.CreateBatch(context.Background(), []*pipelineOrder{
+		{Customer: "ada", Status: "paid", Amount: 10, Tags: []string{"gift", "rush"}},
+		{Customer: "bob", Status: "paid", Amount: 25, Tags: []string{"rush"}},
+		{Customer: "ada", Status: "paid", Amount: 5},
+		{Customer: "cy", Status: "open", Amount: 100},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return repo
+}
+
+func TestPipeline_Stages(t *testing.T) {
+	stages, err := NewPipeline().
+		Match(WhereCondition("status", OpEqual, "paid"), WhereCondition("amount", OpGreaterThan, 5)).
+		Group("customer", Sum("total", "amount"), Count("orders")).
+		Sort("total", OrderDesc).Sort("_id", OrderAsc).
+		Unwind("$tags", true).
+		Limit(3).
+		Stages()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	match := map[string]interface{}{"$and": []interface{}{
+		map[string]interface{}{"status": "paid"},
+		map[string]interface{}{"amount": map[string]interface{}{"$gt": 5}},
+	}}
+	if !reflect.DeepEqual(stages[0]["$match"], match) {
+		t.Errorf("Unexpected match stage: %v", stages[0])
+	}
+	group := stages[1]["$group"].(map[string]interface{})
+	if group["_id"] != "$customer" || !reflect.DeepEqual(group["orders"], map[string]interface{}{"$sum": 1}) {
+		t.Errorf("Unexpected group stage: %v", group)
+	}
+	sort := stages[2]["$sort"].(OrderedDocument)
+	if len(sort) != 2 || sort[0] != (DocumentElement{Key: "total", Value: -1}) || sort[1].Key != "_id" {
+		t.Errorf("Expected ordered multi-key sort, got %v", sort)
+	}
+	if stages[3]["$unwind"].(map[string]interface{})["path"] != "$tags" || stages[4]["$limit"] != 3 {
+		t.Errorf("Unexpected trailing stages: %v", stages[3:])
+	}
+}
+
+func TestConditionDocument(t *testing.T) {
+	tests := []struct {
+		condition Condition
+		expected  map[string]interface{}
+	}{
+		{WhereCondition("age", OpGreaterThanOrEqual, 18), map[string]interface{}{"age": map[string]interface{}{"$gte": 18}}},
+		{WhereCondition("name", OpLike, "a%"), map[string]interface{}{"name": map[string]interface{}{"$regex": "(?s)^a.*$"}}},
+		{WhereCondition("email", OpIsNull, nil), map[string]interface{}{"email": nil}},
+		{WhereCondition("age", OpBetween, []int{1, 9}), map[string]interface{}{"age": map[string]interface{}{"$gte": 1, "$lte": 9}}},
+		{CompositeCondition{Logic: LogicOr, Conditions: []Condition{WhereCondition("a", OpEqual, 1)}},
+			map[string]interface{}{"$or": []interface{}{map[string]interface{}{"a": 1}}}},
+	}
+	for _, test := range tests {
+		doc, err := ConditionDocument(test.condition)
+		if err != nil || !reflect.DeepEqual(doc, test.expected) {
+			t.Errorf("%s: expected %v, got %v (%v)", test.condition, test.expected, doc, err)
+		}
+	}
+
+	if _, err := ConditionDocument(WhereCondition("x", OpExists, nil)); !IsErrorType(err, ErrorTypeUnsupported) {
+		t.Errorf("Expected unsupported operator error, got %v", err)
+	}
+}
+
+func TestAggregateAs_Memory(t *testing.T) {
+	repo := seedPipelineOrders(t, NewMemoryProvider())
+
+	totals, err := AggregateAs[customerTotal](context.Background(), repo, NewPipeline().
+		Match(WhereCondition("status", OpEqual, "paid")).
+		Group("customer", Sum("total", "amount"), Count("orders")).
+		Sort("total", OrderDesc))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []customerTotal{{"bob", 25, 1}, {"ada", 15, 2}}
+	if !reflect.DeepEqual(totals, expected) {
+		t.Errorf("Expected %v, got %v", expected, totals)
+	}
+}
+
+func TestEvaluatePipeline_Stages(t *testing.T) {
+	provider := NewMemoryProvider()
+	repo := seedPipelineOrders(t, provider)
+	customers := GetMemoryRepository[pipelineCustomer](provider)
+	customers.Create(context.Background(), &pipelineCustomer{ID: "ada", Tier: "gold"})
+	ctx := context.Background()
+
+	tags, err := repo.RunPipeline(ctx, NewPipeline().Unwind("tags", false).Group("tags", Count("n"), AddToSet("customers", "customer")).Sort("_id", OrderAsc))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tags) != 2 || tags[1]["_id"] != "rush" || tags[1]["n"] != float64(2) || len(tags[1]["customers"].([]interface{})) != 2 {
+		t.Errorf("Unexpected unwound tag counts: %v", tags)
+	}
+
+	joined, err := repo.RunPipeline(ctx, NewPipeline().
+		Match(WhereCondition("id", OpEqual, 1)).
+		Lookup("pipelineCustomer", "customer", "id", "profile").
+		Project("amount").ProjectAs("who", "customer"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(joined) != 1 || joined[0]["who"] != "ada" || joined[0]["status"] != nil {
+		t.Errorf("Unexpected projection: %v", joined)
+	}
+
+	withProfile, _ := repo.RunPipeline(ctx, NewPipeline().Limit(1).Lookup("pipelineCustomer", "customer", "id", "profile"))
+	profile := withProfile[0]["profile"].([]interface{})
+	if len(profile) != 1 || profile[0].(map[string]interface{})["tier"] != "gold" {
+		t.Errorf("Expected joined customer profile, got %v", withProfile[0]["profile"])
+	}
+
+	faceted, err := repo.RunPipeline(ctx, NewPipeline().Facet(map[string]*Pipeline{
+		"count": NewPipeline().Group("", Count("n"), Avg("avg", "amount"), Max("max", "amount")),
+		"page":  NewPipeline().Sort("amount", OrderAsc).Skip(1).Limit(2),
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	summary := faceted[0]["count"].([]map[string]interface{})[0]
+	if summary["n"] != float64(4) || summary["avg"] != float64(35) || summary["max"] != float64(100) {
+		t.Errorf("Unexpected facet summary: %v", summary)
+	}
+	if page := faceted[0]["page"].([]map[string]interface{}); len(page) != 2 || page[0]["amount"] != float64(10) {
+		t.Errorf("Unexpected facet page: %v", page)
+	}
+
+	if _, err := NewMemoryRepository[pipelineOrder]().RunPipeline(ctx, NewPipeline().Lookup("missing", "a", "b", "c")); !IsNotFound(err) {
+		t.Errorf("Expected unknown collection error, got %v", err)
+	}
+}
+
+func TestAggregateAs_DocumentRepository(t *testing.T) {
+	repo := &aggregatingRepository[pipelineOrder]{result: []map[string]interface{}{{"_id": "ada", "total": 15.0, "orders": 2}}}
+
+	totals, err := AggregateAs[customerTotal](context.Background(), repo, NewPipeline().Group("customer", Sum("total", "amount")))
+	if err != nil || len(totals) != 1 || totals[0].Total != 15 {
+		t.Fatalf("Expected decoded result, got %v (%v)", totals, err)
+	}
+	if len(repo.stages) != 1 || repo.stages[0]["$group"] == nil {
+		t.Errorf("Expected stages passed to Aggregate, got %v", repo.stages)
+	}
+
+	if _, err := AggregateAs[customerTotal](context.Background(), &mockRepository[pipelineOrder]{}, NewPipeline()); !IsErrorType(err, ErrorTypeUnsupported) {
+		t.Errorf("Expected unsupported error, got %v", err)
+	}
+}
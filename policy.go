@@ -0,0 +1,445 @@
+package gpa
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// =====================================
+// Subject Context
+// =====================================
+
+type subjectContextKey struct{}
+
+// WithSubject returns a context carrying the subject (user, service account, ...) that policies evaluate.
+// Example: ctx = gpa.WithSubject(ctx, currentUser)
+func WithSubject(ctx context.Context, subject interface{}) context.Context {
+	return context.WithValue(ctx, subjectContextKey{}, subject)
+}
+
+// SubjectFromContext returns the subject stored by WithSubject
+func SubjectFromContext(ctx context.Context) (interface{}, bool) {
+	subject := ctx.Value(subjectContextKey{})
+	return subject, subject != nil
+}
+
+// =====================================
+// Access Policies
+// =====================================
+
+// PolicyAction is the kind of write a policy is asked to allow
+type PolicyAction string
+
+const (
+	PolicyCreate PolicyAction = "create"
+	PolicyUpdate PolicyAction = "update"
+	PolicyDelete PolicyAction = "delete"
+)
+
+// Policy is a row-level access policy for entities of type T.
+// Policies are restrictive: every policy registered for T must allow an operation.
+type Policy[T any] struct {
+	// Name identifies the policy in errors
+	Name string
+
+	// Read returns the condition rows must satisfy to be visible to subject.
+	// A nil condition leaves reads unrestricted by this policy.
+	// Example: return gpa.CompositeCondition{Logic: gpa.LogicOr, Conditions: []gpa.Condition{
+	//     gpa.WhereCondition("author_id", gpa.OpEqual, subject.(*User).ID),
+	//     gpa.WhereCondition("published", gpa.OpEqual, true)}}, nil
+	Read func(ctx context.Context, subject interface{}) (Condition, error)
+
+	// Write returns nil if subject may perform action on entity, or an error to deny it.
+	// For updates it is called with both the stored and the updated entity.
+	// A nil Write leaves writes unrestricted by this policy.
+	Write func(ctx context.Context, subject interface{}, action PolicyAction, entity *T) error
+}
+
+var (
+	policyMutex sync.RWMutex
+	policies    = make(map[reflect.Type][]interface{})
+)
+
+// RegisterPolicy registers a policy for entities of type T.
+// Registering a policy with the name of an existing one replaces it.
+// Example: gpa.RegisterPolicy(gpa.Policy[Post]{Name: "posts", Read: readablePosts, Write: ownPosts})
+func RegisterPolicy[T any](policy Policy[T]) {
+	policyMutex.Lock()
+	defer policyMutex.Unlock()
+
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	for i, existing := range policies[t] {
+		if existing.(Policy[T]).Name == policy.Name {
+			policies[t][i] = policy
+			return
+		}
+	}
+	policies[t] = append(policies[t], policy)
+}
+
+// ClearPolicies removes all policies registered for entities of type T
+func ClearPolicies[T any]() {
+	policyMutex.Lock()
+	defer policyMutex.Unlock()
+	delete(policies, reflect.TypeOf((*T)(nil)).Elem())
+}
+
+// PoliciesFor returns the policies registered for entities of type T
+func PoliciesFor[T any]() []Policy[T] {
+	policyMutex.RLock()
+	defer policyMutex.RUnlock()
+
+	registered := policies[reflect.TypeOf((*T)(nil)).Elem()]
+	result := make([]Policy[T], len(registered))
+	for i, policy := range registered {
+		result[i] = policy.(Policy[T])
+	}
+	return result
+}
+
+// ReadConditions returns the conditions the subject in ctx must satisfy to read entities of type T.
+// Fails with a permission error if policies exist for T and ctx carries no subject.
+func ReadConditions[T any](ctx context.Context) ([]Condition, error) {
+	registered := PoliciesFor[T]()
+	if len(registered) == 0 {
+		return nil, nil
+	}
+	subject, ok := SubjectFromContext(ctx)
+	if !ok {
+		return nil, NewError(ErrorTypePermission, "no subject in context").WithEntity(entityName[T]())
+	}
+
+	var conditions []Condition
+	for _, policy := range registered {
+		if policy.Read == nil {
+			continue
+		}
+		condition, err := policy.Read(ctx, subject)
+		if err != nil {
+			return nil, policyDenied[T](policy.Name, err)
+		}
+		if condition != nil {
+			conditions = append(conditions, condition)
+		}
+	}
+	return conditions, nil
+}
+
+// CheckWrite reports whether the subject in ctx may perform action on entity.
+// Returns a permission error naming the denying policy.
+func CheckWrite[T any](ctx context.Context, action PolicyAction, entity *T) error {
+	registered := PoliciesFor[T]()
+	if len(registered) == 0 {
+		return nil
+	}
+	subject, ok := SubjectFromContext(ctx)
+	if !ok {
+		return NewError(ErrorTypePermission, "no subject in context").WithEntity(entityName[T]())
+	}
+	for _, policy := range registered {
+		if policy.Write == nil {
+			continue
+		}
+		if err := policy.Write(ctx, subject, action, entity); err != nil {
+			return policyDenied[T](policy.Name, err)
+		}
+	}
+	return nil
+}
+
+// policyDenied wraps a policy failure as a permission error, keeping permission errors returned by the policy
+func policyDenied[T any](name string, err error) error {
+	if IsErrorType(err, ErrorTypePermission) {
+		return err
+	}
+	message := "denied by policy"
+	if name != "" {
+		message = fmt.Sprintf("denied by policy %q", name)
+	}
+	return NewErrorWithCause(ErrorTypePermission, message, err).WithEntity(entityName[T]())
+}
+
+// =====================================
+// Policy Enforcing Repository
+// =====================================
+
+// policyRepository enforces the policies registered for T on every operation
+type policyRepository[T any] struct {
+	repo Repository[T]
+	info func() *EntityInfo
+}
+
+// NewPolicyRepository wraps repo so that every operation is checked against the policies
+// registered for T with RegisterPolicy. Reads get the policies' conditions; single-entity reads
+// and all writes check the affected rows and fail with ErrorTypePermission. Raw queries are
+// rejected while any policy is registered for T, since they cannot be scoped.
+// Example: repo = NewPolicyRepository(repo)
+func NewPolicyRepository[T any](repo Repository[T]) Repository[T] {
+	return &policyRepository[T]{
+		repo: repo,
+		info: sync.OnceValue(func() *EntityInfo {
+			info, err := repo.GetEntityInfo()
+			if err != nil {
+				return nil
+			}
+			return info
+		}),
+	}
+}
+
+// scope appends the read conditions to opts
+func (r *policyRepository[T]) scope(ctx context.Context, opts []QueryOption) ([]QueryOption, error) {
+	conditions, err := ReadConditions[T](ctx)
+	if err != nil {
+		return nil, err
+	}
+	scoped := make([]QueryOption, 0, len(opts)+len(conditions))
+	scoped = append(scoped, opts...)
+	for _, condition := range conditions {
+		scoped = append(scoped, ConditionOption{Condition: condition})
+	}
+	return scoped, nil
+}
+
+// readable checks entity against the read conditions
+func (r *policyRepository[T]) readable(ctx context.Context, entity *T) error {
+	conditions, err := ReadConditions[T](ctx)
+	if err != nil {
+		return err
+	}
+	ok, err := MatchConditions(entity, conditions)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return NewError(ErrorTypePermission, "entity is not readable").WithEntity(entityName[T]())
+	}
+	return nil
+}
+
+func (r *policyRepository[T]) Create(ctx context.Context, entity *T) error {
+	if err := CheckWrite(ctx, PolicyCreate, entity); err != nil {
+		return err
+	}
+	return r.repo.Create(ctx, entity)
+}
+
+func (r *policyRepository[T]) CreateBatch(ctx context.Context, entities []*T) error {
+	for _, entity := range entities {
+		if err := CheckWrite(ctx, PolicyCreate, entity); err != nil {
+			return err
+		}
+	}
+	return r.repo.CreateBatch(ctx, entities)
+}
+
+func (r *policyRepository[T]) FindByID(ctx context.Context, id interface{}) (*T, error) {
+	if _, err := ReadConditions[T](ctx); err != nil {
+		return nil, err
+	}
+	entity, err := r.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.readable(ctx, entity); err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+func (r *policyRepository[T]) FindAll(ctx context.Context, opts ...QueryOption) ([]*T, error) {
+	scoped, err := r.scope(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return r.repo.FindAll(ctx, scoped...)
+}
+
+// Update checks the stored entity and the updated entity
+func (r *policyRepository[T]) Update(ctx context.Context, entity *T) error {
+	if len(PoliciesFor[T]()) > 0 {
+		id, err := entityPrimaryKey(entity, r.info())
+		if err != nil {
+			return err
+		}
+		if err := r.checkStored(ctx, id, PolicyUpdate); err != nil {
+			return err
+		}
+		if err := CheckWrite(ctx, PolicyUpdate, entity); err != nil {
+			return err
+		}
+	}
+	return r.repo.Update(ctx, entity)
+}
+
+// UpdatePartial checks the stored entity and the entity with the updates applied
+func (r *policyRepository[T]) UpdatePartial(ctx context.Context, id interface{}, updates map[string]interface{}) error {
+	if len(PoliciesFor[T]()) > 0 {
+		stored, err := r.repo.FindByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := CheckWrite(ctx, PolicyUpdate, stored); err != nil {
+			return err
+		}
+		updated := *stored
+		applyUpdates(reflect.ValueOf(&updated).Elem(), updates)
+		if err := CheckWrite(ctx, PolicyUpdate, &updated); err != nil {
+			return err
+		}
+	}
+	return r.repo.UpdatePartial(ctx, id, updates)
+}
+
+func (r *policyRepository[T]) Delete(ctx context.Context, id interface{}) error {
+	if len(PoliciesFor[T]()) > 0 {
+		if err := r.checkStored(ctx, id, PolicyDelete); err != nil {
+			return err
+		}
+	}
+	return r.repo.Delete(ctx, id)
+}
+
+// DeleteByCondition checks every matching row before deleting, and scopes the delete to readable rows
+func (r *policyRepository[T]) DeleteByCondition(ctx context.Context, condition Condition) error {
+	conditions, err := ReadConditions[T](ctx)
+	if err != nil {
+		return err
+	}
+	if len(PoliciesFor[T]()) == 0 {
+		return r.repo.DeleteByCondition(ctx, condition)
+	}
+
+	scoped := CompositeCondition{Conditions: append([]Condition{condition}, conditions...), Logic: LogicAnd}
+	matches, err := r.repo.Query(ctx, ConditionOption{Condition: scoped})
+	if err != nil {
+		return err
+	}
+	for _, entity := range matches {
+		if err := CheckWrite(ctx, PolicyDelete, entity); err != nil {
+			return err
+		}
+	}
+	return r.repo.DeleteByCondition(ctx, scoped)
+}
+
+// checkStored loads the stored entity and checks action against it
+func (r *policyRepository[T]) checkStored(ctx context.Context, id interface{}, action PolicyAction) error {
+	stored, err := r.repo.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	return CheckWrite(ctx, action, stored)
+}
+
+func (r *policyRepository[T]) Query(ctx context.Context, opts ...QueryOption) ([]*T, error) {
+	scoped, err := r.scope(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return r.repo.Query(ctx, scoped...)
+}
+
+func (r *policyRepository[T]) QueryScored(ctx context.Context, opts ...QueryOption) ([]Scored[T], error) {
+	scoped, err := r.scope(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return QueryScored(ctx, r.repo, scoped...)
+}
+
+func (r *policyRepository[T]) QueryOne(ctx context.Context, opts ...QueryOption) (*T, error) {
+	scoped, err := r.scope(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return r.repo.QueryOne(ctx, scoped...)
+}
+
+func (r *policyRepository[T]) Count(ctx context.Context, opts ...QueryOption) (int64, error) {
+	scoped, err := r.scope(ctx, opts)
+	if err != nil {
+		return 0, err
+	}
+	return r.repo.Count(ctx, scoped...)
+}
+
+func (r *policyRepository[T]) Exists(ctx context.Context, opts ...QueryOption) (bool, error) {
+	scoped, err := r.scope(ctx, opts)
+	if err != nil {
+		return false, err
+	}
+	return r.repo.Exists(ctx, scoped...)
+}
+
+func (r *policyRepository[T]) Transaction(ctx context.Context, fn TransactionFunc[T]) error {
+	return r.repo.Transaction(ctx, func(tx Transaction[T]) error {
+		return fn(&policyTransaction[T]{
+			policyRepository: policyRepository[T]{repo: tx, info: r.info},
+			tx:               tx,
+		})
+	})
+}
+
+func (r *policyRepository[T]) RawQuery(ctx context.Context, query string, args []interface{}) ([]*T, error) {
+	if len(PoliciesFor[T]()) > 0 {
+		return nil, NewError(ErrorTypePermission, "raw queries bypass access policies").WithEntity(entityName[T]())
+	}
+	return r.repo.RawQuery(ctx, query, args)
+}
+
+func (r *policyRepository[T]) RawExec(ctx context.Context, query string, args []interface{}) (Result, error) {
+	if len(PoliciesFor[T]()) > 0 {
+		return nil, NewError(ErrorTypePermission, "raw queries bypass access policies").WithEntity(entityName[T]())
+	}
+	return r.repo.RawExec(ctx, query, args)
+}
+
+func (r *policyRepository[T]) GetEntityInfo() (*EntityInfo, error) {
+	return r.repo.GetEntityInfo()
+}
+
+func (r *policyRepository[T]) Close() error {
+	return r.repo.Close()
+}
+
+// policyTransaction enforces policies on operations executed inside a transaction
+type policyTransaction[T any] struct {
+	policyRepository[T]
+	tx Transaction[T]
+}
+
+func (t *policyTransaction[T]) Commit() error                  { return t.tx.Commit() }
+func (t *policyTransaction[T]) Rollback() error                { return t.tx.Rollback() }
+func (t *policyTransaction[T]) SetSavepoint(name string) error { return t.tx.SetSavepoint(name) }
+func (t *policyTransaction[T]) RollbackToSavepoint(name string) error {
+	return t.tx.RollbackToSavepoint(name)
+}
+
+// applyUpdates sets the fields named in updates on a struct value, as UpdatePartial would.
+// Unknown fields and values that cannot be converted to the field type are skipped.
+func applyUpdates(value reflect.Value, updates map[string]interface{}) {
+	for name, update := range updates {
+		field, _, ok := lookupStructField(value, name)
+		if !ok || !field.CanSet() {
+			continue
+		}
+		if update == nil {
+			field.Set(reflect.Zero(field.Type()))
+			continue
+		}
+		updateValue := reflect.ValueOf(update)
+		switch {
+		case updateValue.Type().AssignableTo(field.Type()):
+			field.Set(updateValue)
+		case updateValue.Type().ConvertibleTo(field.Type()) && sameKindFamily(updateValue.Kind(), field.Kind()):
+			field.Set(updateValue.Convert(field.Type()))
+		case field.Kind() == reflect.Ptr && updateValue.Type().AssignableTo(field.Type().Elem()):
+			ptr := reflect.New(field.Type().Elem())
+			ptr.Elem().Set(updateValue)
+			field.Set(ptr)
+		}
+	}
+}
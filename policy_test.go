@@ -0,0 +1,166 @@
+package gpa
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type policyPost struct {
+	ID        int    `json:"id"`
+	AuthorID  int    `json:"author_id"`
+	Published bool   `json:"published"`
+	Title     string `json:"title"`
+}
+
+type policyUser struct {
+	ID    int
+	Admin bool
+}
+
+func registerPostPolicy() {
+	RegisterPolicy(Policy[policyPost]{
+		Name: "posts",
+		Read: func(ctx context.Context, subject interface{}) (Condition, error) {
+			user := subject.(*policyUser)
+			if user.Admin {
+				return nil, nil
+			}
+			return CompositeCondition{Logic: LogicOr, Conditions: []Condition{
+				WhereCondition("author_id", OpEqual, user.ID),
+				WhereCondition("published", OpEqual, true),
+			}}, nil
+		},
+		Write: func(ctx context.Context, subject interface{}, action PolicyAction, post *policyPost) error {
+			user := subject.(*policyUser)
+			if user.Admin || post.AuthorID == user.ID {
+				return nil
+			}
+			return errors.New("only the author may modify a post")
+		},
+	})
+}
+
+func TestPolicyRepository_ReadConditions(t *testing.T) {
+	registerPostPolicy()
+	defer ClearPolicies[policyPost]()
+
+	mock := &mockRepository[policyPost]{}
+	repo := NewPolicyRepository[policyPost](mock)
+	ctx := WithSubject(context.Background(), &policyUser{ID: 1})
+
+	if _, err := repo.Query(ctx, Where("title", OpLike, "Go%")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(mock.lastOpts) != 2 {
+		t.Fatalf("Expected policy condition to be appended, got %d options", len(mock.lastOpts))
+	}
+
+	admin := WithSubject(context.Background(), &policyUser{ID: 2, Admin: true})
+	repo.Count(admin)
+	if len(mock.lastOpts) != 0 {
+		t.Errorf("Expected nil condition to leave reads unrestricted, got %d options", len(mock.lastOpts))
+	}
+
+	if _, err := repo.FindAll(context.Background()); !IsErrorType(err, ErrorTypePermission) {
+		t.Errorf("Expected permission error without subject, got %v", err)
+	}
+}
+
+func TestPolicyRepository_FindByID(t *testing.T) {
+	registerPostPolicy()
+	defer ClearPolicies[policyPost]()
+
+	mock := &mockRepository[policyPost]{items: []*policyPost{{ID: 1, AuthorID: 9, Published: false}}}
+	repo := NewPolicyRepository[policyPost](mock)
+
+	if _, err := repo.FindByID(WithSubject(context.Background(), &policyUser{ID: 1}), 1); !IsErrorType(err, ErrorTypePermission) {
+		t.Errorf("Expected unpublished post of another author to be denied, got %v", err)
+	}
+	if _, err := repo.FindByID(WithSubject(context.Background(), &policyUser{ID: 9}), 1); err != nil {
+		t.Errorf("Expected author to read own post, got %v", err)
+	}
+
+	mock.items[0].Published = true
+	if _, err := repo.FindByID(WithSubject(context.Background(), &policyUser{ID: 1}), 1); err != nil {
+		t.Errorf("Expected published post to be readable, got %v", err)
+	}
+}
+
+func TestPolicyRepository_Writes(t *testing.T) {
+	registerPostPolicy()
+	defer ClearPolicies[policyPost]()
+
+	mock := &mockRepository[policyPost]{items: []*policyPost{{ID: 1, AuthorID: 9, Published: true}}}
+	repo := NewPolicyRepository[policyPost](mock)
+	other := WithSubject(context.Background(), &policyUser{ID: 1})
+	author := WithSubject(context.Background(), &policyUser{ID: 9})
+
+	err := repo.Create(other, &policyPost{AuthorID: 9})
+	if !IsErrorType(err, ErrorTypePermission) {
+		t.Errorf("Expected create on behalf of another author to be denied, got %v", err)
+	}
+	var gpaErr GPAError
+	if errors.As(err, &gpaErr) && gpaErr.Message != `denied by policy "posts"` {
+		t.Errorf("Expected policy name in message, got %q", gpaErr.Message)
+	}
+
+	if err := repo.Update(other, &policyPost{ID: 1, AuthorID: 1}); !IsErrorType(err, ErrorTypePermission) {
+		t.Errorf("Expected update of another author's post to be denied, got %v", err)
+	}
+	if err := repo.UpdatePartial(author, 1, map[string]interface{}{"author_id": 1}); !IsErrorType(err, ErrorTypePermission) {
+		t.Errorf("Expected handing a post to another author to be denied, got %v", err)
+	}
+	if err := repo.Delete(other, 1); !IsErrorType(err, ErrorTypePermission) {
+		t.Errorf("Expected delete of another author's post to be denied, got %v", err)
+	}
+	if err := repo.DeleteByCondition(other, WhereCondition("published", OpEqual, true)); !IsErrorType(err, ErrorTypePermission) {
+		t.Errorf("Expected bulk delete including another author's post to be denied, got %v", err)
+	}
+	if mock.callCount("Create")+mock.callCount("Update")+mock.callCount("UpdatePartial")+mock.callCount("Delete")+mock.callCount("DeleteByCondition") != 0 {
+		t.Error("Expected denied writes not to reach the provider")
+	}
+
+	if err := repo.UpdatePartial(author, 1, map[string]interface{}{"title": "New"}); err != nil {
+		t.Errorf("Expected author to update own post, got %v", err)
+	}
+	if err := repo.Delete(author, 1); err != nil {
+		t.Errorf("Expected author to delete own post, got %v", err)
+	}
+}
+
+func TestPolicyRepository_RawQueriesAndTransactions(t *testing.T) {
+	mock := &mockRepository[policyPost]{}
+	repo := NewPolicyRepository[policyPost](mock)
+	ctx := WithSubject(context.Background(), &policyUser{ID: 1})
+
+	if _, err := repo.RawQuery(ctx, "SELECT 1", nil); err != nil {
+		t.Errorf("Expected raw queries without policies to pass, got %v", err)
+	}
+
+	registerPostPolicy()
+	defer ClearPolicies[policyPost]()
+
+	if _, err := repo.RawExec(ctx, "DELETE FROM posts", nil); !IsErrorType(err, ErrorTypePermission) {
+		t.Errorf("Expected raw exec to be rejected, got %v", err)
+	}
+
+	err := repo.Transaction(ctx, func(tx Transaction[policyPost]) error {
+		return tx.Create(ctx, &policyPost{AuthorID: 2})
+	})
+	if !IsErrorType(err, ErrorTypePermission) {
+		t.Errorf("Expected policy enforced inside transaction, got %v", err)
+	}
+}
+
+func TestRegisterPolicy_ReplacesByName(t *testing.T) {
+	defer ClearPolicies[policyPost]()
+
+	RegisterPolicy(Policy[policyPost]{Name: "a"})
+	RegisterPolicy(Policy[policyPost]{Name: "b"})
+	RegisterPolicy(Policy[policyPost]{Name: "a"})
+
+	if len(PoliciesFor[policyPost]()) != 2 {
+		t.Errorf("Expected 2 policies, got %d", len(PoliciesFor[policyPost]()))
+	}
+}
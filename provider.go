@@ -105,7 +105,8 @@ type KeyValueProvider interface {
 	// Exists checks if a key exists
 	Exists(ctx context.Context, key string) (bool, error)
 
-	// Keys returns all keys matching a pattern
+	// Keys returns all keys matching a pattern.
+	// Redis implements this with KEYS, which blocks the server; prefer ScanKeys.
 	Keys(ctx context.Context, pattern string) ([]string, error)
 
 	// Expire sets TTL for a key
@@ -115,6 +116,78 @@ type KeyValueProvider interface {
 	TTL(ctx context.Context, key string) (time.Duration, error)
 }
 
+// BatchKeyValueProvider extends KeyValueProvider with fetching many keys in one round
+// trip, like Redis MGET
+type BatchKeyValueProvider interface {
+	KeyValueProvider
+
+	// MGet returns the values of keys as Get would; missing keys are omitted
+	MGet(ctx context.Context, keys []string) (map[string]interface{}, error)
+}
+
+// AtomicKeyValueProvider extends KeyValueProvider with conditional single-key operations.
+// Redis implements these with SET NX and short Lua scripts; they are what distributed
+// locks and counters are built on.
+type AtomicKeyValueProvider interface {
+	KeyValueProvider
+
+	// SetIfAbsent stores value only if key does not exist, reporting whether it did so
+	SetIfAbsent(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error)
+
+	// CompareAndDelete deletes key only if its value equals expected
+	CompareAndDelete(ctx context.Context, key string, expected interface{}) (bool, error)
+
+	// CompareAndExpire sets the TTL of key only if its value equals expected
+	CompareAndExpire(ctx context.Context, key string, expected interface{}, ttl time.Duration) (bool, error)
+
+	// Increment adds delta to the integer at key, creating it at 0, and returns the result
+	Increment(ctx context.Context, key string, delta int64) (int64, error)
+
+	// CompareAndSwap stores value only if the value of key equals expected, or if key
+	// does not exist when expected is nil
+	CompareAndSwap(ctx context.Context, key string, expected, value interface{}, ttl time.Duration) (bool, error)
+
+	// GetAndSet stores value and returns the previous value, nil if key did not exist
+	GetAndSet(ctx context.Context, key string, value interface{}, ttl time.Duration) (interface{}, error)
+}
+
+// TransactionalKeyValueProvider extends AtomicKeyValueProvider with optimistic
+// multi-key transactions, as Redis WATCH/MULTI/EXEC.
+type TransactionalKeyValueProvider interface {
+	AtomicKeyValueProvider
+
+	// Watch watches keys and runs fn, then applies the writes fn queued on tx
+	// atomically if none of the keys changed meanwhile. On conflict nothing is
+	// written and a retryable ErrorTypeTransaction error is returned.
+	Watch(ctx context.Context, fn func(tx KVTx) error, keys ...string) error
+}
+
+// PubSubProvider extends Provider with publish/subscribe messaging.
+// Implemented by Redis pub/sub, Postgres LISTEN/NOTIFY and the in-memory provider.
+// Delivery is at-most-once: messages published while nobody is subscribed, or that a
+// slow subscriber has no room for, are dropped and never redelivered.
+type PubSubProvider interface {
+	Provider
+
+	// Publish sends payload to the subscribers of channel and returns how many received it
+	Publish(ctx context.Context, channel string, payload []byte) (int64, error)
+
+	// Subscribe returns the messages of channels matching any of patterns (glob-style,
+	// as in Redis PSUBSCRIBE). The subscription is active when Subscribe returns and
+	// ends, closing the channel, when ctx is done.
+	Subscribe(ctx context.Context, patterns ...string) (<-chan Message, error)
+}
+
+// ScriptingKeyValueProvider extends KeyValueProvider with atomic server-side scripts.
+// Redis implements it with EVALSHA, falling back to EVAL.
+type ScriptingKeyValueProvider interface {
+	KeyValueProvider
+
+	// Eval runs a Lua script with keys and args and returns its reply, with integers
+	// as int64 and arrays as []interface{}
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
 // DocumentProvider extends Provider with document database functionality
 // Implemented by providers like MongoDB, CouchDB, etc.
 type DocumentProvider interface {
@@ -138,7 +211,8 @@ type DocumentProvider interface {
 	// Aggregate runs an aggregation pipeline
 	Aggregate(ctx context.Context, collection string, pipeline interface{}) (interface{}, error)
 
-	// Watch starts a change stream
+	// Watch starts a change stream. pipeline may be a *DocumentChangeRequest, and the
+	// stream should implement DocumentChangeCursor; see NewDocumentChangeRepository.
 	Watch(ctx context.Context, collection string, pipeline interface{}) (interface{}, error)
 }
 
@@ -247,6 +321,33 @@ func AsKeyValueProvider(provider Provider) (KeyValueProvider, bool) {
 	return nil, false
 }
 
+// AsAtomicKeyValueProvider safely casts a Provider to AtomicKeyValueProvider
+// Returns the AtomicKeyValueProvider instance and true if successful, nil and false otherwise
+func AsAtomicKeyValueProvider(provider Provider) (AtomicKeyValueProvider, bool) {
+	if kvProvider, ok := provider.(AtomicKeyValueProvider); ok {
+		return kvProvider, true
+	}
+	return nil, false
+}
+
+// AsTransactionalKeyValueProvider safely casts a Provider to TransactionalKeyValueProvider
+// Returns the TransactionalKeyValueProvider instance and true if successful, nil and false otherwise
+func AsTransactionalKeyValueProvider(provider Provider) (TransactionalKeyValueProvider, bool) {
+	if kvProvider, ok := provider.(TransactionalKeyValueProvider); ok {
+		return kvProvider, true
+	}
+	return nil, false
+}
+
+// AsPubSubProvider safely casts a Provider to PubSubProvider
+// Returns the PubSubProvider instance and true if successful, nil and false otherwise
+func AsPubSubProvider(provider Provider) (PubSubProvider, bool) {
+	if psProvider, ok := provider.(PubSubProvider); ok {
+		return psProvider, true
+	}
+	return nil, false
+}
+
 // AsDocumentProvider safely casts a Provider to DocumentProvider
 // Returns the DocumentProvider instance and true if successful, nil and false otherwise
 func AsDocumentProvider(provider Provider) (DocumentProvider, bool) {
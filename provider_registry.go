@@ -20,6 +20,7 @@ var (
 type ProviderRegistry struct {
 	mutex     sync.RWMutex
 	providers map[string]map[string]Provider // [providerType][instanceName]Provider
+	guards    map[string]map[string]*ProviderGuard
 }
 
 // Registry returns the singleton instance of ProviderRegistry
@@ -55,7 +56,8 @@ func (r *ProviderRegistry) RegisterDefault(provider Provider) {
 	r.Register("default", provider)
 }
 
-// Get retrieves a provider by type and instance name
+// Get retrieves a provider by type and instance name. Instances protected with
+// Protect are returned wrapped by GuardProvider.
 func (r *ProviderRegistry) Get(providerType string, instanceName ...string) (Provider, error) {
 	name := "default"
 	if len(instanceName) > 0 {
@@ -74,6 +76,9 @@ func (r *ProviderRegistry) Get(providerType string, instanceName ...string) (Pro
 	if !exists {
 		return nil, fmt.Errorf("%w: instance '%s' of type '%s' not found", ErrProviderNotFound, name, providerType)
 	}
+	if guard, guarded := r.guards[providerType][name]; guarded {
+		return GuardProvider(provider, guard), nil
+	}
 	
 	return provider, nil
 }
@@ -87,7 +92,8 @@ func (r *ProviderRegistry) MustGet(providerType string, instanceName ...string)
 	return provider
 }
 
-// GetByType returns all providers of a specific type
+// GetByType returns all providers of a specific type, with protected instances
+// wrapped by GuardProvider
 func (r *ProviderRegistry) GetByType(providerType string) (map[string]Provider, error) {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
@@ -100,6 +106,9 @@ func (r *ProviderRegistry) GetByType(providerType string) (map[string]Provider,
 	// Return a copy to prevent external modification
 	result := make(map[string]Provider)
 	for name, provider := range typeProviders {
+		if guard, guarded := r.guards[providerType][name]; guarded {
+			provider = GuardProvider(provider, guard)
+		}
 		result[name] = provider
 	}
 	return result, nil
@@ -154,6 +163,7 @@ func (r *ProviderRegistry) Remove(providerType, instanceName string) error {
 	}
 	
 	delete(typeProviders, instanceName)
+	delete(r.guards[providerType], instanceName)
 	
 	// Clean up empty provider type maps
 	if len(typeProviders) == 0 {
@@ -177,10 +187,13 @@ func (r *ProviderRegistry) RemoveAll() error {
 	}
 	
 	r.providers = make(map[string]map[string]Provider)
+	r.guards = nil
 	return nil
 }
 
-// HealthCheck checks the health of all registered providers
+// HealthCheck checks the health of all registered providers.
+// Instances protected with Protect are checked through their circuit breaker,
+// so an open circuit is reported without contacting the provider.
 func (r *ProviderRegistry) HealthCheck() map[string]map[string]error {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
@@ -189,6 +202,10 @@ func (r *ProviderRegistry) HealthCheck() map[string]map[string]error {
 	for providerType, typeProviders := range r.providers {
 		results[providerType] = make(map[string]error)
 		for instanceName, provider := range typeProviders {
+			if guard, guarded := r.guards[providerType][instanceName]; guarded {
+				results[providerType][instanceName] = guard.CheckHealth(provider)
+				continue
+			}
 			results[providerType][instanceName] = provider.Health()
 		}
 	}
@@ -246,8 +263,12 @@ func Get[T Provider](instanceName ...string) (T, error) {
 		return zero, err
 	}
 	
-	// Type assertion to ensure we get the correct type
+	// Type assertion to ensure we get the correct type; a concrete T cannot hold a
+	// guarded provider, so it gets the provider the guard wraps
 	typedProvider, ok := provider.(T)
+	if !ok {
+		typedProvider, ok = UnwrapProvider(provider).(T)
+	}
 	if !ok {
 		return zero, fmt.Errorf("provider is not of expected type %T, got %T", zero, provider)
 	}
@@ -286,6 +307,9 @@ func GetByType[T Provider]() (map[string]T, error) {
 	result := make(map[string]T)
 	for name, provider := range providers {
 		typedProvider, ok := provider.(T)
+		if !ok {
+			typedProvider, ok = UnwrapProvider(provider).(T)
+		}
 		if !ok {
 			return nil, fmt.Errorf("provider %s is not of expected type %T, got %T", name, (*T)(nil), provider)
 		}
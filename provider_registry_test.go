@@ -520,6 +520,15 @@ func TestGenericFunctions(t *testing.T) {
 		t.Errorf("Expected 3 providers, got %d", len(allProviders))
 	}
 
+	// Test concrete types of protected instances
+	Registry().Protect("test", "primary", DefaultGuardConfig())
+	if result, err := Get[*mockProvider]("primary"); err != nil || result != gormProvider {
+		t.Errorf("Expected the protected provider itself for a concrete type, got %v (%v)", result, err)
+	}
+	if allProviders, err := GetByType[*mockProvider](); err != nil || allProviders["primary"] != gormProvider {
+		t.Errorf("Expected the protected provider itself for a concrete type, got %v (%v)", allProviders, err)
+	}
+
 	// Test panic on non-existent provider instance
 	defer func() {
 		if r := recover(); r == nil {
@@ -0,0 +1,103 @@
+package gpa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"path"
+	"strings"
+)
+
+// =====================================
+// Pub/Sub Messages
+// =====================================
+
+// Message is a message received from a PubSubProvider
+type Message struct {
+	// Channel is the channel the message was published to
+	Channel string
+
+	// Pattern is the subscription pattern that matched Channel, empty for exact channels
+	Pattern string
+
+	// Payload is the published data
+	Payload []byte
+}
+
+// TypedMessage is a Message decoded into a T by Subscribe
+type TypedMessage[T any] struct {
+	Channel string
+	Pattern string
+	Value   *T
+}
+
+// IsChannelPattern reports whether pattern contains glob characters.
+// Providers without pattern subscriptions, like Postgres LISTEN, reject such patterns.
+func IsChannelPattern(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// matchChannel returns the first of patterns matching channel
+func matchChannel(patterns []string, channel string) (string, bool) {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, channel); matched {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// =====================================
+// Typed Publish and Subscribe
+// =====================================
+
+// Publish encodes value as JSON and publishes it to channel, returning how many
+// subscribers received it. Plain JSON keeps payloads readable by other languages
+// and valid as NOTIFY text.
+// Example: n, err := gpa.Publish(ctx, ps, "orders.created", &order)
+func Publish[T any](ctx context.Context, ps PubSubProvider, channel string, value *T) (int64, error) {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return 0, NewErrorWithCause(ErrorTypeSerialization, fmt.Sprintf("cannot encode message for %q", channel), err).WithEntity(entityName[T]())
+	}
+	return ps.Publish(ctx, channel, payload)
+}
+
+// Subscribe subscribes to patterns and decodes messages into T. The subscription is
+// active when Subscribe returns and ends when ctx is done or the loop stops.
+// Payloads that cannot be decoded are yielded as ErrorTypeSerialization errors.
+// Delivery is at-most-once, see PubSubProvider.
+// Example:
+//
+//	messages, err := gpa.Subscribe[Order](ctx, ps, "orders.*")
+//	for msg, err := range messages {
+//	    if err != nil { log.Print(err); continue }
+//	    handle(msg.Channel, msg.Value)
+//	}
+func Subscribe[T any](ctx context.Context, ps PubSubProvider, patterns ...string) (iter.Seq2[TypedMessage[T], error], error) {
+	ctx, cancel := context.WithCancel(ctx)
+	messages, err := ps.Subscribe(ctx, patterns...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return func(yield func(TypedMessage[T], error) bool) {
+		defer cancel()
+		for msg := range messages {
+			typed := TypedMessage[T]{Channel: msg.Channel, Pattern: msg.Pattern}
+			var value T
+			if err := DecodeValue(msg.Payload, &value); err != nil {
+				if !yield(typed, err) {
+					return
+				}
+				continue
+			}
+			typed.Value = &value
+			if !yield(typed, nil) {
+				return
+			}
+		}
+	}, nil
+}
@@ -0,0 +1,117 @@
+package gpa
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type orderEvent struct {
+	ID    int
+	Total float64
+}
+
+func TestMemoryProvider_PubSub(t *testing.T) {
+	provider := NewMemoryProvider()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	exact, err := provider.Subscribe(ctx, "orders.created")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	wildcard, _ := provider.Subscribe(ctx, "orders.*")
+
+	if n, _ := provider.Publish(ctx, "orders.created", []byte("1")); n != 2 {
+		t.Errorf("Expected 2 receivers, got %d", n)
+	}
+	if n, _ := provider.Publish(ctx, "users.created", []byte("2")); n != 0 {
+		t.Errorf("Expected no receivers, got %d", n)
+	}
+
+	if msg := <-exact; msg.Channel != "orders.created" || msg.Pattern != "" || string(msg.Payload) != "1" {
+		t.Errorf("Unexpected exact message %+v", msg)
+	}
+	if msg := <-wildcard; msg.Pattern != "orders.*" {
+		t.Errorf("Expected matching pattern, got %+v", msg)
+	}
+
+	// Both subscriptions are removed before their channels close
+	cancel()
+	for _, messages := range []<-chan Message{exact, wildcard} {
+		select {
+		case _, open := <-messages:
+			if open {
+				t.Error("Expected no further messages")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected the subscription to end when its context was canceled")
+		}
+	}
+	if n, _ := provider.Publish(context.Background(), "orders.created", nil); n != 0 {
+		t.Errorf("Expected no receivers after unsubscribe, got %d", n)
+	}
+
+	if _, err := provider.Subscribe(context.Background(), "orders.["); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected invalid pattern error, got %v", err)
+	}
+	if _, ok := AsPubSubProvider(provider); !ok {
+		t.Error("Expected memory provider to implement PubSubProvider")
+	}
+}
+
+func TestMemoryProvider_PubSubAtMostOnce(t *testing.T) {
+	provider := NewMemoryProvider()
+	messages, _ := provider.Subscribe(context.Background(), "events")
+
+	for i := 0; i < memorySubscriberBuffer+10; i++ {
+		provider.Publish(context.Background(), "events", []byte("x"))
+	}
+	if len(messages) != memorySubscriberBuffer {
+		t.Errorf("Expected a full buffer of %d, got %d", memorySubscriberBuffer, len(messages))
+	}
+
+	provider.Close()
+	for range messages {
+	}
+	if _, err := provider.Subscribe(context.Background(), "events"); !IsErrorType(err, ErrorTypeConnection) {
+		t.Errorf("Expected connection error after close, got %v", err)
+	}
+}
+
+func TestTypedPubSub(t *testing.T) {
+	provider := NewMemoryProvider()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	messages, err := Subscribe[orderEvent](ctx, provider, "orders.*")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	provider.Publish(ctx, "orders.broken", []byte("not json"))
+	Publish(ctx, provider, "orders.paid", &orderEvent{ID: 7, Total: 9.5})
+
+	var received []TypedMessage[orderEvent]
+	var decodeErrs []error
+	for msg, err := range messages {
+		if err != nil {
+			decodeErrs = append(decodeErrs, err)
+			continue
+		}
+		received = append(received, msg)
+		break
+	}
+	if len(decodeErrs) != 1 || !IsErrorType(decodeErrs[0], ErrorTypeSerialization) {
+		t.Errorf("Expected one serialization error, got %v", decodeErrs)
+	}
+	if len(received) != 1 || received[0].Channel != "orders.paid" || received[0].Value.ID != 7 {
+		t.Errorf("Unexpected messages %+v", received)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for n, _ := provider.Publish(ctx, "orders.paid", nil); n != 0; n, _ = provider.Publish(ctx, "orders.paid", nil) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected breaking the loop to unsubscribe")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
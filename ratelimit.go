@@ -0,0 +1,417 @@
+package gpa
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// =====================================
+// Rate Limiting
+// =====================================
+
+// RateLimitAlgorithm selects how a RateLimiter counts requests
+type RateLimitAlgorithm string
+
+const (
+	// FixedWindow allows Limit requests per Period-aligned window. It runs as a Lua
+	// script where the provider has scripts and falls back to Increment otherwise, so it
+	// works on any provider with atomic counters, but allows bursts of up to 2*Limit
+	// around window boundaries. Rejected requests still count.
+	FixedWindow RateLimitAlgorithm = "fixed_window"
+
+	// SlidingWindowLog allows Limit requests in any Period by logging request times.
+	// Exact, at the cost of storing one entry per request.
+	SlidingWindowLog RateLimitAlgorithm = "sliding_window_log"
+
+	// TokenBucket refills Limit tokens per Period into a bucket of Burst tokens,
+	// allowing bursts of Burst requests and Limit per Period on average.
+	TokenBucket RateLimitAlgorithm = "token_bucket"
+
+	// LeakyBucket queues up to Burst requests that drain at Limit per Period.
+	// Allowed requests report a Delay to wait before running, smoothing traffic.
+	LeakyBucket RateLimitAlgorithm = "leaky_bucket"
+)
+
+// RateLimit configures a RateLimiter
+type RateLimit struct {
+	// Algorithm defaults to FixedWindow
+	Algorithm RateLimitAlgorithm
+
+	// Limit is the number of requests allowed per Period
+	Limit int64
+
+	// Period is the window, or the time to refill or drain Limit requests
+	Period time.Duration
+
+	// Burst is the bucket size of TokenBucket and LeakyBucket. Defaults to Limit.
+	Burst int64
+
+	// KeyPrefix is prepended to rate limit keys. Defaults to "ratelimit:".
+	KeyPrefix string
+}
+
+// RateLimitResult is the outcome of a rate limit check
+type RateLimitResult struct {
+	// Allowed reports whether the request may proceed
+	Allowed bool
+
+	// Limit is the configured limit, for X-RateLimit-Limit headers
+	Limit int64
+
+	// Remaining is the number of requests that would be allowed right now
+	Remaining int64
+
+	// RetryAfter is how long to wait before the request can be allowed, when it was not
+	RetryAfter time.Duration
+
+	// Delay is how long an allowed LeakyBucket request should wait before running
+	Delay time.Duration
+}
+
+// RateLimiter checks requests against a rate limit per key
+type RateLimiter interface {
+	// Allow checks a single request for key
+	Allow(ctx context.Context, key string) (RateLimitResult, error)
+
+	// AllowN checks n requests for key at once, allowing all or none of them
+	AllowN(ctx context.Context, key string, n int64) (RateLimitResult, error)
+}
+
+// kvUpdater atomically replaces a stored value; implemented by MemoryProvider
+type kvUpdater interface {
+	updateKV(ctx context.Context, key string, fn func(current interface{}) (interface{}, time.Duration)) error
+}
+
+// asKVUpdater returns kv as a kvUpdater, looking through namespaced providers
+func asKVUpdater(kv KeyValueProvider) (kvUpdater, bool) {
+	if store, ok := kv.(kvUpdater); ok {
+		return store, true
+	}
+	if wrapper, ok := kv.(interface{ updater() (kvUpdater, bool) }); ok {
+		return wrapper.updater()
+	}
+	return nil, false
+}
+
+// rateLimitStep runs one check of an algorithm against the store
+type rateLimitStep func(ctx context.Context, key string, n int64, now time.Time) (RateLimitResult, error)
+
+// rateLimiter implements RateLimiter for all algorithms and backends
+type rateLimiter struct {
+	limit RateLimit
+	step  rateLimitStep
+	now   func() time.Time
+}
+
+// NewRateLimiter returns a rate limiter storing its state in kv. All algorithms run
+// as Lua scripts on a ScriptingKeyValueProvider. Otherwise FixedWindow needs Increment,
+// as offered by AtomicKeyValueProvider, and the other algorithms run under the store
+// lock of MemoryProvider; other providers get ErrorTypeUnsupported. Times come from
+// the client clock.
+// Example:
+//
+//	limiter, err := gpa.NewRateLimiter(kv, gpa.RateLimit{Algorithm: gpa.TokenBucket, Limit: 100, Period: time.Minute})
+//	res, err := limiter.Allow(ctx, "api:"+userID)
+//	if !res.Allowed { w.Header().Set("Retry-After", strconv.Itoa(int(res.RetryAfter.Seconds()))) }
+func NewRateLimiter(kv KeyValueProvider, limit RateLimit) (RateLimiter, error) {
+	if limit.Limit <= 0 || limit.Period <= 0 {
+		return nil, NewError(ErrorTypeInvalidArgument, "rate limit needs a positive limit and period")
+	}
+	if limit.Algorithm == "" {
+		limit.Algorithm = FixedWindow
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = limit.Limit
+	}
+	if limit.KeyPrefix == "" {
+		limit.KeyPrefix = "ratelimit:"
+	}
+
+	l := &rateLimiter{limit: limit, now: time.Now}
+	script, ok := rateLimitScripts[limit.Algorithm]
+	if !ok {
+		return nil, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("unknown rate limit algorithm %q", limit.Algorithm))
+	}
+	if store, ok := kv.(ScriptingKeyValueProvider); ok {
+		l.step = l.scripted(store, script)
+		if limit.Algorithm == FixedWindow {
+			l.step = l.fixedWindow(l.step)
+		}
+		return l, nil
+	}
+	if limit.Algorithm == FixedWindow {
+		counter, ok := kv.(AtomicKeyValueProvider)
+		if !ok {
+			return nil, NewError(ErrorTypeUnsupported, "fixed window rate limits need a provider with atomic counters")
+		}
+		l.step = l.fixedWindow(l.counted(counter))
+		return l, nil
+	}
+	store, ok := asKVUpdater(kv)
+	if !ok {
+		return nil, NewError(ErrorTypeUnsupported, fmt.Sprintf("%s rate limits need a provider with scripts", limit.Algorithm))
+	}
+	l.step = l.inMemory(store)
+	return l, nil
+}
+
+// Allow implements RateLimiter
+func (l *rateLimiter) Allow(ctx context.Context, key string) (RateLimitResult, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+// AllowN implements RateLimiter
+func (l *rateLimiter) AllowN(ctx context.Context, key string, n int64) (RateLimitResult, error) {
+	capacity := l.limit.Limit
+	if l.limit.Algorithm == TokenBucket || l.limit.Algorithm == LeakyBucket {
+		capacity = l.limit.Burst
+	}
+	if n <= 0 || n > capacity {
+		return RateLimitResult{}, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("cannot take %d of %d requests", n, capacity))
+	}
+	result, err := l.step(ctx, l.limit.KeyPrefix+key, n, l.now())
+	result.Limit = l.limit.Limit
+	return result, err
+}
+
+// fixedWindow runs step on the key of the window containing now
+func (l *rateLimiter) fixedWindow(step rateLimitStep) rateLimitStep {
+	return func(ctx context.Context, key string, n int64, now time.Time) (RateLimitResult, error) {
+		window := now.UnixNano() / int64(l.limit.Period)
+		return step(ctx, key+":"+strconv.FormatInt(window, 10), n, now)
+	}
+}
+
+// counted counts fixed window requests with Increment, then sets the expiry in a
+// second call. The window number is part of the key, so a missed expiry only leaves
+// a stale key behind; scripting providers use the fixed window script instead.
+func (l *rateLimiter) counted(kv AtomicKeyValueProvider) rateLimitStep {
+	return func(ctx context.Context, key string, n int64, now time.Time) (RateLimitResult, error) {
+		count, err := kv.Increment(ctx, key, n)
+		if err != nil {
+			return RateLimitResult{}, err
+		}
+		resetAfter := l.limit.Period - time.Duration(now.UnixNano()%int64(l.limit.Period))
+		if count == n {
+			if err := kv.Expire(ctx, key, resetAfter+time.Second); err != nil {
+				return RateLimitResult{}, err
+			}
+		}
+
+		result := RateLimitResult{Allowed: count <= l.limit.Limit, Remaining: max(l.limit.Limit-count, 0)}
+		if !result.Allowed {
+			result.RetryAfter = resetAfter
+		}
+		return result, nil
+	}
+}
+
+// =====================================
+// Rate Limit Algorithms
+// =====================================
+
+// Algorithms work on millisecond timestamps so the Go and Lua versions agree.
+
+// slidingLogState is the in-memory state of SlidingWindowLog: request times in ms
+type slidingLogState []int64
+
+// bucketState is the in-memory state of TokenBucket (level is the token count) and
+// LeakyBucket (level is the theoretical time the queue drains, in ms)
+type bucketState struct {
+	level float64
+	ts    int64
+}
+
+// slidingLogStep checks n requests at now against a log of request times
+func slidingLogStep(log slidingLogState, now, period, limit, n int64) (slidingLogState, RateLimitResult, time.Duration) {
+	live := slidingLogState{}
+	for _, t := range log {
+		if t > now-period {
+			live = append(live, t)
+		}
+	}
+	count := int64(len(live))
+	if count+n > limit {
+		retry := live[count+n-limit-1] + period - now
+		return live, RateLimitResult{Remaining: limit - count, RetryAfter: time.Duration(retry) * time.Millisecond}, time.Duration(period) * time.Millisecond
+	}
+	for i := int64(0); i < n; i++ {
+		live = append(live, now)
+	}
+	return live, RateLimitResult{Allowed: true, Remaining: limit - count - n}, time.Duration(period) * time.Millisecond
+}
+
+// tokenBucketStep refills the bucket at rate tokens per ms and takes n tokens
+func tokenBucketStep(state bucketState, known bool, now int64, capacity int64, rate float64, n int64) (bucketState, RateLimitResult, time.Duration) {
+	tokens := float64(capacity)
+	if known {
+		tokens = math.Min(float64(capacity), state.level+float64(now-state.ts)*rate)
+	}
+	result := RateLimitResult{}
+	if tokens >= float64(n) {
+		tokens -= float64(n)
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration(math.Ceil((float64(n)-tokens)/rate)) * time.Millisecond
+	}
+	result.Remaining = int64(math.Floor(tokens))
+	ttl := time.Duration(math.Ceil(float64(capacity)/rate)) * time.Millisecond
+	return bucketState{level: tokens, ts: now}, result, ttl
+}
+
+// leakyBucketStep queues n requests that drain one per interval ms, with the queue
+// tracked as the time it drains (GCRA)
+func leakyBucketStep(state bucketState, known bool, now int64, capacity int64, interval float64, n int64) (bucketState, RateLimitResult, time.Duration) {
+	drains := float64(now)
+	if known {
+		drains = math.Max(state.level, drains)
+	}
+	wait := drains - float64(now)
+	after := wait + float64(n)*interval
+	room := float64(capacity) * interval
+
+	result := RateLimitResult{}
+	if after <= room {
+		result.Allowed = true
+		result.Delay = time.Duration(math.Ceil(wait)) * time.Millisecond
+		result.Remaining = int64(math.Floor((room - after) / interval))
+		drains += float64(n) * interval
+	} else {
+		result.RetryAfter = time.Duration(math.Ceil(after-room)) * time.Millisecond
+		result.Remaining = int64(math.Floor(math.Max(room-wait, 0) / interval))
+	}
+	ttl := time.Duration(math.Ceil(drains-float64(now))+1) * time.Millisecond
+	return bucketState{level: drains, ts: now}, result, ttl
+}
+
+// inMemory runs the algorithms under the store lock of a MemoryProvider
+func (l *rateLimiter) inMemory(store kvUpdater) rateLimitStep {
+	period := l.limit.Period.Milliseconds()
+	return func(ctx context.Context, key string, n int64, now time.Time) (RateLimitResult, error) {
+		ms := now.UnixMilli()
+		var result RateLimitResult
+		err := store.updateKV(ctx, key, func(current interface{}) (interface{}, time.Duration) {
+			state, known := current.(bucketState)
+			switch l.limit.Algorithm {
+			case SlidingWindowLog:
+				log, _ := current.(slidingLogState)
+				next, res, ttl := slidingLogStep(log, ms, period, l.limit.Limit, n)
+				result = res
+				return next, ttl
+			case TokenBucket:
+				next, res, ttl := tokenBucketStep(state, known, ms, l.limit.Burst, float64(l.limit.Limit)/float64(period), n)
+				result = res
+				return next, ttl
+			default:
+				next, res, ttl := leakyBucketStep(state, known, ms, l.limit.Burst, float64(period)/float64(l.limit.Limit), n)
+				result = res
+				return next, ttl
+			}
+		})
+		return result, err
+	}
+}
+
+// =====================================
+// Lua Scripts
+// =====================================
+
+// rateLimitScripts implement the algorithms for Redis. Each takes the key and
+// ARGV now_ms, period_ms, limit, burst, n, token and replies
+// {allowed, remaining, retry_after_ms, delay_ms}.
+var rateLimitScripts = map[RateLimitAlgorithm]string{
+	FixedWindow: `
+local now, period, limit, n = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[5])
+local count = redis.call('INCRBY', KEYS[1], n)
+local reset = period - now % period
+if count == n then
+  redis.call('PEXPIRE', KEYS[1], reset + 1000)
+end
+if count > limit then
+  return {0, 0, reset, 0}
+end
+return {1, limit - count, 0, 0}
+`,
+	SlidingWindowLog: `
+local now, period, limit, n = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[5])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - period)
+local count = redis.call('ZCARD', KEYS[1])
+if count + n > limit then
+  local oldest = redis.call('ZRANGE', KEYS[1], count + n - limit - 1, count + n - limit - 1, 'WITHSCORES')
+  return {0, limit - count, tonumber(oldest[2]) + period - now, 0}
+end
+for i = 1, n do
+  redis.call('ZADD', KEYS[1], now, ARGV[6] .. ':' .. i)
+end
+redis.call('PEXPIRE', KEYS[1], period)
+return {1, limit - count - n, 0, 0}
+`,
+	TokenBucket: `
+local now, period, limit, burst, n = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4]), tonumber(ARGV[5])
+local rate = limit / period
+local state = redis.call('HMGET', KEYS[1], 'level', 'ts')
+local tokens = burst
+if state[1] then
+  tokens = math.min(burst, tonumber(state[1]) + (now - tonumber(state[2])) * rate)
+end
+local allowed, retry = 0, 0
+if tokens >= n then
+  tokens = tokens - n
+  allowed = 1
+else
+  retry = math.ceil((n - tokens) / rate)
+end
+redis.call('HSET', KEYS[1], 'level', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate))
+return {allowed, math.floor(tokens), retry, 0}
+`,
+	LeakyBucket: `
+local now, period, limit, burst, n = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4]), tonumber(ARGV[5])
+local interval = period / limit
+local drains = tonumber(redis.call('HGET', KEYS[1], 'level') or now)
+drains = math.max(drains, now)
+local wait = drains - now
+local after = wait + n * interval
+local room = burst * interval
+if after > room then
+  return {0, math.floor(math.max(room - wait, 0) / interval), math.ceil(after - room), 0}
+end
+drains = drains + n * interval
+redis.call('HSET', KEYS[1], 'level', tostring(drains), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(drains - now) + 1)
+return {1, math.floor((room - after) / interval), 0, math.ceil(wait)}
+`,
+}
+
+// scripted runs the algorithm's Lua script on the provider
+func (l *rateLimiter) scripted(store ScriptingKeyValueProvider, script string) rateLimitStep {
+	return func(ctx context.Context, key string, n int64, now time.Time) (RateLimitResult, error) {
+		reply, err := store.Eval(ctx, script, []string{key},
+			now.UnixMilli(), l.limit.Period.Milliseconds(), l.limit.Limit, l.limit.Burst, n, newRandomID())
+		if err != nil {
+			return RateLimitResult{}, err
+		}
+		values, ok := reply.([]interface{})
+		if !ok || len(values) != 4 {
+			return RateLimitResult{}, NewError(ErrorTypeInternal, fmt.Sprintf("unexpected rate limit script reply %v", reply))
+		}
+		ints := make([]int64, len(values))
+		for i, v := range values {
+			f, ok := numericValue(reflect.ValueOf(v))
+			if !ok {
+				return RateLimitResult{}, NewError(ErrorTypeInternal, fmt.Sprintf("unexpected rate limit script reply %v", reply))
+			}
+			ints[i] = int64(f)
+		}
+		return RateLimitResult{
+			Allowed:    ints[0] == 1,
+			Remaining:  ints[1],
+			RetryAfter: time.Duration(ints[2]) * time.Millisecond,
+			Delay:      time.Duration(ints[3]) * time.Millisecond,
+		}, nil
+	}
+}
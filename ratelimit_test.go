@@ -0,0 +1,174 @@
+package gpa
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scriptedKVProvider records Eval calls and returns a canned reply
+type scriptedKVProvider struct {
+	*tracingKVProvider
+	script string
+	keys   []string
+	args   []interface{}
+	reply  interface{}
+}
+
+func (p *scriptedKVProvider) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	p.script, p.keys, p.args = script, keys, args
+	return p.reply, nil
+}
+
+// newClockedLimiter returns a limiter on a memory provider sharing a settable clock
+func newClockedLimiter(t *testing.T, limit RateLimit) (RateLimiter, *time.Time) {
+	t.Helper()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	provider := NewMemoryProvider()
+	provider.now = func() time.Time { return now }
+	limiter, err := NewRateLimiter(provider, limit)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	limiter.(*rateLimiter).now = provider.now
+	return limiter, &now
+}
+
+func TestRateLimiter_FixedWindow(t *testing.T) {
+	limiter, now := newClockedLimiter(t, RateLimit{Limit: 3, Period: time.Minute})
+	ctx := context.Background()
+
+	*now = now.Add(15 * time.Second)
+	for i := int64(2); i >= 0; i-- {
+		if res, _ := limiter.Allow(ctx, "ip:1"); !res.Allowed || res.Remaining != i || res.Limit != 3 {
+			t.Fatalf("Expected allowed with %d remaining, got %+v", i, res)
+		}
+	}
+	res, _ := limiter.Allow(ctx, "ip:1")
+	if res.Allowed || res.RetryAfter != 45*time.Second {
+		t.Errorf("Expected rejection until the window ends, got %+v", res)
+	}
+	if res, _ := limiter.Allow(ctx, "ip:2"); !res.Allowed {
+		t.Error("Expected keys to be limited independently")
+	}
+
+	*now = now.Add(45 * time.Second)
+	if res, _ := limiter.Allow(ctx, "ip:1"); !res.Allowed || res.Remaining != 2 {
+		t.Errorf("Expected a fresh window, got %+v", res)
+	}
+}
+
+func TestRateLimiter_SlidingWindowLog(t *testing.T) {
+	limiter, now := newClockedLimiter(t, RateLimit{Algorithm: SlidingWindowLog, Limit: 2, Period: time.Minute})
+	ctx := context.Background()
+
+	limiter.Allow(ctx, "user")
+	*now = now.Add(30 * time.Second)
+	limiter.Allow(ctx, "user")
+	*now = now.Add(10 * time.Second)
+	if res, _ := limiter.Allow(ctx, "user"); res.Allowed || res.RetryAfter != 20*time.Second || res.Remaining != 0 {
+		t.Errorf("Expected retry when the oldest request leaves the window, got %+v", res)
+	}
+	*now = now.Add(21 * time.Second)
+	if res, _ := limiter.Allow(ctx, "user"); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("Expected one slot freed, got %+v", res)
+	}
+	if res, _ := limiter.AllowN(ctx, "other", 2); !res.Allowed {
+		t.Errorf("Expected AllowN to take the full limit, got %+v", res)
+	}
+}
+
+func TestRateLimiter_TokenBucket(t *testing.T) {
+	limiter, now := newClockedLimiter(t, RateLimit{Algorithm: TokenBucket, Limit: 10, Period: 10 * time.Second, Burst: 3})
+	ctx := context.Background()
+
+	if res, _ := limiter.AllowN(ctx, "k", 3); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("Expected a full burst, got %+v", res)
+	}
+	if res, _ := limiter.Allow(ctx, "k"); res.Allowed || res.RetryAfter != time.Second {
+		t.Errorf("Expected to wait for one token, got %+v", res)
+	}
+	*now = now.Add(2500 * time.Millisecond)
+	if res, _ := limiter.Allow(ctx, "k"); !res.Allowed || res.Remaining != 1 {
+		t.Errorf("Expected refilled tokens, got %+v", res)
+	}
+	if _, err := limiter.AllowN(ctx, "k", 4); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected error for more than the burst, got %v", err)
+	}
+}
+
+func TestRateLimiter_LeakyBucket(t *testing.T) {
+	limiter, now := newClockedLimiter(t, RateLimit{Algorithm: LeakyBucket, Limit: 1, Period: time.Second, Burst: 2})
+	ctx := context.Background()
+
+	first, _ := limiter.Allow(ctx, "q")
+	second, _ := limiter.Allow(ctx, "q")
+	if !first.Allowed || first.Delay != 0 || !second.Allowed || second.Delay != time.Second || second.Remaining != 0 {
+		t.Errorf("Expected queued requests spaced by the drain rate, got %+v then %+v", first, second)
+	}
+	if res, _ := limiter.Allow(ctx, "q"); res.Allowed || res.RetryAfter != time.Second {
+		t.Errorf("Expected a full queue, got %+v", res)
+	}
+	*now = now.Add(time.Second)
+	if res, _ := limiter.Allow(ctx, "q"); !res.Allowed || res.Delay != time.Second {
+		t.Errorf("Expected room after draining one request, got %+v", res)
+	}
+}
+
+func TestRateLimiter_Scripted(t *testing.T) {
+	kv := &scriptedKVProvider{tracingKVProvider: newCodecKV(), reply: []interface{}{int64(0), int64(2), int64(1500), int64(0)}}
+	limiter, err := NewRateLimiter(kv, RateLimit{Algorithm: TokenBucket, Limit: 5, Period: time.Second, KeyPrefix: "rl:"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res, err := limiter.Allow(context.Background(), "k")
+	if err != nil || res.Allowed || res.Remaining != 2 || res.RetryAfter != 1500*time.Millisecond || res.Limit != 5 {
+		t.Errorf("Unexpected result %+v (%v)", res, err)
+	}
+	if !strings.Contains(kv.script, "HMGET") || kv.args[1] != int64(1000) || kv.args[4] != int64(1) {
+		t.Errorf("Expected token bucket script with period and n, got %v", kv.args)
+	}
+
+	kv.reply = "OK"
+	if _, err := limiter.Allow(context.Background(), "k"); !IsErrorType(err, ErrorTypeInternal) {
+		t.Errorf("Expected error for malformed reply, got %v", err)
+	}
+}
+
+func TestRateLimiter_ScriptedFixedWindow(t *testing.T) {
+	kv := &scriptedKVProvider{tracingKVProvider: newCodecKV(), reply: []interface{}{int64(1), int64(4), int64(0), int64(0)}}
+	limiter, err := NewRateLimiter(kv, RateLimit{Limit: 5, Period: time.Minute, KeyPrefix: "rl:"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 15, 0, time.UTC)
+	limiter.(*rateLimiter).now = func() time.Time { return now }
+
+	if res, err := limiter.Allow(context.Background(), "k"); err != nil || !res.Allowed || res.Remaining != 4 {
+		t.Errorf("Unexpected result %+v (%v)", res, err)
+	}
+	window := now.UnixNano() / int64(time.Minute)
+	if len(kv.keys) != 1 || kv.keys[0] != "rl:k:"+strconv.FormatInt(window, 10) {
+		t.Errorf("Expected the window key, got %v", kv.keys)
+	}
+	if !strings.Contains(kv.script, "INCRBY") || !strings.Contains(kv.script, "PEXPIRE") {
+		t.Errorf("Expected the count and expiry in one script, got %s", kv.script)
+	}
+}
+
+func TestNewRateLimiter_Unsupported(t *testing.T) {
+	kv := newCodecKV()
+	for _, algorithm := range []RateLimitAlgorithm{FixedWindow, SlidingWindowLog} {
+		if _, err := NewRateLimiter(kv, RateLimit{Algorithm: algorithm, Limit: 1, Period: time.Second}); !IsErrorType(err, ErrorTypeUnsupported) {
+			t.Errorf("%s: expected unsupported error, got %v", algorithm, err)
+		}
+	}
+	if _, err := NewRateLimiter(NewMemoryProvider(), RateLimit{Limit: 1}); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected error without period, got %v", err)
+	}
+	if _, err := NewRateLimiter(NewMemoryProvider(), RateLimit{Algorithm: "gcra", Limit: 1, Period: time.Second}); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected unknown algorithm error, got %v", err)
+	}
+}
@@ -0,0 +1,567 @@
+package gpa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// =====================================
+// Data Structure Interfaces
+// =====================================
+
+// HashRepository stores field/value maps under a key, like Redis hashes.
+// Use HSetStruct and HGetStruct to read and write structs.
+type HashRepository interface {
+	// HSet sets fields of the hash at key and returns how many fields were added
+	// Example: added, err := HSet(ctx, "user:1:profile", map[string]interface{}{"bio": "hi"})
+	HSet(ctx context.Context, key string, values map[string]interface{}) (int64, error)
+
+	// HGet returns one field. Returns ErrorTypeNotFound if the field doesn't exist.
+	// Example: bio, err := HGet(ctx, "user:1:profile", "bio")
+	HGet(ctx context.Context, key, field string) (string, error)
+
+	// HMGet returns the given fields; missing fields are omitted
+	HMGet(ctx context.Context, key string, fields ...string) (map[string]string, error)
+
+	// HGetAll returns every field of the hash, or an empty map if it doesn't exist
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+
+	// HDel removes fields and returns how many existed
+	HDel(ctx context.Context, key string, fields ...string) (int64, error)
+
+	// HExists reports whether field is set
+	HExists(ctx context.Context, key, field string) (bool, error)
+
+	// HIncrBy adds delta to the integer field and returns the result
+	HIncrBy(ctx context.Context, key, field string, delta int64) (int64, error)
+}
+
+// ListRepository stores ordered lists of E under a key, like Redis lists.
+// Indexes may be negative to count from the end, as in Redis.
+type ListRepository[E any] interface {
+	// LPush prepends values and returns the new length
+	// Example: length, err := LPush(ctx, "user:1:actions", "login")
+	LPush(ctx context.Context, key string, values ...E) (int64, error)
+
+	// RPush appends values and returns the new length
+	RPush(ctx context.Context, key string, values ...E) (int64, error)
+
+	// LPop removes and returns the first element. Returns ErrorTypeNotFound if the list is empty.
+	LPop(ctx context.Context, key string) (E, error)
+
+	// RPop removes and returns the last element. Returns ErrorTypeNotFound if the list is empty.
+	RPop(ctx context.Context, key string) (E, error)
+
+	// LRange returns the elements from start to stop inclusive
+	// Example: latest, err := LRange(ctx, "user:1:actions", 0, 9)
+	LRange(ctx context.Context, key string, start, stop int64) ([]E, error)
+
+	// LLen returns the length of the list
+	LLen(ctx context.Context, key string) (int64, error)
+
+	// LTrim keeps only the elements from start to stop inclusive
+	LTrim(ctx context.Context, key string, start, stop int64) error
+}
+
+// SetRepository stores unordered sets of distinct E under a key, like Redis sets
+type SetRepository[E any] interface {
+	// SAdd adds members and returns how many were new
+	// Example: added, err := SAdd(ctx, "user:1:skills", "Go", "Redis")
+	SAdd(ctx context.Context, key string, members ...E) (int64, error)
+
+	// SRem removes members and returns how many existed
+	SRem(ctx context.Context, key string, members ...E) (int64, error)
+
+	// SIsMember reports whether member is in the set
+	SIsMember(ctx context.Context, key string, member E) (bool, error)
+
+	// SMembers returns every member, in no particular order
+	SMembers(ctx context.Context, key string) ([]E, error)
+
+	// SCard returns the number of members
+	SCard(ctx context.Context, key string) (int64, error)
+}
+
+// ZMember is a sorted set member with its score
+type ZMember[E any] struct {
+	Member E
+	Score  float64
+}
+
+// SortedSetRepository stores sets of E ordered by score under a key, like Redis sorted sets.
+// Members with equal scores are ordered by their encoded value.
+type SortedSetRepository[E any] interface {
+	// ZAdd adds or updates members and returns how many were new
+	// Example: added, err := ZAdd(ctx, "leaderboard", gpa.ZMember[string]{Member: "user:1", Score: 95.5})
+	ZAdd(ctx context.Context, key string, members ...ZMember[E]) (int64, error)
+
+	// ZIncrBy adds delta to member's score, adding the member if needed, and returns the new score
+	ZIncrBy(ctx context.Context, key string, delta float64, member E) (float64, error)
+
+	// ZScore returns the score of member. Returns ErrorTypeNotFound if it isn't in the set.
+	ZScore(ctx context.Context, key string, member E) (float64, error)
+
+	// ZRem removes members and returns how many existed
+	ZRem(ctx context.Context, key string, members ...E) (int64, error)
+
+	// ZRange returns members by ascending score from rank start to stop inclusive
+	ZRange(ctx context.Context, key string, start, stop int64) ([]ZMember[E], error)
+
+	// ZRevRange returns members by descending score from rank start to stop inclusive
+	// Example: top, err := ZRevRange(ctx, "leaderboard", 0, 2)
+	ZRevRange(ctx context.Context, key string, start, stop int64) ([]ZMember[E], error)
+
+	// ZRangeByScore returns members with min <= score <= max by ascending score, skipping
+	// offset members and returning at most count; a count of 0 returns all
+	ZRangeByScore(ctx context.Context, key string, min, max float64, offset, count int64) ([]ZMember[E], error)
+
+	// ZRank returns the 0-based ascending rank of member. Returns ErrorTypeNotFound if it isn't in the set.
+	ZRank(ctx context.Context, key string, member E) (int64, error)
+
+	// ZCard returns the number of members
+	ZCard(ctx context.Context, key string) (int64, error)
+}
+
+// StreamMessage is an entry of an append-only stream
+type StreamMessage[E any] struct {
+	ID     string
+	Stream string
+	Value  E
+}
+
+// StreamRepository appends to and reads from streams, like Redis streams.
+// Stream IDs are opaque strings; "0" reads from the start and "$" only new entries.
+type StreamRepository[E any] interface {
+	// XAdd appends value and returns its ID
+	// Example: id, err := XAdd(ctx, "orders", map[string]string{"id": "42"})
+	XAdd(ctx context.Context, stream string, value E) (string, error)
+
+	// XLen returns the number of entries
+	XLen(ctx context.Context, stream string) (int64, error)
+
+	// XRange returns up to count entries with IDs from start to end inclusive ("-" and "+" for the ends)
+	XRange(ctx context.Context, stream, start, end string, count int64) ([]StreamMessage[E], error)
+
+	// XRead returns up to count entries after lastID, waiting up to block for new ones
+	XRead(ctx context.Context, stream, lastID string, count int64, block time.Duration) ([]StreamMessage[E], error)
+
+	// XGroupCreate creates a consumer group reading from start, creating the stream if needed
+	XGroupCreate(ctx context.Context, stream, group, start string) error
+
+	// XReadGroup returns up to count entries not yet delivered to the group, waiting up to block
+	// Example: msgs, err := XReadGroup(ctx, "orders", "billing", "worker-1", 10, time.Second)
+	XReadGroup(ctx context.Context, stream, group, consumer string, count int64, block time.Duration) ([]StreamMessage[E], error)
+
+	// XAck acknowledges processed entries of a group and returns how many were pending
+	XAck(ctx context.Context, stream, group string, ids ...string) (int64, error)
+}
+
+// RedisRepository combines the key-value repository of T with Redis data structures,
+// so hashes, lists, sets, sorted sets and streams can be used without the native client.
+// Structures hold strings; ListOf, SetOf, SortedSetOf and StreamOf give typed views.
+type RedisRepository[T any] interface {
+	AdvancedKeyValueRepository[T]
+	HashRepository
+	ListRepository[string]
+	SetRepository[string]
+	SortedSetRepository[string]
+	StreamRepository[map[string]string]
+}
+
+// =====================================
+// Hash Struct Mapping
+// =====================================
+
+// jsonStringFields returns the JSON names of the string-kinded fields of t
+func jsonStringFields(t reflect.Type) map[string]bool {
+	fields := map[string]bool{}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return fields
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		kind := field.Type.Kind()
+		if kind == reflect.Pointer {
+			kind = field.Type.Elem().Kind()
+		}
+		fields[name] = kind == reflect.String
+	}
+	return fields
+}
+
+// HSetStruct stores the fields of value in the hash at key, using JSON field names.
+// Strings are stored as-is and other values as JSON, so numbers stay usable with HIncrBy.
+// Example: err := gpa.HSetStruct(ctx, repo, "user:1:profile", &profile)
+func HSetStruct[T any](ctx context.Context, hash HashRepository, key string, value *T) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return NewErrorWithCause(ErrorTypeSerialization, "cannot encode hash fields", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return NewErrorWithCause(ErrorTypeSerialization, fmt.Sprintf("%s does not encode to an object", entityName[T]()), err)
+	}
+
+	values := make(map[string]interface{}, len(fields))
+	for name, raw := range fields {
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			values[name] = s
+		} else {
+			values[name] = string(raw)
+		}
+	}
+	_, err = hash.HSet(ctx, key, values)
+	return err
+}
+
+// HGetStruct loads the hash at key into a T. Returns ErrorTypeNotFound if the hash is empty.
+// Example: profile, err := gpa.HGetStruct[Profile](ctx, repo, "user:1:profile")
+func HGetStruct[T any](ctx context.Context, hash HashRepository, key string) (*T, error) {
+	values, err := hash.HGetAll(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, NewError(ErrorTypeNotFound, fmt.Sprintf("hash %q not found", key)).WithEntity(entityName[T]())
+	}
+
+	stringFields := jsonStringFields(reflect.TypeOf((*T)(nil)).Elem())
+	fields := make(map[string]json.RawMessage, len(values))
+	for name, value := range values {
+		if isString, known := stringFields[name]; !known {
+			continue
+		} else if isString || !json.Valid([]byte(value)) {
+			fields[name], _ = json.Marshal(value)
+		} else {
+			fields[name] = json.RawMessage(value)
+		}
+	}
+	data, _ := json.Marshal(fields)
+
+	var result T
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, NewErrorWithCause(ErrorTypeSerialization, fmt.Sprintf("cannot decode hash %q", key), err)
+	}
+	return &result, nil
+}
+
+// =====================================
+// Typed Views
+// =====================================
+
+// memberCodec encodes structure elements as strings with a codec. Members hold the
+// codec's payload without the EncodeValue header, so equal values encode to equal
+// members and other clients can read them.
+type memberCodec[E any] struct {
+	codec Codec
+}
+
+func newMemberCodec[E any](codec Codec) memberCodec[E] {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+	return memberCodec[E]{codec: codec}
+}
+
+func (m memberCodec[E]) encode(values ...E) ([]string, error) {
+	encoded := make([]string, len(values))
+	for i, v := range values {
+		data, err := m.codec.Marshal(v)
+		if err != nil {
+			return nil, NewErrorWithCause(ErrorTypeSerialization, fmt.Sprintf("%s encoding failed", m.codec.Name()), err)
+		}
+		encoded[i] = string(data)
+	}
+	return encoded, nil
+}
+
+func (m memberCodec[E]) decode(values ...string) ([]E, error) {
+	decoded := make([]E, len(values))
+	for i, v := range values {
+		if err := m.codec.Unmarshal([]byte(v), &decoded[i]); err != nil {
+			return nil, NewErrorWithCause(ErrorTypeSerialization, fmt.Sprintf("%s decoding failed", m.codec.Name()), err)
+		}
+	}
+	return decoded, nil
+}
+
+func (m memberCodec[E]) decodeOne(value string, err error) (E, error) {
+	var zero E
+	if err != nil {
+		return zero, err
+	}
+	decoded, err := m.decode(value)
+	if err != nil {
+		return zero, err
+	}
+	return decoded[0], nil
+}
+
+// typedList implements ListRepository[E] over a string list
+type typedList[E any] struct {
+	list ListRepository[string]
+	memberCodec[E]
+}
+
+// ListOf returns a view of list whose elements are E, encoded with codec (JSON if nil)
+// Example: actions := gpa.ListOf[Action](repo, nil)
+func ListOf[E any](list ListRepository[string], codec Codec) ListRepository[E] {
+	return &typedList[E]{list: list, memberCodec: newMemberCodec[E](codec)}
+}
+
+func (l *typedList[E]) LPush(ctx context.Context, key string, values ...E) (int64, error) {
+	encoded, err := l.encode(values...)
+	if err != nil {
+		return 0, err
+	}
+	return l.list.LPush(ctx, key, encoded...)
+}
+
+func (l *typedList[E]) RPush(ctx context.Context, key string, values ...E) (int64, error) {
+	encoded, err := l.encode(values...)
+	if err != nil {
+		return 0, err
+	}
+	return l.list.RPush(ctx, key, encoded...)
+}
+
+func (l *typedList[E]) LPop(ctx context.Context, key string) (E, error) {
+	return l.decodeOne(l.list.LPop(ctx, key))
+}
+
+func (l *typedList[E]) RPop(ctx context.Context, key string) (E, error) {
+	return l.decodeOne(l.list.RPop(ctx, key))
+}
+
+func (l *typedList[E]) LRange(ctx context.Context, key string, start, stop int64) ([]E, error) {
+	values, err := l.list.LRange(ctx, key, start, stop)
+	if err != nil {
+		return nil, err
+	}
+	return l.decode(values...)
+}
+
+func (l *typedList[E]) LLen(ctx context.Context, key string) (int64, error) {
+	return l.list.LLen(ctx, key)
+}
+
+func (l *typedList[E]) LTrim(ctx context.Context, key string, start, stop int64) error {
+	return l.list.LTrim(ctx, key, start, stop)
+}
+
+// typedSet implements SetRepository[E] over a string set
+type typedSet[E any] struct {
+	set SetRepository[string]
+	memberCodec[E]
+}
+
+// SetOf returns a view of set whose members are E, encoded with codec (JSON if nil).
+// The codec must encode equal values identically.
+// Example: tags := gpa.SetOf[Tag](repo, nil)
+func SetOf[E any](set SetRepository[string], codec Codec) SetRepository[E] {
+	return &typedSet[E]{set: set, memberCodec: newMemberCodec[E](codec)}
+}
+
+func (s *typedSet[E]) SAdd(ctx context.Context, key string, members ...E) (int64, error) {
+	encoded, err := s.encode(members...)
+	if err != nil {
+		return 0, err
+	}
+	return s.set.SAdd(ctx, key, encoded...)
+}
+
+func (s *typedSet[E]) SRem(ctx context.Context, key string, members ...E) (int64, error) {
+	encoded, err := s.encode(members...)
+	if err != nil {
+		return 0, err
+	}
+	return s.set.SRem(ctx, key, encoded...)
+}
+
+func (s *typedSet[E]) SIsMember(ctx context.Context, key string, member E) (bool, error) {
+	encoded, err := s.encode(member)
+	if err != nil {
+		return false, err
+	}
+	return s.set.SIsMember(ctx, key, encoded[0])
+}
+
+func (s *typedSet[E]) SMembers(ctx context.Context, key string) ([]E, error) {
+	members, err := s.set.SMembers(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return s.decode(members...)
+}
+
+func (s *typedSet[E]) SCard(ctx context.Context, key string) (int64, error) {
+	return s.set.SCard(ctx, key)
+}
+
+// typedSortedSet implements SortedSetRepository[E] over a string sorted set
+type typedSortedSet[E any] struct {
+	zset SortedSetRepository[string]
+	memberCodec[E]
+}
+
+// SortedSetOf returns a view of zset whose members are E, encoded with codec (JSON if nil).
+// The codec must encode equal values identically.
+// Example: board := gpa.SortedSetOf[PlayerID](repo, nil)
+func SortedSetOf[E any](zset SortedSetRepository[string], codec Codec) SortedSetRepository[E] {
+	return &typedSortedSet[E]{zset: zset, memberCodec: newMemberCodec[E](codec)}
+}
+
+func (z *typedSortedSet[E]) decodeMembers(members []ZMember[string], err error) ([]ZMember[E], error) {
+	if err != nil {
+		return nil, err
+	}
+	decoded := make([]ZMember[E], len(members))
+	for i, m := range members {
+		if decoded[i].Member, err = z.decodeOne(m.Member, nil); err != nil {
+			return nil, err
+		}
+		decoded[i].Score = m.Score
+	}
+	return decoded, nil
+}
+
+func (z *typedSortedSet[E]) ZAdd(ctx context.Context, key string, members ...ZMember[E]) (int64, error) {
+	encoded := make([]ZMember[string], len(members))
+	for i, m := range members {
+		member, err := z.encode(m.Member)
+		if err != nil {
+			return 0, err
+		}
+		encoded[i] = ZMember[string]{Member: member[0], Score: m.Score}
+	}
+	return z.zset.ZAdd(ctx, key, encoded...)
+}
+
+func (z *typedSortedSet[E]) ZIncrBy(ctx context.Context, key string, delta float64, member E) (float64, error) {
+	encoded, err := z.encode(member)
+	if err != nil {
+		return 0, err
+	}
+	return z.zset.ZIncrBy(ctx, key, delta, encoded[0])
+}
+
+func (z *typedSortedSet[E]) ZScore(ctx context.Context, key string, member E) (float64, error) {
+	encoded, err := z.encode(member)
+	if err != nil {
+		return 0, err
+	}
+	return z.zset.ZScore(ctx, key, encoded[0])
+}
+
+func (z *typedSortedSet[E]) ZRem(ctx context.Context, key string, members ...E) (int64, error) {
+	encoded, err := z.encode(members...)
+	if err != nil {
+		return 0, err
+	}
+	return z.zset.ZRem(ctx, key, encoded...)
+}
+
+func (z *typedSortedSet[E]) ZRange(ctx context.Context, key string, start, stop int64) ([]ZMember[E], error) {
+	return z.decodeMembers(z.zset.ZRange(ctx, key, start, stop))
+}
+
+func (z *typedSortedSet[E]) ZRevRange(ctx context.Context, key string, start, stop int64) ([]ZMember[E], error) {
+	return z.decodeMembers(z.zset.ZRevRange(ctx, key, start, stop))
+}
+
+func (z *typedSortedSet[E]) ZRangeByScore(ctx context.Context, key string, min, max float64, offset, count int64) ([]ZMember[E], error) {
+	return z.decodeMembers(z.zset.ZRangeByScore(ctx, key, min, max, offset, count))
+}
+
+func (z *typedSortedSet[E]) ZRank(ctx context.Context, key string, member E) (int64, error) {
+	encoded, err := z.encode(member)
+	if err != nil {
+		return 0, err
+	}
+	return z.zset.ZRank(ctx, key, encoded[0])
+}
+
+func (z *typedSortedSet[E]) ZCard(ctx context.Context, key string) (int64, error) {
+	return z.zset.ZCard(ctx, key)
+}
+
+// streamDataField is the stream entry field that holds values written by StreamOf
+const streamDataField = "data"
+
+// typedStream implements StreamRepository[E] over a stream of field maps
+type typedStream[E any] struct {
+	stream StreamRepository[map[string]string]
+	memberCodec[E]
+}
+
+// StreamOf returns a view of stream whose entries are E, encoded with codec (JSON if nil)
+// in the entry's "data" field
+// Example: orders := gpa.StreamOf[OrderPlaced](repo, nil)
+func StreamOf[E any](stream StreamRepository[map[string]string], codec Codec) StreamRepository[E] {
+	return &typedStream[E]{stream: stream, memberCodec: newMemberCodec[E](codec)}
+}
+
+func (s *typedStream[E]) decodeMessages(messages []StreamMessage[map[string]string], err error) ([]StreamMessage[E], error) {
+	if err != nil {
+		return nil, err
+	}
+	decoded := make([]StreamMessage[E], len(messages))
+	for i, m := range messages {
+		data, ok := m.Value[streamDataField]
+		if !ok {
+			return nil, NewError(ErrorTypeSerialization, fmt.Sprintf("stream entry %s has no %q field", m.ID, streamDataField))
+		}
+		if decoded[i].Value, err = s.decodeOne(data, nil); err != nil {
+			return nil, err
+		}
+		decoded[i].ID, decoded[i].Stream = m.ID, m.Stream
+	}
+	return decoded, nil
+}
+
+func (s *typedStream[E]) XAdd(ctx context.Context, stream string, value E) (string, error) {
+	encoded, err := s.encode(value)
+	if err != nil {
+		return "", err
+	}
+	return s.stream.XAdd(ctx, stream, map[string]string{streamDataField: encoded[0]})
+}
+
+func (s *typedStream[E]) XLen(ctx context.Context, stream string) (int64, error) {
+	return s.stream.XLen(ctx, stream)
+}
+
+func (s *typedStream[E]) XRange(ctx context.Context, stream, start, end string, count int64) ([]StreamMessage[E], error) {
+	return s.decodeMessages(s.stream.XRange(ctx, stream, start, end, count))
+}
+
+func (s *typedStream[E]) XRead(ctx context.Context, stream, lastID string, count int64, block time.Duration) ([]StreamMessage[E], error) {
+	return s.decodeMessages(s.stream.XRead(ctx, stream, lastID, count, block))
+}
+
+func (s *typedStream[E]) XGroupCreate(ctx context.Context, stream, group, start string) error {
+	return s.stream.XGroupCreate(ctx, stream, group, start)
+}
+
+func (s *typedStream[E]) XReadGroup(ctx context.Context, stream, group, consumer string, count int64, block time.Duration) ([]StreamMessage[E], error) {
+	return s.decodeMessages(s.stream.XReadGroup(ctx, stream, group, consumer, count, block))
+}
+
+func (s *typedStream[E]) XAck(ctx context.Context, stream, group string, ids ...string) (int64, error) {
+	return s.stream.XAck(ctx, stream, group, ids...)
+}
@@ -0,0 +1,187 @@
+package gpa
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type hashProfile struct {
+	Name   string   `json:"name"`
+	Age    int      `json:"age"`
+	Zip    string   `json:"zip"`
+	Tags   []string `json:"tags"`
+	Secret string   `json:"-"`
+}
+
+type leaderboardPlayer struct {
+	ID   int
+	Name string
+}
+
+func TestHashStruct_RoundTrip(t *testing.T) {
+	provider := NewMemoryProvider()
+	ctx := context.Background()
+
+	profile := hashProfile{Name: "ada", Age: 36, Zip: "01234", Tags: []string{"admin"}, Secret: "x"}
+	if err := HSetStruct(ctx, provider, "user:1", &profile); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if name, _ := provider.HGet(ctx, "user:1", "name"); name != "ada" {
+		t.Errorf("Expected strings stored raw, got %q", name)
+	}
+	if age, err := provider.HIncrBy(ctx, "user:1", "age", 1); err != nil || age != 37 {
+		t.Errorf("Expected numeric field usable with HIncrBy, got %d (%v)", age, err)
+	}
+	provider.HSet(ctx, "user:1", map[string]interface{}{"unknown": "ignored"})
+
+	loaded, err := HGetStruct[hashProfile](ctx, provider, "user:1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if loaded.Name != "ada" || loaded.Age != 37 || loaded.Zip != "01234" || len(loaded.Tags) != 1 || loaded.Secret != "" {
+		t.Errorf("Unexpected profile %+v", loaded)
+	}
+	if _, err := HGetStruct[hashProfile](ctx, provider, "user:2"); !IsNotFound(err) {
+		t.Errorf("Expected not found, got %v", err)
+	}
+}
+
+func TestMemoryProvider_Structures(t *testing.T) {
+	provider := NewMemoryProvider()
+	ctx := context.Background()
+
+	provider.RPush(ctx, "queue", "b", "c")
+	provider.LPush(ctx, "queue", "a", "z")
+	if items, _ := provider.LRange(ctx, "queue", 0, -1); len(items) != 4 || items[0] != "z" || items[3] != "c" {
+		t.Errorf("Expected [z a b c], got %v", items)
+	}
+	provider.LTrim(ctx, "queue", 1, -2)
+	if first, _ := provider.LPop(ctx, "queue"); first != "a" {
+		t.Errorf("Expected a after trim, got %q", first)
+	}
+	provider.RPop(ctx, "queue")
+	if _, err := provider.LPop(ctx, "queue"); !IsNotFound(err) {
+		t.Errorf("Expected not found on empty list, got %v", err)
+	}
+	if exists, _ := provider.Exists(ctx, "queue"); exists {
+		t.Error("Expected empty list to be removed")
+	}
+
+	if added, _ := provider.SAdd(ctx, "tags", "go", "db", "go"); added != 2 {
+		t.Errorf("Expected 2 new members, got %d", added)
+	}
+	if ok, _ := provider.SIsMember(ctx, "tags", "db"); !ok {
+		t.Error("Expected db to be a member")
+	}
+	if _, err := provider.LPush(ctx, "tags", "x"); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected wrong type error, got %v", err)
+	}
+
+	provider.ZAdd(ctx, "scores", ZMember[string]{Member: "a", Score: 3}, ZMember[string]{Member: "b", Score: 1})
+	provider.ZIncrBy(ctx, "scores", 5, "b")
+	if top, _ := provider.ZRevRange(ctx, "scores", 0, 0); len(top) != 1 || top[0].Member != "b" || top[0].Score != 6 {
+		t.Errorf("Expected b with 6 on top, got %v", top)
+	}
+	if rank, _ := provider.ZRank(ctx, "scores", "a"); rank != 0 {
+		t.Errorf("Expected a ranked first, got %d", rank)
+	}
+	if inRange, _ := provider.ZRangeByScore(ctx, "scores", 2, 10, 1, 1); len(inRange) != 1 || inRange[0].Member != "b" {
+		t.Errorf("Expected b at offset 1, got %v", inRange)
+	}
+}
+
+func TestTypedViews(t *testing.T) {
+	provider := NewMemoryProvider()
+	ctx := context.Background()
+
+	list := ListOf[leaderboardPlayer](provider, nil)
+	list.RPush(ctx, "players", leaderboardPlayer{ID: 1, Name: "ada"}, leaderboardPlayer{ID: 2, Name: "bob"})
+	if players, err := list.LRange(ctx, "players", 0, -1); err != nil || len(players) != 2 || players[1].Name != "bob" {
+		t.Errorf("Expected typed list, got %v (%v)", players, err)
+	}
+	if raw, _ := provider.LRange(ctx, "players", 0, 0); len(raw) != 1 || raw[0] != `{"ID":1,"Name":"ada"}` {
+		t.Errorf("Expected members stored as plain JSON, got %q", raw)
+	}
+
+	set := SetOf[int](provider, GobCodec{})
+	set.SAdd(ctx, "ids", 1, 2, 2)
+	if n, _ := set.SCard(ctx, "ids"); n != 2 {
+		t.Errorf("Expected 2 distinct members, got %d", n)
+	}
+	if ok, _ := set.SIsMember(ctx, "ids", 2); !ok {
+		t.Error("Expected 2 to be a member")
+	}
+
+	board := SortedSetOf[leaderboardPlayer](provider, nil)
+	board.ZAdd(ctx, "board",
+		ZMember[leaderboardPlayer]{Member: leaderboardPlayer{ID: 1, Name: "ada"}, Score: 10},
+		ZMember[leaderboardPlayer]{Member: leaderboardPlayer{ID: 2, Name: "bob"}, Score: 20})
+	top, err := board.ZRangeByScore(ctx, "board", 15, 100, 0, 0)
+	if err != nil || len(top) != 1 || top[0].Member.Name != "bob" || top[0].Score != 20 {
+		t.Errorf("Expected bob above 15, got %v (%v)", top, err)
+	}
+	if score, _ := board.ZScore(ctx, "board", leaderboardPlayer{ID: 1, Name: "ada"}); score != 10 {
+		t.Errorf("Expected score 10, got %v", score)
+	}
+}
+
+func TestMemoryProvider_Streams(t *testing.T) {
+	provider := NewMemoryProvider()
+	now := time.UnixMilli(1000)
+	provider.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	first, _ := provider.XAdd(ctx, "orders", map[string]string{"id": "1"})
+	second, _ := provider.XAdd(ctx, "orders", map[string]string{"id": "2"})
+	if first != "1000-0" || second != "1000-1" {
+		t.Errorf("Expected sequenced IDs within a millisecond, got %s and %s", first, second)
+	}
+	if n, _ := provider.XLen(ctx, "orders"); n != 2 {
+		t.Errorf("Expected 2 entries, got %d", n)
+	}
+	if all, _ := provider.XRange(ctx, "orders", "-", "+", 0); len(all) != 2 || all[1].Value["id"] != "2" {
+		t.Errorf("Expected both entries, got %v", all)
+	}
+	if after, _ := provider.XRead(ctx, "orders", first, 10, 0); len(after) != 1 || after[0].ID != second {
+		t.Errorf("Expected the entry after %s, got %v", first, after)
+	}
+
+	if latest, _ := provider.XRead(ctx, "orders", "$", 10, 0); len(latest) != 0 {
+		t.Errorf("Expected $ to skip existing entries, got %v", latest)
+	}
+	done := make(chan []StreamMessage[map[string]string])
+	go func() {
+		messages, _ := provider.XRead(ctx, "orders", second, 10, time.Second)
+		done <- messages
+	}()
+	time.Sleep(10 * time.Millisecond)
+	provider.XAdd(ctx, "orders", map[string]string{"id": "3"})
+	if messages := <-done; len(messages) != 1 || messages[0].Value["id"] != "3" {
+		t.Errorf("Expected the blocked read to see the new entry, got %v", messages)
+	}
+
+	if err := provider.XGroupCreate(ctx, "orders", "billing", "0"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := provider.XGroupCreate(ctx, "orders", "billing", "0"); !IsErrorType(err, ErrorTypeDuplicate) {
+		t.Errorf("Expected duplicate group error, got %v", err)
+	}
+	batch, _ := provider.XReadGroup(ctx, "orders", "billing", "worker-1", 2, 0)
+	rest, _ := provider.XReadGroup(ctx, "orders", "billing", "worker-2", 10, 0)
+	if len(batch) != 2 || len(rest) != 1 {
+		t.Fatalf("Expected each entry delivered once to the group, got %v then %v", batch, rest)
+	}
+	if acked, _ := provider.XAck(ctx, "orders", "billing", batch[0].ID, batch[0].ID, "9-9"); acked != 1 {
+		t.Errorf("Expected one pending entry acknowledged, got %d", acked)
+	}
+	if _, err := provider.XReadGroup(ctx, "orders", "missing", "w", 1, 0); !IsNotFound(err) {
+		t.Errorf("Expected unknown group error, got %v", err)
+	}
+
+	typed := StreamOf[leaderboardPlayer](provider, nil)
+	typed.XAdd(ctx, "players", leaderboardPlayer{ID: 1, Name: "ada"})
+	if players, err := typed.XRange(ctx, "players", "-", "+", 0); err != nil || len(players) != 1 || players[0].Value.Name != "ada" {
+		t.Errorf("Expected a typed stream entry, got %v (%v)", players, err)
+	}
+}
@@ -0,0 +1,354 @@
+package gpa
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// =====================================
+// Retry Policy
+// =====================================
+
+// SQLSTATE codes that indicate a transaction can safely be re-run
+const (
+	CodeSerializationFailure = "40001"
+	CodeDeadlockDetected     = "40P01"
+)
+
+// Retryable reports whether the operation that produced the error may succeed if retried.
+// Errors marked with WithRetryable, connection and timeout errors are retryable, as
+// are transaction errors whose SQLState, or Code when no SQLState is set, is a
+// serialization failure or deadlock, or whose cause reads like one.
+func (e GPAError) Retryable() bool {
+	if e.details != nil && e.details.retryable {
+		return true
+	}
+	switch e.Type {
+	case ErrorTypeConnection, ErrorTypeTimeout:
+		return true
+	case ErrorTypeTransaction:
+		state := e.SQLState
+		if state == "" {
+			state = e.Code
+		}
+		if state == CodeSerializationFailure || state == CodeDeadlockDetected {
+			return true
+		}
+		return e.Cause != nil && isSerializationMessage(e.Cause.Error())
+	}
+	return false
+}
+
+// IsRetryable checks if err, or any error it wraps, is a retryable GPAError.
+// Context cancellation and deadline errors are never retryable.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if gpaErr, ok := AsGPAError(err); ok {
+		return gpaErr.Retryable()
+	}
+	return false
+}
+
+// RetryPolicy controls how failed operations are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	// Values below 1 are treated as 1.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between attempts.
+	MaxBackoff time.Duration
+
+	// Multiplier grows the delay after every attempt.
+	Multiplier float64
+
+	// Jitter randomizes each delay by up to this fraction (0.0 - 1.0) in either direction.
+	Jitter float64
+
+	// Retryable decides whether an error should be retried.
+	// Defaults to IsRetryable when nil.
+	Retryable func(err error) bool
+
+	// RetryWrites lets NewRetryRepository retry non-idempotent writes (Create,
+	// CreateBatch, UpdatePartial and RawExec) on any retryable error. By default they are
+	// only retried when the error proves nothing was applied, since after a timeout or
+	// a lost connection the write may have succeeded and a retry could apply it twice.
+	// Enable it when writes are idempotent, e.g. with client-generated primary keys.
+	RetryWrites bool
+}
+
+// DefaultRetryPolicy returns a policy with 3 attempts and exponential backoff
+// starting at 50ms, capped at 2s, with 20% jitter.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 50 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// shouldRetry reports whether err qualifies for another attempt
+func (p RetryPolicy) shouldRetry(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// forWrites returns the policy for non-idempotent writes. Unless RetryWrites is set, it
+// only retries errors that prove the write was not applied.
+func (p RetryPolicy) forWrites() RetryPolicy {
+	if p.RetryWrites {
+		return p
+	}
+	writes := p
+	writes.Retryable = func(err error) bool {
+		return p.shouldRetry(err) && IsNotApplied(err)
+	}
+	return writes
+}
+
+// IsNotApplied reports whether err proves that the failed write was not applied: the
+// database rolled it back as a serialization failure or deadlock. Timeouts and
+// connection errors do not, since the write may have committed before they occurred.
+func IsNotApplied(err error) bool {
+	gpaErr, ok := AsGPAError(err)
+	return ok && gpaErr.Type == ErrorTypeTransaction && gpaErr.Retryable()
+}
+
+// backoff returns the delay to wait after the given (1-based) attempt failed
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := float64(p.InitialBackoff)
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	for i := 1; i < attempt; i++ {
+		delay *= multiplier
+		if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+			delay = float64(p.MaxBackoff)
+			break
+		}
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (rand.Float64()*2 - 1)
+	}
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return time.Duration(delay)
+}
+
+// Retry runs fn until it succeeds, returns a non-retryable error, or the policy is exhausted.
+// It stops early when ctx is done or when the next backoff would overrun ctx's deadline,
+// returning the last error from fn in both cases.
+// Example: err := Retry(ctx, DefaultRetryPolicy(), func(ctx context.Context) error { return repo.Create(ctx, &user) })
+func Retry(ctx context.Context, policy RetryPolicy, fn func(ctx context.Context) error) error {
+	attempts := policy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = fn(ctx); err == nil {
+			return nil
+		}
+		if attempt == attempts || !policy.shouldRetry(err) {
+			return err
+		}
+
+		delay := policy.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+	return err
+}
+
+// =====================================
+// Retrying Repository
+// =====================================
+
+// retryRepository wraps a Repository[T] and retries failed calls according to a policy
+type retryRepository[T any] struct {
+	repo   Repository[T]
+	policy RetryPolicy
+}
+
+// NewRetryRepository wraps repo so that every call is retried according to policy.
+// Reads and idempotent writes (Update, Delete, DeleteByCondition) are retried on any
+// retryable error. Create, CreateBatch, UpdatePartial and RawExec are only retried when
+// the error proves nothing was applied, unless policy.RetryWrites is set.
+// Transaction re-runs the whole TransactionFunc when the transaction was rolled back
+// by a serialization failure or deadlock, or on any retryable error when
+// policy.RetryWrites is set. The function must therefore be safe to execute more than once.
+// Example: repo = NewRetryRepository(repo, DefaultRetryPolicy())
+func NewRetryRepository[T any](repo Repository[T], policy RetryPolicy) Repository[T] {
+	return &retryRepository[T]{repo: repo, policy: policy}
+}
+
+func (r *retryRepository[T]) Create(ctx context.Context, entity *T) error {
+	return Retry(ctx, r.policy.forWrites(), func(ctx context.Context) error {
+		return r.repo.Create(ctx, entity)
+	})
+}
+
+func (r *retryRepository[T]) CreateBatch(ctx context.Context, entities []*T) error {
+	return Retry(ctx, r.policy.forWrites(), func(ctx context.Context) error {
+		return r.repo.CreateBatch(ctx, entities)
+	})
+}
+
+func (r *retryRepository[T]) FindByID(ctx context.Context, id interface{}) (result *T, err error) {
+	err = Retry(ctx, r.policy, func(ctx context.Context) error {
+		result, err = r.repo.FindByID(ctx, id)
+		return err
+	})
+	return result, err
+}
+
+func (r *retryRepository[T]) FindAll(ctx context.Context, opts ...QueryOption) (result []*T, err error) {
+	err = Retry(ctx, r.policy, func(ctx context.Context) error {
+		result, err = r.repo.FindAll(ctx, opts...)
+		return err
+	})
+	return result, err
+}
+
+func (r *retryRepository[T]) Update(ctx context.Context, entity *T) error {
+	return Retry(ctx, r.policy, func(ctx context.Context) error {
+		return r.repo.Update(ctx, entity)
+	})
+}
+
+func (r *retryRepository[T]) UpdatePartial(ctx context.Context, id interface{}, updates map[string]interface{}) error {
+	return Retry(ctx, r.policy.forWrites(), func(ctx context.Context) error {
+		return r.repo.UpdatePartial(ctx, id, updates)
+	})
+}
+
+func (r *retryRepository[T]) Delete(ctx context.Context, id interface{}) error {
+	return Retry(ctx, r.policy, func(ctx context.Context) error {
+		return r.repo.Delete(ctx, id)
+	})
+}
+
+func (r *retryRepository[T]) DeleteByCondition(ctx context.Context, condition Condition) error {
+	return Retry(ctx, r.policy, func(ctx context.Context) error {
+		return r.repo.DeleteByCondition(ctx, condition)
+	})
+}
+
+func (r *retryRepository[T]) Query(ctx context.Context, opts ...QueryOption) (result []*T, err error) {
+	err = Retry(ctx, r.policy, func(ctx context.Context) error {
+		result, err = r.repo.Query(ctx, opts...)
+		return err
+	})
+	return result, err
+}
+
+func (r *retryRepository[T]) QueryScored(ctx context.Context, opts ...QueryOption) (result []Scored[T], err error) {
+	err = Retry(ctx, r.policy, func(ctx context.Context) error {
+		result, err = QueryScored(ctx, r.repo, opts...)
+		return err
+	})
+	return result, err
+}
+
+func (r *retryRepository[T]) QueryOne(ctx context.Context, opts ...QueryOption) (result *T, err error) {
+	err = Retry(ctx, r.policy, func(ctx context.Context) error {
+		result, err = r.repo.QueryOne(ctx, opts...)
+		return err
+	})
+	return result, err
+}
+
+func (r *retryRepository[T]) Count(ctx context.Context, opts ...QueryOption) (count int64, err error) {
+	err = Retry(ctx, r.policy, func(ctx context.Context) error {
+		count, err = r.repo.Count(ctx, opts...)
+		return err
+	})
+	return count, err
+}
+
+func (r *retryRepository[T]) Exists(ctx context.Context, opts ...QueryOption) (exists bool, err error) {
+	err = Retry(ctx, r.policy, func(ctx context.Context) error {
+		exists, err = r.repo.Exists(ctx, opts...)
+		return err
+	})
+	return exists, err
+}
+
+// Transaction re-runs fn in a fresh transaction while the transaction is rolled back; see RetryTransaction.
+// Calls made through tx are not retried individually; the transaction is the unit of retry.
+func (r *retryRepository[T]) Transaction(ctx context.Context, fn TransactionFunc[T]) error {
+	return RetryTransaction(ctx, r.repo, r.policy, fn)
+}
+
+func (r *retryRepository[T]) RawQuery(ctx context.Context, query string, args []interface{}) (result []*T, err error) {
+	err = Retry(ctx, r.policy, func(ctx context.Context) error {
+		result, err = r.repo.RawQuery(ctx, query, args)
+		return err
+	})
+	return result, err
+}
+
+func (r *retryRepository[T]) RawExec(ctx context.Context, query string, args []interface{}) (result Result, err error) {
+	err = Retry(ctx, r.policy.forWrites(), func(ctx context.Context) error {
+		result, err = r.repo.RawExec(ctx, query, args)
+		return err
+	})
+	return result, err
+}
+
+func (r *retryRepository[T]) GetEntityInfo() (*EntityInfo, error) {
+	return r.repo.GetEntityInfo()
+}
+
+func (r *retryRepository[T]) Close() error {
+	return r.repo.Close()
+}
+
+// RetryTransaction runs fn inside repo.Transaction and re-runs the whole transaction
+// when it fails with an error proving it was rolled back, such as a serialization
+// failure on commit. Timeouts and connection errors are only retried when
+// policy.RetryWrites is set, since the commit may have applied before they occurred.
+// Example: err := RetryTransaction(ctx, repo, DefaultRetryPolicy(), func(tx Transaction[User]) error { ... })
+func RetryTransaction[T any](ctx context.Context, repo Repository[T], policy RetryPolicy, fn TransactionFunc[T]) error {
+	return Retry(ctx, policy.forWrites(), func(ctx context.Context) error {
+		return repo.Transaction(ctx, fn)
+	})
+}
+
+// isSerializationMessage reports whether a driver message describes a serialization failure or deadlock
+func isSerializationMessage(msg string) bool {
+	msg = strings.ToLower(msg)
+	return strings.Contains(msg, "could not serialize access") ||
+		strings.Contains(msg, "deadlock") ||
+		strings.Contains(msg, "serialization failure") ||
+		strings.Contains(msg, "write conflict")
+}
@@ -0,0 +1,231 @@
+package gpa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func fastRetryPolicy(attempts int) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    attempts,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		Multiplier:     2,
+	}
+}
+
+func TestGPAErrorRetryable(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      GPAError
+		expected bool
+	}{
+		{"connection", NewError(ErrorTypeConnection, "reset"), true},
+		{"timeout", NewError(ErrorTypeTimeout, "slow"), true},
+		{"serialization code", NewErrorWithCode(ErrorTypeTransaction, "conflict", CodeSerializationFailure), true},
+		{"deadlock code", NewErrorWithCode(ErrorTypeTransaction, "deadlock", CodeDeadlockDetected), true},
+		{"serialization state", NewErrorWithCode(ErrorTypeTransaction, "conflict", "1213").WithSQLState(CodeSerializationFailure), true},
+		{"other state", NewErrorWithCode(ErrorTypeTransaction, "rolled back", CodeSerializationFailure).WithSQLState("40000"), false},
+		{"deadlock cause", NewErrorWithCause(ErrorTypeTransaction, "commit failed", errors.New("Deadlock found when trying to get lock")), true},
+		{"plain transaction", NewError(ErrorTypeTransaction, "rolled back"), false},
+		{"not found", NewError(ErrorTypeNotFound, "missing"), false},
+		{"validation", NewError(ErrorTypeValidation, "bad"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.err.Retryable() != tt.expected {
+				t.Errorf("Expected Retryable() = %v for %v", tt.expected, tt.err)
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	wrapped := fmt.Errorf("query failed: %w", NewError(ErrorTypeConnection, "reset"))
+	if !IsRetryable(wrapped) {
+		t.Error("Expected wrapped connection error to be retryable")
+	}
+	if IsRetryable(errors.New("plain")) {
+		t.Error("Expected plain error to not be retryable")
+	}
+	if IsRetryable(context.DeadlineExceeded) {
+		t.Error("Expected deadline error to not be retryable")
+	}
+	if IsRetryable(nil) {
+		t.Error("Expected nil to not be retryable")
+	}
+}
+
+func TestRetry_SucceedsAfterRetryableErrors(t *testing.T) {
+	attempts := 0
+	err := Retry(context.Background(), fastRetryPolicy(3), func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return NewError(ErrorTypeConnection, "reset")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestRetry_StopsOnNonRetryable(t *testing.T) {
+	attempts := 0
+	err := Retry(context.Background(), fastRetryPolicy(5), func(ctx context.Context) error {
+		attempts++
+		return NewError(ErrorTypeValidation, "bad input")
+	})
+	if !IsValidation(err) {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", attempts)
+	}
+}
+
+func TestRetry_ExhaustsAttempts(t *testing.T) {
+	attempts := 0
+	err := Retry(context.Background(), fastRetryPolicy(4), func(ctx context.Context) error {
+		attempts++
+		return NewError(ErrorTypeTimeout, "slow")
+	})
+	if err == nil {
+		t.Error("Expected error after exhausting attempts")
+	}
+	if attempts != 4 {
+		t.Errorf("Expected 4 attempts, got %d", attempts)
+	}
+}
+
+func TestRetry_RespectsDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	policy := RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Second}
+	attempts := 0
+	start := time.Now()
+	err := Retry(ctx, policy, func(ctx context.Context) error {
+		attempts++
+		return NewError(ErrorTypeConnection, "reset")
+	})
+	if err == nil {
+		t.Error("Expected error")
+	}
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt when backoff exceeds deadline, got %d", attempts)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("Expected Retry to return without waiting for the backoff")
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 35 * time.Millisecond, Multiplier: 2}
+
+	expected := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 35 * time.Millisecond, 35 * time.Millisecond}
+	for i, want := range expected {
+		if got := policy.backoff(i + 1); got != want {
+			t.Errorf("Attempt %d: expected backoff %v, got %v", i+1, want, got)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		got := policy.backoff(1)
+		if got < 5*time.Millisecond || got > 15*time.Millisecond {
+			t.Errorf("Jittered backoff out of range: %v", got)
+		}
+	}
+}
+
+func TestRetryRepository(t *testing.T) {
+	mock := &mockRepository[tracedEntity]{
+		errs: []error{NewError(ErrorTypeConnection, "reset"), NewError(ErrorTypeTimeout, "slow")},
+	}
+	repo := NewRetryRepository[tracedEntity](mock, fastRetryPolicy(3))
+
+	if _, err := repo.Count(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if mock.callCount("Count") != 3 {
+		t.Errorf("Expected 3 Count calls, got %d", mock.callCount("Count"))
+	}
+}
+
+func TestRetryRepository_Writes(t *testing.T) {
+	timeout := NewError(ErrorTypeTimeout, "slow")
+	mock := &mockRepository[tracedEntity]{errs: []error{timeout, timeout}}
+	repo := NewRetryRepository[tracedEntity](mock, fastRetryPolicy(3))
+	ctx := context.Background()
+
+	if err := repo.Create(ctx, &tracedEntity{ID: 1}); !IsErrorType(err, ErrorTypeTimeout) || mock.callCount("Create") != 1 {
+		t.Errorf("Expected a timed out Create not to be retried, got %d calls (%v)", mock.callCount("Create"), err)
+	}
+
+	mock.errs = []error{NewErrorWithCode(ErrorTypeTransaction, "deadlock", CodeDeadlockDetected)}
+	if _, err := repo.RawExec(ctx, "INSERT", nil); err != nil {
+		t.Errorf("Expected a rolled back RawExec to be retried, got %v", err)
+	}
+
+	mock.calls, mock.errs = nil, []error{timeout, timeout}
+	policy := fastRetryPolicy(3)
+	policy.RetryWrites = true
+	if err := NewRetryRepository[tracedEntity](mock, policy).Create(ctx, &tracedEntity{ID: 1}); err != nil || mock.callCount("Create") != 3 {
+		t.Errorf("Expected opted-in write retries, got %d calls (%v)", mock.callCount("Create"), err)
+	}
+
+	mock.calls, mock.errs = nil, []error{timeout}
+	if err := repo.Update(ctx, &tracedEntity{ID: 1}); err != nil || mock.callCount("Update") != 2 {
+		t.Errorf("Expected idempotent Update to be retried, got %d calls (%v)", mock.callCount("Update"), err)
+	}
+}
+
+func TestRetryRepository_TransactionRerunsFunction(t *testing.T) {
+	mock := &mockRepository[tracedEntity]{}
+	repo := NewRetryRepository[tracedEntity](mock, fastRetryPolicy(3))
+
+	runs := 0
+	err := repo.Transaction(context.Background(), func(tx Transaction[tracedEntity]) error {
+		runs++
+		if runs == 1 {
+			return NewErrorWithCode(ErrorTypeTransaction, "could not serialize", CodeSerializationFailure)
+		}
+		return tx.Create(context.Background(), &tracedEntity{ID: runs})
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if runs != 2 {
+		t.Errorf("Expected transaction function to run twice, got %d", runs)
+	}
+	if mock.callCount("Transaction") != 2 {
+		t.Errorf("Expected 2 transactions, got %d", mock.callCount("Transaction"))
+	}
+}
+
+func TestRetryTransaction_CommitOutcomeUnknown(t *testing.T) {
+	mock := &mockRepository[tracedEntity]{}
+	ctx := context.Background()
+	fn := func(tx Transaction[tracedEntity]) error { return tx.Create(ctx, &tracedEntity{ID: 1}) }
+
+	// Transaction, Create, then a commit whose reply was lost
+	mock.errs = []error{nil, nil, NewError(ErrorTypeConnection, "reset on COMMIT")}
+	if err := RetryTransaction[tracedEntity](ctx, mock, fastRetryPolicy(3), fn); !IsErrorType(err, ErrorTypeConnection) || mock.callCount("Transaction") != 1 {
+		t.Errorf("Expected an unknown commit not to be re-run, got %d transactions (%v)", mock.callCount("Transaction"), err)
+	}
+
+	mock.calls, mock.errs = nil, []error{nil, nil, NewError(ErrorTypeConnection, "reset on COMMIT")}
+	policy := fastRetryPolicy(3)
+	policy.RetryWrites = true
+	if err := RetryTransaction[tracedEntity](ctx, mock, policy, fn); err != nil || mock.callCount("Transaction") != 2 {
+		t.Errorf("Expected opted-in transaction retries, got %d transactions (%v)", mock.callCount("Transaction"), err)
+	}
+}
@@ -0,0 +1,228 @@
+package gpa
+
+import (
+	"context"
+	"iter"
+)
+
+// =====================================
+// Key Scanning
+// =====================================
+
+// defaultScanBatch is the SCAN count hint used when none is given
+const defaultScanBatch = 100
+
+// KeyScanner is implemented by stores with cursor-based key iteration, like Redis SCAN.
+// PatternKeyValueRepository and MemoryProvider implement it.
+type KeyScanner interface {
+	// Scan returns keys matching pattern from cursor on, and the cursor to continue
+	// from. A returned cursor of 0 ends the scan.
+	Scan(ctx context.Context, cursor uint64, pattern string, count int64) ([]string, uint64, error)
+}
+
+// KeyValue is a key and its decoded value, yielded by ScanValues
+type KeyValue[T any] struct {
+	Key   string
+	Value *T
+}
+
+// scanPages yields the non-empty pages of a scan until the cursor returns to 0
+func scanPages(ctx context.Context, scanner KeyScanner, pattern string, batch int64) iter.Seq2[[]string, error] {
+	if pattern == "" {
+		pattern = "*"
+	}
+	if batch <= 0 {
+		batch = defaultScanBatch
+	}
+	return func(yield func([]string, error) bool) {
+		var cursor uint64
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(nil, NewErrorWithCause(ErrorTypeTimeout, "key scan canceled", err))
+				return
+			}
+			keys, next, err := scanner.Scan(ctx, cursor, pattern, batch)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if len(keys) > 0 && !yield(keys, nil) {
+				return
+			}
+			if next == 0 {
+				return
+			}
+			cursor = next
+		}
+	}
+}
+
+// ScanKeys iterates over the keys matching pattern without blocking the server the
+// way KEYS does. batch is the count hint passed to each SCAN. As with Redis SCAN, a
+// key may be yielded more than once and keys changed during the scan may be missed.
+// The scan stops with an ErrorTypeTimeout error when ctx is done.
+// Example:
+//
+//	for key, err := range gpa.ScanKeys(ctx, repo, "session:*", 500) {
+//	    if err != nil { return err }
+//	    fmt.Println(key)
+//	}
+func ScanKeys(ctx context.Context, scanner KeyScanner, pattern string, batch int64) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		for keys, err := range scanPages(ctx, scanner, pattern, batch) {
+			if err != nil {
+				yield("", err)
+				return
+			}
+			for _, key := range keys {
+				if !yield(key, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// keyBatchGetter is the MGet half of BatchKeyValueRepository
+type keyBatchGetter[T any] interface {
+	MGet(ctx context.Context, keys []string) (map[string]*T, error)
+}
+
+// keyBatchDeleter is the MDelete half of BatchKeyValueRepository
+type keyBatchDeleter interface {
+	MDelete(ctx context.Context, keys []string) (int64, error)
+}
+
+// ScanValues iterates over the keys matching pattern with their values, fetching each
+// page of keys with a single MGet when scanner is a BatchKeyValueRepository[T] or a
+// BatchKeyValueProvider. Other KeyValueProviders are read with one Get per key. Provider
+// values are decoded with their codec. Keys that expire between the scan and the fetch
+// are skipped.
+// Example: for kv, err := range gpa.ScanValues[Session](ctx, repo, "session:*", 500) { ... }
+func ScanValues[T any](ctx context.Context, scanner KeyScanner, pattern string, batch int64) iter.Seq2[KeyValue[T], error] {
+	var fetch func(ctx context.Context, keys []string) (map[string]*T, error)
+	switch s := scanner.(type) {
+	case keyBatchGetter[T]:
+		fetch = s.MGet
+	case BatchKeyValueProvider:
+		fetch = func(ctx context.Context, keys []string) (map[string]*T, error) {
+			raw, err := s.MGet(ctx, keys)
+			if err != nil {
+				return nil, err
+			}
+			values := make(map[string]*T, len(raw))
+			for key, value := range raw {
+				decoded, err := decodeStored[T](value)
+				if IsNotFound(err) {
+					continue
+				}
+				if err != nil {
+					return nil, err
+				}
+				values[key] = decoded
+			}
+			return values, nil
+		}
+	case KeyValueProvider:
+		fetch = func(ctx context.Context, keys []string) (map[string]*T, error) {
+			values := make(map[string]*T, len(keys))
+			for _, key := range keys {
+				value, err := GetAs[T](ctx, s, key)
+				if IsNotFound(err) {
+					continue
+				}
+				if err != nil {
+					return nil, err
+				}
+				values[key] = value
+			}
+			return values, nil
+		}
+	default:
+		return func(yield func(KeyValue[T], error) bool) {
+			yield(KeyValue[T]{}, NewError(ErrorTypeUnsupported, "scanner cannot fetch values").WithEntity(entityName[T]()))
+		}
+	}
+
+	return func(yield func(KeyValue[T], error) bool) {
+		for keys, err := range scanPages(ctx, scanner, pattern, batch) {
+			if err != nil {
+				yield(KeyValue[T]{}, err)
+				return
+			}
+			values, err := fetch(ctx, keys)
+			if err != nil {
+				yield(KeyValue[T]{}, err)
+				return
+			}
+			for _, key := range keys {
+				value, ok := values[key]
+				if !ok {
+					continue
+				}
+				if !yield(KeyValue[T]{Key: key, Value: value}, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// DeletePattern deletes the keys matching pattern page by page, with MDelete when
+// scanner is a BatchKeyValueRepository or by key when it is a KeyValueProvider, and
+// returns how many were deleted. Keys the scan yields more than once are deleted once,
+// and keys already gone are not counted. An empty pattern is rejected rather than deleting
+// every key. When ctx is done the deletion stops, keeping what was already deleted.
+// Example: n, err := gpa.DeletePattern(ctx, repo, "cache:user:*", 1000)
+func DeletePattern(ctx context.Context, scanner KeyScanner, pattern string, batch int64) (int64, error) {
+	if pattern == "" {
+		return 0, NewError(ErrorTypeInvalidArgument, "pattern is required")
+	}
+
+	var remove func(ctx context.Context, keys []string) (int64, error)
+	switch s := scanner.(type) {
+	case keyBatchDeleter:
+		remove = s.MDelete
+	case KeyValueProvider:
+		remove = func(ctx context.Context, keys []string) (int64, error) {
+			var deleted int64
+			for _, key := range keys {
+				err := s.Delete(ctx, key)
+				if IsNotFound(err) {
+					continue
+				}
+				if err != nil {
+					return deleted, err
+				}
+				deleted++
+			}
+			return deleted, nil
+		}
+	default:
+		return 0, NewError(ErrorTypeUnsupported, "scanner cannot delete keys")
+	}
+
+	var deleted int64
+	seen := make(map[string]bool)
+	for page, err := range scanPages(ctx, scanner, pattern, batch) {
+		if err != nil {
+			return deleted, err
+		}
+		keys := make([]string, 0, len(page))
+		for _, key := range page {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		n, err := remove(ctx, keys)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,169 @@
+package gpa
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+)
+
+// batchScanRepository adds MGet and MDelete to a memory provider, like a Redis repository
+type batchScanRepository struct {
+	*MemoryProvider
+	mgets, mdeletes int
+}
+
+func (r *batchScanRepository) MGet(ctx context.Context, keys []string) (map[string]*codecSession, error) {
+	r.mgets++
+	values := map[string]*codecSession{}
+	for _, key := range keys {
+		if value, err := GetAs[codecSession](ctx, r.MemoryProvider, key); err == nil {
+			values[key] = value
+		}
+	}
+	return values, nil
+}
+
+func (r *batchScanRepository) MDelete(ctx context.Context, keys []string) (int64, error) {
+	r.mdeletes++
+	for _, key := range keys {
+		r.Delete(ctx, key)
+	}
+	return int64(len(keys)), nil
+}
+
+func seedScanKeys(t *testing.T, provider *MemoryProvider, n int) {
+	t.Helper()
+	ctx := context.Background()
+	for i := 0; i < n; i++ {
+		if err := SetAs(ctx, provider, fmt.Sprintf("session:%d", i), &codecSession{User: fmt.Sprint(i)}, 0); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	provider.Set(ctx, "user:1", "ada", 0)
+}
+
+func TestScanKeys(t *testing.T) {
+	provider := NewMemoryProvider()
+	seedScanKeys(t, provider, 25)
+
+	var keys []string
+	for key, err := range ScanKeys(context.Background(), provider, "session:*", 4) {
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) != 25 || keys[0] != "session:0" {
+		t.Errorf("Expected each of 25 session keys once, got %d: %v", len(keys), keys)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var seen int
+	var scanErr error
+	for _, err := range ScanKeys(ctx, provider, "*", 2) {
+		if err != nil {
+			scanErr = err
+			break
+		}
+		if seen++; seen == 1 {
+			cancel()
+		}
+	}
+	if !IsErrorType(scanErr, ErrorTypeTimeout) || seen >= 26 {
+		t.Errorf("Expected the scan to stop after cancel, got %v after %d keys", scanErr, seen)
+	}
+}
+
+func TestMemoryProvider_ScanStableUnderDeletes(t *testing.T) {
+	provider := NewMemoryProvider()
+	seedScanKeys(t, provider, 50)
+
+	deleted, err := DeletePattern(context.Background(), provider, "session:*", 3)
+	if err != nil || deleted != 50 {
+		t.Fatalf("Expected 50 deletions, got %d (%v)", deleted, err)
+	}
+	if keys, _ := provider.Keys(context.Background(), "*"); len(keys) != 1 || keys[0] != "user:1" {
+		t.Errorf("Expected only user:1 to remain, got %v", keys)
+	}
+	if _, err := DeletePattern(context.Background(), provider, "", 3); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected empty pattern to be rejected, got %v", err)
+	}
+}
+
+func TestScanValues(t *testing.T) {
+	ctx := context.Background()
+	provider := NewMemoryProvider()
+	seedScanKeys(t, provider, 10)
+
+	users := map[string]bool{}
+	for kv, err := range ScanValues[codecSession](ctx, provider, "session:*", 3) {
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		users[kv.Value.User] = true
+	}
+	if len(users) != 10 {
+		t.Errorf("Expected 10 decoded values, got %v", users)
+	}
+
+	repo := &batchScanRepository{MemoryProvider: provider}
+	var count int
+	for range ScanValues[codecSession](ctx, repo, "session:*", 5) {
+		count++
+	}
+	if count != 10 || repo.mgets < 2 {
+		t.Errorf("Expected 10 values fetched with paged MGets, got %d with %d calls", count, repo.mgets)
+	}
+	if n, err := DeletePattern(ctx, repo, "session:*", 5); err != nil || n != 10 || repo.mdeletes < 2 {
+		t.Errorf("Expected paged MDelete of 10 keys, got %d with %d calls (%v)", n, repo.mdeletes, err)
+	}
+}
+
+// repeatingScanner returns its keys twice, as SCAN may while a hash table grows, and
+// reports deletes of missing keys as not found. It has no MGet.
+type repeatingScanner struct {
+	KeyValueProvider
+	keys []string
+	gets int
+}
+
+func (s *repeatingScanner) Scan(ctx context.Context, cursor uint64, pattern string, count int64) ([]string, uint64, error) {
+	return s.keys, 1 - cursor, nil
+}
+
+func (s *repeatingScanner) Get(ctx context.Context, key string) (interface{}, error) {
+	s.gets++
+	return s.KeyValueProvider.Get(ctx, key)
+}
+
+func (s *repeatingScanner) Delete(ctx context.Context, key string) error {
+	if exists, _ := s.Exists(ctx, key); !exists {
+		return NewError(ErrorTypeNotFound, "key not found")
+	}
+	return s.KeyValueProvider.Delete(ctx, key)
+}
+
+func TestScanValues_PerKeyFallback(t *testing.T) {
+	ctx := context.Background()
+	provider := NewMemoryProvider()
+	seedScanKeys(t, provider, 3)
+	scanner := &repeatingScanner{KeyValueProvider: provider, keys: []string{"session:0", "session:1", "session:2", "session:gone"}}
+
+	var count int
+	for _, err := range ScanValues[codecSession](ctx, scanner, "session:*", 10) {
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		count++
+	}
+	if count != 6 || scanner.gets != 8 {
+		t.Errorf("Expected one Get per scanned key, got %d values from %d gets", count, scanner.gets)
+	}
+
+	if n, err := DeletePattern(ctx, scanner, "session:*", 10); err != nil || n != 3 {
+		t.Errorf("Expected 3 deletes without repeated or missing keys, got %d (%v)", n, err)
+	}
+}
@@ -0,0 +1,309 @@
+package gpa
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// =====================================
+// Full-Text Search Options
+// =====================================
+
+// RelevanceField is the order field used by OrderByRelevance. Providers sort it by
+// their native score: ts_rank, MATCH ... AGAINST, bm25 or MongoDB's textScore.
+const RelevanceField = "_relevance"
+
+// SearchCondition matches entities whose text fields contain any of the words in Text.
+// An empty Fields searches every text field (MongoDB always uses its text index).
+type SearchCondition struct {
+	Text   string
+	Fields []string
+}
+
+func (c SearchCondition) Field() string      { return strings.Join(c.Fields, ",") }
+func (c SearchCondition) Operator() Operator { return OpSearch }
+func (c SearchCondition) Value() interface{} { return c.Text }
+func (c SearchCondition) String() string {
+	return fmt.Sprintf("SEARCH(%s) %q", c.Field(), c.Text)
+}
+
+// Search matches entities whose fields contain any of the words in text.
+// Example: posts, err := repo.Query(ctx, gpa.Search("go generics", "title", "body"), gpa.OrderByRelevance())
+func Search(text string, fields ...string) QueryOption {
+	return ConditionOption{Condition: SearchCondition{Text: text, Fields: fields}}
+}
+
+// OrderByRelevance orders the results of a Search by relevance, best match first
+// Example: posts, err := repo.Query(ctx, gpa.Search("go"), gpa.OrderByRelevance(), gpa.Limit(10))
+func OrderByRelevance() QueryOption {
+	return OrderOption{Order: Order{Field: RelevanceField, Direction: OrderDesc}}
+}
+
+// TextScoreDocument is the MongoDB expression for the relevance of a $text match,
+// used in projections and as the sort value for RelevanceField.
+func TextScoreDocument() map[string]interface{} {
+	return map[string]interface{}{"$meta": "textScore"}
+}
+
+// =====================================
+// Scored Results
+// =====================================
+
+// Scored is a search result with its relevance score. Higher scores are better;
+// scores are only comparable within one query.
+type Scored[T any] struct {
+	Entity *T
+	Score  float64
+}
+
+// ScoredQuerier is implemented by repositories that can return relevance scores.
+// The repository decorators implement it by forwarding to the repository they wrap.
+type ScoredQuerier[T any] interface {
+	QueryScored(ctx context.Context, opts ...QueryOption) ([]Scored[T], error)
+}
+
+// QueryScored runs a query containing a Search condition and returns each entity with
+// its relevance score. Entities are scored 0 if the query has no Search condition.
+// Example: results, err := gpa.QueryScored(ctx, repo, gpa.Search("go"), gpa.OrderByRelevance())
+func QueryScored[T any](ctx context.Context, repo Repository[T], opts ...QueryOption) ([]Scored[T], error) {
+	querier, ok := repo.(ScoredQuerier[T])
+	if !ok {
+		return nil, NewError(ErrorTypeUnsupported, "repository does not return relevance scores").WithEntity(entityName[T]())
+	}
+	return querier.QueryScored(ctx, opts...)
+}
+
+// =====================================
+// SQL Translation
+// =====================================
+
+// SearchDialect selects the full-text functions used by SearchSQL
+type SearchDialect string
+
+const (
+	// SearchPostgres matches to_tsvector over the fields against an OR-ed tsquery
+	SearchPostgres SearchDialect = "postgres"
+	// SearchMySQL uses MATCH ... AGAINST in natural language mode; the fields need a FULLTEXT index
+	SearchMySQL SearchDialect = "mysql"
+	// SearchSQLite queries an FTS5 virtual table, optionally limited to the given columns
+	SearchSQLite SearchDialect = "sqlite"
+)
+
+// SearchSQL translates a SearchCondition to a SQL predicate with ? placeholders.
+// table is only used by SQLite, where it names the FTS5 table.
+// Example: clause, args, err := gpa.SearchSQL(gpa.SearchPostgres, "posts", condition)
+func SearchSQL(dialect SearchDialect, table string, condition SearchCondition) (string, []interface{}, error) {
+	expr, args, err := searchSQL(dialect, table, condition)
+	if err != nil {
+		return "", nil, err
+	}
+	switch dialect {
+	case SearchPostgres:
+		return expr[0] + " @@ " + expr[1], args, nil
+	case SearchMySQL:
+		return expr[0], args, nil
+	}
+	return expr[0] + " MATCH ?", args, nil
+}
+
+// RelevanceSQL returns an expression for the relevance of a SearchCondition match,
+// where higher is better, for use in ORDER BY ... DESC or as a selected score column.
+// Example: expr, args, err := gpa.RelevanceSQL(gpa.SearchMySQL, "posts", condition)
+func RelevanceSQL(dialect SearchDialect, table string, condition SearchCondition) (string, []interface{}, error) {
+	expr, args, err := searchSQL(dialect, table, condition)
+	if err != nil {
+		return "", nil, err
+	}
+	switch dialect {
+	case SearchPostgres:
+		return fmt.Sprintf("ts_rank(%s, %s)", expr[0], expr[1]), args, nil
+	case SearchMySQL:
+		return expr[0], args, nil
+	}
+	// bm25 is lower for better matches
+	return fmt.Sprintf("-bm25(%s)", table), nil, nil
+}
+
+// searchSQL validates the condition and returns the dialect's building blocks and arguments
+func searchSQL(dialect SearchDialect, table string, condition SearchCondition) ([]string, []interface{}, error) {
+	terms := searchTerms(condition.Text)
+	if len(terms) == 0 {
+		return nil, nil, NewError(ErrorTypeInvalidArgument, "search text has no words")
+	}
+	for _, field := range condition.Fields {
+		if !sqlIdentifier.MatchString(field) {
+			return nil, nil, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("invalid search column %q", field))
+		}
+	}
+	if dialect != SearchSQLite && len(condition.Fields) == 0 {
+		return nil, nil, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("%s search needs at least one field", dialect))
+	}
+
+	switch dialect {
+	case SearchPostgres:
+		vector := fmt.Sprintf("to_tsvector('simple', concat_ws(' ', %s))", strings.Join(condition.Fields, ", "))
+		return []string{vector, "to_tsquery('simple', ?)"}, []interface{}{strings.Join(terms, " | ")}, nil
+	case SearchMySQL:
+		match := fmt.Sprintf("MATCH(%s) AGAINST (? IN NATURAL LANGUAGE MODE)", strings.Join(condition.Fields, ", "))
+		return []string{match}, []interface{}{condition.Text}, nil
+	case SearchSQLite:
+		if !sqlIdentifier.MatchString(table) {
+			return nil, nil, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("invalid search table %q", table))
+		}
+		query := `"` + strings.Join(terms, `" OR "`) + `"`
+		if len(condition.Fields) > 0 {
+			query = "{" + strings.Join(condition.Fields, " ") + "} : (" + query + ")"
+		}
+		return []string{table}, []interface{}{query}, nil
+	}
+	return nil, nil, NewError(ErrorTypeUnsupported, fmt.Sprintf("unknown search dialect %q", dialect))
+}
+
+// =====================================
+// In-Memory Evaluation
+// =====================================
+
+// searchTerms splits text into lowercase words, dropping punctuation and duplicates
+func searchTerms(text string) []string {
+	seen := map[string]bool{}
+	var terms []string
+	for _, word := range tokenize(text) {
+		if !seen[word] {
+			seen[word] = true
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// tokenize splits text into lowercase words of letters and digits
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// searchableTokens returns the words of the given fields of entity, or of all its
+// string fields when fields is empty
+func searchableTokens(entity interface{}, fields []string) []string {
+	var tokens []string
+	if len(fields) > 0 {
+		for _, field := range fields {
+			if value, ok := resolveFieldPath(reflect.ValueOf(entity), field); ok {
+				tokens = appendTextTokens(tokens, value)
+			}
+		}
+		return tokens
+	}
+	return appendTextTokens(tokens, reflect.ValueOf(entity))
+}
+
+// appendTextTokens appends the words of every string found in value
+func appendTextTokens(tokens []string, value reflect.Value) []string {
+	value = indirectValue(value)
+	if !value.IsValid() {
+		return tokens
+	}
+	switch value.Kind() {
+	case reflect.String:
+		return append(tokens, tokenize(value.String())...)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			tokens = appendTextTokens(tokens, value.Index(i))
+		}
+	case reflect.Map:
+		for _, key := range value.MapKeys() {
+			tokens = appendTextTokens(tokens, value.MapIndex(key))
+		}
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).IsExported() {
+				tokens = appendTextTokens(tokens, value.Field(i))
+			}
+		}
+	}
+	return tokens
+}
+
+// matchSearch reports whether entity contains any word of the search text
+func matchSearch(entity interface{}, c SearchCondition) bool {
+	terms := searchTerms(c.Text)
+	for _, token := range searchableTokens(entity, c.Fields) {
+		for _, term := range terms {
+			if token == term {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// searchCondition returns the first top-level SearchCondition, if any
+func searchCondition(conditions []Condition) (SearchCondition, bool) {
+	for _, c := range conditions {
+		switch search := c.(type) {
+		case SearchCondition:
+			return search, true
+		case *SearchCondition:
+			return *search, true
+		}
+	}
+	return SearchCondition{}, false
+}
+
+// scoreEntities scores matched by TF-IDF of the search terms, with document
+// frequencies taken from corpus
+func scoreEntities[T any](corpus, matched []*T, c SearchCondition) map[*T]float64 {
+	type termCounts struct {
+		counts map[string]int
+		total  int
+	}
+	terms := searchTerms(c.Text)
+	frequency := make(map[*T]termCounts, len(corpus))
+	documents := map[string]int{}
+	for _, entity := range corpus {
+		tokens := searchableTokens(entity, c.Fields)
+		tc := termCounts{counts: map[string]int{}, total: len(tokens)}
+		for _, token := range tokens {
+			tc.counts[token]++
+		}
+		frequency[entity] = tc
+		for _, term := range terms {
+			if tc.counts[term] > 0 {
+				documents[term]++
+			}
+		}
+	}
+
+	scores := make(map[*T]float64, len(matched))
+	for _, entity := range matched {
+		tc, ok := frequency[entity]
+		if !ok || tc.total == 0 {
+			continue
+		}
+		var score float64
+		for _, term := range terms {
+			if documents[term] > 0 {
+				tf := float64(tc.counts[term]) / float64(tc.total)
+				score += tf * math.Log(1+float64(len(corpus))/float64(documents[term]))
+			}
+		}
+		scores[entity] = score
+	}
+	return scores
+}
+
+// compareScores compares two relevance scores
+func compareScores(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,136 @@
+package gpa
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type searchPost struct {
+	ID    int      `json:"id"`
+	Title string   `json:"title"`
+	Body  string   `json:"body"`
+	Tags  []string `json:"tags"`
+}
+
+func seedSearchPosts(t *testing.T) *MemoryRepository[searchPost] {
+	t.Helper()
+	repo := NewMemoryRepository[searchPost]()
+	err := repo.CreateBatch(context.Background(), []*searchPost{
+		{Title: "Cooking pasta", Body: "Boil water, add pasta."},
+		{Title: "Go generics", Body: "Type parameters in Go make generic code simpler. Go!"},
+		{Title: "Gardening", Body: "Water the plants", Tags: []string{"go", "outdoors"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return repo
+}
+
+func TestMemoryRepository_Search(t *testing.T) {
+	repo := seedSearchPosts(t)
+	ctx := context.Background()
+
+	posts, err := repo.Query(ctx, Search("GO, water!", "title", "body"), OrderBy("id", OrderAsc))
+	if err != nil || len(posts) != 3 {
+		t.Fatalf("Expected any-word matches in all posts, got %v (%v)", posts, err)
+	}
+	if count, _ := repo.Count(ctx, Search("go")); count != 2 {
+		t.Errorf("Expected search over all text fields to include tags, got %d", count)
+	}
+	if count, _ := repo.Count(ctx, Search("go", "title")); count != 1 {
+		t.Errorf("Expected search limited to title, got %d", count)
+	}
+
+	scored, err := QueryScored[searchPost](ctx, repo, Search("go water", "title", "body"), OrderByRelevance())
+	if err != nil || len(scored) != 3 {
+		t.Fatalf("Unexpected scored results: %v (%v)", scored, err)
+	}
+	if scored[0].Entity.Title != "Go generics" || scored[0].Score <= scored[1].Score || scored[2].Score <= 0 {
+		t.Errorf("Expected Go generics first with descending scores, got %+v %+v %+v", scored[0], scored[1], scored[2])
+	}
+
+	plain, _ := QueryScored[searchPost](ctx, repo, Limit(1))
+	if len(plain) != 1 || plain[0].Score != 0 {
+		t.Errorf("Expected zero scores without a search, got %+v", plain)
+	}
+	if _, err := QueryScored[searchPost](ctx, &mockRepository[searchPost]{}); !IsErrorType(err, ErrorTypeUnsupported) {
+		t.Errorf("Expected unsupported error, got %v", err)
+	}
+}
+
+func TestMemoryRepository_RelevanceOrderPosition(t *testing.T) {
+	repo := seedSearchPosts(t)
+	ctx := context.Background()
+
+	scored, err := QueryScored[searchPost](ctx, repo, Search("go water", "title", "body"), OrderBy("title", OrderAsc), OrderByRelevance())
+	if err != nil || len(scored) != 3 {
+		t.Fatalf("Unexpected scored results: %v (%v)", scored, err)
+	}
+	if scored[0].Entity.Title != "Cooking pasta" || scored[2].Entity.Title != "Go generics" {
+		t.Errorf("Expected title to sort before relevance, got %s, %s, %s", scored[0].Entity.Title, scored[1].Entity.Title, scored[2].Entity.Title)
+	}
+
+	scored, _ = QueryScored[searchPost](ctx, repo, Search("go water", "title", "body"), OrderByRelevance(), OrderBy("title", OrderAsc))
+	if scored[0].Entity.Title != "Go generics" {
+		t.Errorf("Expected relevance to sort first, got %s", scored[0].Entity.Title)
+	}
+}
+
+func TestQueryScored_Decorators(t *testing.T) {
+	var repo Repository[searchPost] = seedSearchPosts(t)
+	repo = NewValidatingRepository[searchPost](repo)
+	repo = NewAuditRepository[searchPost](repo, &memoryAuditSink{})
+	repo = NewGuardedRepository[searchPost](repo, NewProviderGuard(GuardConfig{}))
+	repo = NewRetryRepository[searchPost](repo, fastRetryPolicy(2))
+	repo = NewTracedRepository[searchPost](repo, NewRecordingTracer(), ProviderInfo{})
+
+	scored, err := QueryScored[searchPost](context.Background(), repo, Search("go"), OrderByRelevance())
+	if err != nil || len(scored) != 2 || scored[0].Entity.Title != "Go generics" || scored[0].Score <= 0 {
+		t.Errorf("Expected scores through the decorators, got %+v (%v)", scored, err)
+	}
+}
+
+func TestSearchSQL(t *testing.T) {
+	condition := SearchCondition{Text: "Go, generics go", Fields: []string{"title", "body"}}
+	tests := []struct {
+		dialect SearchDialect
+		clause  string
+		args    []interface{}
+	}{
+		{SearchPostgres, "to_tsvector('simple', concat_ws(' ', title, body)) @@ to_tsquery('simple', ?)", []interface{}{"go | generics"}},
+		{SearchMySQL, "MATCH(title, body) AGAINST (? IN NATURAL LANGUAGE MODE)", []interface{}{"Go, generics go"}},
+		{SearchSQLite, "posts_fts MATCH ?", []interface{}{`{title body} : ("go" OR "generics")`}},
+	}
+	for _, test := range tests {
+		clause, args, err := SearchSQL(test.dialect, "posts_fts", condition)
+		if err != nil || clause != test.clause || !reflect.DeepEqual(args, test.args) {
+			t.Errorf("%s: expected %s %v, got %s %v (%v)", test.dialect, test.clause, test.args, clause, args, err)
+		}
+	}
+
+	if expr, _, _ := RelevanceSQL(SearchPostgres, "", condition); expr != "ts_rank(to_tsvector('simple', concat_ws(' ', title, body)), to_tsquery('simple', ?))" {
+		t.Errorf("Unexpected Postgres relevance: %s", expr)
+	}
+	if expr, args, _ := RelevanceSQL(SearchSQLite, "posts_fts", condition); expr != "-bm25(posts_fts)" || args != nil {
+		t.Errorf("Unexpected SQLite relevance: %s %v", expr, args)
+	}
+
+	if _, _, err := SearchSQL(SearchMySQL, "", SearchCondition{Text: "go"}); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected missing field error, got %v", err)
+	}
+	if _, _, err := SearchSQL(SearchPostgres, "", SearchCondition{Text: "?!", Fields: []string{"title"}}); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected empty search error, got %v", err)
+	}
+	if _, _, err := SearchSQL(SearchPostgres, "", SearchCondition{Text: "go", Fields: []string{"title) OR (1=1"}}); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected invalid column error, got %v", err)
+	}
+}
+
+func TestConditionDocument_Search(t *testing.T) {
+	doc, err := ConditionDocument(SearchCondition{Text: "go generics"})
+	expected := map[string]interface{}{"$text": map[string]interface{}{"$search": "go generics"}}
+	if err != nil || !reflect.DeepEqual(doc, expected) {
+		t.Errorf("Expected %v, got %v (%v)", expected, doc, err)
+	}
+}
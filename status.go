@@ -0,0 +1,251 @@
+package gpa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// =====================================
+// HTTP and gRPC Status Mapping
+// =====================================
+
+// GRPCCode mirrors the canonical gRPC status codes (google.golang.org/grpc/codes)
+// so that the core package does not depend on gRPC. Convert with codes.Code(c).
+type GRPCCode uint32
+
+const (
+	GRPCOK                 GRPCCode = 0
+	GRPCCanceled           GRPCCode = 1
+	GRPCUnknown            GRPCCode = 2
+	GRPCInvalidArgument    GRPCCode = 3
+	GRPCDeadlineExceeded   GRPCCode = 4
+	GRPCNotFound           GRPCCode = 5
+	GRPCAlreadyExists      GRPCCode = 6
+	GRPCPermissionDenied   GRPCCode = 7
+	GRPCResourceExhausted  GRPCCode = 8
+	GRPCFailedPrecondition GRPCCode = 9
+	GRPCAborted            GRPCCode = 10
+	GRPCOutOfRange         GRPCCode = 11
+	GRPCUnimplemented      GRPCCode = 12
+	GRPCInternal           GRPCCode = 13
+	GRPCUnavailable        GRPCCode = 14
+	GRPCDataLoss           GRPCCode = 15
+	GRPCUnauthenticated    GRPCCode = 16
+)
+
+var grpcCodeNames = map[GRPCCode]string{
+	GRPCOK:                 "OK",
+	GRPCCanceled:           "CANCELLED",
+	GRPCUnknown:            "UNKNOWN",
+	GRPCInvalidArgument:    "INVALID_ARGUMENT",
+	GRPCDeadlineExceeded:   "DEADLINE_EXCEEDED",
+	GRPCNotFound:           "NOT_FOUND",
+	GRPCAlreadyExists:      "ALREADY_EXISTS",
+	GRPCPermissionDenied:   "PERMISSION_DENIED",
+	GRPCResourceExhausted:  "RESOURCE_EXHAUSTED",
+	GRPCFailedPrecondition: "FAILED_PRECONDITION",
+	GRPCAborted:            "ABORTED",
+	GRPCOutOfRange:         "OUT_OF_RANGE",
+	GRPCUnimplemented:      "UNIMPLEMENTED",
+	GRPCInternal:           "INTERNAL",
+	GRPCUnavailable:        "UNAVAILABLE",
+	GRPCDataLoss:           "DATA_LOSS",
+	GRPCUnauthenticated:    "UNAUTHENTICATED",
+}
+
+// String returns the canonical name of the code, e.g. "NOT_FOUND"
+func (c GRPCCode) String() string {
+	if name, ok := grpcCodeNames[c]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
+
+// StatusMapping describes how an ErrorType is reported over HTTP and gRPC
+type StatusMapping struct {
+	HTTPStatus int
+	GRPCCode   GRPCCode
+	// Title is the problem title; defaults to the HTTP status text
+	Title string
+	// TypeURI is the problem type URI; defaults to "about:blank"
+	TypeURI string
+}
+
+// ProblemRenderer builds the problem details for a GPAError.
+// Register one with RegisterProblemRenderer to customise the response for an ErrorType.
+type ProblemRenderer func(err GPAError) ProblemDetails
+
+var (
+	statusMutex           sync.RWMutex
+	statusMappingOverride = make(map[ErrorType]StatusMapping)
+	problemRenderers      = make(map[ErrorType]ProblemRenderer)
+
+	defaultStatusMappings = map[ErrorType]StatusMapping{
+		ErrorTypeValidation:      {HTTPStatus: http.StatusUnprocessableEntity, GRPCCode: GRPCInvalidArgument},
+		ErrorTypeNotFound:        {HTTPStatus: http.StatusNotFound, GRPCCode: GRPCNotFound},
+		ErrorTypeDuplicate:       {HTTPStatus: http.StatusConflict, GRPCCode: GRPCAlreadyExists},
+		ErrorTypeConnection:      {HTTPStatus: http.StatusServiceUnavailable, GRPCCode: GRPCUnavailable},
+		ErrorTypeTimeout:         {HTTPStatus: http.StatusGatewayTimeout, GRPCCode: GRPCDeadlineExceeded},
+		ErrorTypePermission:      {HTTPStatus: http.StatusForbidden, GRPCCode: GRPCPermissionDenied},
+		ErrorTypeConstraint:      {HTTPStatus: http.StatusConflict, GRPCCode: GRPCFailedPrecondition},
+		ErrorTypeTransaction:     {HTTPStatus: http.StatusConflict, GRPCCode: GRPCAborted},
+		ErrorTypeUnsupported:     {HTTPStatus: http.StatusNotImplemented, GRPCCode: GRPCUnimplemented},
+		ErrorTypeInternal:        {HTTPStatus: http.StatusInternalServerError, GRPCCode: GRPCInternal},
+		ErrorTypeSerialization:   {HTTPStatus: http.StatusInternalServerError, GRPCCode: GRPCInternal},
+		ErrorTypeInvalidArgument: {HTTPStatus: http.StatusBadRequest, GRPCCode: GRPCInvalidArgument},
+		ErrorTypeDatabase:        {HTTPStatus: http.StatusInternalServerError, GRPCCode: GRPCInternal},
+		ErrorTypeLocked:          {HTTPStatus: http.StatusLocked, GRPCCode: GRPCAborted},
+	}
+)
+
+// RegisterStatusMapping overrides the status mapping for an ErrorType.
+// Example: gpa.RegisterStatusMapping(gpa.ErrorTypeValidation, gpa.StatusMapping{HTTPStatus: 400, GRPCCode: gpa.GRPCInvalidArgument})
+func RegisterStatusMapping(errorType ErrorType, mapping StatusMapping) {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+	statusMappingOverride[errorType] = mapping
+}
+
+// RegisterProblemRenderer overrides how problem details are rendered for an ErrorType.
+// Passing a nil renderer restores the default rendering.
+func RegisterProblemRenderer(errorType ErrorType, renderer ProblemRenderer) {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+	if renderer == nil {
+		delete(problemRenderers, errorType)
+		return
+	}
+	problemRenderers[errorType] = renderer
+}
+
+// ResetStatusMappings removes all registered status mappings and problem renderers
+func ResetStatusMappings() {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+	statusMappingOverride = make(map[ErrorType]StatusMapping)
+	problemRenderers = make(map[ErrorType]ProblemRenderer)
+}
+
+// StatusMappingFor returns the status mapping for an ErrorType.
+// Unknown types map to 500 / INTERNAL.
+func StatusMappingFor(errorType ErrorType) StatusMapping {
+	statusMutex.RLock()
+	mapping, ok := statusMappingOverride[errorType]
+	statusMutex.RUnlock()
+	if !ok {
+		mapping, ok = defaultStatusMappings[errorType]
+	}
+	if !ok {
+		mapping = StatusMapping{HTTPStatus: http.StatusInternalServerError, GRPCCode: GRPCInternal}
+	}
+	if mapping.Title == "" {
+		mapping.Title = http.StatusText(mapping.HTTPStatus)
+	}
+	if mapping.TypeURI == "" {
+		mapping.TypeURI = "about:blank"
+	}
+	return mapping
+}
+
+// HTTPStatus returns the HTTP status code for err.
+// Returns 200 for nil, and 500 for errors that contain no GPAError.
+// Example: w.WriteHeader(gpa.HTTPStatus(err))
+func HTTPStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	return statusMappingForError(err).HTTPStatus
+}
+
+// GRPCStatusCode returns the gRPC status code for err.
+// Returns OK for nil, and INTERNAL for errors that contain no GPAError.
+// Example: status.Error(codes.Code(gpa.GRPCStatusCode(err)), err.Error())
+func GRPCStatusCode(err error) GRPCCode {
+	if err == nil {
+		return GRPCOK
+	}
+	return statusMappingForError(err).GRPCCode
+}
+
+func statusMappingForError(err error) StatusMapping {
+	if gpaErr, ok := AsGPAError(err); ok {
+		return StatusMappingFor(gpaErr.Type)
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return StatusMappingFor(ErrorTypeTimeout)
+	case errors.Is(err, context.Canceled):
+		return StatusMapping{HTTPStatus: 499, GRPCCode: GRPCCanceled, Title: "Client Closed Request", TypeURI: "about:blank"}
+	}
+	return StatusMappingFor(ErrorTypeInternal)
+}
+
+// =====================================
+// RFC 7807 Problem Details
+// =====================================
+
+// ProblemContentType is the media type of problem details responses
+const ProblemContentType = "application/problem+json"
+
+// ProblemDetails is an RFC 7807 problem details object.
+// Besides the standard members it carries the error code, the involved
+// fields and, for validation errors, the individual field violations.
+type ProblemDetails struct {
+	Type     string           `json:"type"`
+	Title    string           `json:"title"`
+	Status   int              `json:"status"`
+	Detail   string           `json:"detail,omitempty"`
+	Instance string           `json:"instance,omitempty"`
+	Code     string           `json:"code,omitempty"`
+	Fields   []string         `json:"fields,omitempty"`
+	Errors   []FieldViolation `json:"errors,omitempty"`
+}
+
+// NewProblemDetails renders err as problem details.
+// The detail is the GPAError message, which TranslateError keeps generic; the cause is
+// never exposed, since it may contain driver internals. Errors that contain no GPAError
+// render as a generic 500.
+func NewProblemDetails(err error) ProblemDetails {
+	gpaErr, ok := AsGPAError(err)
+	if !ok {
+		mapping := statusMappingForError(err)
+		return ProblemDetails{Type: mapping.TypeURI, Title: mapping.Title, Status: mapping.HTTPStatus}
+	}
+
+	statusMutex.RLock()
+	renderer := problemRenderers[gpaErr.Type]
+	statusMutex.RUnlock()
+	if renderer != nil {
+		return renderer(gpaErr)
+	}
+
+	mapping := StatusMappingFor(gpaErr.Type)
+	problem := ProblemDetails{
+		Type:   mapping.TypeURI,
+		Title:  mapping.Title,
+		Status: mapping.HTTPStatus,
+		Detail: gpaErr.Message,
+		Code:   gpaErr.Code,
+		Fields: gpaErr.Fields(),
+		Errors: gpaErr.Violations(),
+	}
+	if problem.Code == "" {
+		problem.Code = string(gpaErr.Type)
+	}
+	return problem
+}
+
+// WriteProblem writes err to w as an application/problem+json response.
+// Example: gpa.WriteProblem(w, err)
+func WriteProblem(w http.ResponseWriter, err error) error {
+	problem := NewProblemDetails(err)
+	if problem.Status == 0 {
+		problem.Status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+	return json.NewEncoder(w).Encode(problem)
+}
@@ -0,0 +1,147 @@
+package gpa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPStatusAndGRPCCode(t *testing.T) {
+	tests := []struct {
+		errorType ErrorType
+		http      int
+		grpc      GRPCCode
+	}{
+		{ErrorTypeNotFound, 404, GRPCNotFound},
+		{ErrorTypeDuplicate, 409, GRPCAlreadyExists},
+		{ErrorTypeValidation, 422, GRPCInvalidArgument},
+		{ErrorTypeInvalidArgument, 400, GRPCInvalidArgument},
+		{ErrorTypePermission, 403, GRPCPermissionDenied},
+		{ErrorTypeConnection, 503, GRPCUnavailable},
+		{ErrorTypeTimeout, 504, GRPCDeadlineExceeded},
+		{ErrorTypeTransaction, 409, GRPCAborted},
+		{ErrorTypeUnsupported, 501, GRPCUnimplemented},
+		{ErrorTypeDatabase, 500, GRPCInternal},
+		{ErrorTypeLocked, 423, GRPCAborted},
+	}
+
+	for _, tt := range tests {
+		err := fmt.Errorf("wrapped: %w", NewError(tt.errorType, "boom"))
+		if got := HTTPStatus(err); got != tt.http {
+			t.Errorf("%s: expected HTTP %d, got %d", tt.errorType, tt.http, got)
+		}
+		if got := GRPCStatusCode(err); got != tt.grpc {
+			t.Errorf("%s: expected gRPC %s, got %s", tt.errorType, tt.grpc, got)
+		}
+	}
+
+	if HTTPStatus(nil) != 200 || GRPCStatusCode(nil) != GRPCOK {
+		t.Error("Expected nil error to map to OK")
+	}
+	if HTTPStatus(errors.New("plain")) != 500 {
+		t.Error("Expected plain errors to map to 500")
+	}
+	if GRPCStatusCode(context.DeadlineExceeded) != GRPCDeadlineExceeded {
+		t.Error("Expected context deadline to map to DEADLINE_EXCEEDED")
+	}
+	if GRPCNotFound.String() != "NOT_FOUND" {
+		t.Errorf("Expected NOT_FOUND, got %s", GRPCNotFound.String())
+	}
+}
+
+func TestRegisterStatusMapping(t *testing.T) {
+	defer ResetStatusMappings()
+
+	RegisterStatusMapping(ErrorTypeValidation, StatusMapping{HTTPStatus: 400, GRPCCode: GRPCInvalidArgument, TypeURI: "https://example.com/validation"})
+
+	err := NewError(ErrorTypeValidation, "bad input")
+	if HTTPStatus(err) != 400 {
+		t.Errorf("Expected overridden status 400, got %d", HTTPStatus(err))
+	}
+	problem := NewProblemDetails(err)
+	if problem.Type != "https://example.com/validation" || problem.Title != "Bad Request" {
+		t.Errorf("Unexpected problem: %+v", problem)
+	}
+
+	ResetStatusMappings()
+	if HTTPStatus(err) != 422 {
+		t.Errorf("Expected default status after reset, got %d", HTTPStatus(err))
+	}
+}
+
+func TestNewProblemDetails(t *testing.T) {
+	err := NewErrorWithCause(ErrorTypeValidation, "user is invalid", errors.New("driver secret")).
+		WithViolations(
+			FieldViolation{Field: "email", Rule: "email", Message: "must be a valid email"},
+			FieldViolation{Field: "age", Rule: "min", Message: "must be at least 18"},
+		)
+
+	problem := NewProblemDetails(err)
+	if problem.Status != 422 || problem.Type != "about:blank" || problem.Title != "Unprocessable Entity" {
+		t.Errorf("Unexpected problem header: %+v", problem)
+	}
+	if problem.Detail != "user is invalid" || problem.Code != "validation" {
+		t.Errorf("Expected message as detail and type as code, got %+v", problem)
+	}
+	if len(problem.Errors) != 2 || problem.Errors[1].Field != "age" {
+		t.Errorf("Expected field violations, got %+v", problem.Errors)
+	}
+
+	plain := NewProblemDetails(errors.New("driver secret"))
+	if plain.Status != 500 || plain.Detail != "" {
+		t.Errorf("Expected generic 500 without detail, got %+v", plain)
+	}
+	translated := NewProblemDetails(AnnotateError(&pqError{Code: "23505", Message: `duplicate key value violates unique constraint "users_email_key"`, Detail: "Key (email)=(a@b.c) already exists."}, "Create", "users"))
+	if translated.Status != 409 || strings.Contains(translated.Detail, "users_email_key") || strings.Contains(translated.Detail, "a@b.c") {
+		t.Errorf("Expected driver text kept out of the detail, got %+v", translated)
+	}
+}
+
+func TestRegisterProblemRenderer(t *testing.T) {
+	defer ResetStatusMappings()
+
+	RegisterProblemRenderer(ErrorTypeNotFound, func(err GPAError) ProblemDetails {
+		return ProblemDetails{Type: "https://example.com/not-found", Title: "Missing", Status: 404, Detail: err.Entity}
+	})
+
+	problem := NewProblemDetails(NewError(ErrorTypeNotFound, "gone").WithEntity("users"))
+	if problem.Title != "Missing" || problem.Detail != "users" {
+		t.Errorf("Expected custom renderer output, got %+v", problem)
+	}
+
+	RegisterProblemRenderer(ErrorTypeNotFound, nil)
+	if NewProblemDetails(NewError(ErrorTypeNotFound, "gone")).Title != "Not Found" {
+		t.Error("Expected nil renderer to restore default rendering")
+	}
+}
+
+func TestWriteProblem(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	err := WriteProblem(recorder, NewError(ErrorTypeDuplicate, "email taken").WithFields("email"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if recorder.Code != http.StatusConflict {
+		t.Errorf("Expected 409, got %d", recorder.Code)
+	}
+	if ct := recorder.Header().Get("Content-Type"); ct != ProblemContentType {
+		t.Errorf("Expected problem content type, got %s", ct)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if body["detail"] != "email taken" || body["status"] != float64(409) {
+		t.Errorf("Unexpected body: %v", body)
+	}
+	if _, exists := body["errors"]; exists {
+		t.Error("Expected errors member to be omitted when there are no violations")
+	}
+}
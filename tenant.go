@@ -0,0 +1,632 @@
+package gpa
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// =====================================
+// Tenant Context
+// =====================================
+
+type tenantContextKey struct{}
+
+// WithTenant returns a context carrying the tenant id.
+// Example: ctx = gpa.WithTenant(ctx, "acme")
+func WithTenant(ctx context.Context, tenantID interface{}) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant id stored by WithTenant.
+// Returns false if the context carries no tenant, or a nil one.
+func TenantFromContext(ctx context.Context) (interface{}, bool) {
+	tenantID := ctx.Value(tenantContextKey{})
+	return tenantID, tenantID != nil
+}
+
+// requireTenant returns the tenant in ctx, or a permission error if there is none.
+// Scoped repositories fail closed: without a tenant nothing is read or written.
+func requireTenant(ctx context.Context) (interface{}, error) {
+	tenantID, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil, NewError(ErrorTypePermission, "no tenant in context")
+	}
+	return tenantID, nil
+}
+
+// =====================================
+// Tenant Scoped Repository
+// =====================================
+
+// TenantConfig configures tenant scoping
+type TenantConfig struct {
+	// Field is the tenant column used in query conditions. Defaults to "tenant_id".
+	// The entity's struct field is matched by Go name or json, db, bson or gorm column tag.
+	Field string
+
+	// AllowRawQueries lets RawQuery and RawExec through unscoped.
+	// They are rejected by default because the tenant condition cannot be injected into raw SQL.
+	AllowRawQueries bool
+}
+
+// tenantRepository scopes every operation to the tenant in the context
+type tenantRepository[T any] struct {
+	repo   Repository[T]
+	config TenantConfig
+	info   func() *EntityInfo
+}
+
+// NewTenantRepository wraps repo so that every operation is scoped to the tenant in the context.
+// Queries, counts and condition deletes get a tenant condition; Create stamps the tenant field;
+// FindByID, Update, UpdatePartial and Delete only touch rows owned by the tenant. Rows of other
+// tenants are reported as not found, and writes that would move a row to another tenant are rejected.
+// Example: repo = NewTenantRepository(repo, TenantConfig{Field: "tenant_id"})
+func NewTenantRepository[T any](repo Repository[T], config TenantConfig) Repository[T] {
+	if config.Field == "" {
+		config.Field = "tenant_id"
+	}
+	return &tenantRepository[T]{
+		repo:   repo,
+		config: config,
+		info: sync.OnceValue(func() *EntityInfo {
+			info, err := repo.GetEntityInfo()
+			if err != nil {
+				return nil
+			}
+			return info
+		}),
+	}
+}
+
+// scope appends the tenant condition to opts
+func (r *tenantRepository[T]) scope(ctx context.Context, opts []QueryOption) ([]QueryOption, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	scoped := make([]QueryOption, 0, len(opts)+1)
+	scoped = append(scoped, opts...)
+	return append(scoped, Where(r.config.Field, OpEqual, tenantID)), nil
+}
+
+// tenantField returns the entity's tenant field. A nil pointer field is allocated
+// when allocate is set, and returned as an invalid Value otherwise.
+func (r *tenantRepository[T]) tenantField(entity *T, allocate bool) (reflect.Value, error) {
+	value := reflect.ValueOf(entity).Elem()
+	if value.Kind() != reflect.Struct {
+		return reflect.Value{}, NewError(ErrorTypeInvalidArgument, "tenant scoping requires a struct entity")
+	}
+	field, _, ok := lookupStructField(value, r.config.Field)
+	if !ok {
+		return reflect.Value{}, NewError(ErrorTypeInvalidArgument,
+			fmt.Sprintf("entity %s has no tenant field %q", value.Type().Name(), r.config.Field))
+	}
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			if !allocate {
+				return reflect.Value{}, nil
+			}
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+		field = field.Elem()
+	}
+	return field, nil
+}
+
+// stamp sets the tenant field of entity, rejecting entities that belong to another tenant
+func (r *tenantRepository[T]) stamp(entity *T, tenantID interface{}) error {
+	if entity == nil {
+		return NewError(ErrorTypeInvalidArgument, "entity cannot be nil")
+	}
+	field, err := r.tenantField(entity, true)
+	if err != nil {
+		return err
+	}
+	tenantValue, err := convertTenantID(tenantID, field.Type())
+	if err != nil {
+		return err
+	}
+	if !field.IsZero() && !field.Equal(tenantValue) {
+		return NewError(ErrorTypePermission, "cross-tenant write rejected").WithEntity(entityName[T]())
+	}
+	field.Set(tenantValue)
+	return nil
+}
+
+// ownedBy reports whether entity belongs to the tenant
+func (r *tenantRepository[T]) ownedBy(entity *T, tenantID interface{}) (bool, error) {
+	field, err := r.tenantField(entity, false)
+	if err != nil || !field.IsValid() {
+		return false, err
+	}
+	tenantValue, err := convertTenantID(tenantID, field.Type())
+	if err != nil {
+		return false, err
+	}
+	return field.Equal(tenantValue), nil
+}
+
+// entityPrimaryKey returns the value of the entity's primary key, using the first
+// primary key in info if available and falling back to an "ID" field
+func entityPrimaryKey(entity interface{}, info *EntityInfo) (interface{}, error) {
+	names := []string{"ID", "id"}
+	if info != nil && len(info.PrimaryKey) > 0 {
+		names = info.PrimaryKey[:1]
+	}
+	value := indirectValue(reflect.ValueOf(entity))
+	if value.Kind() == reflect.Struct {
+		for _, name := range names {
+			if field, _, ok := lookupStructField(value, name); ok {
+				return field.Interface(), nil
+			}
+		}
+	}
+	return nil, NewError(ErrorTypeInvalidArgument, "cannot determine the entity's primary key")
+}
+
+// convertTenantID converts the context tenant id to the type of the tenant field.
+// Only same-kind conversions are allowed, so an int tenant never silently becomes a rune string.
+func convertTenantID(tenantID interface{}, fieldType reflect.Type) (reflect.Value, error) {
+	value := reflect.ValueOf(tenantID)
+	if value.Type().AssignableTo(fieldType) {
+		return value, nil
+	}
+	if value.Type().ConvertibleTo(fieldType) && sameKindFamily(value.Kind(), fieldType.Kind()) {
+		return value.Convert(fieldType), nil
+	}
+	return reflect.Value{}, NewError(ErrorTypeInvalidArgument,
+		fmt.Sprintf("tenant id of type %T cannot be stored in a %s field", tenantID, fieldType))
+}
+
+// sameKindFamily reports whether both kinds are strings, or both are numbers
+func sameKindFamily(a, b reflect.Kind) bool {
+	isNumber := func(k reflect.Kind) bool { return k >= reflect.Int && k <= reflect.Float64 }
+	return (a == reflect.String && b == reflect.String) || (isNumber(a) && isNumber(b))
+}
+
+func (r *tenantRepository[T]) Create(ctx context.Context, entity *T) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	if err := r.stamp(entity, tenantID); err != nil {
+		return err
+	}
+	return r.repo.Create(ctx, entity)
+}
+
+func (r *tenantRepository[T]) CreateBatch(ctx context.Context, entities []*T) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	for _, entity := range entities {
+		if err := r.stamp(entity, tenantID); err != nil {
+			return err
+		}
+	}
+	return r.repo.CreateBatch(ctx, entities)
+}
+
+// FindByID returns a not found error for entities owned by another tenant
+func (r *tenantRepository[T]) FindByID(ctx context.Context, id interface{}) (*T, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entity, err := r.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	owned, err := r.ownedBy(entity, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if !owned {
+		return nil, NewError(ErrorTypeNotFound, "entity not found").WithEntity(entityName[T]())
+	}
+	return entity, nil
+}
+
+func (r *tenantRepository[T]) FindAll(ctx context.Context, opts ...QueryOption) ([]*T, error) {
+	scoped, err := r.scope(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return r.repo.FindAll(ctx, scoped...)
+}
+
+// Update rejects entities that belong to another tenant, or whose stored row does
+func (r *tenantRepository[T]) Update(ctx context.Context, entity *T) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	if err := r.stamp(entity, tenantID); err != nil {
+		return err
+	}
+	id, err := entityPrimaryKey(entity, r.info())
+	if err != nil {
+		return err
+	}
+	if _, err := r.FindByID(ctx, id); err != nil {
+		return err
+	}
+	return r.repo.Update(ctx, entity)
+}
+
+// UpdatePartial rejects updates to rows of other tenants and updates that change the tenant field
+func (r *tenantRepository[T]) UpdatePartial(ctx context.Context, id interface{}, updates map[string]interface{}) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	var zero T
+	if _, sf, ok := lookupStructField(reflect.ValueOf(&zero).Elem(), r.config.Field); ok {
+		for key, value := range updates {
+			if (key == r.config.Field || fieldMatchesName(sf, key)) && fmt.Sprint(value) != fmt.Sprint(tenantID) {
+				return NewError(ErrorTypePermission, "cross-tenant write rejected").WithEntity(entityName[T]())
+			}
+		}
+	}
+	if _, err := r.FindByID(ctx, id); err != nil {
+		return err
+	}
+	return r.repo.UpdatePartial(ctx, id, updates)
+}
+
+func (r *tenantRepository[T]) Delete(ctx context.Context, id interface{}) error {
+	if _, err := r.FindByID(ctx, id); err != nil {
+		return err
+	}
+	return r.repo.Delete(ctx, id)
+}
+
+func (r *tenantRepository[T]) DeleteByCondition(ctx context.Context, condition Condition) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	scoped := CompositeCondition{
+		Conditions: []Condition{condition, WhereCondition(r.config.Field, OpEqual, tenantID)},
+		Logic:      LogicAnd,
+	}
+	return r.repo.DeleteByCondition(ctx, scoped)
+}
+
+func (r *tenantRepository[T]) Query(ctx context.Context, opts ...QueryOption) ([]*T, error) {
+	scoped, err := r.scope(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return r.repo.Query(ctx, scoped...)
+}
+
+func (r *tenantRepository[T]) QueryScored(ctx context.Context, opts ...QueryOption) ([]Scored[T], error) {
+	scoped, err := r.scope(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return QueryScored(ctx, r.repo, scoped...)
+}
+
+func (r *tenantRepository[T]) QueryOne(ctx context.Context, opts ...QueryOption) (*T, error) {
+	scoped, err := r.scope(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return r.repo.QueryOne(ctx, scoped...)
+}
+
+func (r *tenantRepository[T]) Count(ctx context.Context, opts ...QueryOption) (int64, error) {
+	scoped, err := r.scope(ctx, opts)
+	if err != nil {
+		return 0, err
+	}
+	return r.repo.Count(ctx, scoped...)
+}
+
+func (r *tenantRepository[T]) Exists(ctx context.Context, opts ...QueryOption) (bool, error) {
+	scoped, err := r.scope(ctx, opts)
+	if err != nil {
+		return false, err
+	}
+	return r.repo.Exists(ctx, scoped...)
+}
+
+func (r *tenantRepository[T]) Transaction(ctx context.Context, fn TransactionFunc[T]) error {
+	if _, err := requireTenant(ctx); err != nil {
+		return err
+	}
+	return r.repo.Transaction(ctx, func(tx Transaction[T]) error {
+		return fn(&tenantTransaction[T]{
+			tenantRepository: tenantRepository[T]{repo: tx, config: r.config, info: r.info},
+			tx:               tx,
+		})
+	})
+}
+
+// RawQuery is rejected unless TenantConfig.AllowRawQueries is set
+func (r *tenantRepository[T]) RawQuery(ctx context.Context, query string, args []interface{}) ([]*T, error) {
+	if !r.config.AllowRawQueries {
+		return nil, NewError(ErrorTypePermission, "raw queries are not tenant scoped")
+	}
+	if _, err := requireTenant(ctx); err != nil {
+		return nil, err
+	}
+	return r.repo.RawQuery(ctx, query, args)
+}
+
+// RawExec is rejected unless TenantConfig.AllowRawQueries is set
+func (r *tenantRepository[T]) RawExec(ctx context.Context, query string, args []interface{}) (Result, error) {
+	if !r.config.AllowRawQueries {
+		return nil, NewError(ErrorTypePermission, "raw queries are not tenant scoped")
+	}
+	if _, err := requireTenant(ctx); err != nil {
+		return nil, err
+	}
+	return r.repo.RawExec(ctx, query, args)
+}
+
+func (r *tenantRepository[T]) GetEntityInfo() (*EntityInfo, error) {
+	return r.repo.GetEntityInfo()
+}
+
+func (r *tenantRepository[T]) Close() error {
+	return r.repo.Close()
+}
+
+// tenantTransaction scopes operations executed inside a transaction
+type tenantTransaction[T any] struct {
+	tenantRepository[T]
+	tx Transaction[T]
+}
+
+func (t *tenantTransaction[T]) Commit() error                  { return t.tx.Commit() }
+func (t *tenantTransaction[T]) Rollback() error                { return t.tx.Rollback() }
+func (t *tenantTransaction[T]) SetSavepoint(name string) error { return t.tx.SetSavepoint(name) }
+func (t *tenantTransaction[T]) RollbackToSavepoint(name string) error {
+	return t.tx.RollbackToSavepoint(name)
+}
+
+// =====================================
+// Tenant Routing
+// =====================================
+
+// TenantRouter resolves the provider instance of the tenant in the context,
+// for deployments that give each tenant its own database.
+type TenantRouter struct {
+	registry     *ProviderRegistry
+	providerType string
+	instanceFor  func(tenantID interface{}) string
+}
+
+// NewTenantRouter creates a router over the instances of providerType in registry.
+// instanceFor maps a tenant id to an instance name; nil uses the tenant id itself.
+// Tenants without a registered instance are rejected; there is no fallback to "default".
+// Example: router := gpa.NewTenantRouter(gpa.Registry(), "postgres", nil)
+func NewTenantRouter(registry *ProviderRegistry, providerType string, instanceFor func(tenantID interface{}) string) *TenantRouter {
+	if instanceFor == nil {
+		instanceFor = func(tenantID interface{}) string { return fmt.Sprint(tenantID) }
+	}
+	return &TenantRouter{registry: registry, providerType: providerType, instanceFor: instanceFor}
+}
+
+// Instance returns the instance name for the tenant in the context
+func (r *TenantRouter) Instance(ctx context.Context) (string, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return "", err
+	}
+	return r.instanceFor(tenantID), nil
+}
+
+// Provider returns the provider registered for the tenant in the context
+func (r *TenantRouter) Provider(ctx context.Context) (Provider, error) {
+	instance, err := r.Instance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.registry.Get(r.providerType, instance)
+}
+
+// tenantRoutedRepository forwards each call to the repository of the tenant's provider instance
+type tenantRoutedRepository[T any] struct {
+	router  *TenantRouter
+	factory func(Provider) (Repository[T], error)
+
+	mutex sync.Mutex
+	repos map[string]Repository[T]
+}
+
+// NewTenantRoutedRepository returns a repository that routes each call to the provider
+// instance of the tenant in the context. factory builds a repository for a provider and is
+// called once per instance.
+// Example: repo := NewTenantRoutedRepository(router, func(p Provider) (Repository[User], error) { return gpagorm.GetRepository[User](p), nil })
+func NewTenantRoutedRepository[T any](router *TenantRouter, factory func(Provider) (Repository[T], error)) Repository[T] {
+	return &tenantRoutedRepository[T]{
+		router:  router,
+		factory: factory,
+		repos:   make(map[string]Repository[T]),
+	}
+}
+
+// resolve returns the repository of the tenant in the context
+func (r *tenantRoutedRepository[T]) resolve(ctx context.Context) (Repository[T], error) {
+	instance, err := r.router.Instance(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if repo, ok := r.repos[instance]; ok {
+		return repo, nil
+	}
+
+	provider, err := r.router.registry.Get(r.router.providerType, instance)
+	if err != nil {
+		return nil, NewErrorWithCause(ErrorTypePermission, fmt.Sprintf("no provider for tenant instance %q", instance), err)
+	}
+	repo, err := r.factory(provider)
+	if err != nil {
+		return nil, err
+	}
+	r.repos[instance] = repo
+	return repo, nil
+}
+
+func (r *tenantRoutedRepository[T]) Create(ctx context.Context, entity *T) error {
+	repo, err := r.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return repo.Create(ctx, entity)
+}
+
+func (r *tenantRoutedRepository[T]) CreateBatch(ctx context.Context, entities []*T) error {
+	repo, err := r.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return repo.CreateBatch(ctx, entities)
+}
+
+func (r *tenantRoutedRepository[T]) FindByID(ctx context.Context, id interface{}) (*T, error) {
+	repo, err := r.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repo.FindByID(ctx, id)
+}
+
+func (r *tenantRoutedRepository[T]) FindAll(ctx context.Context, opts ...QueryOption) ([]*T, error) {
+	repo, err := r.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repo.FindAll(ctx, opts...)
+}
+
+func (r *tenantRoutedRepository[T]) Update(ctx context.Context, entity *T) error {
+	repo, err := r.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return repo.Update(ctx, entity)
+}
+
+func (r *tenantRoutedRepository[T]) UpdatePartial(ctx context.Context, id interface{}, updates map[string]interface{}) error {
+	repo, err := r.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return repo.UpdatePartial(ctx, id, updates)
+}
+
+func (r *tenantRoutedRepository[T]) Delete(ctx context.Context, id interface{}) error {
+	repo, err := r.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return repo.Delete(ctx, id)
+}
+
+func (r *tenantRoutedRepository[T]) DeleteByCondition(ctx context.Context, condition Condition) error {
+	repo, err := r.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return repo.DeleteByCondition(ctx, condition)
+}
+
+func (r *tenantRoutedRepository[T]) Query(ctx context.Context, opts ...QueryOption) ([]*T, error) {
+	repo, err := r.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repo.Query(ctx, opts...)
+}
+
+func (r *tenantRoutedRepository[T]) QueryScored(ctx context.Context, opts ...QueryOption) ([]Scored[T], error) {
+	repo, err := r.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return QueryScored(ctx, repo, opts...)
+}
+
+func (r *tenantRoutedRepository[T]) QueryOne(ctx context.Context, opts ...QueryOption) (*T, error) {
+	repo, err := r.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repo.QueryOne(ctx, opts...)
+}
+
+func (r *tenantRoutedRepository[T]) Count(ctx context.Context, opts ...QueryOption) (int64, error) {
+	repo, err := r.resolve(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return repo.Count(ctx, opts...)
+}
+
+func (r *tenantRoutedRepository[T]) Exists(ctx context.Context, opts ...QueryOption) (bool, error) {
+	repo, err := r.resolve(ctx)
+	if err != nil {
+		return false, err
+	}
+	return repo.Exists(ctx, opts...)
+}
+
+func (r *tenantRoutedRepository[T]) Transaction(ctx context.Context, fn TransactionFunc[T]) error {
+	repo, err := r.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return repo.Transaction(ctx, fn)
+}
+
+func (r *tenantRoutedRepository[T]) RawQuery(ctx context.Context, query string, args []interface{}) ([]*T, error) {
+	repo, err := r.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repo.RawQuery(ctx, query, args)
+}
+
+func (r *tenantRoutedRepository[T]) RawExec(ctx context.Context, query string, args []interface{}) (Result, error) {
+	repo, err := r.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repo.RawExec(ctx, query, args)
+}
+
+// GetEntityInfo returns the metadata of any tenant repository resolved so far.
+// The metadata is the same for every tenant, but without a context no repository can be resolved.
+func (r *tenantRoutedRepository[T]) GetEntityInfo() (*EntityInfo, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, repo := range r.repos {
+		return repo.GetEntityInfo()
+	}
+	return nil, NewError(ErrorTypeUnsupported, "no tenant repository has been resolved yet")
+}
+
+// Close closes every tenant repository resolved so far
+func (r *tenantRoutedRepository[T]) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var firstErr error
+	for instance, repo := range r.repos {
+		if err := repo.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(r.repos, instance)
+	}
+	return firstErr
+}
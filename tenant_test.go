@@ -0,0 +1,188 @@
+package gpa
+
+import (
+	"context"
+	"testing"
+)
+
+type tenantEntity struct {
+	ID       int    `json:"id"`
+	TenantID string `json:"tenant_id"`
+	Name     string `json:"name"`
+}
+
+func TestTenantContext(t *testing.T) {
+	if _, ok := TenantFromContext(context.Background()); ok {
+		t.Error("Expected no tenant in empty context")
+	}
+	tenantID, ok := TenantFromContext(WithTenant(context.Background(), "acme"))
+	if !ok || tenantID != "acme" {
+		t.Errorf("Expected tenant 'acme', got %v", tenantID)
+	}
+}
+
+func TestTenantRepository_FailsClosed(t *testing.T) {
+	mock := &mockRepository[tenantEntity]{}
+	repo := NewTenantRepository[tenantEntity](mock, TenantConfig{})
+	ctx := context.Background()
+
+	if _, err := repo.Query(ctx); !IsErrorType(err, ErrorTypePermission) {
+		t.Errorf("Expected permission error without tenant, got %v", err)
+	}
+	if err := repo.Create(ctx, &tenantEntity{}); !IsErrorType(err, ErrorTypePermission) {
+		t.Errorf("Expected permission error without tenant, got %v", err)
+	}
+	if len(mock.calls) != 0 {
+		t.Errorf("Expected no calls to reach the provider, got %v", mock.calls)
+	}
+}
+
+func TestTenantRepository_InjectsCondition(t *testing.T) {
+	mock := &mockRepository[tenantEntity]{}
+	repo := NewTenantRepository[tenantEntity](mock, TenantConfig{})
+	ctx := WithTenant(context.Background(), "acme")
+
+	if _, err := repo.Query(ctx, Where("name", OpEqual, "widget")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	query := NewQuery()
+	for _, opt := range mock.lastOpts {
+		opt.Apply(query)
+	}
+	if len(query.Conditions) != 2 {
+		t.Fatalf("Expected 2 conditions, got %d", len(query.Conditions))
+	}
+	last := query.Conditions[1]
+	if last.Field() != "tenant_id" || last.Value() != "acme" {
+		t.Errorf("Expected tenant condition, got %s = %v", last.Field(), last.Value())
+	}
+
+	if _, err := repo.Count(ctx); err != nil || len(mock.lastOpts) != 1 {
+		t.Errorf("Expected tenant condition on Count, got %d options", len(mock.lastOpts))
+	}
+
+	if err := repo.DeleteByCondition(ctx, WhereCondition("name", OpEqual, "old")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	composite, ok := mock.lastCondition.(CompositeCondition)
+	if !ok || composite.Logic != LogicAnd || len(composite.Conditions) != 2 {
+		t.Errorf("Expected condition AND tenant condition, got %v", mock.lastCondition)
+	}
+}
+
+func TestTenantRepository_StampsCreate(t *testing.T) {
+	mock := &mockRepository[tenantEntity]{}
+	repo := NewTenantRepository[tenantEntity](mock, TenantConfig{})
+	ctx := WithTenant(context.Background(), "acme")
+
+	entity := &tenantEntity{Name: "widget"}
+	if err := repo.Create(ctx, entity); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if entity.TenantID != "acme" {
+		t.Errorf("Expected tenant to be stamped, got %q", entity.TenantID)
+	}
+
+	err := repo.CreateBatch(ctx, []*tenantEntity{{Name: "a"}, {Name: "b", TenantID: "globex"}})
+	if !IsErrorType(err, ErrorTypePermission) {
+		t.Errorf("Expected cross-tenant create to be rejected, got %v", err)
+	}
+}
+
+func TestTenantRepository_Ownership(t *testing.T) {
+	mock := &mockRepository[tenantEntity]{
+		items: []*tenantEntity{{ID: 1, TenantID: "globex", Name: "secret"}},
+	}
+	repo := NewTenantRepository[tenantEntity](mock, TenantConfig{})
+	ctx := WithTenant(context.Background(), "acme")
+
+	if _, err := repo.FindByID(ctx, 1); !IsNotFound(err) {
+		t.Errorf("Expected other tenant's row to be not found, got %v", err)
+	}
+	if err := repo.Update(ctx, &tenantEntity{ID: 1, Name: "hijack"}); !IsNotFound(err) {
+		t.Errorf("Expected update of other tenant's row to fail, got %v", err)
+	}
+	if err := repo.UpdatePartial(ctx, 1, map[string]interface{}{"name": "hijack"}); !IsNotFound(err) {
+		t.Errorf("Expected partial update of other tenant's row to fail, got %v", err)
+	}
+	if err := repo.Delete(ctx, 1); !IsNotFound(err) {
+		t.Errorf("Expected delete of other tenant's row to fail, got %v", err)
+	}
+	if mock.callCount("Update")+mock.callCount("UpdatePartial")+mock.callCount("Delete") != 0 {
+		t.Error("Expected no cross-tenant writes to reach the provider")
+	}
+
+	owner := WithTenant(context.Background(), "globex")
+	if err := repo.UpdatePartial(owner, 1, map[string]interface{}{"tenant_id": "acme"}); !IsErrorType(err, ErrorTypePermission) {
+		t.Errorf("Expected moving a row to another tenant to be rejected, got %v", err)
+	}
+	if err := repo.Delete(owner, 1); err != nil {
+		t.Errorf("Expected owner to delete, got %v", err)
+	}
+}
+
+func TestTenantRepository_RawQueries(t *testing.T) {
+	mock := &mockRepository[tenantEntity]{}
+	ctx := WithTenant(context.Background(), "acme")
+
+	repo := NewTenantRepository[tenantEntity](mock, TenantConfig{})
+	if _, err := repo.RawQuery(ctx, "SELECT * FROM things", nil); !IsErrorType(err, ErrorTypePermission) {
+		t.Errorf("Expected raw query to be rejected, got %v", err)
+	}
+
+	allowed := NewTenantRepository[tenantEntity](mock, TenantConfig{AllowRawQueries: true})
+	if _, err := allowed.RawExec(ctx, "DELETE FROM things WHERE tenant_id = ?", []interface{}{"acme"}); err != nil {
+		t.Errorf("Expected raw exec to be allowed, got %v", err)
+	}
+}
+
+func TestTenantRepository_Transaction(t *testing.T) {
+	mock := &mockRepository[tenantEntity]{}
+	repo := NewTenantRepository[tenantEntity](mock, TenantConfig{})
+	ctx := WithTenant(context.Background(), "acme")
+
+	entity := &tenantEntity{Name: "widget"}
+	err := repo.Transaction(ctx, func(tx Transaction[tenantEntity]) error {
+		return tx.Create(ctx, entity)
+	})
+	if err != nil || entity.TenantID != "acme" {
+		t.Errorf("Expected tenant stamped inside transaction, got %v / %q", err, entity.TenantID)
+	}
+}
+
+func TestTenantRoutedRepository(t *testing.T) {
+	registry := &ProviderRegistry{providers: make(map[string]map[string]Provider)}
+	registry.Register("tenant_acme", newMockProvider("postgres"))
+	registry.Register("tenant_globex", newMockProvider("postgres"))
+
+	router := NewTenantRouter(registry, "postgres", func(tenantID interface{}) string {
+		return "tenant_" + tenantID.(string)
+	})
+
+	repos := make(map[Provider]*mockRepository[tenantEntity])
+	repo := NewTenantRoutedRepository[tenantEntity](router, func(p Provider) (Repository[tenantEntity], error) {
+		mock := &mockRepository[tenantEntity]{}
+		repos[p] = mock
+		return mock, nil
+	})
+
+	acme := WithTenant(context.Background(), "acme")
+	repo.Create(acme, &tenantEntity{Name: "a"})
+	repo.Create(acme, &tenantEntity{Name: "b"})
+	repo.Create(WithTenant(context.Background(), "globex"), &tenantEntity{Name: "c"})
+
+	if len(repos) != 2 {
+		t.Fatalf("Expected one repository per tenant instance, got %d", len(repos))
+	}
+	acmeProvider, _ := router.Provider(acme)
+	if repos[acmeProvider].callCount("Create") != 2 {
+		t.Errorf("Expected acme writes to go to acme instance, got %d", repos[acmeProvider].callCount("Create"))
+	}
+
+	if err := repo.Create(WithTenant(context.Background(), "initech"), &tenantEntity{}); !IsErrorType(err, ErrorTypePermission) {
+		t.Errorf("Expected unknown tenant to be rejected, got %v", err)
+	}
+	if err := repo.Create(context.Background(), &tenantEntity{}); !IsErrorType(err, ErrorTypePermission) {
+		t.Errorf("Expected missing tenant to be rejected, got %v", err)
+	}
+}
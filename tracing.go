@@ -0,0 +1,468 @@
+package gpa
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// =====================================
+// Tracing
+// =====================================
+
+// Semantic attribute keys attached to database spans.
+const (
+	AttrDBSystem    = "db.system"
+	AttrDBProvider  = "db.provider"
+	AttrDBOperation = "db.operation"
+	AttrDBStatement = "db.statement"
+	AttrDBEntity    = "db.entity"
+	AttrDBKey       = "db.key"
+)
+
+// Attribute is a key/value pair attached to a span.
+// The shape matches OpenTelemetry's attribute.KeyValue closely enough that
+// adapters can convert with a simple type switch on Value.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attr creates a span attribute
+func Attr(key string, value interface{}) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Span represents a single traced operation.
+// The method set is a subset of OpenTelemetry's trace.Span.
+type Span interface {
+	// SetAttributes adds attributes to the span.
+	SetAttributes(attrs ...Attribute)
+
+	// RecordError records an error as an event on the span and marks it as failed.
+	RecordError(err error)
+
+	// End completes the span. Calls after the first have no effect.
+	End()
+}
+
+// Tracer starts spans. Implementations must return a context that carries
+// the new span so that nested calls become children of it.
+//
+// An OpenTelemetry adapter looks like:
+//
+//	type otelTracer struct{ t trace.Tracer }
+//
+//	func (o otelTracer) Start(ctx context.Context, name string, attrs ...gpa.Attribute) (context.Context, gpa.Span) {
+//	    ctx, span := o.t.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+//	    s := otelSpan{span}
+//	    s.SetAttributes(attrs...)
+//	    return gpa.ContextWithSpan(ctx, s), s
+//	}
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// SpanFromContext returns the span carried by ctx, or a no-op span if there is none
+func SpanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanContextKey{}).(Span); ok {
+		return span
+	}
+	return noopSpan{}
+}
+
+// NoopTracer is a Tracer that records nothing
+type NoopTracer struct{}
+
+// Start returns ctx unchanged and a no-op span
+func (NoopTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attrs ...Attribute) {}
+func (noopSpan) RecordError(err error)            {}
+func (noopSpan) End()                             {}
+
+// =====================================
+// In-Memory Recorder
+// =====================================
+
+// RecordedSpan is a snapshot of a span captured by RecordingTracer
+type RecordedSpan struct {
+	ID         int
+	ParentID   int
+	Name       string
+	Attributes map[string]interface{}
+	Errors     []error
+	StartTime  time.Time
+	EndTime    time.Time
+	Ended      bool
+}
+
+// RecordingTracer is an in-memory Tracer intended for tests.
+// It keeps every span it starts, including parent/child relationships.
+type RecordingTracer struct {
+	mutex sync.Mutex
+	spans []*recordingSpan
+}
+
+// NewRecordingTracer creates an empty RecordingTracer
+func NewRecordingTracer() *RecordingTracer {
+	return &RecordingTracer{}
+}
+
+// Start begins a new span, parented to the recording span carried by ctx if any
+func (t *RecordingTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	t.mutex.Lock()
+	span := &recordingSpan{
+		tracer: t,
+		data: RecordedSpan{
+			ID:         len(t.spans) + 1,
+			Name:       name,
+			Attributes: make(map[string]interface{}),
+			StartTime:  time.Now(),
+		},
+	}
+	if parent, ok := ctx.Value(spanContextKey{}).(*recordingSpan); ok && parent.tracer == t {
+		span.data.ParentID = parent.data.ID
+	}
+	t.spans = append(t.spans, span)
+	t.mutex.Unlock()
+
+	span.SetAttributes(attrs...)
+	return ContextWithSpan(ctx, span), span
+}
+
+// Spans returns a snapshot of all recorded spans in start order
+func (t *RecordingTracer) Spans() []RecordedSpan {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	result := make([]RecordedSpan, 0, len(t.spans))
+	for _, span := range t.spans {
+		data := span.data
+		data.Attributes = make(map[string]interface{}, len(span.data.Attributes))
+		for k, v := range span.data.Attributes {
+			data.Attributes[k] = v
+		}
+		data.Errors = append([]error(nil), span.data.Errors...)
+		result = append(result, data)
+	}
+	return result
+}
+
+// Reset discards all recorded spans
+func (t *RecordingTracer) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.spans = nil
+}
+
+type recordingSpan struct {
+	tracer *RecordingTracer
+	data   RecordedSpan
+}
+
+func (s *recordingSpan) SetAttributes(attrs ...Attribute) {
+	s.tracer.mutex.Lock()
+	defer s.tracer.mutex.Unlock()
+	for _, attr := range attrs {
+		s.data.Attributes[attr.Key] = attr.Value
+	}
+}
+
+func (s *recordingSpan) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.tracer.mutex.Lock()
+	defer s.tracer.mutex.Unlock()
+	s.data.Errors = append(s.data.Errors, err)
+}
+
+func (s *recordingSpan) End() {
+	s.tracer.mutex.Lock()
+	defer s.tracer.mutex.Unlock()
+	if s.data.Ended {
+		return
+	}
+	s.data.Ended = true
+	s.data.EndTime = time.Now()
+}
+
+// =====================================
+// Traced Repository
+// =====================================
+
+// tracedRepository wraps a Repository[T] and emits one span per call
+type tracedRepository[T any] struct {
+	repo   Repository[T]
+	tracer Tracer
+	attrs  []Attribute
+}
+
+// NewTracedRepository wraps repo so every call runs inside a span started on tracer.
+// Spans are named "gpa.<Method>" and carry db.system, db.provider and db.entity
+// attributes derived from info and T. Raw queries also carry db.statement.
+// Example: repo = NewTracedRepository(repo, tracer, provider.ProviderInfo())
+func NewTracedRepository[T any](repo Repository[T], tracer Tracer, info ProviderInfo) Repository[T] {
+	if tracer == nil {
+		tracer = NoopTracer{}
+	}
+	return &tracedRepository[T]{
+		repo:   repo,
+		tracer: tracer,
+		attrs: []Attribute{
+			Attr(AttrDBSystem, string(info.DatabaseType)),
+			Attr(AttrDBProvider, info.Name),
+			Attr(AttrDBEntity, entityName[T]()),
+		},
+	}
+}
+
+func (r *tracedRepository[T]) start(ctx context.Context, op string, extra ...Attribute) (context.Context, Span) {
+	attrs := make([]Attribute, 0, len(r.attrs)+len(extra)+1)
+	attrs = append(attrs, r.attrs...)
+	attrs = append(attrs, Attr(AttrDBOperation, op))
+	attrs = append(attrs, extra...)
+	return r.tracer.Start(ctx, "gpa."+op, attrs...)
+}
+
+// finishSpan records err on span (if any) and ends it
+func finishSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+func (r *tracedRepository[T]) Create(ctx context.Context, entity *T) (err error) {
+	ctx, span := r.start(ctx, "Create")
+	defer func() { finishSpan(span, err) }()
+	return r.repo.Create(ctx, entity)
+}
+
+func (r *tracedRepository[T]) CreateBatch(ctx context.Context, entities []*T) (err error) {
+	ctx, span := r.start(ctx, "CreateBatch", Attr("db.batch_size", len(entities)))
+	defer func() { finishSpan(span, err) }()
+	return r.repo.CreateBatch(ctx, entities)
+}
+
+func (r *tracedRepository[T]) FindByID(ctx context.Context, id interface{}) (result *T, err error) {
+	ctx, span := r.start(ctx, "FindByID")
+	defer func() { finishSpan(span, err) }()
+	return r.repo.FindByID(ctx, id)
+}
+
+func (r *tracedRepository[T]) FindAll(ctx context.Context, opts ...QueryOption) (result []*T, err error) {
+	ctx, span := r.start(ctx, "FindAll")
+	defer func() { finishSpan(span, err) }()
+	return r.repo.FindAll(ctx, opts...)
+}
+
+func (r *tracedRepository[T]) Update(ctx context.Context, entity *T) (err error) {
+	ctx, span := r.start(ctx, "Update")
+	defer func() { finishSpan(span, err) }()
+	return r.repo.Update(ctx, entity)
+}
+
+func (r *tracedRepository[T]) UpdatePartial(ctx context.Context, id interface{}, updates map[string]interface{}) (err error) {
+	ctx, span := r.start(ctx, "UpdatePartial")
+	defer func() { finishSpan(span, err) }()
+	return r.repo.UpdatePartial(ctx, id, updates)
+}
+
+func (r *tracedRepository[T]) Delete(ctx context.Context, id interface{}) (err error) {
+	ctx, span := r.start(ctx, "Delete")
+	defer func() { finishSpan(span, err) }()
+	return r.repo.Delete(ctx, id)
+}
+
+func (r *tracedRepository[T]) DeleteByCondition(ctx context.Context, condition Condition) (err error) {
+	ctx, span := r.start(ctx, "DeleteByCondition")
+	defer func() { finishSpan(span, err) }()
+	return r.repo.DeleteByCondition(ctx, condition)
+}
+
+func (r *tracedRepository[T]) Query(ctx context.Context, opts ...QueryOption) (result []*T, err error) {
+	ctx, span := r.start(ctx, "Query")
+	defer func() { finishSpan(span, err) }()
+	return r.repo.Query(ctx, opts...)
+}
+
+func (r *tracedRepository[T]) QueryScored(ctx context.Context, opts ...QueryOption) (result []Scored[T], err error) {
+	ctx, span := r.start(ctx, "QueryScored")
+	defer func() { finishSpan(span, err) }()
+	return QueryScored(ctx, r.repo, opts...)
+}
+
+func (r *tracedRepository[T]) QueryOne(ctx context.Context, opts ...QueryOption) (result *T, err error) {
+	ctx, span := r.start(ctx, "QueryOne")
+	defer func() { finishSpan(span, err) }()
+	return r.repo.QueryOne(ctx, opts...)
+}
+
+func (r *tracedRepository[T]) Count(ctx context.Context, opts ...QueryOption) (count int64, err error) {
+	ctx, span := r.start(ctx, "Count")
+	defer func() { finishSpan(span, err) }()
+	return r.repo.Count(ctx, opts...)
+}
+
+func (r *tracedRepository[T]) Exists(ctx context.Context, opts ...QueryOption) (exists bool, err error) {
+	ctx, span := r.start(ctx, "Exists")
+	defer func() { finishSpan(span, err) }()
+	return r.repo.Exists(ctx, opts...)
+}
+
+func (r *tracedRepository[T]) Transaction(ctx context.Context, fn TransactionFunc[T]) (err error) {
+	ctx, span := r.start(ctx, "Transaction")
+	defer func() { finishSpan(span, err) }()
+	return r.repo.Transaction(ctx, func(tx Transaction[T]) error {
+		return fn(&tracedTransaction[T]{
+			tracedRepository: tracedRepository[T]{repo: tx, tracer: r.tracer, attrs: r.attrs},
+			tx:               tx,
+		})
+	})
+}
+
+func (r *tracedRepository[T]) RawQuery(ctx context.Context, query string, args []interface{}) (result []*T, err error) {
+	ctx, span := r.start(ctx, "RawQuery", Attr(AttrDBStatement, query))
+	defer func() { finishSpan(span, err) }()
+	return r.repo.RawQuery(ctx, query, args)
+}
+
+func (r *tracedRepository[T]) RawExec(ctx context.Context, query string, args []interface{}) (result Result, err error) {
+	ctx, span := r.start(ctx, "RawExec", Attr(AttrDBStatement, query))
+	defer func() { finishSpan(span, err) }()
+	return r.repo.RawExec(ctx, query, args)
+}
+
+func (r *tracedRepository[T]) GetEntityInfo() (*EntityInfo, error) {
+	return r.repo.GetEntityInfo()
+}
+
+func (r *tracedRepository[T]) Close() error {
+	return r.repo.Close()
+}
+
+// tracedTransaction traces operations executed inside a transaction
+type tracedTransaction[T any] struct {
+	tracedRepository[T]
+	tx Transaction[T]
+}
+
+func (t *tracedTransaction[T]) Commit() error                  { return t.tx.Commit() }
+func (t *tracedTransaction[T]) Rollback() error                { return t.tx.Rollback() }
+func (t *tracedTransaction[T]) SetSavepoint(name string) error { return t.tx.SetSavepoint(name) }
+func (t *tracedTransaction[T]) RollbackToSavepoint(name string) error {
+	return t.tx.RollbackToSavepoint(name)
+}
+
+// =====================================
+// Traced Providers
+// =====================================
+
+// tracedSQLProvider wraps a SQLProvider and traces raw statements
+type tracedSQLProvider struct {
+	SQLProvider
+	tracer Tracer
+}
+
+// NewTracedSQLProvider wraps provider so RawQuery and RawExec run inside spans.
+// All other methods are delegated unchanged.
+func NewTracedSQLProvider(provider SQLProvider, tracer Tracer) SQLProvider {
+	if tracer == nil {
+		tracer = NoopTracer{}
+	}
+	return &tracedSQLProvider{SQLProvider: provider, tracer: tracer}
+}
+
+func (p *tracedSQLProvider) start(ctx context.Context, op string, extra ...Attribute) (context.Context, Span) {
+	info := p.SQLProvider.ProviderInfo()
+	attrs := append([]Attribute{
+		Attr(AttrDBSystem, string(info.DatabaseType)),
+		Attr(AttrDBProvider, info.Name),
+		Attr(AttrDBOperation, op),
+	}, extra...)
+	return p.tracer.Start(ctx, "gpa."+op, attrs...)
+}
+
+func (p *tracedSQLProvider) RawQuery(ctx context.Context, query string, args ...interface{}) (result interface{}, err error) {
+	ctx, span := p.start(ctx, "RawQuery", Attr(AttrDBStatement, query))
+	defer func() { finishSpan(span, err) }()
+	return p.SQLProvider.RawQuery(ctx, query, args...)
+}
+
+func (p *tracedSQLProvider) RawExec(ctx context.Context, query string, args ...interface{}) (result Result, err error) {
+	ctx, span := p.start(ctx, "RawExec", Attr(AttrDBStatement, query))
+	defer func() { finishSpan(span, err) }()
+	return p.SQLProvider.RawExec(ctx, query, args...)
+}
+
+// tracedKeyValueProvider wraps a KeyValueProvider and traces key operations
+type tracedKeyValueProvider struct {
+	KeyValueProvider
+	tracer Tracer
+}
+
+// NewTracedKeyValueProvider wraps provider so Get, Set, Delete and Exists run inside spans.
+// All other methods are delegated unchanged.
+func NewTracedKeyValueProvider(provider KeyValueProvider, tracer Tracer) KeyValueProvider {
+	if tracer == nil {
+		tracer = NoopTracer{}
+	}
+	return &tracedKeyValueProvider{KeyValueProvider: provider, tracer: tracer}
+}
+
+func (p *tracedKeyValueProvider) start(ctx context.Context, op string, key string) (context.Context, Span) {
+	info := p.KeyValueProvider.ProviderInfo()
+	return p.tracer.Start(ctx, "gpa."+op,
+		Attr(AttrDBSystem, string(info.DatabaseType)),
+		Attr(AttrDBProvider, info.Name),
+		Attr(AttrDBOperation, op),
+		Attr(AttrDBKey, key),
+	)
+}
+
+func (p *tracedKeyValueProvider) Get(ctx context.Context, key string) (value interface{}, err error) {
+	ctx, span := p.start(ctx, "Get", key)
+	defer func() { finishSpan(span, err) }()
+	return p.KeyValueProvider.Get(ctx, key)
+}
+
+func (p *tracedKeyValueProvider) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) (err error) {
+	ctx, span := p.start(ctx, "Set", key)
+	defer func() { finishSpan(span, err) }()
+	return p.KeyValueProvider.Set(ctx, key, value, ttl)
+}
+
+func (p *tracedKeyValueProvider) Delete(ctx context.Context, key string) (err error) {
+	ctx, span := p.start(ctx, "Delete", key)
+	defer func() { finishSpan(span, err) }()
+	return p.KeyValueProvider.Delete(ctx, key)
+}
+
+func (p *tracedKeyValueProvider) Exists(ctx context.Context, key string) (exists bool, err error) {
+	ctx, span := p.start(ctx, "Exists", key)
+	defer func() { finishSpan(span, err) }()
+	return p.KeyValueProvider.Exists(ctx, key)
+}
+
+// entityName returns the Go type name of T, dereferencing pointers
+func entityName[T any]() string {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
@@ -0,0 +1,321 @@
+package gpa
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockRepository is a minimal Repository[T] used to test decorators.
+// Each call is recorded by name; errs are returned in order, one per call.
+type mockRepository[T any] struct {
+	mutex         sync.Mutex
+	calls         []string
+	errs          []error
+	items         []*T
+	lastOpts      []QueryOption
+	lastCondition Condition
+	lastUpdates   map[string]interface{}
+	info          *EntityInfo
+}
+
+func (m *mockRepository[T]) record(op string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.calls = append(m.calls, op)
+	if len(m.errs) == 0 {
+		return nil
+	}
+	err := m.errs[0]
+	m.errs = m.errs[1:]
+	return err
+}
+
+func (m *mockRepository[T]) callCount(op string) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	count := 0
+	for _, call := range m.calls {
+		if call == op {
+			count++
+		}
+	}
+	return count
+}
+
+func (m *mockRepository[T]) Create(ctx context.Context, entity *T) error {
+	if err := m.record("Create"); err != nil {
+		return err
+	}
+	m.items = append(m.items, entity)
+	return nil
+}
+
+func (m *mockRepository[T]) CreateBatch(ctx context.Context, entities []*T) error {
+	if err := m.record("CreateBatch"); err != nil {
+		return err
+	}
+	m.items = append(m.items, entities...)
+	return nil
+}
+
+func (m *mockRepository[T]) FindByID(ctx context.Context, id interface{}) (*T, error) {
+	if err := m.record("FindByID"); err != nil {
+		return nil, err
+	}
+	if len(m.items) == 0 {
+		return nil, NewError(ErrorTypeNotFound, "not found")
+	}
+	return m.items[0], nil
+}
+
+func (m *mockRepository[T]) FindAll(ctx context.Context, opts ...QueryOption) ([]*T, error) {
+	m.lastOpts = opts
+	return m.items, m.record("FindAll")
+}
+
+func (m *mockRepository[T]) Update(ctx context.Context, entity *T) error {
+	return m.record("Update")
+}
+
+func (m *mockRepository[T]) UpdatePartial(ctx context.Context, id interface{}, updates map[string]interface{}) error {
+	m.lastUpdates = updates
+	return m.record("UpdatePartial")
+}
+
+func (m *mockRepository[T]) Delete(ctx context.Context, id interface{}) error {
+	return m.record("Delete")
+}
+
+func (m *mockRepository[T]) DeleteByCondition(ctx context.Context, condition Condition) error {
+	m.lastCondition = condition
+	return m.record("DeleteByCondition")
+}
+
+func (m *mockRepository[T]) Query(ctx context.Context, opts ...QueryOption) ([]*T, error) {
+	m.lastOpts = opts
+	return m.items, m.record("Query")
+}
+
+func (m *mockRepository[T]) QueryOne(ctx context.Context, opts ...QueryOption) (*T, error) {
+	m.lastOpts = opts
+	if err := m.record("QueryOne"); err != nil {
+		return nil, err
+	}
+	if len(m.items) == 0 {
+		return nil, NewError(ErrorTypeNotFound, "not found")
+	}
+	return m.items[0], nil
+}
+
+func (m *mockRepository[T]) Count(ctx context.Context, opts ...QueryOption) (int64, error) {
+	m.lastOpts = opts
+	return int64(len(m.items)), m.record("Count")
+}
+
+func (m *mockRepository[T]) Exists(ctx context.Context, opts ...QueryOption) (bool, error) {
+	m.lastOpts = opts
+	return len(m.items) > 0, m.record("Exists")
+}
+
+func (m *mockRepository[T]) Transaction(ctx context.Context, fn TransactionFunc[T]) error {
+	if err := m.record("Transaction"); err != nil {
+		return err
+	}
+	if err := fn(&mockTransaction[T]{mockRepository: m}); err != nil {
+		m.record("Rollback")
+		return err
+	}
+	return m.record("Commit")
+}
+
+func (m *mockRepository[T]) RawQuery(ctx context.Context, query string, args []interface{}) ([]*T, error) {
+	return m.items, m.record("RawQuery")
+}
+
+func (m *mockRepository[T]) RawExec(ctx context.Context, query string, args []interface{}) (Result, error) {
+	return nil, m.record("RawExec")
+}
+
+func (m *mockRepository[T]) GetEntityInfo() (*EntityInfo, error) {
+	if m.info != nil {
+		return m.info, nil
+	}
+	return &EntityInfo{Name: entityName[T]()}, nil
+}
+
+func (m *mockRepository[T]) Close() error {
+	return m.record("Close")
+}
+
+type mockTransaction[T any] struct {
+	*mockRepository[T]
+}
+
+func (t *mockTransaction[T]) Commit() error                         { return nil }
+func (t *mockTransaction[T]) Rollback() error                       { return nil }
+func (t *mockTransaction[T]) SetSavepoint(name string) error        { return nil }
+func (t *mockTransaction[T]) RollbackToSavepoint(name string) error { return nil }
+
+type tracedEntity struct {
+	ID   int
+	Name string
+}
+
+func TestTracedRepository_Spans(t *testing.T) {
+	tracer := NewRecordingTracer()
+	mock := &mockRepository[tracedEntity]{}
+	repo := NewTracedRepository[tracedEntity](mock, tracer, ProviderInfo{Name: "gorm", DatabaseType: DatabaseTypeSQL})
+	ctx := context.Background()
+
+	if err := repo.Create(ctx, &tracedEntity{ID: 1}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := repo.RawQuery(ctx, "SELECT * FROM traced_entities", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	spans := tracer.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+
+	create := spans[0]
+	if create.Name != "gpa.Create" {
+		t.Errorf("Expected span name 'gpa.Create', got '%s'", create.Name)
+	}
+	if !create.Ended {
+		t.Error("Expected span to be ended")
+	}
+	if create.Attributes[AttrDBSystem] != "sql" {
+		t.Errorf("Expected db.system 'sql', got %v", create.Attributes[AttrDBSystem])
+	}
+	if create.Attributes[AttrDBEntity] != "tracedEntity" {
+		t.Errorf("Expected db.entity 'tracedEntity', got %v", create.Attributes[AttrDBEntity])
+	}
+
+	if spans[1].Attributes[AttrDBStatement] != "SELECT * FROM traced_entities" {
+		t.Errorf("Expected statement attribute, got %v", spans[1].Attributes[AttrDBStatement])
+	}
+}
+
+func TestTracedRepository_RecordsErrors(t *testing.T) {
+	tracer := NewRecordingTracer()
+	failure := NewError(ErrorTypeNotFound, "missing")
+	mock := &mockRepository[tracedEntity]{errs: []error{failure}}
+	repo := NewTracedRepository[tracedEntity](mock, tracer, ProviderInfo{})
+
+	_, err := repo.FindByID(context.Background(), 1)
+	if err == nil {
+		t.Fatal("Expected error")
+	}
+
+	spans := tracer.Spans()
+	if len(spans) != 1 || len(spans[0].Errors) != 1 {
+		t.Fatalf("Expected one span with one error, got %+v", spans)
+	}
+	if !errors.Is(spans[0].Errors[0], failure) {
+		t.Errorf("Expected recorded error to match, got %v", spans[0].Errors[0])
+	}
+}
+
+func TestTracedRepository_TransactionPropagation(t *testing.T) {
+	tracer := NewRecordingTracer()
+	repo := NewTracedRepository[tracedEntity](&mockRepository[tracedEntity]{}, tracer, ProviderInfo{})
+
+	err := repo.Transaction(context.Background(), func(tx Transaction[tracedEntity]) error {
+		return tx.Create(context.Background(), &tracedEntity{ID: 1})
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	spans := tracer.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	if spans[0].Name != "gpa.Transaction" || spans[1].Name != "gpa.Create" {
+		t.Errorf("Unexpected span names: %s, %s", spans[0].Name, spans[1].Name)
+	}
+}
+
+func TestRecordingTracer_Parenting(t *testing.T) {
+	tracer := NewRecordingTracer()
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	_, child := tracer.Start(ctx, "child")
+	child.End()
+	parent.End()
+	parent.End()
+
+	spans := tracer.Spans()
+	if spans[1].ParentID != spans[0].ID {
+		t.Errorf("Expected child parent %d, got %d", spans[0].ID, spans[1].ParentID)
+	}
+	if SpanFromContext(ctx) != parent {
+		t.Error("Expected span to be carried by context")
+	}
+	if _, ok := SpanFromContext(context.Background()).(noopSpan); !ok {
+		t.Error("Expected no-op span for empty context")
+	}
+
+	tracer.Reset()
+	if len(tracer.Spans()) != 0 {
+		t.Error("Expected no spans after reset")
+	}
+}
+
+type tracingKVProvider struct {
+	*mockProvider
+	values map[string]interface{}
+}
+
+func (p *tracingKVProvider) Client() interface{} { return nil }
+func (p *tracingKVProvider) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	p.values[key] = value
+	return nil
+}
+func (p *tracingKVProvider) Get(ctx context.Context, key string) (interface{}, error) {
+	value, ok := p.values[key]
+	if !ok {
+		return nil, NewError(ErrorTypeNotFound, "key not found")
+	}
+	return value, nil
+}
+func (p *tracingKVProvider) Delete(ctx context.Context, key string) error { return nil }
+func (p *tracingKVProvider) Exists(ctx context.Context, key string) (bool, error) {
+	return false, nil
+}
+func (p *tracingKVProvider) Keys(ctx context.Context, pattern string) ([]string, error) {
+	return nil, nil
+}
+func (p *tracingKVProvider) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return nil
+}
+func (p *tracingKVProvider) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return 0, nil
+}
+
+func TestTracedKeyValueProvider(t *testing.T) {
+	tracer := NewRecordingTracer()
+	kv := NewTracedKeyValueProvider(&tracingKVProvider{
+		mockProvider: newMockProvider("redis"),
+		values:       map[string]interface{}{},
+	}, tracer)
+
+	if _, err := kv.Get(context.Background(), "user:1"); err == nil {
+		t.Fatal("Expected not found error")
+	}
+
+	spans := tracer.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	if spans[0].Attributes[AttrDBKey] != "user:1" {
+		t.Errorf("Expected db.key 'user:1', got %v", spans[0].Attributes[AttrDBKey])
+	}
+	if len(spans[0].Errors) != 1 {
+		t.Error("Expected error to be recorded")
+	}
+}
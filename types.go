@@ -109,6 +109,10 @@ const (
 	OpNotExists          Operator = "NOT EXISTS"
 	OpInSubQuery         Operator = "IN_SUBQUERY"
 	OpNotInSubQuery      Operator = "NOT_IN_SUBQUERY"
+	OpNear               Operator = "NEAR"
+	OpWithin             Operator = "WITHIN"
+	OpIntersects         Operator = "INTERSECTS"
+	OpSearch             Operator = "SEARCH"
 )
 
 // LogicOperator represents logic operators for combining conditions
@@ -220,4 +224,5 @@ const (
 	ErrorTypeSerialization   ErrorType = "serialization"
 	ErrorTypeInvalidArgument ErrorType = "invalid_argument"
 	ErrorTypeDatabase        ErrorType = "database"
+	ErrorTypeLocked          ErrorType = "locked"
 )
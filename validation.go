@@ -0,0 +1,546 @@
+package gpa
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// =====================================
+// Struct Tag Validation
+// =====================================
+
+// ValidationRule checks a single field value against a rule parameter.
+// It returns an empty string when the value is valid, or a message describing the violation.
+// Pointer values are dereferenced before the rule runs; nil pointers only reach "required".
+// A message starting with "invalid parameter" reports a misconfigured tag rather than a violation.
+type ValidationRule func(value reflect.Value, param string) string
+
+var (
+	validationMutex sync.RWMutex
+	validationRules = map[string]ValidationRule{
+		"required": validateRequired,
+		"email":    validateEmail,
+		"url":      validateURL,
+		"uuid":     validateUUID,
+		"min":      validateMin,
+		"max":      validateMax,
+		"len":      validateLen,
+		"oneof":    validateOneOf,
+	}
+
+	emailPattern = regexp.MustCompile(`^[^\s@]+@[^\s@]+\.[^\s@]+$`)
+	uuidPattern  = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// RegisterValidationRule registers a custom rule usable in validate tags.
+// Registering a built-in name replaces the built-in rule.
+// Example: gpa.RegisterValidationRule("slug", validateSlug) // `validate:"required,slug"`
+func RegisterValidationRule(name string, rule ValidationRule) {
+	validationMutex.Lock()
+	defer validationMutex.Unlock()
+	validationRules[name] = rule
+}
+
+// ValidateEntity validates entity against its validate struct tags, the
+// MaxLength and IsNullable metadata in info (which may be nil), and finally its
+// ValidationHook, if implemented. All field violations are collected and returned
+// as a single ErrorTypeValidation GPAError; see GPAError.Violations.
+// Providers do not call it themselves: wrap a repository with
+// NewValidatingRepository to validate Create, CreateBatch and Update.
+// Example: if err := gpa.ValidateEntity(ctx, user, info); err != nil { return err }
+func ValidateEntity(ctx context.Context, entity interface{}, info *EntityInfo) error {
+	value := reflect.ValueOf(entity)
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return NewError(ErrorTypeInvalidArgument, "cannot validate a nil entity")
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return NewError(ErrorTypeInvalidArgument, fmt.Sprintf("cannot validate %s, expected a struct", value.Kind()))
+	}
+
+	violations, err := validateStructTags(value)
+	if err != nil {
+		return err
+	}
+	if info != nil {
+		violations = append(violations, validateFieldInfo(value, info.Fields, violations)...)
+	}
+
+	if hook, ok := entity.(ValidationHook); ok {
+		if hookErr := hook.Validate(ctx); hookErr != nil {
+			gpaErr, isGPA := AsGPAError(hookErr)
+			switch {
+			case isGPA && gpaErr.Type == ErrorTypeValidation && len(gpaErr.Violations()) > 0:
+				violations = append(violations, gpaErr.Violations()...)
+			case isGPA && gpaErr.Type == ErrorTypeValidation, !isGPA:
+				if len(violations) == 0 {
+					return hookErr
+				}
+				violations = append(violations, FieldViolation{Message: hookErr.Error()})
+			default:
+				// Non-validation errors from the hook (e.g. a failed lookup) are returned as-is
+				return hookErr
+			}
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	return newValidationError(value.Type().Name(), violations)
+}
+
+// newValidationError builds the error returned for a set of violations
+func newValidationError(entity string, violations []FieldViolation) GPAError {
+	fields := make([]string, 0, len(violations))
+	seen := make(map[string]bool)
+	for _, v := range violations {
+		if v.Field != "" && !seen[v.Field] {
+			seen[v.Field] = true
+			fields = append(fields, v.Field)
+		}
+	}
+
+	message := "validation failed"
+	if len(fields) > 0 {
+		message = "validation failed for " + strings.Join(fields, ", ")
+	}
+	return NewError(ErrorTypeValidation, message).
+		WithEntity(entity).
+		WithFields(fields...).
+		WithViolations(violations...)
+}
+
+// validateStructTags applies the validate tags of every exported field, including those of embedded structs
+func validateStructTags(value reflect.Value) ([]FieldViolation, error) {
+	var violations []FieldViolation
+	structType := value.Type()
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		fieldValue := value.Field(i)
+
+		// Embedded structs are walked even when unexported, since their fields are promoted
+		if field.Anonymous {
+			embedded := fieldValue
+			if embedded.Kind() == reflect.Ptr {
+				if embedded.IsNil() {
+					continue
+				}
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				nested, err := validateStructTags(embedded)
+				if err != nil {
+					return nil, err
+				}
+				violations = append(violations, nested...)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("validate")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		fieldViolations, err := validateField(fieldValue, field, tag)
+		if err != nil {
+			return nil, err
+		}
+		violations = append(violations, fieldViolations...)
+	}
+	return violations, nil
+}
+
+// validateField applies the comma-separated rules of a validate tag to a single field
+func validateField(value reflect.Value, field reflect.StructField, tag string) ([]FieldViolation, error) {
+	name := fieldDisplayName(field)
+
+	for _, spec := range strings.Split(tag, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		ruleName, param, _ := strings.Cut(spec, "=")
+
+		if ruleName == "omitempty" {
+			if value.IsZero() {
+				return nil, nil
+			}
+			continue
+		}
+
+		validationMutex.RLock()
+		rule, ok := validationRules[ruleName]
+		validationMutex.RUnlock()
+		if !ok {
+			return nil, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("unknown validation rule %q on field %s", ruleName, field.Name))
+		}
+
+		target := value
+		for target.Kind() == reflect.Ptr || target.Kind() == reflect.Interface {
+			if target.IsNil() {
+				break
+			}
+			target = target.Elem()
+		}
+		if ruleName != "required" && (target.Kind() == reflect.Ptr || target.Kind() == reflect.Interface) {
+			// nil optional value: only "required" applies
+			continue
+		}
+
+		if message := rule(target, param); message != "" {
+			if strings.HasPrefix(message, "invalid parameter") {
+				return nil, NewError(ErrorTypeInvalidArgument, fmt.Sprintf("%s for rule %q on field %s", message, ruleName, field.Name))
+			}
+			// Report only the first failing rule per field
+			return []FieldViolation{{Field: name, Rule: ruleName, Message: message}}, nil
+		}
+	}
+	return nil, nil
+}
+
+// validateFieldInfo applies MaxLength and IsNullable from the entity metadata.
+// Checks already reported by a validate tag for the same field are skipped.
+func validateFieldInfo(value reflect.Value, fields []FieldInfo, existing []FieldViolation) []FieldViolation {
+	reported := make(map[string]bool)
+	for _, v := range existing {
+		reported[v.Field+"|"+v.Rule] = true
+	}
+
+	var violations []FieldViolation
+	for _, info := range fields {
+		fieldValue, field, ok := lookupStructField(value, info.Name)
+		if !ok {
+			continue
+		}
+		name := fieldDisplayName(field)
+
+		if !info.IsNullable && !info.IsPrimaryKey && !info.IsAutoIncrement && info.DefaultValue == nil &&
+			(fieldValue.Kind() == reflect.Ptr || fieldValue.Kind() == reflect.Interface) && fieldValue.IsNil() &&
+			!reported[name+"|required"] {
+			violations = append(violations, FieldViolation{Field: name, Rule: "required", Message: "is required"})
+			continue
+		}
+
+		if info.MaxLength > 0 && !reported[name+"|max"] {
+			for fieldValue.Kind() == reflect.Ptr && !fieldValue.IsNil() {
+				fieldValue = fieldValue.Elem()
+			}
+			if fieldValue.Kind() == reflect.String && utf8.RuneCountInString(fieldValue.String()) > info.MaxLength {
+				violations = append(violations, FieldViolation{
+					Field:   name,
+					Rule:    "max",
+					Message: fmt.Sprintf("must be at most %d characters", info.MaxLength),
+				})
+			}
+		}
+	}
+	return violations
+}
+
+// lookupStructField finds a field by Go name, or by its json, db, bson or gorm column name.
+// Embedded structs are searched as well.
+func lookupStructField(value reflect.Value, name string) (reflect.Value, reflect.StructField, bool) {
+	structType := value.Type()
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if field.Anonymous {
+			embedded := value.Field(i)
+			if embedded.Kind() == reflect.Ptr {
+				if embedded.IsNil() {
+					continue
+				}
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if found, sf, ok := lookupStructField(embedded, name); ok {
+					return found, sf, true
+				}
+			}
+		}
+		if field.IsExported() && fieldMatchesName(field, name) {
+			return value.Field(i), field, true
+		}
+	}
+	return reflect.Value{}, reflect.StructField{}, false
+}
+
+// fieldMatchesName reports whether name refers to field by Go name or by storage tag
+func fieldMatchesName(field reflect.StructField, name string) bool {
+	if field.Name == name {
+		return true
+	}
+	for _, key := range []string{"json", "db", "bson"} {
+		if tagName, _, _ := strings.Cut(field.Tag.Get(key), ","); tagName != "" && tagName == name {
+			return true
+		}
+	}
+	for _, part := range strings.Split(field.Tag.Get("gorm"), ";") {
+		if column, ok := strings.CutPrefix(strings.TrimSpace(part), "column:"); ok && column == name {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldDisplayName is the name reported in violations: the json name if set, else the Go name
+func fieldDisplayName(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	return field.Name
+}
+
+// =====================================
+// Built-in Rules
+// =====================================
+
+func validateRequired(value reflect.Value, _ string) string {
+	if !value.IsValid() || value.IsZero() {
+		return "is required"
+	}
+	return ""
+}
+
+func validateEmail(value reflect.Value, _ string) string {
+	if value.Kind() != reflect.String || !emailPattern.MatchString(value.String()) {
+		return "must be a valid email address"
+	}
+	return ""
+}
+
+func validateURL(value reflect.Value, _ string) string {
+	if value.Kind() == reflect.String {
+		if parsed, err := url.ParseRequestURI(value.String()); err == nil && parsed.Scheme != "" && parsed.Host != "" {
+			return ""
+		}
+	}
+	return "must be a valid URL"
+}
+
+func validateUUID(value reflect.Value, _ string) string {
+	if value.Kind() != reflect.String || !uuidPattern.MatchString(value.String()) {
+		return "must be a valid UUID"
+	}
+	return ""
+}
+
+func validateMin(value reflect.Value, param string) string {
+	return compareSize(value, param, "at least", func(size, limit float64) bool { return size >= limit })
+}
+
+func validateMax(value reflect.Value, param string) string {
+	return compareSize(value, param, "at most", func(size, limit float64) bool { return size <= limit })
+}
+
+func validateLen(value reflect.Value, param string) string {
+	return compareSize(value, param, "exactly", func(size, limit float64) bool { return size == limit })
+}
+
+func validateOneOf(value reflect.Value, param string) string {
+	options := strings.Fields(param)
+	actual := fmt.Sprint(value)
+	for _, option := range options {
+		if actual == option {
+			return ""
+		}
+	}
+	return "must be one of: " + strings.Join(options, ", ")
+}
+
+// compareSize compares a string's length in characters, a collection's length,
+// or a number's value against the rule parameter
+func compareSize(value reflect.Value, param, qualifier string, ok func(size, limit float64) bool) string {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return fmt.Sprintf("invalid parameter %q", param)
+	}
+
+	var size float64
+	var unit string
+	switch value.Kind() {
+	case reflect.String:
+		size, unit = float64(utf8.RuneCountInString(value.String())), " characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		size, unit = float64(value.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = value.Float()
+	default:
+		return fmt.Sprintf("invalid parameter %q for %s", param, value.Kind())
+	}
+
+	if ok(size, limit) {
+		return ""
+	}
+	return fmt.Sprintf("must be %s %s%s", qualifier, param, unit)
+}
+
+// =====================================
+// Validating Repository
+// =====================================
+
+// validatingRepository validates entities before they are written
+type validatingRepository[T any] struct {
+	repo Repository[T]
+	info func() *EntityInfo
+}
+
+// NewValidatingRepository wraps repo so that Create, CreateBatch and Update run
+// ValidateEntity first, including inside transactions. Invalid entities never reach the provider.
+// Example: repo = NewValidatingRepository(repo)
+func NewValidatingRepository[T any](repo Repository[T]) Repository[T] {
+	return &validatingRepository[T]{
+		repo: repo,
+		info: sync.OnceValue(func() *EntityInfo {
+			info, err := repo.GetEntityInfo()
+			if err != nil {
+				// Tag rules and ValidationHook still apply without metadata
+				return nil
+			}
+			return info
+		}),
+	}
+}
+
+func (r *validatingRepository[T]) validate(ctx context.Context, entity *T) error {
+	if entity == nil {
+		return NewError(ErrorTypeInvalidArgument, "entity cannot be nil")
+	}
+	return ValidateEntity(ctx, entity, r.info())
+}
+
+func (r *validatingRepository[T]) Create(ctx context.Context, entity *T) error {
+	if err := r.validate(ctx, entity); err != nil {
+		return err
+	}
+	return r.repo.Create(ctx, entity)
+}
+
+// CreateBatch validates every entity and reports the violations of all of them,
+// prefixing each field with the entity's index, e.g. "[2].email".
+func (r *validatingRepository[T]) CreateBatch(ctx context.Context, entities []*T) error {
+	var violations []FieldViolation
+	for i, entity := range entities {
+		err := r.validate(ctx, entity)
+		if err == nil {
+			continue
+		}
+		gpaErr, ok := AsGPAError(err)
+		if !ok || gpaErr.Type != ErrorTypeValidation {
+			return err
+		}
+		for _, v := range gpaErr.Violations() {
+			v.Field = fmt.Sprintf("[%d].%s", i, v.Field)
+			violations = append(violations, v)
+		}
+		if len(gpaErr.Violations()) == 0 {
+			violations = append(violations, FieldViolation{Field: fmt.Sprintf("[%d]", i), Message: gpaErr.Message})
+		}
+	}
+	if len(violations) > 0 {
+		return newValidationError(entityName[T](), violations)
+	}
+	return r.repo.CreateBatch(ctx, entities)
+}
+
+func (r *validatingRepository[T]) FindByID(ctx context.Context, id interface{}) (*T, error) {
+	return r.repo.FindByID(ctx, id)
+}
+
+func (r *validatingRepository[T]) FindAll(ctx context.Context, opts ...QueryOption) ([]*T, error) {
+	return r.repo.FindAll(ctx, opts...)
+}
+
+func (r *validatingRepository[T]) Update(ctx context.Context, entity *T) error {
+	if err := r.validate(ctx, entity); err != nil {
+		return err
+	}
+	return r.repo.Update(ctx, entity)
+}
+
+func (r *validatingRepository[T]) UpdatePartial(ctx context.Context, id interface{}, updates map[string]interface{}) error {
+	return r.repo.UpdatePartial(ctx, id, updates)
+}
+
+func (r *validatingRepository[T]) Delete(ctx context.Context, id interface{}) error {
+	return r.repo.Delete(ctx, id)
+}
+
+func (r *validatingRepository[T]) DeleteByCondition(ctx context.Context, condition Condition) error {
+	return r.repo.DeleteByCondition(ctx, condition)
+}
+
+func (r *validatingRepository[T]) Query(ctx context.Context, opts ...QueryOption) ([]*T, error) {
+	return r.repo.Query(ctx, opts...)
+}
+
+func (r *validatingRepository[T]) QueryScored(ctx context.Context, opts ...QueryOption) ([]Scored[T], error) {
+	return QueryScored(ctx, r.repo, opts...)
+}
+
+func (r *validatingRepository[T]) QueryOne(ctx context.Context, opts ...QueryOption) (*T, error) {
+	return r.repo.QueryOne(ctx, opts...)
+}
+
+func (r *validatingRepository[T]) Count(ctx context.Context, opts ...QueryOption) (int64, error) {
+	return r.repo.Count(ctx, opts...)
+}
+
+func (r *validatingRepository[T]) Exists(ctx context.Context, opts ...QueryOption) (bool, error) {
+	return r.repo.Exists(ctx, opts...)
+}
+
+func (r *validatingRepository[T]) Transaction(ctx context.Context, fn TransactionFunc[T]) error {
+	return r.repo.Transaction(ctx, func(tx Transaction[T]) error {
+		return fn(&validatingTransaction[T]{
+			validatingRepository: validatingRepository[T]{repo: tx, info: r.info},
+			tx:                   tx,
+		})
+	})
+}
+
+func (r *validatingRepository[T]) RawQuery(ctx context.Context, query string, args []interface{}) ([]*T, error) {
+	return r.repo.RawQuery(ctx, query, args)
+}
+
+func (r *validatingRepository[T]) RawExec(ctx context.Context, query string, args []interface{}) (Result, error) {
+	return r.repo.RawExec(ctx, query, args)
+}
+
+func (r *validatingRepository[T]) GetEntityInfo() (*EntityInfo, error) {
+	return r.repo.GetEntityInfo()
+}
+
+func (r *validatingRepository[T]) Close() error {
+	return r.repo.Close()
+}
+
+// validatingTransaction validates entities written inside a transaction
+type validatingTransaction[T any] struct {
+	validatingRepository[T]
+	tx Transaction[T]
+}
+
+func (t *validatingTransaction[T]) Commit() error                  { return t.tx.Commit() }
+func (t *validatingTransaction[T]) Rollback() error                { return t.tx.Rollback() }
+func (t *validatingTransaction[T]) SetSavepoint(name string) error { return t.tx.SetSavepoint(name) }
+func (t *validatingTransaction[T]) RollbackToSavepoint(name string) error {
+	return t.tx.RollbackToSavepoint(name)
+}
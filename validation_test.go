@@ -0,0 +1,228 @@
+package gpa
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type validatedAudit struct {
+	CreatedBy string `json:"created_by" validate:"required,oneof=system admin"`
+}
+
+type validatedUser struct {
+	validatedAudit
+	ID       int      `json:"id"`
+	Email    string   `json:"email" validate:"required,email"`
+	Name     string   `json:"name" validate:"min=3,max=10"`
+	Role     string   `json:"role" validate:"oneof=admin member"`
+	Website  string   `json:"website" validate:"omitempty,url"`
+	TenantID string   `json:"tenant_id" validate:"uuid"`
+	Age      int      `json:"age" validate:"min=18"`
+	Tags     []string `json:"tags" validate:"max=2"`
+	Nickname *string  `json:"nickname" validate:"min=2"`
+	Bio      string   `db:"biography"`
+	Manager  *string  `json:"manager"`
+}
+
+func validUser() *validatedUser {
+	return &validatedUser{
+		validatedAudit: validatedAudit{CreatedBy: "system"},
+		Email:          "ada@example.com",
+		Name:           "Ada",
+		Role:           "admin",
+		TenantID:       "1b4e28ba-2fa1-11d2-883f-0016d3cca427",
+		Age:            36,
+	}
+}
+
+func TestValidateEntity_Valid(t *testing.T) {
+	if err := ValidateEntity(context.Background(), validUser(), nil); err != nil {
+		t.Errorf("Expected valid entity, got %v", err)
+	}
+}
+
+func TestValidateEntity_ReportsAllViolations(t *testing.T) {
+	short := "x"
+	user := &validatedUser{
+		Email:    "not-an-email",
+		Name:     "Al",
+		Role:     "owner",
+		Website:  "not a url",
+		TenantID: "123",
+		Age:      12,
+		Tags:     []string{"a", "b", "c"},
+		Nickname: &short,
+	}
+
+	err := ValidateEntity(context.Background(), user, nil)
+	gpaErr, ok := AsGPAError(err)
+	if !ok || gpaErr.Type != ErrorTypeValidation {
+		t.Fatalf("Expected validation error, got %v", err)
+	}
+
+	got := make(map[string]string)
+	for _, v := range gpaErr.Violations() {
+		got[v.Field] = v.Rule
+	}
+	expected := map[string]string{
+		"created_by": "required",
+		"email":      "email",
+		"name":       "min",
+		"role":       "oneof",
+		"website":    "url",
+		"tenant_id":  "uuid",
+		"age":        "min",
+		"tags":       "max",
+		"nickname":   "min",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected violations %v, got %v", expected, got)
+	}
+	if gpaErr.Entity != "validatedUser" || len(gpaErr.Fields()) != len(expected) {
+		t.Errorf("Unexpected error context: entity=%s fields=%v", gpaErr.Entity, gpaErr.Fields())
+	}
+	if HTTPStatus(err) != 422 {
+		t.Errorf("Expected 422, got %d", HTTPStatus(err))
+	}
+}
+
+func TestValidateEntity_FieldInfo(t *testing.T) {
+	user := validUser()
+	user.Bio = strings.Repeat("x", 21)
+
+	info := &EntityInfo{Fields: []FieldInfo{
+		{Name: "biography", MaxLength: 20, IsNullable: true},
+		{Name: "manager", IsNullable: false},
+		{Name: "email", MaxLength: 255},
+		{Name: "missing", MaxLength: 1},
+	}}
+
+	gpaErr, ok := AsGPAError(ValidateEntity(context.Background(), user, info))
+	if !ok {
+		t.Fatal("Expected validation error")
+	}
+	if len(gpaErr.Violations()) != 2 {
+		t.Fatalf("Expected 2 violations, got %+v", gpaErr.Violations())
+	}
+	if gpaErr.Violations()[0].Field != "Bio" || gpaErr.Violations()[0].Rule != "max" {
+		t.Errorf("Expected MaxLength violation on Bio, got %+v", gpaErr.Violations()[0])
+	}
+	if gpaErr.Violations()[1].Field != "manager" || gpaErr.Violations()[1].Rule != "required" {
+		t.Errorf("Expected non-nullable violation on manager, got %+v", gpaErr.Violations()[1])
+	}
+}
+
+type hookedUser struct {
+	Email string `validate:"required"`
+	Name  string
+	fail  error
+}
+
+func (u *hookedUser) Validate(ctx context.Context) error {
+	return u.fail
+}
+
+func TestValidateEntity_RunsValidationHook(t *testing.T) {
+	ctx := context.Background()
+
+	hookErr := NewError(ErrorTypeValidation, "name is reserved").
+		WithViolations(FieldViolation{Field: "Name", Rule: "reserved", Message: "is reserved"})
+	gpaErr, _ := AsGPAError(ValidateEntity(ctx, &hookedUser{fail: hookErr}, nil))
+	if len(gpaErr.Violations()) != 2 {
+		t.Errorf("Expected tag and hook violations to be merged, got %+v", gpaErr.Violations())
+	}
+
+	plain := NewError(ErrorTypeValidation, "name is required")
+	if err := ValidateEntity(ctx, &hookedUser{Email: "a", fail: plain}, nil); !errors.Is(err, ErrValidation) || err.Error() != plain.Error() {
+		t.Errorf("Expected hook error to be returned as-is, got %v", err)
+	}
+
+	lookup := NewError(ErrorTypeConnection, "lookup failed")
+	if err := ValidateEntity(ctx, &hookedUser{fail: lookup}, nil); !IsConnection(err) {
+		t.Errorf("Expected non-validation hook error to be returned, got %v", err)
+	}
+}
+
+func TestValidateEntity_Misconfiguration(t *testing.T) {
+	type badTag struct {
+		Name string `validate:"shout"`
+	}
+	if err := ValidateEntity(context.Background(), &badTag{}, nil); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected invalid argument for unknown rule, got %v", err)
+	}
+
+	type badParam struct {
+		Name string `validate:"min=abc"`
+	}
+	if err := ValidateEntity(context.Background(), &badParam{}, nil); !IsErrorType(err, ErrorTypeInvalidArgument) {
+		t.Errorf("Expected invalid argument for bad parameter, got %v", err)
+	}
+}
+
+func TestRegisterValidationRule(t *testing.T) {
+	RegisterValidationRule("lowercase", func(value reflect.Value, _ string) string {
+		if value.String() != strings.ToLower(value.String()) {
+			return "must be lowercase"
+		}
+		return ""
+	})
+	defer func() {
+		validationMutex.Lock()
+		delete(validationRules, "lowercase")
+		validationMutex.Unlock()
+	}()
+
+	type slugged struct {
+		Slug string `validate:"lowercase"`
+	}
+	gpaErr, ok := AsGPAError(ValidateEntity(context.Background(), &slugged{Slug: "Hello"}, nil))
+	if !ok || gpaErr.Violations()[0].Message != "must be lowercase" {
+		t.Errorf("Expected custom rule violation, got %+v", gpaErr)
+	}
+}
+
+func TestValidatingRepository(t *testing.T) {
+	mock := &mockRepository[validatedUser]{}
+	repo := NewValidatingRepository[validatedUser](mock)
+	ctx := context.Background()
+
+	if err := repo.Create(ctx, &validatedUser{}); !IsValidation(err) {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+	if mock.callCount("Create") != 0 {
+		t.Error("Expected invalid entity not to reach the provider")
+	}
+
+	if err := repo.Create(ctx, validUser()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := repo.Update(ctx, &validatedUser{}); !IsValidation(err) {
+		t.Errorf("Expected validation error on update, got %v", err)
+	}
+
+	invalid := validUser()
+	invalid.Email = "bad"
+	err := repo.CreateBatch(ctx, []*validatedUser{validUser(), invalid})
+	gpaErr, ok := AsGPAError(err)
+	if !ok || len(gpaErr.Violations()) != 1 || gpaErr.Violations()[0].Field != "[1].email" {
+		t.Errorf("Expected indexed batch violation, got %v", err)
+	}
+	if mock.callCount("CreateBatch") != 0 {
+		t.Error("Expected invalid batch not to reach the provider")
+	}
+}
+
+func TestValidatingRepository_Transaction(t *testing.T) {
+	mock := &mockRepository[validatedUser]{}
+	repo := NewValidatingRepository[validatedUser](mock)
+
+	err := repo.Transaction(context.Background(), func(tx Transaction[validatedUser]) error {
+		return tx.Create(context.Background(), &validatedUser{})
+	})
+	if !IsValidation(err) {
+		t.Errorf("Expected validation inside transaction, got %v", err)
+	}
+}